@@ -0,0 +1,512 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"context"
+	"github.com/hashicorp/raft"
+	"io"
+	"net"
+	"reflect"
+	"time"
+)
+
+var RaftSnapshotterClass = reflect.TypeOf((*RaftSnapshotter)(nil)).Elem()
+
+/**
+Manual snapshot trigger implemented by the raft server
+ */
+type RaftSnapshotter interface {
+
+	/**
+	Triggers user snapshot and returns metadata of the persisted snapshot
+	 */
+	Snapshot() (*raft.SnapshotMeta, error)
+
+}
+
+var SnapshotArchiverClass = reflect.TypeOf((*SnapshotArchiver)(nil)).Elem()
+
+/**
+Export and import of snapshot archives implemented by the raft server, like 'consul snapshot save/restore'
+ */
+type SnapshotArchiver interface {
+
+	/**
+	Writes the archive of the latest snapshot
+	 */
+	ExportSnapshot(w io.Writer) (*raft.SnapshotMeta, error)
+
+	/**
+	Writes the archive of the snapshot, empty id is the latest one
+	 */
+	ExportSnapshotID(id string, w io.Writer) (*raft.SnapshotMeta, error)
+
+	/**
+	Verifies the archive and restores the cluster from it, runs only on the leader.
+	The leader takes the state and installs it to followers, it is intended for the disaster recovery.
+	 */
+	ImportSnapshot(r io.Reader) (*raft.SnapshotMeta, error)
+
+}
+
+var LogScrubberClass = reflect.TypeOf((*LogScrubber)(nil)).Elem()
+
+/**
+Log store able to verify checksums of all stored entries
+ */
+type LogScrubber interface {
+
+	/**
+	Reads all entries and passes them to callback with the verification error if any.
+	Callback returns false to stop the scrub.
+	 */
+	ScrubLog(cb func(log *raft.Log, err error) bool) error
+
+}
+
+var SnapshotStoreDecoratorClass = reflect.TypeOf((*SnapshotStoreDecorator)(nil)).Elem()
+
+/**
+Named snapshot store decorator used in 'raft-snapshot.pipeline' property
+ */
+type SnapshotStoreDecorator interface {
+
+	/**
+	Name of the decorator in the pipeline
+	 */
+	DecoratorName() string
+
+	/**
+	Wraps the store, sinks and sources of the result store transform the snapshot stream
+	 */
+	Decorate(store raft.SnapshotStore) (raft.SnapshotStore, error)
+
+}
+
+var KeyProviderClass = reflect.TypeOf((*KeyProvider)(nil)).Elem()
+
+/**
+Provider of the snapshot master key selected by 'raft.snapshot-key-provider', wraps random data keys of snapshots,
+so the master key could stay in the external key management service
+ */
+type KeyProvider interface {
+
+	/**
+	Name of the provider, stored in the snapshot header
+	 */
+	KeyProviderName() string
+
+	/**
+	Encrypts the data key of the snapshot, aad identifies the snapshot
+	 */
+	WrapKey(dataKey, aad []byte) ([]byte, error)
+
+	/**
+	Decrypts the data key wrapped by WrapKey
+	 */
+	UnwrapKey(wrapped, aad []byte) ([]byte, error)
+
+}
+
+var KeyResolverClass = reflect.TypeOf((*KeyResolver)(nil)).Elem()
+
+/**
+Master key provider of 'raft.snapshot-key-provider' shared by snapshots and the raft log and stable stores
+ */
+type KeyResolver interface {
+
+	/**
+	Returns true if the key bean or the provider other than 'token' is configured
+	 */
+	KeysConfigured() bool
+
+	/**
+	Resolves the provider once, the token is prompted at most one time
+	 */
+	ResolveKeyProvider() (KeyProvider, error)
+
+}
+
+var ScheduledSnapshotterClass = reflect.TypeOf((*ScheduledSnapshotter)(nil)).Elem()
+
+/**
+Snapshot trigger on the 'raft-snapshot.schedule'
+ */
+type ScheduledSnapshotter interface {
+
+	/**
+	Returns the time of the next scheduled snapshot, false if the schedule is disabled
+	 */
+	NextSnapshot() (time.Time, bool)
+
+}
+
+var SnapshotVerifierClass = reflect.TypeOf((*SnapshotVerifier)(nil)).Elem()
+
+/**
+Implemented by the 'raft-snapshot' store if 'raft-snapshot.checksum' is enabled
+ */
+type SnapshotVerifier interface {
+
+	/**
+	Reads the stored snapshot and compares it with the checksums recorded when it was written without restoring it,
+	the error wraps ErrSnapshotIntegrity on mismatch
+	 */
+	Verify(id string) (*SnapshotChecksum, error)
+
+}
+
+var SnapshotCompletedHandlerClass = reflect.TypeOf((*SnapshotCompletedHandler)(nil)).Elem()
+
+/**
+Application beans notified after each snapshot is persisted, for example to ship it to the backup storage.
+Handlers are invoked in the background one snapshot at a time, so slow uploads do not delay raft.
+ */
+type SnapshotCompletedHandler interface {
+
+	/**
+	Reader has the snapshot as restored by FSM and is closed after the return
+	 */
+	SnapshotCompleted(meta *raft.SnapshotMeta, reader io.Reader) error
+
+}
+
+var LogArchiverClass = reflect.TypeOf((*LogArchiver)(nil)).Elem()
+
+/**
+Application beans receiving the log entries before the truncation deletes them, for example to ship them to the object storage.
+Every server archives only entries of its own log up to its applied index, the conflicting tail removed by followers is not.
+The archive of a single server is not the full history: entries the server skipped by installing the snapshot of the leader
+are in that snapshot only, so the history is the union of archives of all servers together with the installed snapshots.
+Entries are delivered at least once, the failed archive keeps them in the log until the next compaction.
+ */
+type LogArchiver interface {
+
+	/**
+	Entries are ordered by index, the same slice is passed to every archiver and must not be modified
+	 */
+	ArchiveLogs(logs []*raft.Log) error
+
+}
+
+var EventEmitterClass = reflect.TypeOf((*EventEmitter)(nil)).Elem()
+
+/**
+Serf user event emitter implemented by the serf server
+ */
+type EventEmitter interface {
+
+	/**
+	Emits user event, returns *EventSizeError if the event exceeds serf limit
+	 */
+	EmitEvent(name string, payload []byte, coalesce bool) error
+
+	/**
+	Emits payload exceeding serf limit as the sequence of chunk events
+	 */
+	EmitChunkedEvent(name string, payload []byte) error
+
+}
+
+var NodeHealthCheckerClass = reflect.TypeOf((*NodeHealthChecker)(nil)).Elem()
+
+/**
+Composite node health combining serf status and raft replication state
+ */
+type NodeHealthChecker interface {
+
+	/**
+	Returns health of the node by id from the point of view of the local raft server
+	 */
+	NodeHealth(id string) (*NodeHealth, error)
+
+}
+
+var LeaderChangePublisherClass = reflect.TypeOf((*LeaderChangePublisher)(nil)).Elem()
+
+/**
+Publisher of the leadership changes to external systems, invoked by the raft server
+ */
+type LeaderChangePublisher interface {
+
+	PublishLeaderChange(change *LeaderChange) error
+
+}
+
+var DNSProviderClass = reflect.TypeOf((*DNSProvider)(nil)).Elem()
+
+/**
+DNS provider updating the record pointing to the current leader
+ */
+type DNSProvider interface {
+
+	UpdateRecord(name string, address string) error
+
+}
+
+var ReadinessCheckerClass = reflect.TypeOf((*ReadinessChecker)(nil)).Elem()
+
+/**
+Readiness of the node to receive the traffic
+ */
+type ReadinessChecker interface {
+
+	/**
+	Returns false with the reason if the node is not running or saturated
+	 */
+	Ready() (bool, string)
+
+}
+
+var LeaderTrackerClass = reflect.TypeOf((*LeaderTracker)(nil)).Elem()
+
+/**
+Access to the current leader and local leadership transitions
+ */
+type LeaderTracker interface {
+
+	/**
+	Address of the current leader, empty if unknown
+	 */
+	LeaderAddress() raft.ServerAddress
+
+	/**
+	ID of the current leader, empty if unknown
+	 */
+	LeaderID() raft.ServerID
+
+	/**
+	New subscription on local leadership transitions, closed on shutdown
+	 */
+	LeaderCh() <-chan bool
+
+}
+
+var ClusterEventPublisherClass = reflect.TypeOf((*ClusterEventPublisher)(nil)).Elem()
+
+/**
+Internal event bus of raft and serf lifecycle events
+ */
+type ClusterEventPublisher interface {
+
+	Publish(event *ClusterEvent)
+
+	/**
+	Subscribes on events with the buffered channel, returns function to unsubscribe
+	 */
+	Subscribe(buffer int) (<-chan *ClusterEvent, func())
+
+	/**
+	Returns retained events published after the sequence number, false if some of them were already evicted
+	 */
+	Since(seq uint64) ([]*ClusterEvent, bool)
+
+}
+
+var ServiceRegistrarClass = reflect.TypeOf((*ServiceRegistrar)(nil)).Elem()
+
+/**
+Registers the raft node in the external service registry like Consul or etcd
+ */
+type ServiceRegistrar interface {
+
+	/**
+	Registers or updates the node, invoked on serve and on leadership changes
+	 */
+	Register(reg *ServiceRegistration) error
+
+	/**
+	Removes the node from the registry, invoked on shutdown
+	 */
+	Deregister(id string) error
+
+}
+
+var PeerDiscoveryClass = reflect.TypeOf((*PeerDiscovery)(nil)).Elem()
+
+/**
+Discovery of the peers outside of gossip
+ */
+type PeerDiscovery interface {
+
+	/**
+	Resolves peers, updates ServerLookup and joins them by serf
+	 */
+	Discover() error
+
+}
+
+var LeadershipHookClass = reflect.TypeOf((*LeadershipHook)(nil)).Elem()
+
+/**
+Application beans notified on local leadership transitions, invoked exactly once per transition
+in the order of the transitions, so the hooks should not block.
+ */
+type LeadershipHook interface {
+
+	/**
+	Local node became leader, context is cancelled on loss of leadership or shutdown
+	 */
+	OnBecomeLeader(ctx context.Context)
+
+	/**
+	Local node lost leadership or the server is shutting down while leader
+	 */
+	OnLoseLeadership()
+
+}
+
+var MetadataStoreClass = reflect.TypeOf((*MetadataStore)(nil)).Elem()
+
+/**
+Namespaced persistent metadata of the local node kept in the raft stable store,
+used by the module subsystems and applications instead of side files in the data dir.
+ */
+type MetadataStore interface {
+
+	/**
+	Returns value of the key in namespace, false if not found
+	 */
+	Get(namespace, key string) ([]byte, bool, error)
+
+	Set(namespace, key string, value []byte) error
+
+	Delete(namespace, key string) error
+
+	/**
+	Returns sorted keys of the namespace
+	 */
+	List(namespace string) ([]string, error)
+
+}
+
+var IndexTimeLookupClass = reflect.TypeOf((*IndexTimeLookup)(nil)).Elem()
+
+/**
+Translation of the raft log index to the wall-clock time
+ */
+type IndexTimeLookup interface {
+
+	LookupTime(index uint64) (*IndexTime, error)
+
+}
+
+var HedgedReaderClass = reflect.TypeOf((*HedgedReader)(nil)).Elem()
+
+/**
+Tail latency reduction of the stale reads implemented by the raft client pool
+ */
+type HedgedReader interface {
+
+	/**
+	Reads from the nearest replica and hedges to the second one after delay, returns the first successful response
+	 */
+	HedgedRead(ctx context.Context, replicas []raft.ServerAddress, read HedgedReadFunc) (interface{}, error)
+
+}
+
+var ConfigReloaderClass = reflect.TypeOf((*ConfigReloader)(nil)).Elem()
+
+/**
+Runtime reload of the raft config without restart
+ */
+type ConfigReloader interface {
+
+	/**
+	Applies current values of the reloadable 'raft-server.*' properties to the running raft
+	 */
+	ReloadConfig() error
+
+	ReloadableConfig() (raft.ReloadableConfig, bool)
+
+}
+
+var StateHasherClass = reflect.TypeOf((*StateHasher)(nil)).Elem()
+
+/**
+Optional interface of the application FSM used by 'raft.state-hash' to detect divergence of the replicas
+ */
+type StateHasher interface {
+
+	/**
+	Returns deterministic hash of the FSM state and the applied index it corresponds to
+	 */
+	StateHash() (index uint64, hash []byte, err error)
+
+}
+
+var LogEntryDecoderClass = reflect.TypeOf((*LogEntryDecoder)(nil)).Elem()
+
+/**
+Optional interface of the application FSM used by the log dump to show the commands instead of raw bytes
+ */
+type LogEntryDecoder interface {
+
+	/**
+	Decodes the data of the command entry to the value marshaled to JSON or msgpack
+	 */
+	DecodeLogEntry(data []byte) (interface{}, error)
+
+}
+
+var LeaderLeaserClass = reflect.TypeOf((*LeaderLeaser)(nil)).Elem()
+
+/**
+Leader lease with fencing token implemented by the raft server
+ */
+type LeaderLeaser interface {
+
+	/**
+	Returns raft.ErrNotLeader on followers, the lease is invalidated on step-down
+	 */
+	LeaderLease() (*LeaderLease, error)
+
+}
+
+var ServerReplacerClass = reflect.TypeOf((*ServerReplacer)(nil)).Elem()
+
+/**
+Resumable replacement of the raft server implemented by the raft server
+ */
+type ServerReplacer interface {
+
+	/**
+	Starts or resumes the replacement on the leader, returns raft.ErrNotLeader on followers
+	 */
+	ReplaceServer(oldID, newID string) (*ReplaceOperation, error)
+
+	ReplaceStatus() (*ReplaceOperation, error)
+
+}
+
+var SharedListenerClass = reflect.TypeOf((*SharedListener)(nil)).Elem()
+
+/**
+gRPC API listener sharing the raft port implemented by the raft server
+ */
+type SharedListener interface {
+
+	/**
+	Returns false unless 'raft.shared-port' is enabled, the API server serves the listener
+	 */
+	APIListener() (net.Listener, bool)
+
+}
+
+var ValueLogCollectorClass = reflect.TypeOf((*ValueLogCollector)(nil)).Elem()
+
+/**
+Periodic value log GC of the badger instance of the raft stores
+ */
+type ValueLogCollector interface {
+
+	/**
+	Rewrites value log files while badger finds them worth it, returns the number of rewritten files
+	 */
+	CollectValueLog() (int, error)
+
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+)
+
+/**
+Log store decorator passing entries to the archivers before DeleteRange. Entries above the applied index are
+the conflicting tail truncated by the follower, they are deleted without the archive. Entries the follower never had,
+because it installed the snapshot of the leader, are not archived by it. When an archiver fails
+nothing is deleted, raft logs the failed compaction and retries it after the next snapshot.
+ */
+type archivingLogStore struct {
+	raft.LogStore
+	archivers  []LogArchiver
+	batchSize  int
+	applied    func() uint64
+}
+
+func newArchivingLogStore(delegate raft.LogStore, archivers []LogArchiver, batchSize int, applied func() uint64) *archivingLogStore {
+	return &archivingLogStore{
+		LogStore:  delegate,
+		archivers: archivers,
+		batchSize: batchSize,
+		applied:   applied,
+	}
+}
+
+func (t *archivingLogStore) DeleteRange(min, max uint64) error {
+	last := max
+	if applied := t.applied(); last > applied {
+		last = applied
+	}
+	if min <= last {
+		if err := t.archive(min, last); err != nil {
+			return err
+		}
+	}
+	return t.LogStore.DeleteRange(min, max)
+}
+
+func (t *archivingLogStore) archive(min, max uint64) error {
+	batch := make([]*raft.Log, 0, t.batchSize)
+	for index := min; index <= max; index++ {
+		log := new(raft.Log)
+		if err := t.LogStore.GetLog(index, log); err != nil {
+			if err == raft.ErrLogNotFound {
+				// deleted by the previous compaction that failed after the archive
+				continue
+			}
+			return errors.Errorf("get log %d to archive, %v", index, err)
+		}
+		batch = append(batch, log)
+		if len(batch) == t.batchSize || index == max {
+			if err := t.archiveBatch(batch); err != nil {
+				return err
+			}
+			batch = make([]*raft.Log, 0, t.batchSize)
+		}
+	}
+	if len(batch) > 0 {
+		return t.archiveBatch(batch)
+	}
+	return nil
+}
+
+func (t *archivingLogStore) archiveBatch(batch []*raft.Log) error {
+	for _, archiver := range t.archivers {
+		if err := archiver.ArchiveLogs(batch); err != nil {
+			metrics.IncrCounter([]string{"raft", "logstore", "archive_errors"}, 1)
+			return errors.Errorf("archive logs %d-%d, %v", batch[0].Index, batch[len(batch)-1].Index, err)
+		}
+	}
+	metrics.IncrCounter([]string{"raft", "logstore", "archived_entries"}, float32(len(batch)))
+	return nil
+}
+
+func (t *archivingLogStore) IsMonotonic() bool {
+	if m, ok := t.LogStore.(raft.MonotonicLogStore); ok {
+		return m.IsMonotonic()
+	}
+	return false
+}
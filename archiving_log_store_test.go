@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type recordingArchiver struct {
+	indexes  []uint64
+	batches  int
+	fail     bool
+}
+
+func (t *recordingArchiver) ArchiveLogs(logs []*raft.Log) error {
+	if t.fail {
+		return errors.New("storage is down")
+	}
+	t.batches++
+	for _, log := range logs {
+		t.indexes = append(t.indexes, log.Index)
+	}
+	return nil
+}
+
+func TestArchivingLogStore(t *testing.T) {
+
+	raw := raft.NewInmemStore()
+	for i := uint64(1); i <= 10; i++ {
+		require.NoError(t, raw.StoreLog(&raft.Log{Index: i, Term: 1, Type: raft.LogCommand}))
+	}
+
+	archiver := new(recordingArchiver)
+	applied := uint64(8)
+	store := newArchivingLogStore(raw, []LogArchiver{archiver}, 3, func() uint64 { return applied })
+
+	// compaction after the snapshot
+	require.NoError(t, store.DeleteRange(1, 4))
+	require.Equal(t, []uint64{1, 2, 3, 4}, archiver.indexes)
+	require.Equal(t, 2, archiver.batches)
+
+	// conflicting tail is not archived
+	require.NoError(t, store.DeleteRange(9, 10))
+	require.Equal(t, 4, len(archiver.indexes))
+
+	// failed archive keeps the entries
+	archiver.fail = true
+	require.Error(t, store.DeleteRange(5, 8))
+	first, err := raw.FirstIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), first)
+
+	archiver.fail = false
+	require.NoError(t, store.DeleteRange(5, 8))
+	require.Equal(t, []uint64{1, 2, 3, 4, 5, 6, 7, 8}, archiver.indexes)
+}
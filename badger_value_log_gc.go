@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/dgraph-io/badger/v3"
+	"github.com/keyvalstore/store"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// upper bound of rewritten files per run, so the run does not hold the disk for long
+const maxValueLogRewrites = 16
+
+/**
+Runs the value log GC of the badger instance of the raft stores on the interval. Entries deleted by the log
+compaction stay in the value log files until they are rewritten, so the disk grows without it.
+Enabled for the 'badger' backend unless 'raft-storage.badger.gc-interval' is zero.
+ */
+type implValueLogCollector struct {
+
+	Log           *zap.Logger               `inject`
+	DataStores    []store.ManagedDataStore  `inject:"optional"`
+	BadgerStore   RaftBadgerStore           `inject`
+
+	Backend       string  `value:"raft-storage.backend,default=badger"`
+	RaftStoreBean string  `value:"raft-storage.bean,default=raft-store"`
+
+	Interval      time.Duration  `value:"raft-storage.badger.gc-interval,default=10m"`
+	// rewrite the file if at least this percent of it is discarded
+	DiscardPercent  int          `value:"raft-storage.badger.gc-discard-percent,default=50"`
+
+	mutex         sync.Mutex
+	shutdownOnce  sync.Once
+	shutdownCh    chan struct{}
+	doneCh        chan struct{}
+}
+
+func BadgerValueLogGC() ValueLogCollector {
+	return &implValueLogCollector{
+		shutdownCh: make(chan struct{}),
+	}
+}
+
+func (t *implValueLogCollector) PostConstruct() (err error) {
+	if t.Backend, err = storageBackend(t.Backend); err != nil || t.Backend != RaftStoreBadger {
+		return err
+	}
+	if t.Interval < 0 {
+		return errors.Errorf("invalid property 'raft-storage.badger.gc-interval' value '%v'", t.Interval)
+	}
+	if t.DiscardPercent < 1 || t.DiscardPercent > 99 {
+		return errors.Errorf("issue in property 'raft-storage.badger.gc-discard-percent', expected value from 1 to 99 instead of %d", t.DiscardPercent)
+	}
+	if t.Interval == 0 {
+		return nil
+	}
+	t.doneCh = make(chan struct{})
+	go t.gcLoop()
+	return nil
+}
+
+func (t *implValueLogCollector) Destroy() error {
+	t.shutdownOnce.Do(func() {
+		close(t.shutdownCh)
+	})
+	// the holder closes the instance after this bean, the running GC must finish before
+	if t.doneCh != nil {
+		<-t.doneCh
+	}
+	return nil
+}
+
+func (t *implValueLogCollector) gcLoop() {
+	defer close(t.doneCh)
+
+	t.Log.Info("BadgerValueLogGCScheduled", zap.Duration("interval", t.Interval), zap.Int("discardPercent", t.DiscardPercent))
+
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			start := time.Now()
+			rewrites, err := t.CollectValueLog()
+			if err != nil {
+				t.Log.Error("BadgerValueLogGC", zap.Error(err))
+			} else if rewrites > 0 {
+				t.Log.Info("BadgerValueLogGC", zap.Int("rewrites", rewrites), zap.Duration("elapsed", time.Since(start)))
+			}
+		case <-t.shutdownCh:
+			return
+		}
+	}
+}
+
+func (t *implValueLogCollector) CollectValueLog() (int, error) {
+	if t.Backend != "" && t.Backend != RaftStoreBadger {
+		return 0, errors.Errorf("value log GC requires 'badger' in property 'raft-storage.backend' instead of '%s'", t.Backend)
+	}
+	db, err := badgerDataStore(t.DataStores, t.RaftStoreBean, t.BadgerStore)
+	if err != nil {
+		return 0, err
+	}
+	return t.collect(db)
+}
+
+func (t *implValueLogCollector) collect(db *badger.DB) (int, error) {
+	// badger allows one GC at a time, the manual run waits for the scheduled one
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	rewrites := 0
+	for rewrites < maxValueLogRewrites {
+		select {
+		case <-t.shutdownCh:
+			return rewrites, nil
+		default:
+		}
+		err := db.RunValueLogGC(float64(t.DiscardPercent) / 100)
+		if err == badger.ErrNoRewrite || err == badger.ErrRejected || err == badger.ErrGCInMemoryMode {
+			// nothing to rewrite, the instance is closing or has no value log
+			return rewrites, nil
+		}
+		if err != nil {
+			return rewrites, err
+		}
+		rewrites++
+	}
+	return rewrites, nil
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/dgraph-io/badger/v3"
+	"github.com/hashicorp/raft"
+	"github.com/sprintframework/raft-badger"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBadgerValueLogGC(t *testing.T) {
+
+	db, err := badger.Open(badger.DefaultOptions(t.TempDir()).WithValueLogFileSize(1 << 20).WithValueThreshold(64).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	logStore := raftbadger.NewLogStore(db, []byte("log"))
+	data := make([]byte, 4096)
+	for i := uint64(1); i <= 1000; i++ {
+		require.NoError(t, logStore.StoreLog(&raft.Log{Index: i, Term: 1, Type: raft.LogCommand, Data: data}))
+	}
+	// the log compaction after the snapshot
+	require.NoError(t, logStore.DeleteRange(1, 990))
+
+	gc := BadgerValueLogGC().(*implValueLogCollector)
+	gc.DiscardPercent = 50
+	_, err = gc.collect(db)
+	require.NoError(t, err)
+
+	var log raft.Log
+	require.NoError(t, logStore.GetLog(1000, &log))
+	require.Len(t, log.Data, 4096)
+
+	// no value log in memory
+	mem, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer mem.Close()
+	rewrites, err := gc.collect(mem)
+	require.NoError(t, err)
+	require.Equal(t, 0, rewrites)
+}
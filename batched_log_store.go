@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"encoding/binary"
+	"github.com/armon/go-metrics"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/hashicorp/raft"
+	"github.com/sprintframework/raft-badger"
+	"google.golang.org/protobuf/proto"
+	"time"
+)
+
+/**
+Badger log store writing the whole batch of StoreLogs in one transaction. Followers append up to
+'raft-server.max-append-entries' entries per call, the batch is split only when it exceeds the transaction
+limits of badger. Entries are encoded the same way as in the raft-badger log store, reads and deletes go to it.
+ */
+type batchedLogStore struct {
+	raft.LogStore
+	db         *badger.DB
+	prefix     []byte
+	prefixLen  int
+}
+
+/**
+Log store writing the side keys of entries in the same badger transaction as the entries
+ */
+type sideLogStore interface {
+	storeLogsWith(logs []*raft.Log, side func(txn *badger.Txn, i int) error) error
+}
+
+func newBatchedLogStore(delegate raft.LogStore, db *badger.DB, prefix []byte) raft.LogStore {
+	return &batchedLogStore{
+		LogStore:  delegate,
+		db:        db,
+		prefix:    prefix,
+		prefixLen: len(prefix),
+	}
+}
+
+func (t *batchedLogStore) getRawKey(index uint64) []byte {
+	key := make([]byte, t.prefixLen + 8)
+	copy(key, t.prefix)
+	binary.BigEndian.PutUint64(key[t.prefixLen:], index)
+	return key
+}
+
+func (t *batchedLogStore) StoreLog(log *raft.Log) error {
+	return t.StoreLogs([]*raft.Log{log})
+}
+
+func (t *batchedLogStore) StoreLogs(logs []*raft.Log) error {
+	return t.storeLogsWith(logs, nil)
+}
+
+/**
+Stores the entries together with the side keys written by the callback for the entry at the position,
+the side keys of the entry are set before it in the same transaction, so the split of the batch leaves
+at most orphan side keys of the missing entry
+ */
+func (t *batchedLogStore) storeLogsWith(logs []*raft.Log, side func(txn *badger.Txn, i int) error) error {
+	start := time.Now()
+
+	txn := t.db.NewTransaction(true)
+	// no-op after the commit
+	defer func() {
+		txn.Discard()
+	}()
+
+	txns := 1
+	for i, log := range logs {
+		data, err := proto.Marshal(&raftbadger.RaftLog{
+			Index:      log.Index,
+			Term:       log.Term,
+			Type:       raftbadger.RaftLogType(log.Type),
+			Data:       log.Data,
+			Extensions: log.Extensions,
+		})
+		if err != nil {
+			return err
+		}
+		key := t.getRawKey(log.Index)
+		set := func() error {
+			if side != nil {
+				if err := side(txn, i); err != nil {
+					return err
+				}
+			}
+			return txn.Set(key, data)
+		}
+		err = set()
+		if err == badger.ErrTxnTooBig {
+			if err := txn.Commit(); err != nil {
+				return err
+			}
+			txn = t.db.NewTransaction(true)
+			txns++
+			err = set()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		return err
+	}
+
+	metrics.MeasureSince([]string{"raft", "logstore", "batch_append"}, start)
+	metrics.AddSample([]string{"raft", "logstore", "batch_size"}, float32(len(logs)))
+	if txns > 1 {
+		metrics.IncrCounter([]string{"raft", "logstore", "batch_splits"}, float32(txns - 1))
+	}
+	return nil
+}
+
+func (t *batchedLogStore) IsMonotonic() bool {
+	if m, ok := t.LogStore.(raft.MonotonicLogStore); ok {
+		return m.IsMonotonic()
+	}
+	return false
+}
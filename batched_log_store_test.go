@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"encoding/binary"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/hashicorp/raft"
+	"github.com/sprintframework/raft-badger"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBatchedLogStore(t *testing.T) {
+
+	// small memtable and values kept in the tree, so the batch exceeds the transaction limits
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithMemTableSize(4 << 20).WithValueThreshold(64 << 10).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	plain := raftbadger.NewLogStore(db, []byte("log"))
+	store := newBatchedLogStore(plain, db, []byte("log"))
+
+	data := make([]byte, 16 << 10)
+	var logs []*raft.Log
+	for i := uint64(1); i <= 100; i++ {
+		logs = append(logs, &raft.Log{Index: i, Term: 2, Type: raft.LogCommand, Data: data, Extensions: []byte("ext")})
+	}
+	require.NoError(t, store.StoreLogs(logs))
+
+	// entries are readable by the raft-badger store
+	var log raft.Log
+	require.NoError(t, plain.GetLog(100, &log))
+	require.Equal(t, uint64(2), log.Term)
+	require.Len(t, log.Data, 16 << 10)
+	require.Equal(t, "ext", string(log.Extensions))
+
+	last, err := store.LastIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), last)
+
+	require.NoError(t, store.StoreLog(&raft.Log{Index: 101, Term: 3, Type: raft.LogNoop}))
+	require.NoError(t, store.GetLog(101, &log))
+	require.Equal(t, raft.LogNoop, log.Type)
+}
+
+func TestBatchedChecksums(t *testing.T) {
+
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithMemTableSize(4 << 20).WithValueThreshold(64 << 10).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	batched := newBatchedLogStore(raftbadger.NewLogStore(db, []byte("log")), db, []byte("log"))
+	encrypted, err := newEncryptedLogStore(batched, raftbadger.NewStableStore(db, []byte("conf")), TokenKeyProviderKDF("secret", 1000))
+	require.NoError(t, err)
+	store := NewChecksumLogStore(encrypted, db, []byte("crc"))
+
+	data := make([]byte, 16 << 10)
+	var logs []*raft.Log
+	for i := uint64(1); i <= 100; i++ {
+		logs = append(logs, &raft.Log{Index: i, Term: 2, Type: raft.LogCommand, Data: data})
+	}
+	require.NoError(t, store.StoreLogs(logs))
+
+	// every entry of the split batch has the checksum of the plain entry
+	require.NoError(t, db.View(func(txn *badger.Txn) error {
+		for _, log := range logs {
+			item, err := txn.Get(store.(*implChecksumLogStore).getRawKey(log.Index))
+			if err != nil {
+				return err
+			}
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			require.Equal(t, logChecksum(log), binary.BigEndian.Uint32(value))
+		}
+		return nil
+	}))
+
+	var log raft.Log
+	require.NoError(t, store.GetLog(100, &log))
+	require.Len(t, log.Data, 16 << 10)
+}
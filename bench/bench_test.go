@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package bench
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/hashicorp/raft"
+	"github.com/sprintframework/raft-badger"
+	"github.com/sprintframework/raftmod"
+	"github.com/sprintframework/raftmod/examples/kvfsm"
+	"io"
+	"testing"
+	"time"
+)
+
+// number of applies in flight on the leader
+const pipeline = 64
+
+func newKVFSM() raft.FSM {
+	return kvfsm.New()
+}
+
+func badgerStoreFactory(checksum bool) StoreFactory {
+	return func(int) (*NodeStore, error) {
+		db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+		if err != nil {
+			return nil, err
+		}
+		var logStore raft.LogStore = raftbadger.NewLogStore(db, []byte("log"))
+		if checksum {
+			logStore = raftmod.NewChecksumLogStore(logStore, db, []byte("crc"))
+		}
+		return &NodeStore{Log: logStore, Stable: raftbadger.NewStableStore(db, []byte("conf")), Close: db.Close}, nil
+	}
+}
+
+func command(b *testing.B, i, size int) []byte {
+	data, err := json.Marshal(&kvfsm.Command{Op: kvfsm.OpSet, Key: fmt.Sprintf("key%d", i % 1024), Value: string(bytes.Repeat([]byte{'x'}, size))})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+func runApply(b *testing.B, stores StoreFactory, size int) {
+
+	c, err := NewCluster(3, stores, newKVFSM)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Shutdown()
+
+	leader, err := c.WaitLeader(time.Second)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	cmd := command(b, 0, size)
+	b.SetBytes(int64(len(cmd)))
+	b.ResetTimer()
+
+	futures := make([]raft.ApplyFuture, 0, pipeline)
+	for i := 0; i < b.N; i++ {
+		futures = append(futures, raftmod.ApplyDeterministic(leader.Raft, cmd, 10 * time.Second))
+		if len(futures) == pipeline || i == b.N - 1 {
+			for _, f := range futures {
+				if err := f.Error(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			futures = futures[:0]
+		}
+	}
+}
+
+func BenchmarkApply(b *testing.B) {
+	for _, size := range []int{64, 1024, 16 * 1024} {
+		b.Run(fmt.Sprintf("payload=%d", size), func(b *testing.B) {
+			runApply(b, InmemStoreFactory, size)
+		})
+	}
+}
+
+func BenchmarkApplyLogStore(b *testing.B) {
+	for _, backend := range []struct {
+		name    string
+		stores  StoreFactory
+	}{
+		{"inmem", InmemStoreFactory},
+		{"badger", badgerStoreFactory(false)},
+		{"badger-checksum", badgerStoreFactory(true)},
+	} {
+		b.Run(backend.name, func(b *testing.B) {
+			runApply(b, backend.stores, 1024)
+		})
+	}
+}
+
+// FSM with the fixed number of keys applied directly
+func populatedFSM(b *testing.B, keys, size int) *kvfsm.KVFSM {
+	fsm := kvfsm.New()
+	for i := 0; i < keys; i++ {
+		data, err := json.Marshal(&kvfsm.Command{Op: kvfsm.OpSet, Key: fmt.Sprintf("key%d", i), Value: string(bytes.Repeat([]byte{'x'}, size))})
+		if err != nil {
+			b.Fatal(err)
+		}
+		fsm.Apply(&raft.Log{Index: uint64(i + 1), Term: 1, Data: data})
+	}
+	return fsm
+}
+
+func snapshotStores(b *testing.B, dir string) map[string]raft.SnapshotStore {
+	plain, err := raft.NewFileSnapshotStore(dir, 2, io.Discard)
+	if err != nil {
+		b.Fatal(err)
+	}
+	encDir := dir + "-enc"
+	files, err := raft.NewFileSnapshotStore(encDir, 2, io.Discard)
+	if err != nil {
+		b.Fatal(err)
+	}
+	encrypted, err := raftmod.NewEncryptedSnapshotStore(files, "bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return map[string]raft.SnapshotStore{"plain": plain, "encrypted": encrypted}
+}
+
+func persist(b *testing.B, fsm raft.FSM, store raft.SnapshotStore, index uint64) {
+	snapshot, err := fsm.Snapshot()
+	if err != nil {
+		b.Fatal(err)
+	}
+	sink, err := store.Create(raft.SnapshotVersionMax, index, 1, raft.Configuration{}, 0, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := snapshot.Persist(sink); err != nil {
+		b.Fatal(err)
+	}
+	snapshot.Release()
+}
+
+func BenchmarkSnapshotPersist(b *testing.B) {
+	fsm := populatedFSM(b, 10000, 256)
+	for _, name := range []string{"plain", "encrypted"} {
+		b.Run(name, func(b *testing.B) {
+			dir := b.TempDir()
+			store := snapshotStores(b, dir)[name]
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				persist(b, fsm, store, uint64(i + 1))
+			}
+		})
+	}
+}
+
+func BenchmarkSnapshotRestore(b *testing.B) {
+	fsm := populatedFSM(b, 10000, 256)
+	for _, name := range []string{"plain", "encrypted"} {
+		b.Run(name, func(b *testing.B) {
+			dir := b.TempDir()
+			store := snapshotStores(b, dir)[name]
+			persist(b, fsm, store, 1)
+			list, err := store.List()
+			if err != nil || len(list) == 0 {
+				b.Fatalf("no snapshot, %v", err)
+			}
+			b.SetBytes(list[0].Size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, source, err := store.Open(list[0].ID)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := kvfsm.New().Restore(source); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
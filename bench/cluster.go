@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+/**
+In-process raft clusters and reproducible benchmarks of the module, run with
+
+	go test -bench . -benchmem ./bench
+ */
+package bench
+
+import (
+	"fmt"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"time"
+)
+
+/**
+Log and stable store of the node, closer is called on cluster shutdown
+ */
+type NodeStore struct {
+	Log     raft.LogStore
+	Stable  raft.StableStore
+	Close   func() error
+}
+
+type StoreFactory func(node int) (*NodeStore, error)
+
+/**
+Node of the in-process cluster connected by the in-memory transport
+ */
+type Node struct {
+	ID         raft.ServerID
+	Raft       *raft.Raft
+	FSM        raft.FSM
+	Transport  *raft.InmemTransport
+	store      *NodeStore
+}
+
+type Cluster struct {
+	Nodes  []*Node
+}
+
+func InmemStoreFactory(int) (*NodeStore, error) {
+	s := raft.NewInmemStore()
+	return &NodeStore{Log: s, Stable: s}, nil
+}
+
+func benchConfig(id raft.ServerID) *raft.Config {
+	config := raft.DefaultConfig()
+	config.LocalID = id
+	config.Logger = hclog.NewNullLogger()
+	config.HeartbeatTimeout = 50 * time.Millisecond
+	config.ElectionTimeout = 50 * time.Millisecond
+	config.LeaderLeaseTimeout = 50 * time.Millisecond
+	config.CommitTimeout = 5 * time.Millisecond
+	// benchmarks measure apply path, automatic snapshots are disabled
+	config.SnapshotThreshold = 1 << 62
+	config.SnapshotInterval = time.Hour
+	return config
+}
+
+/**
+Starts the bootstrapped cluster of n voters and waits for the leader
+ */
+func NewCluster(n int, stores StoreFactory, newFSM func() raft.FSM) (*Cluster, error) {
+
+	c := &Cluster{}
+	var configuration raft.Configuration
+
+	for i := 0; i < n; i++ {
+		store, err := stores(i)
+		if err != nil {
+			c.Shutdown()
+			return nil, err
+		}
+		addr, transport := raft.NewInmemTransport("")
+		node := &Node{
+			ID:        raft.ServerID(fmt.Sprintf("node%d", i)),
+			FSM:       newFSM(),
+			Transport: transport,
+			store:     store,
+		}
+		c.Nodes = append(c.Nodes, node)
+		configuration.Servers = append(configuration.Servers, raft.Server{Suffrage: raft.Voter, ID: node.ID, Address: addr})
+	}
+
+	for _, a := range c.Nodes {
+		for _, b := range c.Nodes {
+			if a != b {
+				a.Transport.Connect(b.Transport.LocalAddr(), b.Transport)
+			}
+		}
+	}
+
+	for _, node := range c.Nodes {
+		config := benchConfig(node.ID)
+		snapshots := raft.NewInmemSnapshotStore()
+		if err := raft.BootstrapCluster(config, node.store.Log, node.store.Stable, snapshots, node.Transport, configuration); err != nil {
+			c.Shutdown()
+			return nil, err
+		}
+		r, err := raft.NewRaft(config, node.FSM, node.store.Log, node.store.Stable, snapshots, node.Transport)
+		if err != nil {
+			c.Shutdown()
+			return nil, err
+		}
+		node.Raft = r
+	}
+
+	if _, err := c.WaitLeader(10 * time.Second); err != nil {
+		c.Shutdown()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Cluster) WaitLeader(timeout time.Duration) (*Node, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		for _, node := range c.Nodes {
+			if node.Raft != nil && node.Raft.State() == raft.Leader {
+				return node, nil
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil, errors.Errorf("no leader elected in %v", timeout)
+}
+
+func (c *Cluster) Shutdown() {
+	for _, node := range c.Nodes {
+		if node.Raft != nil {
+			node.Raft.Shutdown().Error()
+		}
+		node.Transport.Close()
+		if node.store != nil && node.store.Close != nil {
+			node.store.Close()
+		}
+	}
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/pkg/errors"
+	"net"
+	"strings"
+	"sync"
+)
+
+/**
+Returns the first of comma separated bind addresses, it is the advertised one
+ */
+func primaryBindAddress(address string) string {
+	if i := strings.IndexByte(address, ','); i >= 0 {
+		return strings.TrimSpace(address[:i])
+	}
+	return strings.TrimSpace(address)
+}
+
+/**
+Resolves comma separated bind addresses, the host of each address could be the network interface name,
+for example 'eth0:8300,10.0.0.5:8300', the port is adjusted by the node sequence
+ */
+func ResolveBindAddresses(address string, seq int) ([]*net.TCPAddr, error) {
+
+	var list []*net.TCPAddr
+	for _, addr := range strings.Split(address, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, errors.Errorf("empty port in address '%s', %v", addr, err)
+		}
+		if ip, ok, err := interfaceIP(host); err != nil {
+			return nil, err
+		} else if ok {
+			addr = net.JoinHostPort(ip.String(), port)
+		}
+		tcpAddr, err := ParseAndAdjustTCPAddr(addr, seq)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, tcpAddr)
+	}
+
+	if len(list) == 0 {
+		return nil, errors.Errorf("no addresses in '%s'", address)
+	}
+	return list, nil
+}
+
+/**
+Returns the address of the network interface with the name, IPv4 is preferred, false if there is no such interface
+ */
+func interfaceIP(name string) (net.IP, bool, error) {
+
+	if name == "" || net.ParseIP(name) != nil {
+		return nil, false, nil
+	}
+
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		// host name
+		return nil, false, nil
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, false, errors.Errorf("addresses of interface '%s', %v", name, err)
+	}
+
+	var found net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP, true, nil
+		}
+		if found == nil {
+			found = ipNet.IP
+		}
+	}
+
+	if found == nil {
+		return nil, false, errors.Errorf("interface '%s' has no usable address", name)
+	}
+	return found, true, nil
+}
+
+/**
+Listens on all addresses, the first one is the address of the listener
+ */
+func listenAll(addrs []*net.TCPAddr) (net.Listener, error) {
+
+	if len(addrs) == 1 {
+		return net.Listen("tcp", addrs[0].String())
+	}
+
+	t := &multiListener{
+		connCh:  make(chan net.Conn),
+		closeCh: make(chan struct{}),
+	}
+	for _, addr := range addrs {
+		l, err := net.Listen("tcp", addr.String())
+		if err != nil {
+			t.Close()
+			return nil, errors.Errorf("bind failed on '%s', %v", addr.String(), err)
+		}
+		t.listeners = append(t.listeners, l)
+	}
+	for _, l := range t.listeners {
+		go t.serve(l)
+	}
+	return t, nil
+}
+
+type multiListener struct {
+	listeners  []net.Listener
+	connCh     chan net.Conn
+	closeOnce  sync.Once
+	closeCh    chan struct{}
+}
+
+func (t *multiListener) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		select {
+		case t.connCh <- conn:
+		case <-t.closeCh:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// Accept implements the net.Listener interface.
+func (t *multiListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-t.connCh:
+		return conn, nil
+	case <-t.closeCh:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements the net.Listener interface.
+func (t *multiListener) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.closeCh)
+		for _, l := range t.listeners {
+			l.Close()
+		}
+	})
+	return nil
+}
+
+// Addr implements the net.Listener interface.
+func (t *multiListener) Addr() net.Addr {
+	return t.listeners[0].Addr()
+}
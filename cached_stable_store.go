@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"sync"
+)
+
+type cachedStableValue struct {
+	value    []byte
+	number   uint64
+	isNumber bool
+}
+
+/**
+Write-through cache of the stable store for the term and the vote read on elections.
+Set and Get are serialized, so the cached value is never older than the stored one.
+When the cache is full it is cleared, metadata keys must not push out the hot keys forever.
+ */
+type cachedStableStore struct {
+	raft.StableStore
+	size   int
+
+	mutex  sync.Mutex
+	cache  map[string]cachedStableValue
+}
+
+func newCachedStableStore(delegate raft.StableStore, size int) *cachedStableStore {
+	return &cachedStableStore{
+		StableStore: delegate,
+		size:        size,
+		cache:       make(map[string]cachedStableValue),
+	}
+}
+
+func (t *cachedStableStore) put(key []byte, value cachedStableValue) {
+	if _, ok := t.cache[string(key)]; !ok && len(t.cache) >= t.size {
+		t.cache = make(map[string]cachedStableValue)
+	}
+	t.cache[string(key)] = value
+}
+
+func (t *cachedStableStore) Set(key []byte, val []byte) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := t.StableStore.Set(key, val); err != nil {
+		delete(t.cache, string(key))
+		return err
+	}
+	t.put(key, cachedStableValue{value: append([]byte(nil), val...)})
+	return nil
+}
+
+func (t *cachedStableStore) Get(key []byte) ([]byte, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if c, ok := t.cache[string(key)]; ok && !c.isNumber {
+		return append([]byte(nil), c.value...), nil
+	}
+	val, err := t.StableStore.Get(key)
+	if err != nil {
+		return val, err
+	}
+	t.put(key, cachedStableValue{value: append([]byte(nil), val...)})
+	return val, nil
+}
+
+func (t *cachedStableStore) SetUint64(key []byte, val uint64) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := t.StableStore.SetUint64(key, val); err != nil {
+		delete(t.cache, string(key))
+		return err
+	}
+	t.put(key, cachedStableValue{number: val, isNumber: true})
+	return nil
+}
+
+func (t *cachedStableStore) GetUint64(key []byte) (uint64, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if c, ok := t.cache[string(key)]; ok && c.isNumber {
+		return c.number, nil
+	}
+	val, err := t.StableStore.GetUint64(key)
+	if err != nil {
+		return val, err
+	}
+	t.put(key, cachedStableValue{number: val, isNumber: true})
+	return val, nil
+}
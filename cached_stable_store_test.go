@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type countingStableStore struct {
+	raft.StableStore
+	gets  int
+}
+
+func (t *countingStableStore) Get(key []byte) ([]byte, error) {
+	t.gets++
+	return t.StableStore.Get(key)
+}
+
+func (t *countingStableStore) GetUint64(key []byte) (uint64, error) {
+	t.gets++
+	return t.StableStore.GetUint64(key)
+}
+
+func TestCachedStableStore(t *testing.T) {
+
+	raw := &countingStableStore{StableStore: raft.NewInmemStore()}
+	require.NoError(t, raw.SetUint64([]byte("CurrentTerm"), 5))
+
+	store := newCachedStableStore(raw, 2)
+
+	for i := 0; i < 3; i++ {
+		term, err := store.GetUint64([]byte("CurrentTerm"))
+		require.NoError(t, err)
+		require.Equal(t, uint64(5), term)
+	}
+	require.Equal(t, 1, raw.gets)
+
+	require.NoError(t, store.SetUint64([]byte("CurrentTerm"), 6))
+	term, err := store.GetUint64([]byte("CurrentTerm"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), term)
+
+	require.NoError(t, store.Set([]byte("LastVoteCand"), []byte("node-1")))
+	value, err := store.Get([]byte("LastVoteCand"))
+	require.NoError(t, err)
+	require.Equal(t, "node-1", string(value))
+	require.Equal(t, 1, raw.gets)
+
+	// the returned value is a copy
+	value[0] = 'x'
+	value, err = store.Get([]byte("LastVoteCand"))
+	require.NoError(t, err)
+	require.Equal(t, "node-1", string(value))
+
+	// the full cache is cleared
+	require.NoError(t, store.Set([]byte("other"), []byte("value")))
+	_, err = store.GetUint64([]byte("CurrentTerm"))
+	require.NoError(t, err)
+	require.Equal(t, 2, raw.gets)
+
+	_, err = store.Get([]byte("missing"))
+	require.Error(t, err)
+}
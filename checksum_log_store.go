@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/hashicorp/raft"
+	"hash/crc32"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+/**
+Error returned on read of the log entry with the checksum mismatch
+ */
+type LogChecksumError struct {
+	Index     uint64
+	Expected  uint32
+	Actual    uint32
+}
+
+func (e *LogChecksumError) Error() string {
+	return fmt.Sprintf("log entry %d checksum mismatch, expected %08x, actual %08x", e.Index, e.Expected, e.Actual)
+}
+
+/**
+Log store decorator that keeps CRC32C checksum of every entry in the separate badger prefix
+and verifies it on read. Entries stored before checksums were enabled are not verified.
+ */
+type implChecksumLogStore struct {
+	raft.LogStore
+	db         *badger.DB
+	prefix     []byte
+	prefixLen  int
+}
+
+func NewChecksumLogStore(delegate raft.LogStore, db *badger.DB, prefix []byte) raft.LogStore {
+	return &implChecksumLogStore{
+		LogStore:  delegate,
+		db:        db,
+		prefix:    prefix,
+		prefixLen: len(prefix),
+	}
+}
+
+func logChecksum(log *raft.Log) uint32 {
+	var hdr [17]byte
+	binary.BigEndian.PutUint64(hdr[0:], log.Index)
+	binary.BigEndian.PutUint64(hdr[8:], log.Term)
+	hdr[16] = byte(log.Type)
+	crc := crc32.Update(0, crc32cTable, hdr[:])
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(log.Data)))
+	crc = crc32.Update(crc, crc32cTable, size[:])
+	crc = crc32.Update(crc, crc32cTable, log.Data)
+	binary.BigEndian.PutUint32(size[:], uint32(len(log.Extensions)))
+	crc = crc32.Update(crc, crc32cTable, size[:])
+	return crc32.Update(crc, crc32cTable, log.Extensions)
+}
+
+func (t *implChecksumLogStore) getRawKey(index uint64) []byte {
+	key := make([]byte, t.prefixLen + 8)
+	copy(key, t.prefix)
+	binary.BigEndian.PutUint64(key[t.prefixLen:], index)
+	return key
+}
+
+/**
+Forwards the raft.MonotonicLogStore contract of the delegate, raft removes all entries after the restore of the
+user snapshot only for monotonic stores
+ */
+func (t *implChecksumLogStore) IsMonotonic() bool {
+	if m, ok := t.LogStore.(raft.MonotonicLogStore); ok {
+		return m.IsMonotonic()
+	}
+	return false
+}
+
+func (t *implChecksumLogStore) GetLog(index uint64, log *raft.Log) error {
+	if err := t.LogStore.GetLog(index, log); err != nil {
+		return err
+	}
+	return t.verify(log)
+}
+
+func (t *implChecksumLogStore) verify(log *raft.Log) error {
+	return t.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(t.getRawKey(log.Index))
+		if err != nil {
+			if err == badger.ErrKeyNotFound {
+				return nil
+			}
+			return err
+		}
+		return item.Value(func(b []byte) error {
+			if len(b) != 4 {
+				return &LogChecksumError{Index: log.Index, Actual: logChecksum(log)}
+			}
+			expected := binary.BigEndian.Uint32(b)
+			if actual := logChecksum(log); actual != expected {
+				return &LogChecksumError{Index: log.Index, Expected: expected, Actual: actual}
+			}
+			return nil
+		})
+	})
+}
+
+func (t *implChecksumLogStore) StoreLog(log *raft.Log) error {
+	return t.StoreLogs([]*raft.Log{log})
+}
+
+func (t *implChecksumLogStore) checksumValue(log *raft.Log) []byte {
+	value := make([]byte, 4)
+	binary.BigEndian.PutUint32(value, logChecksum(log))
+	return value
+}
+
+/**
+Checksums are written in the same transaction as the entries by the badger log store, other delegates get them
+in the write batch flushed first, so the crash in between leaves at most orphan checksums for missing entries
+ */
+func (t *implChecksumLogStore) StoreLogs(logs []*raft.Log) error {
+	if delegate, ok := t.LogStore.(sideLogStore); ok {
+		return delegate.storeLogsWith(logs, func(txn *badger.Txn, i int) error {
+			return txn.Set(t.getRawKey(logs[i].Index), t.checksumValue(logs[i]))
+		})
+	}
+	wb := t.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, log := range logs {
+		if err := wb.Set(t.getRawKey(log.Index), t.checksumValue(log)); err != nil {
+			return err
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		return err
+	}
+	return t.LogStore.StoreLogs(logs)
+}
+
+func (t *implChecksumLogStore) DeleteRange(min, max uint64) error {
+	if err := t.LogStore.DeleteRange(min, max); err != nil {
+		return err
+	}
+	wb := t.db.NewWriteBatch()
+	defer wb.Cancel()
+	err := t.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(t.getRawKey(min)); it.ValidForPrefix(t.prefix); it.Next() {
+			rawKey := it.Item().KeyCopy(nil)
+			key := rawKey[t.prefixLen:]
+			if len(key) != 8 {
+				continue
+			}
+			if binary.BigEndian.Uint64(key) > max {
+				break
+			}
+			if err := wb.Delete(rawKey); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+/**
+Reads all entries of the log and passes them to callback with the verification error if any.
+Callback returns false to stop the scrub.
+ */
+func (t *implChecksumLogStore) ScrubLog(cb func(log *raft.Log, err error) bool) error {
+	first, err := t.FirstIndex()
+	if err != nil {
+		return err
+	}
+	last, err := t.LastIndex()
+	if err != nil {
+		return err
+	}
+	if first == 0 {
+		return nil
+	}
+	for index := first; index <= last; index++ {
+		var log raft.Log
+		err := t.GetLog(index, &log)
+		if err != nil {
+			if _, ok := err.(*LogChecksumError); !ok && err != raft.ErrLogNotFound {
+				return err
+			}
+			log.Index = index
+		}
+		if !cb(&log, err) {
+			break
+		}
+	}
+	return nil
+}
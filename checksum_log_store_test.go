@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/dgraph-io/badger/v3"
+	"github.com/hashicorp/raft"
+	"github.com/sprintframework/raft-badger"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestChecksumLogStore(t *testing.T) {
+
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := NewChecksumLogStore(raftbadger.NewLogStore(db, []byte("log")), db, []byte("crc"))
+
+	err = store.StoreLogs([]*raft.Log{
+		{Index: 1, Term: 1, Type: raft.LogCommand, Data: []byte("first")},
+		{Index: 2, Term: 1, Type: raft.LogCommand, Data: []byte("second")},
+	})
+	require.NoError(t, err)
+
+	var log raft.Log
+	require.NoError(t, store.GetLog(2, &log))
+	require.Equal(t, "second", string(log.Data))
+
+	// corrupt entry behind the checksum store
+	err = raftbadger.NewLogStore(db, []byte("log")).StoreLog(&raft.Log{Index: 2, Term: 1, Type: raft.LogCommand, Data: []byte("secone")})
+	require.NoError(t, err)
+
+	err = store.GetLog(2, &log)
+	require.Error(t, err)
+	checksumErr, ok := err.(*LogChecksumError)
+	require.True(t, ok)
+	require.Equal(t, uint64(2), checksumErr.Index)
+
+	var corrupted []uint64
+	err = store.(LogScrubber).ScrubLog(func(log *raft.Log, err error) bool {
+		if err != nil {
+			corrupted = append(corrupted, log.Index)
+		}
+		return true
+	})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{2}, corrupted)
+
+	require.NoError(t, store.DeleteRange(2, 2))
+	require.Equal(t, raft.ErrLogNotFound, store.GetLog(2, &log))
+
+	require.False(t, store.(raft.MonotonicLogStore).IsMonotonic())
+	monotonic := NewChecksumLogStore(&raft.MockMonotonicLogStore{}, db, []byte("crc"))
+	require.True(t, monotonic.(raft.MonotonicLogStore).IsMonotonic())
+
+}
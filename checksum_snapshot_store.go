@@ -0,0 +1,341 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	snapshotChecksumFile = "checksum.json"
+	// checksum of the 'verify' stage of the pipeline
+	snapshotVerifyFile   = "verify.json"
+)
+
+// sidecar files removed with the snapshot by backends keeping them as separate objects
+var snapshotSidecarFiles = []string{snapshotChecksumFile, snapshotVerifyFile}
+
+/**
+Checksums of the snapshot state recorded when the sink was closed
+ */
+type SnapshotChecksum struct {
+	ID         string
+	Size       int64
+	SHA256     string
+	// zero if per-chunk checksums are disabled
+	ChunkSize  int64    `json:",omitempty"`
+	// hex SHA-256 of every chunk, the last chunk could be shorter
+	Chunks     []string `json:",omitempty"`
+}
+
+/**
+Raw access to the snapshot in the backend, sidecar files are removed together with the snapshot
+ */
+type snapshotSidecar interface {
+
+	writeSidecar(id, name string, data []byte) error
+
+	/**
+	Returns os.ErrNotExist if the file was not written
+	 */
+	readSidecar(id, name string) ([]byte, error)
+
+	/**
+	Opens the stored state without checks of the backend, so the damage is located by checksums
+	 */
+	openState(id string) (io.ReadCloser, error)
+
+}
+
+/**
+Sidecar files in the snapshot directory of raft.FileSnapshotStore created in the folder
+ */
+type fileSnapshotSidecar string
+
+func (t fileSnapshotSidecar) path(id, name string) (string, error) {
+	if id == "" || filepath.Base(id) != id || id[0] == '.' {
+		return "", errors.Errorf("invalid snapshot id '%s'", id)
+	}
+	return filepath.Join(string(t), "snapshots", id, name), nil
+}
+
+func (t fileSnapshotSidecar) writeSidecar(id, name string, data []byte) error {
+	path, err := t.path(id, name)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func (t fileSnapshotSidecar) readSidecar(id, name string) ([]byte, error) {
+	path, err := t.path(id, name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (t fileSnapshotSidecar) openState(id string) (io.ReadCloser, error) {
+	path, err := t.path(id, "state.bin")
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+/**
+Snapshot store recording SHA-256 of the stored bytes and optionally of every chunk when sinks are closed,
+so the integrity of the snapshot is verified without restoring it and without keys of the encrypted pipeline.
+ */
+type implChecksumSnapshotStore struct {
+	raft.SnapshotStore
+	sidecar    snapshotSidecar
+	chunkSize  int64
+}
+
+func newChecksumSnapshotStore(delegate raft.SnapshotStore, sidecar snapshotSidecar, chunkSize int64) *implChecksumSnapshotStore {
+	return &implChecksumSnapshotStore{
+		SnapshotStore: delegate,
+		sidecar:       sidecar,
+		chunkSize:     chunkSize,
+	}
+}
+
+func (t *implChecksumSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration,
+	configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+
+	sink, err := t.SnapshotStore.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil {
+		return nil, err
+	}
+	return &implChecksumSink{
+		SnapshotSink: sink,
+		sidecar:      t.sidecar,
+		file:         snapshotChecksumFile,
+		hasher:       newSnapshotHasher(t.chunkSize),
+	}, nil
+}
+
+/**
+Returns the checksum recorded in the sidecar file, os.ErrNotExist if the snapshot has no such file
+ */
+func readSnapshotChecksum(sidecar snapshotSidecar, id, file string) (*SnapshotChecksum, error) {
+	data, err := sidecar.readSidecar(id, file)
+	if err != nil {
+		return nil, err
+	}
+	sum := new(SnapshotChecksum)
+	if err := json.Unmarshal(data, sum); err != nil {
+		return nil, errors.Errorf("invalid checksum of snapshot '%s', %v", id, err)
+	}
+	return sum, nil
+}
+
+func (t *implChecksumSnapshotStore) Verify(id string) (*SnapshotChecksum, error) {
+
+	expected, err := readSnapshotChecksum(t.sidecar, id, snapshotChecksumFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("snapshot '%s' has no recorded checksum", id)
+		}
+		return nil, err
+	}
+
+	reader, err := t.sidecar.openState(id)
+	if err != nil {
+		return nil, errors.Errorf("open snapshot '%s', %v", id, err)
+	}
+	defer reader.Close()
+
+	hasher := newSnapshotHasher(expected.ChunkSize)
+	if _, err := io.Copy(hasher, reader); err != nil {
+		return nil, errors.Errorf("read snapshot '%s', %v", id, err)
+	}
+	actual := hasher.checksum(id)
+
+	if actual.Size != expected.Size {
+		return nil, errors.Wrapf(ErrSnapshotIntegrity, "snapshot '%s' has %d bytes whereas recorded %d bytes", id, actual.Size, expected.Size)
+	}
+	for i := range expected.Chunks {
+		if i >= len(actual.Chunks) || actual.Chunks[i] != expected.Chunks[i] {
+			return nil, errors.Wrapf(ErrSnapshotIntegrity, "snapshot '%s' chunk %d at offset %d mismatch", id, i, int64(i) * expected.ChunkSize)
+		}
+	}
+	if actual.SHA256 != expected.SHA256 {
+		return nil, errors.Wrapf(ErrSnapshotIntegrity, "snapshot '%s' SHA-256 mismatch", id)
+	}
+	return expected, nil
+}
+
+type implChecksumSink struct {
+	raft.SnapshotSink
+	sidecar  snapshotSidecar
+	file     string
+	hasher   *snapshotHasher
+}
+
+func (t *implChecksumSink) Write(p []byte) (int, error) {
+	n, err := t.SnapshotSink.Write(p)
+	t.hasher.Write(p[:n])
+	return n, err
+}
+
+func (t *implChecksumSink) Close() error {
+	if err := t.SnapshotSink.Close(); err != nil {
+		return err
+	}
+	id := t.SnapshotSink.ID()
+	data, err := json.Marshal(t.hasher.checksum(id))
+	if err != nil {
+		return err
+	}
+	if err := t.sidecar.writeSidecar(id, t.file, data); err != nil {
+		return errors.Errorf("write checksum of snapshot '%s', %v", id, err)
+	}
+	return nil
+}
+
+/**
+Computes the whole and per-chunk SHA-256 of the stream
+ */
+type snapshotHasher struct {
+	total      hash.Hash
+	chunk      hash.Hash
+	chunkSize  int64
+	chunkLen   int64
+	size       int64
+	chunks     []string
+}
+
+func newSnapshotHasher(chunkSize int64) *snapshotHasher {
+	h := &snapshotHasher{total: sha256.New(), chunkSize: chunkSize}
+	if chunkSize > 0 {
+		h.chunk = sha256.New()
+	}
+	return h
+}
+
+func (t *snapshotHasher) Write(p []byte) (int, error) {
+	n := len(p)
+	t.total.Write(p)
+	t.size += int64(n)
+	for t.chunk != nil && len(p) > 0 {
+		part := p
+		if rest := t.chunkSize - t.chunkLen; int64(len(part)) > rest {
+			part = part[:rest]
+		}
+		t.chunk.Write(part)
+		t.chunkLen += int64(len(part))
+		p = p[len(part):]
+		if t.chunkLen == t.chunkSize {
+			t.chunks = append(t.chunks, hex.EncodeToString(t.chunk.Sum(nil)))
+			t.chunk.Reset()
+			t.chunkLen = 0
+		}
+	}
+	return n, nil
+}
+
+func (t *snapshotHasher) checksum(id string) *SnapshotChecksum {
+	chunks := t.chunks
+	if t.chunkLen > 0 {
+		chunks = append(chunks[:len(chunks):len(chunks)], hex.EncodeToString(t.chunk.Sum(nil)))
+	}
+	return &SnapshotChecksum{
+		ID:        id,
+		Size:      t.size,
+		SHA256:    hex.EncodeToString(t.total.Sum(nil)),
+		ChunkSize: t.chunkSize,
+		Chunks:    chunks,
+	}
+}
+
+/**
+Stage 'verify' of the pipeline recording SHA-256 of the stream at its position and checking it on every read,
+so damage of the stages below it fails the restore. Snapshots written before the stage was added are read unchecked.
+ */
+type implVerifySnapshotStore struct {
+	raft.SnapshotStore
+	sidecar  snapshotSidecar
+}
+
+func newVerifySnapshotStore(delegate raft.SnapshotStore, sidecar snapshotSidecar) *implVerifySnapshotStore {
+	return &implVerifySnapshotStore{SnapshotStore: delegate, sidecar: sidecar}
+}
+
+func (t *implVerifySnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration,
+	configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+
+	sink, err := t.SnapshotStore.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil {
+		return nil, err
+	}
+	return &implChecksumSink{
+		SnapshotSink: sink,
+		sidecar:      t.sidecar,
+		file:         snapshotVerifyFile,
+		hasher:       newSnapshotHasher(0),
+	}, nil
+}
+
+func (t *implVerifySnapshotStore) Open(id string) (*raft.SnapshotMeta, io.ReadCloser, error) {
+
+	expected, err := readSnapshotChecksum(t.sidecar, id, snapshotVerifyFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	meta, source, err := t.SnapshotStore.Open(id)
+	if err != nil || expected == nil {
+		return meta, source, err
+	}
+	return meta, &verifyingReader{ReadCloser: source, id: id, hasher: newSnapshotHasher(0), expected: expected}, nil
+}
+
+/**
+Compares the size and hash of the stream with the recorded checksum when the stream ends
+ */
+type verifyingReader struct {
+	io.ReadCloser
+	id        string
+	hasher    *snapshotHasher
+	expected  *SnapshotChecksum
+}
+
+func (t *verifyingReader) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	t.hasher.Write(p[:n])
+	if err == io.EOF {
+		actual := t.hasher.checksum(t.id)
+		if actual.Size != t.expected.Size {
+			return n, errors.Wrapf(ErrSnapshotIntegrity, "snapshot '%s' has %d bytes whereas recorded %d bytes", t.id, actual.Size, t.expected.Size)
+		}
+		if actual.SHA256 != t.expected.SHA256 {
+			return n, errors.Wrapf(ErrSnapshotIntegrity, "snapshot '%s' SHA-256 mismatch", t.id)
+		}
+	}
+	return n, err
+}
+
+/**
+Snapshot store of the pipeline exposing verification of the checksum store under it
+ */
+type verifiableSnapshotStore struct {
+	raft.SnapshotStore
+	checksums  *implChecksumSnapshotStore
+}
+
+func (t *verifiableSnapshotStore) Verify(id string) (*SnapshotChecksum, error) {
+	return t.checksums.Verify(id)
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChecksumSnapshotStore(t *testing.T) {
+
+	dir, err := os.MkdirTemp(os.TempDir(), "raftmodtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	snapshots, err := raft.NewFileSnapshotStore(dir, 5, os.Stderr)
+	require.NoError(t, err)
+
+	// snapshot written before the checksums were enabled
+	sink, err := snapshots.Create(raft.SnapshotVersionMax, 99, 1, raft.Configuration{}, 0, nil)
+	require.NoError(t, err)
+	_, err = sink.Write([]byte("plain"))
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+	plainID := sink.ID()
+
+	store := newChecksumSnapshotStore(snapshots, fileSnapshotSidecar(dir), 16)
+
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	sink, err = store.Create(raft.SnapshotVersionMax, 100, 1, raft.Configuration{}, 0, nil)
+	require.NoError(t, err)
+	_, err = sink.Write(content[:7])
+	require.NoError(t, err)
+	_, err = sink.Write(content[7:])
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+	id := sink.ID()
+
+	sum, err := store.Verify(id)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), sum.Size)
+	require.Equal(t, 7, len(sum.Chunks))
+
+	_, err = store.Verify(plainID)
+	require.Error(t, err)
+
+	// damage in the third chunk
+	state := filepath.Join(dir, "snapshots", id, "state.bin")
+	data, err := os.ReadFile(state)
+	require.NoError(t, err)
+	data[40] ^= 1
+	require.NoError(t, os.WriteFile(state, data, 0600))
+
+	_, err = store.Verify(id)
+	require.True(t, errors.Is(err, ErrSnapshotIntegrity))
+	require.True(t, strings.Contains(err.Error(), "chunk 2"), err.Error())
+
+	// truncated state
+	require.NoError(t, os.WriteFile(state, content[:50], 0600))
+	_, err = store.Verify(id)
+	require.True(t, errors.Is(err, ErrSnapshotIntegrity))
+}
+
+func TestVerifySnapshotStore(t *testing.T) {
+
+	dir, err := os.MkdirTemp(os.TempDir(), "raftmodtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	snapshots, err := raft.NewFileSnapshotStore(dir, 5, os.Stderr)
+	require.NoError(t, err)
+
+	// snapshot written before the stage was added
+	sink, err := snapshots.Create(raft.SnapshotVersionMax, 99, 1, raft.Configuration{}, 0, nil)
+	require.NoError(t, err)
+	_, err = sink.Write([]byte("plain"))
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+	plainID := sink.ID()
+
+	store := newVerifySnapshotStore(snapshots, fileSnapshotSidecar(dir))
+
+	sink, err = store.Create(raft.SnapshotVersionMax, 100, 1, raft.Configuration{}, 0, nil)
+	require.NoError(t, err)
+	_, err = sink.Write([]byte("verified state"))
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+	id := sink.ID()
+
+	for _, s := range []string{plainID, id} {
+		_, reader, err := store.Open(s)
+		require.NoError(t, err)
+		_, err = io.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+	}
+
+	// stream differs from the recorded one
+	sidecar := fileSnapshotSidecar(dir)
+	sum, err := readSnapshotChecksum(sidecar, id, snapshotVerifyFile)
+	require.NoError(t, err)
+	sum.SHA256 = strings.Repeat("0", 64)
+	data, err := json.Marshal(sum)
+	require.NoError(t, err)
+	require.NoError(t, sidecar.writeSidecar(id, snapshotVerifyFile, data))
+
+	_, reader, err := store.Open(id)
+	require.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	require.True(t, errors.Is(err, ErrSnapshotIntegrity))
+	reader.Close()
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+type ClusterEventType string
+
+const (
+	EventLeaderElected        ClusterEventType = "leader-elected"
+	EventMemberJoined         ClusterEventType = "member-joined"
+	EventMemberUpdated        ClusterEventType = "member-updated"
+	EventMemberFailed         ClusterEventType = "member-failed"
+	EventConfigurationChanged ClusterEventType = "configuration-changed"
+	EventSnapshotTaken        ClusterEventType = "snapshot-taken"
+	EventReadinessChanged     ClusterEventType = "readiness-changed"
+	EventSnapshotQuarantined  ClusterEventType = "snapshot-quarantined"
+	EventStateDivergence      ClusterEventType = "state-divergence"
+	EventSnapshotRestored     ClusterEventType = "snapshot-restored"
+)
+
+// number of recent events kept for resume of subscriptions
+const clusterEventHistory = 1024
+
+/**
+Raft or serf lifecycle event published on the cluster event bus
+ */
+type ClusterEvent struct {
+	Seq      uint64             `json:"seq"`
+	Type     ClusterEventType   `json:"type"`
+	Time     time.Time          `json:"time"`
+	ID       string             `json:"id,omitempty"`
+	Name     string             `json:"name,omitempty"`
+	Address  string             `json:"address,omitempty"`
+	Status   string             `json:"status,omitempty"`
+	Index    uint64             `json:"index,omitempty"`
+	Term     uint64             `json:"term,omitempty"`
+}
+
+type implClusterEventBus struct {
+	Log   *zap.Logger  `inject`
+
+	mutex    sync.RWMutex
+	subs     map[chan *ClusterEvent]struct{}
+	seq      uint64
+	history  []*ClusterEvent
+}
+
+func ClusterEventBus() ClusterEventPublisher {
+	return &implClusterEventBus{
+		subs: make(map[chan *ClusterEvent]struct{}),
+	}
+}
+
+func (t *implClusterEventBus) BeanName() string {
+	return "cluster-event-bus"
+}
+
+/**
+Delivers event to all subscribers, the event is dropped for the subscriber with the full buffer
+ */
+func (t *implClusterEventBus) Publish(event *ClusterEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.seq++
+	event.Seq = t.seq
+	if len(t.history) == clusterEventHistory {
+		copy(t.history, t.history[1:])
+		t.history = t.history[:clusterEventHistory-1]
+	}
+	t.history = append(t.history, event)
+	for ch := range t.subs {
+		select {
+		case ch <- event:
+		default:
+			t.Log.Warn("ClusterEventDropped", zap.String("type", string(event.Type)), zap.String("id", event.ID))
+		}
+	}
+}
+
+func (t *implClusterEventBus) Subscribe(buffer int) (<-chan *ClusterEvent, func()) {
+	ch := make(chan *ClusterEvent, buffer)
+	t.mutex.Lock()
+	t.subs[ch] = struct{}{}
+	t.mutex.Unlock()
+
+	return ch, func() {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		if _, ok := t.subs[ch]; ok {
+			delete(t.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+/**
+Returns retained events published after the sequence number, false if some of them were already evicted
+ */
+func (t *implClusterEventBus) Since(seq uint64) ([]*ClusterEvent, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if seq >= t.seq {
+		return nil, true
+	}
+	complete := len(t.history) > 0 && t.history[0].Seq <= seq + 1
+	var list []*ClusterEvent
+	for _, e := range t.history {
+		if e.Seq > seq {
+			list = append(list, e)
+		}
+	}
+	return list, complete
+}
+
+func (t *implClusterEventBus) Destroy() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for ch := range t.subs {
+		close(ch)
+	}
+	t.subs = make(map[chan *ClusterEvent]struct{})
+	return nil
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/hashicorp/raft"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"io"
+	"sync"
+)
+
+const (
+	CompressionZstd = "zstd"
+	CompressionGzip = "gzip"
+
+	snapshotCodeZstd = 1
+	snapshotCodeGzip = 2
+)
+
+// prefix of the compressed snapshot stream, followed by the codec
+var snapshotCompressMagic = []byte("RAFTCMP1")
+
+type implCompressedSnapshotStore struct {
+	delegate  raft.SnapshotStore
+	code      byte
+	level     int
+	// uncompressed sizes by snapshot id
+	sizes     sync.Map
+}
+
+/**
+Compresses new snapshots by 'zstd' or 'gzip', zero level is the default level of the codec.
+Snapshots written before the compression was enabled are opened as is.
+Open returns the uncompressed size in the meta, it is the size of the stream sent by InstallSnapshot.
+ */
+func CompressedSnapshotStore(store raft.SnapshotStore, codec string, level int) (raft.SnapshotStore, error) {
+	t := &implCompressedSnapshotStore{delegate: store, level: level}
+	switch codec {
+	case CompressionZstd:
+		t.code = snapshotCodeZstd
+	case CompressionGzip:
+		if level != 0 && (level < gzip.HuffmanOnly || level > gzip.BestCompression) {
+			return nil, errors.Errorf("invalid gzip level %d", level)
+		}
+		t.code = snapshotCodeGzip
+	default:
+		return nil, errors.Errorf("unsupported snapshot compression '%s', expected '%s' or '%s'", codec, CompressionZstd, CompressionGzip)
+	}
+	return t, nil
+}
+
+func (t *implCompressedSnapshotStore) newWriter(w io.Writer) (io.WriteCloser, error) {
+	if t.code == snapshotCodeGzip {
+		level := t.level
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	}
+	if t.level == 0 {
+		return zstd.NewWriter(w)
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(t.level)))
+}
+
+func newSnapshotReader(code byte, r io.Reader) (io.ReadCloser, error) {
+	switch code {
+	case snapshotCodeZstd:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case snapshotCodeGzip:
+		return gzip.NewReader(r)
+	}
+	return nil, errors.Errorf("unknown snapshot compression code %d", code)
+}
+
+func (t *implCompressedSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration,
+	configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+
+	sink, err := t.delegate.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append(append([]byte(nil), snapshotCompressMagic...), t.code)
+	if err := writeFull(sink, header); err != nil {
+		sink.Cancel()
+		return nil, err
+	}
+
+	writer, err := t.newWriter(sink)
+	if err != nil {
+		sink.Cancel()
+		return nil, err
+	}
+
+	return &implCompressedSink{sink: sink, writer: writer, store: t}, nil
+}
+
+func (t *implCompressedSnapshotStore) List() ([]*raft.SnapshotMeta, error) {
+	return t.delegate.List()
+}
+
+func (t *implCompressedSnapshotStore) Open(id string) (*raft.SnapshotMeta, io.ReadCloser, error) {
+
+	meta, source, err := t.delegate.Open(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	code, reader, err := readCompressHeader(source)
+	if err != nil {
+		source.Close()
+		return nil, nil, errors.Errorf("open snapshot '%s', %v", id, err)
+	}
+	if code == 0 {
+		// written before the compression was enabled
+		return meta, &prefixedReadCloser{Reader: reader, Closer: source}, nil
+	}
+
+	size, ok := t.sizes.Load(id)
+	if !ok {
+		// known only after the restart by decompressing the whole snapshot once
+		n, err := t.uncompressedSize(id)
+		if err != nil {
+			source.Close()
+			return nil, nil, errors.Errorf("size of snapshot '%s', %v", id, err)
+		}
+		size, _ = t.sizes.LoadOrStore(id, n)
+	}
+
+	decompressed, err := newSnapshotReader(code, reader)
+	if err != nil {
+		source.Close()
+		return nil, nil, errors.Errorf("open snapshot '%s', %v", id, err)
+	}
+
+	m := *meta
+	m.Size = size.(int64)
+	return &m, &implCompressedSource{reader: decompressed, source: source}, nil
+}
+
+func (t *implCompressedSnapshotStore) uncompressedSize(id string) (int64, error) {
+	_, source, err := t.delegate.Open(id)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+	code, reader, err := readCompressHeader(source)
+	if err != nil {
+		return 0, err
+	}
+	decompressed, err := newSnapshotReader(code, reader)
+	if err != nil {
+		return 0, err
+	}
+	defer decompressed.Close()
+	return io.Copy(io.Discard, decompressed)
+}
+
+/**
+Returns the codec of the compressed stream and the reader positioned after the header,
+zero codec and the reader of the whole stream if the stream is not compressed
+ */
+func readCompressHeader(source io.Reader) (byte, io.Reader, error) {
+	header := make([]byte, len(snapshotCompressMagic) + 1)
+	n, err := io.ReadFull(source, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, nil, err
+	}
+	if n == len(header) && bytes.Equal(header[:len(snapshotCompressMagic)], snapshotCompressMagic) {
+		return header[len(snapshotCompressMagic)], source, nil
+	}
+	return 0, io.MultiReader(bytes.NewReader(header[:n]), source), nil
+}
+
+type implCompressedSink struct {
+	sink    raft.SnapshotSink
+	writer  io.WriteCloser
+	store   *implCompressedSnapshotStore
+	size    int64
+	closed  bool
+}
+
+func (t *implCompressedSink) Write(p []byte) (int, error) {
+	n, err := t.writer.Write(p)
+	t.size += int64(n)
+	return n, err
+}
+
+func (t *implCompressedSink) Close() error {
+	if !t.closed {
+		t.closed = true
+		if err := t.writer.Close(); err != nil {
+			t.sink.Cancel()
+			return err
+		}
+	}
+	if err := t.sink.Close(); err != nil {
+		return err
+	}
+	t.store.sizes.Store(t.sink.ID(), t.size)
+	return nil
+}
+
+func (t *implCompressedSink) ID() string {
+	return t.sink.ID()
+}
+
+func (t *implCompressedSink) Cancel() error {
+	t.closed = true
+	return t.sink.Cancel()
+}
+
+type implCompressedSource struct {
+	reader  io.ReadCloser
+	source  io.ReadCloser
+}
+
+func (t *implCompressedSource) Read(p []byte) (int, error) {
+	return t.reader.Read(p)
+}
+
+func (t *implCompressedSource) Close() error {
+	t.reader.Close()
+	return t.source.Close()
+}
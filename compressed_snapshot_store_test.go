@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestCompressedSnapshotStore(t *testing.T) {
+
+	content := bytes.Repeat([]byte("raft snapshot of the text heavy state machine\n"), 10000)
+
+	for _, codec := range []string{CompressionZstd, CompressionGzip} {
+
+		dir, err := os.MkdirTemp(os.TempDir(), "raftmodtest")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		snapshots, err := raft.NewFileSnapshotStore(dir, 5, os.Stderr)
+		require.NoError(t, err)
+
+		// snapshot written before the compression was enabled
+		sink, err := snapshots.Create(raft.SnapshotVersionMax, 99, 1, raft.Configuration{}, 0, nil)
+		require.NoError(t, err)
+		_, err = sink.Write([]byte("plain"))
+		require.NoError(t, err)
+		require.NoError(t, sink.Close())
+		plainID := sink.ID()
+
+		store, err := CompressedSnapshotStore(snapshots, codec, 0)
+		require.NoError(t, err)
+
+		sink, err = store.Create(raft.SnapshotVersionMax, 100, 1, raft.Configuration{}, 0, nil)
+		require.NoError(t, err)
+		_, err = sink.Write(content)
+		require.NoError(t, err)
+		require.NoError(t, sink.Close())
+
+		list, err := snapshots.List()
+		require.NoError(t, err)
+		require.True(t, list[0].Size < int64(len(content)) / 10, codec)
+
+		// meta has the uncompressed size also after the restart
+		restarted, err := CompressedSnapshotStore(snapshots, codec, 0)
+		require.NoError(t, err)
+		for _, s := range []raft.SnapshotStore{store, restarted} {
+			meta, reader, err := s.Open(sink.ID())
+			require.NoError(t, err)
+			require.Equal(t, int64(len(content)), meta.Size)
+			actual, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.True(t, bytes.Equal(content, actual))
+			require.NoError(t, reader.Close())
+		}
+
+		_, reader, err := store.Open(plainID)
+		require.NoError(t, err)
+		actual, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.Equal(t, "plain", string(actual))
+		require.NoError(t, reader.Close())
+	}
+
+	_, err := CompressedSnapshotStore(nil, "lz4", 0)
+	require.Error(t, err)
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+Registers the raft node in the local Consul agent by HTTP API, the leader has tag 'leader' and
+followers tag 'follower', so the leader endpoint is discoverable by '<tag>.<service>.service.consul'.
+Empty 'raft.consul.address' disables the registrar.
+ */
+type implConsulRegistrar struct {
+
+	Log          *zap.Logger     `inject`
+
+	Address      string          `value:"raft.consul.address,default="`
+	Token        string          `value:"raft.consul.token,default="`
+	ServiceName  string          `value:"raft.consul.service-name,default="`
+	Timeout      time.Duration   `value:"raft.consul.timeout,default=10s"`
+
+	client       *http.Client
+}
+
+func ConsulRegistrar() ServiceRegistrar {
+	return &implConsulRegistrar{}
+}
+
+func (t *implConsulRegistrar) PostConstruct() error {
+	t.client = &http.Client{Timeout: t.Timeout}
+	if t.Address != "" && !strings.Contains(t.Address, "://") {
+		t.Address = "http://" + t.Address
+	}
+	return nil
+}
+
+type consulService struct {
+	ID       string             `json:"ID"`
+	Name     string             `json:"Name"`
+	Tags     []string           `json:"Tags,omitempty"`
+	Address  string             `json:"Address,omitempty"`
+	Port     int                `json:"Port,omitempty"`
+	Meta     map[string]string  `json:"Meta,omitempty"`
+}
+
+func (t *implConsulRegistrar) Register(reg *ServiceRegistration) error {
+	if t.Address == "" {
+		return nil
+	}
+
+	host, portStr, err := net.SplitHostPort(reg.Address)
+	if err != nil {
+		return errors.Errorf("invalid raft address '%s', %v", reg.Address, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return errors.Errorf("invalid raft port '%s', %v", portStr, err)
+	}
+
+	service := &consulService{
+		ID:      t.serviceID(reg.ID),
+		Name:    reg.Name,
+		Tags:    []string{"follower"},
+		Address: host,
+		Port:    port,
+		Meta: map[string]string{
+			"raft-id":        reg.ID,
+			"leader-id":      reg.LeaderID,
+			"leader-address": reg.LeaderAddress,
+		},
+	}
+	if t.ServiceName != "" {
+		service.Name = t.ServiceName
+	}
+	if reg.Leader {
+		service.Tags = []string{"leader"}
+	}
+
+	body, err := json.Marshal(service)
+	if err != nil {
+		return err
+	}
+
+	if err := t.call(http.MethodPut, "/v1/agent/service/register", body); err != nil {
+		return err
+	}
+
+	t.Log.Info("ConsulRegister", zap.String("service", service.ID), zap.Strings("tags", service.Tags))
+	return nil
+}
+
+func (t *implConsulRegistrar) Deregister(id string) error {
+	if t.Address == "" {
+		return nil
+	}
+	return t.call(http.MethodPut, "/v1/agent/service/deregister/" + t.serviceID(id), nil)
+}
+
+func (t *implConsulRegistrar) serviceID(id string) string {
+	return "raft-" + id
+}
+
+func (t *implConsulRegistrar) call(method, path string, body []byte) error {
+
+	req, err := http.NewRequest(method, t.Address + path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.Token != "" {
+		req.Header.Set("X-Consul-Token", t.Token)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return errors.Errorf("consul '%s', %v", path, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("consul '%s' returned status %s", path, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+)
+
+const (
+	// PermModeAuto applies chmod except on Windows where POSIX modes are not supported
+	PermModeAuto  = "auto"
+	PermModeChmod = "chmod"
+	// PermModeSkip keeps permissions given by umask, for read-only roots and volumes managed by the orchestrator
+	PermModeSkip  = "skip"
+)
+
+/**
+Permission strategy of the data directories from 'application.perm.*' properties
+ */
+type dataDirPerm struct {
+	perm  os.FileMode
+	mode  string
+	uid   int
+	gid   int
+}
+
+func newDataDirPerm(perm os.FileMode, mode string, uid, gid int) (dataDirPerm, error) {
+	switch mode {
+	case PermModeAuto:
+		if runtime.GOOS == "windows" {
+			mode = PermModeSkip
+		} else {
+			mode = PermModeChmod
+		}
+	case PermModeChmod, PermModeSkip:
+	default:
+		return dataDirPerm{}, errors.Errorf("invalid property 'application.perm.mode' value '%s', expected '%s', '%s' or '%s'", mode, PermModeAuto, PermModeChmod, PermModeSkip)
+	}
+	if (uid >= 0 || gid >= 0) && runtime.GOOS == "windows" {
+		return dataDirPerm{}, errors.New("properties 'application.perm.uid' and 'application.perm.gid' are not supported on windows")
+	}
+	return dataDirPerm{perm: perm, mode: mode, uid: uid, gid: gid}, nil
+}
+
+func createDirIfNeeded(dir string, p dataDirPerm) error {
+
+	fi, err := os.Stat(dir)
+	if err == nil {
+		if !fi.IsDir() {
+			return errors.Errorf("data path '%s' exists and is not a directory", dir)
+		}
+		return nil
+	}
+
+	if err = os.Mkdir(dir, p.perm); err != nil {
+		return errors.Errorf("unable to create dir '%s' with permissions %v, %v%s", dir, p.perm, err, permHint(err))
+	}
+
+	if p.mode == PermModeChmod {
+		if err = os.Chmod(dir, p.perm); err != nil {
+			return errors.Errorf("unable to chmod dir '%s' with permissions %v, %v%s", dir, p.perm, err, permHint(err))
+		}
+	}
+
+	if p.uid >= 0 || p.gid >= 0 {
+		if err = os.Chown(dir, p.uid, p.gid); err != nil {
+			return errors.Errorf("unable to chown dir '%s' to uid %d gid %d, %v%s", dir, p.uid, p.gid, err, permHint(err))
+		}
+	}
+
+	return nil
+}
+
+/**
+Creates the directory and missing parents with the permission strategy, existing parents are kept as is
+ */
+func createDirsIfNeeded(dir string, p dataDirPerm) error {
+	dir = filepath.Clean(dir)
+	if _, err := os.Stat(dir); err == nil {
+		return createDirIfNeeded(dir, p)
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := createDirsIfNeeded(parent, p); err != nil {
+			return err
+		}
+	}
+	return createDirIfNeeded(dir, p)
+}
+
+func permHint(err error) string {
+	switch {
+	case errors.Is(err, syscall.EROFS):
+		return ", file system is read-only, point 'application.data.dir' to a writable volume"
+	case os.IsPermission(err):
+		return ", check the owner of the parent directory or set 'application.perm.mode=skip'"
+	}
+	return ""
+}
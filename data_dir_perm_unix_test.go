@@ -0,0 +1,62 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestDataDirPerm(t *testing.T) {
+
+	p, err := newDataDirPerm(0750, PermModeAuto, -1, -1)
+	require.NoError(t, err)
+	require.Equal(t, PermModeChmod, p.mode)
+
+	_, err = newDataDirPerm(0750, "acl", -1, -1)
+	require.Error(t, err)
+
+	// chmod overrides umask, missing parents are created with the same permissions
+	dir := filepath.Join(t.TempDir(), "db", "raft")
+	p, err = newDataDirPerm(0777, PermModeChmod, os.Getuid(), os.Getgid())
+	require.NoError(t, err)
+	require.NoError(t, createDirsIfNeeded(dir, p))
+	for _, d := range []string{dir, filepath.Dir(dir)} {
+		fi, err := os.Stat(d)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0777), fi.Mode().Perm())
+	}
+
+	// skip keeps permissions given by umask
+	skipped := filepath.Join(t.TempDir(), "serf")
+	p, err = newDataDirPerm(0777, PermModeSkip, -1, -1)
+	require.NoError(t, err)
+	old := syscall.Umask(0077)
+	err = createDirIfNeeded(skipped, p)
+	syscall.Umask(old)
+	require.NoError(t, err)
+	fi, err := os.Stat(skipped)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0700), fi.Mode().Perm())
+
+	// existing directory is kept as is
+	require.NoError(t, createDirIfNeeded(skipped, p))
+
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0600))
+	require.Error(t, createDirIfNeeded(file, p))
+
+	require.True(t, strings.Contains(permHint(syscall.EROFS), "read-only"))
+	require.True(t, strings.Contains(permHint(os.ErrPermission), "application.perm.mode=skip"))
+	require.Equal(t, "", permHint(os.ErrNotExist))
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"github.com/hashicorp/raft"
+	"math/rand"
+	"time"
+)
+
+const (
+	// first byte of the Extensions written by NewDeterministicLog
+	entryMetadataMagic   = 0xD7
+	entryMetadataVersion = 1
+	entryMetadataSize    = 2 + 8 + 8
+)
+
+/**
+Leader-assigned time and random seed carried in the Extensions of the log entry,
+FSMs use them instead of the local clock and randomness to stay identical on all replicas
+ */
+type EntryMetadata struct {
+	Time  time.Time
+	Seed  int64
+}
+
+func EncodeEntryMetadata(meta *EntryMetadata) []byte {
+	buf := make([]byte, entryMetadataSize)
+	buf[0] = entryMetadataMagic
+	buf[1] = entryMetadataVersion
+	binary.BigEndian.PutUint64(buf[2:], uint64(meta.Time.UnixNano()))
+	binary.BigEndian.PutUint64(buf[10:], uint64(meta.Seed))
+	return buf
+}
+
+/**
+Returns false if the extensions were not written by EncodeEntryMetadata
+ */
+func DecodeEntryMetadata(extensions []byte) (*EntryMetadata, bool) {
+	if len(extensions) < entryMetadataSize || extensions[0] != entryMetadataMagic || extensions[1] != entryMetadataVersion {
+		return nil, false
+	}
+	return &EntryMetadata{
+		Time: time.Unix(0, int64(binary.BigEndian.Uint64(extensions[2:]))),
+		Seed: int64(binary.BigEndian.Uint64(extensions[10:])),
+	}, true
+}
+
+/**
+Builds the command log entry stamped with the current time and the random seed of the leader
+ */
+func NewDeterministicLog(cmd []byte) (raft.Log, error) {
+	var seed [8]byte
+	if _, err := crand.Read(seed[:]); err != nil {
+		return raft.Log{}, err
+	}
+	meta := &EntryMetadata{
+		Time: time.Now(),
+		Seed: int64(binary.BigEndian.Uint64(seed[:])),
+	}
+	return raft.Log{Data: cmd, Extensions: EncodeEntryMetadata(meta)}, nil
+}
+
+/**
+Applies the command with EntryMetadata on the leader, see EntryTime and EntryRand in FSM
+ */
+func ApplyDeterministic(r *raft.Raft, cmd []byte, timeout time.Duration) raft.ApplyFuture {
+	log, err := NewDeterministicLog(cmd)
+	if err != nil {
+		return errorApplyFuture{err}
+	}
+	return r.ApplyLog(log, timeout)
+}
+
+/**
+Time of the entry assigned by the leader, falls back to AppendedAt of the leader for entries without metadata
+ */
+func EntryTime(log *raft.Log) time.Time {
+	if meta, ok := DecodeEntryMetadata(log.Extensions); ok {
+		return meta.Time
+	}
+	return log.AppendedAt
+}
+
+/**
+Random source seeded identically on all replicas, entries without metadata are seeded by term and index
+ */
+func EntryRand(log *raft.Log) *rand.Rand {
+	seed := int64(log.Term << 32 ^ log.Index)
+	if meta, ok := DecodeEntryMetadata(log.Extensions); ok {
+		seed = meta.Seed
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+type errorApplyFuture struct {
+	err error
+}
+
+func (f errorApplyFuture) Error() error {
+	return f.err
+}
+
+func (f errorApplyFuture) Index() uint64 {
+	return 0
+}
+
+func (f errorApplyFuture) Response() interface{} {
+	return nil
+}
@@ -0,0 +1,33 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDeterministicEntry(t *testing.T) {
+
+	log, err := NewDeterministicLog([]byte("cmd"))
+	require.NoError(t, err)
+
+	meta, ok := DecodeEntryMetadata(log.Extensions)
+	require.True(t, ok)
+	require.Equal(t, meta.Time.UnixNano(), EntryTime(&log).UnixNano())
+
+	// replicas see the same entry and draw the same numbers
+	replica := raft.Log{Index: log.Index, Term: log.Term, Data: log.Data, Extensions: append([]byte(nil), log.Extensions...)}
+	require.Equal(t, EntryRand(&log).Int63(), EntryRand(&replica).Int63())
+
+	plain := raft.Log{Index: 7, Term: 2, Data: []byte("cmd"), AppendedAt: time.Unix(100, 0)}
+	_, ok = DecodeEntryMetadata(plain.Extensions)
+	require.False(t, ok)
+	require.Equal(t, time.Unix(100, 0), EntryTime(&plain))
+	require.Equal(t, EntryRand(&plain).Int63(), EntryRand(&plain).Int63())
+}
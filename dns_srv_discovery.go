@@ -0,0 +1,226 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"fmt"
+	"github.com/hashicorp/serf/serf"
+	"github.com/pkg/errors"
+	"github.com/sprintframework/raftapi"
+	"go.uber.org/zap"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DiscoveryDNSSRV = "dns-srv"
+
+/**
+Discovers peers by DNS SRV records of the domain on the interval:
+
+	_serf._tcp.<domain>  serf join port, discovered peers are joined by serf
+	_raft._tcp.<domain>  raft transport port
+	_api._tcp.<domain>   application port
+	_grpc._tcp.<domain>  grpc port
+
+Targets with raft and api ports are added to ServerLookup with the server ID of the serf member at the target address,
+the host name says nothing about the ID, so targets not joined yet are added on the next interval.
+Enabled by 'discovery.provider=dns-srv'.
+ */
+type implDNSSRVDiscovery struct {
+
+	Log           *zap.Logger           `inject`
+	ServerLookup  raftapi.ServerLookup  `inject`
+	SerfServer    raftapi.SerfServer    `inject:"optional"`
+
+	Provider      string          `value:"discovery.provider,default="`
+	Domain        string          `value:"discovery.dns-srv.domain,default="`
+	Interval      time.Duration   `value:"discovery.dns-srv.interval,default=30s"`
+
+	mutex         sync.Mutex
+	discovered    map[string]*raftapi.Server
+	shutdownOnce  sync.Once
+	shutdownCh    chan struct{}
+}
+
+func DNSSRVDiscovery() PeerDiscovery {
+	return &implDNSSRVDiscovery{
+		discovered: make(map[string]*raftapi.Server),
+		shutdownCh: make(chan struct{}),
+	}
+}
+
+func (t *implDNSSRVDiscovery) BeanName() string {
+	return "dns-srv-discovery"
+}
+
+func (t *implDNSSRVDiscovery) PostConstruct() error {
+	if t.Provider != DiscoveryDNSSRV {
+		return nil
+	}
+	if t.Domain == "" {
+		return errors.New("property 'discovery.dns-srv.domain' is required by 'discovery.provider=dns-srv'")
+	}
+	if t.Interval <= 0 {
+		return errors.Errorf("invalid property 'discovery.dns-srv.interval' value '%v'", t.Interval)
+	}
+	go t.discoveryLoop()
+	return nil
+}
+
+func (t *implDNSSRVDiscovery) Destroy() error {
+	t.shutdownOnce.Do(func() {
+		close(t.shutdownCh)
+	})
+	return nil
+}
+
+func (t *implDNSSRVDiscovery) discoveryLoop() {
+
+	t.Log.Info("DNSSRVDiscovery", zap.String("domain", t.Domain), zap.Duration("interval", t.Interval))
+
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.Discover(); err != nil {
+			t.Log.Warn("DNSSRVDiscovery", zap.String("domain", t.Domain), zap.Error(err))
+		}
+		select {
+		case <-ticker.C:
+		case <-t.shutdownCh:
+			return
+		}
+	}
+}
+
+func (t *implDNSSRVDiscovery) Discover() error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	ports := make(map[string]map[string]int)
+	var lastErr error
+	for _, service := range []string{"serf", "raft", "api", "grpc"} {
+		_, records, err := net.LookupSRV(service, "tcp", t.Domain)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, r := range records {
+			target := strings.TrimSuffix(r.Target, ".")
+			if ports[target] == nil {
+				ports[target] = make(map[string]int)
+			}
+			ports[target][service] = int(r.Port)
+		}
+	}
+	if len(ports) == 0 {
+		return lastErr
+	}
+
+	var joinAddrs []string
+	for target, p := range ports {
+		if port, ok := p["serf"]; ok {
+			joinAddrs = append(joinAddrs, net.JoinHostPort(target, fmt.Sprint(port)))
+		}
+	}
+	joinErr := t.join(joinAddrs)
+
+	members := t.members()
+	current := make(map[string]*raftapi.Server)
+
+	for target, p := range ports {
+		server, err := t.parseServer(target, p, members)
+		if err != nil {
+			t.Log.Debug("DNSSRVDiscoveryServer", zap.String("target", target), zap.Error(err))
+			continue
+		}
+		current[target] = server
+		t.ServerLookup.AddServer(server)
+	}
+
+	for target, server := range t.discovered {
+		if _, ok := current[target]; !ok {
+			t.ServerLookup.RemoveServer(server)
+		}
+	}
+	t.discovered = current
+
+	return joinErr
+}
+
+func (t *implDNSSRVDiscovery) parseServer(target string, ports map[string]int, members []serf.Member) (*raftapi.Server, error) {
+	raftPort, ok := ports["raft"]
+	if !ok {
+		return nil, errors.New("no raft port")
+	}
+	port, ok := ports["api"]
+	if !ok {
+		return nil, errors.New("no api port")
+	}
+	ip, err := net.ResolveIPAddr("ip", target)
+	if err != nil {
+		return nil, err
+	}
+	id, ok := memberID(members, ip.IP, ports["serf"])
+	if !ok {
+		return nil, errors.Errorf("no serf member at '%s'", ip.IP)
+	}
+	return &raftapi.Server{
+		Name:     target,
+		ID:       id,
+		Port:     port,
+		JoinPort: ports["serf"],
+		RaftPort: raftPort,
+		RPCPort:  ports["grpc"],
+		Addr:     &net.TCPAddr{IP: ip.IP, Port: port},
+		Status:   "discovered",
+	}, nil
+}
+
+/**
+Returns the server ID of the member with the address and serf port, zero port matches any port
+ */
+func memberID(members []serf.Member, ip net.IP, serfPort int) (string, bool) {
+	for _, m := range members {
+		if !m.Addr.Equal(ip) || (serfPort != 0 && int(m.Port) != serfPort) {
+			continue
+		}
+		if id := m.Tags["id"]; id != "" {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+func (t *implDNSSRVDiscovery) members() []serf.Member {
+	if t.SerfServer == nil || !t.SerfServer.Alive() {
+		return nil
+	}
+	s, ok := t.SerfServer.Serf()
+	if !ok || s == nil {
+		return nil
+	}
+	return s.Members()
+}
+
+func (t *implDNSSRVDiscovery) join(addrs []string) error {
+	if len(addrs) == 0 || t.SerfServer == nil || !t.SerfServer.Alive() {
+		return nil
+	}
+	s, ok := t.SerfServer.Serf()
+	if !ok || s == nil {
+		return nil
+	}
+	n, err := s.Join(addrs, true)
+	if err != nil && n == 0 {
+		return errors.Errorf("serf join %v, %v", addrs, err)
+	}
+	t.Log.Debug("DNSSRVDiscoveryJoin", zap.Strings("addrs", addrs), zap.Int("joined", n))
+	return nil
+}
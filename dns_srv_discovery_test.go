@@ -0,0 +1,38 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/serf/serf"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+)
+
+func TestDNSSRVServerID(t *testing.T) {
+
+	discovery := &implDNSSRVDiscovery{}
+	ports := map[string]int{"serf": 8300, "raft": 8301, "api": 8080}
+
+	// not joined yet
+	_, err := discovery.parseServer("127.0.0.1", ports, nil)
+	require.Error(t, err)
+
+	members := []serf.Member{
+		{Name: "other", Addr: net.ParseIP("127.0.0.1"), Port: 9300, Tags: map[string]string{"id": "1a2b"}},
+		{Name: "node", Addr: net.ParseIP("127.0.0.1"), Port: 8300, Tags: map[string]string{"id": "5f1e0c"}},
+	}
+	server, err := discovery.parseServer("127.0.0.1", ports, members)
+	require.NoError(t, err)
+	require.Equal(t, "5f1e0c", server.ID)
+	require.Equal(t, 8301, server.RaftPort)
+
+	// without serf record any port of the address
+	delete(ports, "serf")
+	server, err = discovery.parseServer("127.0.0.1", ports, members)
+	require.NoError(t, err)
+	require.Equal(t, "1a2b", server.ID)
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"io"
+	"sort"
+)
+
+/**
+Snapshot store of the storage migration writing new snapshots to both backends,
+reads prefer the new backend and fall back to the old one for snapshots written before the migration.
+Backends generate their own IDs, so snapshots are matched by term and index.
+ */
+type dualSnapshotStore struct {
+	primary    raft.SnapshotStore
+	secondary  raft.SnapshotStore
+}
+
+func newDualSnapshotStore(primary, secondary raft.SnapshotStore) *dualSnapshotStore {
+	return &dualSnapshotStore{primary: primary, secondary: secondary}
+}
+
+func (t *dualSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration,
+	configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+
+	primary, err := t.primary.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil {
+		return nil, err
+	}
+	secondary, err := t.secondary.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil {
+		primary.Cancel()
+		return nil, errors.Errorf("create snapshot in the old backend, %v", err)
+	}
+	return &dualSnapshotSink{primary: primary, secondary: secondary}, nil
+}
+
+/**
+Snapshots of both backends, the newest first, the new backend wins for the same term and index
+ */
+func (t *dualSnapshotStore) List() ([]*raft.SnapshotMeta, error) {
+
+	list, err := t.primary.List()
+	if err != nil {
+		return nil, err
+	}
+	old, err := t.secondary.List()
+	if err != nil {
+		return nil, errors.Errorf("list snapshots of the old backend, %v", err)
+	}
+
+	type position struct {
+		term, index uint64
+	}
+	seen := make(map[position]bool)
+	for _, meta := range list {
+		seen[position{meta.Term, meta.Index}] = true
+	}
+	for _, meta := range old {
+		if !seen[position{meta.Term, meta.Index}] {
+			list = append(list, meta)
+		}
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Term != b.Term {
+			return a.Term > b.Term
+		}
+		return a.Index > b.Index
+	})
+	return list, nil
+}
+
+func (t *dualSnapshotStore) Open(id string) (*raft.SnapshotMeta, io.ReadCloser, error) {
+	meta, reader, err := t.primary.Open(id)
+	if err == nil {
+		return meta, reader, nil
+	}
+	meta, reader, oldErr := t.secondary.Open(id)
+	if oldErr != nil {
+		return nil, nil, err
+	}
+	return meta, reader, nil
+}
+
+/**
+Returns the function removing the snapshot with the term and index of the ID from both backends
+ */
+func (t *dualSnapshotStore) remover(removePrimary, removeSecondary func(id string) error) func(id string) error {
+	return func(id string) error {
+		list, err := t.List()
+		if err != nil {
+			return err
+		}
+		for _, meta := range list {
+			if meta.ID == id {
+				if err := removeMatching(t.primary, removePrimary, meta); err != nil {
+					return err
+				}
+				return removeMatching(t.secondary, removeSecondary, meta)
+			}
+		}
+		return nil
+	}
+}
+
+func removeMatching(store raft.SnapshotStore, remove func(id string) error, target *raft.SnapshotMeta) error {
+	list, err := store.List()
+	if err != nil {
+		return err
+	}
+	for _, meta := range list {
+		if meta.Term == target.Term && meta.Index == target.Index {
+			if err := remove(meta.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type dualSnapshotSink struct {
+	primary    raft.SnapshotSink
+	secondary  raft.SnapshotSink
+}
+
+func (t *dualSnapshotSink) Write(p []byte) (int, error) {
+	n, err := t.primary.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if err := writeFull(t.secondary, p[:n]); err != nil {
+		return n, errors.Errorf("write snapshot to the old backend, %v", err)
+	}
+	return n, nil
+}
+
+func (t *dualSnapshotSink) ID() string {
+	return t.primary.ID()
+}
+
+/**
+Closes the old backend first, so every snapshot of the new backend is in the old one until the migration ends
+ */
+func (t *dualSnapshotSink) Close() error {
+	if err := t.secondary.Close(); err != nil {
+		t.primary.Cancel()
+		return errors.Errorf("close snapshot in the old backend, %v", err)
+	}
+	return t.primary.Close()
+}
+
+func (t *dualSnapshotSink) Cancel() error {
+	t.secondary.Cancel()
+	return t.primary.Cancel()
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type failingSnapshotStore struct {
+	raft.SnapshotStore
+}
+
+func (t failingSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration,
+	configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+	sink, err := t.SnapshotStore.Create(version, index, term, configuration, configurationIndex, trans)
+	return failingSnapshotSink{sink}, err
+}
+
+type failingSnapshotSink struct {
+	raft.SnapshotSink
+}
+
+func (t failingSnapshotSink) Close() error {
+	t.SnapshotSink.Cancel()
+	return errors.New("unavailable")
+}
+
+func TestDualSnapshotStore(t *testing.T) {
+
+	dir, err := os.MkdirTemp(os.TempDir(), "raftmodtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	newDir, oldDir := filepath.Join(dir, "new"), filepath.Join(dir, "old")
+	primary, err := raft.NewFileSnapshotStore(newDir, 5, os.Stderr)
+	require.NoError(t, err)
+	secondary, err := raft.NewFileSnapshotStore(oldDir, 5, os.Stderr)
+	require.NoError(t, err)
+
+	// snapshot written before the migration
+	sink, err := secondary.Create(raft.SnapshotVersionMax, 99, 1, raft.Configuration{}, 0, nil)
+	require.NoError(t, err)
+	_, err = sink.Write([]byte("before"))
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+	oldID := sink.ID()
+
+	store := newDualSnapshotStore(primary, secondary)
+
+	sink, err = store.Create(raft.SnapshotVersionMax, 100, 1, raft.Configuration{}, 0, nil)
+	require.NoError(t, err)
+	_, err = sink.Write([]byte("during"))
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+	id := sink.ID()
+
+	list, err := primary.List()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(list))
+	list, err = secondary.List()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(list))
+
+	list, err = store.List()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(list))
+	require.Equal(t, id, list[0].ID)
+	require.Equal(t, oldID, list[1].ID)
+
+	for s, expected := range map[string]string{id: "during", oldID: "before"} {
+		_, reader, err := store.Open(s)
+		require.NoError(t, err)
+		actual, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.Equal(t, expected, string(actual))
+		reader.Close()
+	}
+
+	// removed from both backends by term and index
+	remove := store.remover(fileSnapshotRemover(newDir), fileSnapshotRemover(oldDir))
+	require.NoError(t, remove(id))
+	list, err = store.List()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(list))
+	require.Equal(t, oldID, list[0].ID)
+
+	// snapshot fails when the old backend fails
+	store = newDualSnapshotStore(primary, failingSnapshotStore{secondary})
+	sink, err = store.Create(raft.SnapshotVersionMax, 101, 1, raft.Configuration{}, 0, nil)
+	require.NoError(t, err)
+	_, err = sink.Write([]byte("lost"))
+	require.NoError(t, err)
+	require.Error(t, sink.Close())
+
+	list, err = primary.List()
+	require.NoError(t, err)
+	require.Equal(t, 0, len(list))
+}
@@ -6,18 +6,55 @@
 package raftmod
 
 import (
-	"crypto/sha256"
+	"bytes"
+	"encoding/binary"
 	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
 	"io"
 )
 
+const (
+	// SnapshotEncryptionGCM authenticates snapshots, tampering fails on Open or Read
+	SnapshotEncryptionGCM = "gcm"
+	// SnapshotEncryptionCTR is the legacy unauthenticated mode
+	SnapshotEncryptionCTR = "ctr"
+)
+
 type implEncryptedSnapshotStore struct {
 	delegate  raft.SnapshotStore
-	token     string
+	keys      KeyProvider
+	mode      string
+}
+
+// key provider opening legacy snapshots encrypted by the master key directly
+type masterKeyProvider interface {
+	masterKey() []byte
 }
 
+/**
+Encrypts new snapshots by AES-GCM, opens both authenticated and legacy AES-CTR snapshots
+ */
 func NewEncryptedSnapshotStore(store raft.SnapshotStore, token string) (raft.SnapshotStore, error) {
-	return &implEncryptedSnapshotStore{delegate: store, token: token}, nil
+	return NewEncryptedSnapshotStoreMode(store, token, SnapshotEncryptionGCM)
+}
+
+/**
+Encrypts new snapshots in the mode 'gcm' or 'ctr', opens snapshots of any mode
+ */
+func NewEncryptedSnapshotStoreMode(store raft.SnapshotStore, token, mode string) (raft.SnapshotStore, error) {
+	return NewKeyProviderSnapshotStore(store, TokenKeyProvider(token), mode)
+}
+
+/**
+Encrypts new snapshots by data keys wrapped by the key provider
+ */
+func NewKeyProviderSnapshotStore(store raft.SnapshotStore, keys KeyProvider, mode string) (raft.SnapshotStore, error) {
+	switch mode {
+	case SnapshotEncryptionGCM, SnapshotEncryptionCTR:
+	default:
+		return nil, errors.Errorf("invalid snapshot encryption mode '%s', expected '%s' or '%s'", mode, SnapshotEncryptionGCM, SnapshotEncryptionCTR)
+	}
+	return &implEncryptedSnapshotStore{delegate: store, keys: keys, mode: mode}, nil
 }
 
 func (t *implEncryptedSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration,
@@ -26,10 +63,18 @@ func (t *implEncryptedSnapshotStore) Create(version raft.SnapshotVersion, index,
 	if err != nil {
 		return
 	}
-	sessionKey := t.newSessionKey(index, term)
-	sink, err = StreamEncrypter(sessionKey, sink)
-	clean(sessionKey)
-	return
+	var encrypted raft.SnapshotSink
+	// random data key of the snapshot is wrapped by the key provider in the header
+	if t.mode == SnapshotEncryptionGCM {
+		encrypted, err = AuthStreamEncrypter(t.keys, snapshotAAD(index, term), sink)
+	} else {
+		encrypted, err = KeyedStreamEncrypter(t.keys, snapshotAAD(index, term), sink)
+	}
+	if err != nil {
+		sink.Cancel()
+		return nil, err
+	}
+	return encrypted, nil
 }
 
 func (t *implEncryptedSnapshotStore) List() ([]*raft.SnapshotMeta, error) {
@@ -41,16 +86,52 @@ func (t *implEncryptedSnapshotStore) Open(id string) (meta *raft.SnapshotMeta, s
 	if err != nil {
 		return
 	}
-	sessionKey := t.newSessionKey(meta.Index, meta.Term)
-	source, err = StreamDecrypter(sessionKey, source)
-	clean(sessionKey)
-	return
+
+	magic := make([]byte, len(gcmStreamMagic))
+	n, err := io.ReadFull(source, magic)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		source.Close()
+		return nil, nil, err
+	}
+
+	var decrypted io.ReadCloser
+	switch {
+	case bytes.Equal(magic, gcmStreamMagic):
+		decrypted, err = AuthStreamDecrypter(t.keys, snapshotAAD(meta.Index, meta.Term), source)
+	case bytes.Equal(magic, ctrStreamMagic):
+		decrypted, err = KeyedStreamDecrypter(t.keys, snapshotAAD(meta.Index, meta.Term), source)
+	case bytes.HasPrefix(magic, streamMagicPrefix):
+		// IV of the legacy snapshot starts with the prefix once in 2^32 snapshots
+		err = errors.Errorf("unsupported snapshot encryption format '%s', written by the newer version", magic)
+	default:
+		legacy, ok := t.keys.(masterKeyProvider)
+		if !ok {
+			err = errors.Errorf("legacy snapshot requires key provider '%s'", TokenKeyProviderName)
+			break
+		}
+		masterKey := legacy.masterKey()
+		defer clean(masterKey)
+		// legacy snapshot starts with IV
+		decrypted, err = StreamDecrypter(masterKey, &prefixedReadCloser{Reader: io.MultiReader(bytes.NewReader(magic[:n]), source), Closer: source})
+	}
+	if err != nil {
+		source.Close()
+		return nil, nil, errors.Wrapf(err, "open snapshot '%s'", id)
+	}
+	return meta, decrypted, nil
+}
+
+type prefixedReadCloser struct {
+	io.Reader
+	io.Closer
 }
 
-func (t *implEncryptedSnapshotStore) newSessionKey(index, term uint64) []byte {
-	h := sha256.New()
-	h.Write([]byte(t.token))
-	return h.Sum(nil)
+// binds the authenticated stream to the snapshot, so the file of one snapshot does not open as another
+func snapshotAAD(index, term uint64) []byte {
+	aad := make([]byte, 16)
+	binary.BigEndian.PutUint64(aad, index)
+	binary.BigEndian.PutUint64(aad[8:], term)
+	return aad
 }
 
 func clean(arr []byte) {
@@ -7,12 +7,19 @@ package raftmod
 
 import (
 	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/hashicorp/raft"
 	"github.com/stretchr/testify/require"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEncryptedSnapshotStore(t *testing.T) {
@@ -24,7 +31,7 @@ func TestEncryptedSnapshotStore(t *testing.T) {
 	snapshots, err := raft.NewFileSnapshotStore(dir, 5, os.Stderr)
 	require.NoError(t, err)
 
-	testing, err := NewEncryptedSnapshotStore(snapshots, "123")
+	testing, err := NewEncryptedSnapshotStoreMode(snapshots, "123", SnapshotEncryptionCTR)
 	require.NoError(t, err)
 
 	sink, err := testing.Create(raft.SnapshotVersionMax, 100, 1, raft.Configuration{}, 0,nil)
@@ -39,8 +46,8 @@ func TestEncryptedSnapshotStore(t *testing.T) {
 	err = sink.Close()
 	require.NoError(t, err)
 
-	// MODIFIES BUF during encryption
-	require.False(t, bytes.Equal([]byte(welcome), buf))
+	// buffer of the caller stays untouched
+	require.True(t, bytes.Equal([]byte(welcome), buf))
 
 	list, err := testing.List()
 	require.NoError(t, err)
@@ -64,3 +71,279 @@ func TestEncryptedSnapshotStore(t *testing.T) {
 
 }
 
+func TestInPlaceStreamEncrypter(t *testing.T) {
+
+	key := make([]byte, 32)
+	welcome := "Hello World!"
+
+	var copied memSink
+	enc, err := StreamEncrypter(key, &copied)
+	require.NoError(t, err)
+	buf := []byte(welcome)
+	_, err = enc.Write(buf)
+	require.NoError(t, err)
+	require.Equal(t, welcome, string(buf))
+
+	var inPlace memSink
+	enc, err = InPlaceStreamEncrypter(key, &inPlace)
+	require.NoError(t, err)
+	_, err = enc.Write(buf)
+	require.NoError(t, err)
+
+	// MODIFIES BUF during encryption
+	require.False(t, bytes.Equal([]byte(welcome), buf))
+
+	for _, sink := range []*memSink{&copied, &inPlace} {
+		dec, err := StreamDecrypter(key, io.NopCloser(bytes.NewReader(sink.Bytes())))
+		require.NoError(t, err)
+		content, err := io.ReadAll(dec)
+		require.NoError(t, err)
+		require.Equal(t, welcome, string(content))
+	}
+}
+
+func TestEncryptedSnapshotHeader(t *testing.T) {
+
+	dir, err := os.MkdirTemp(os.TempDir(), "raftmodtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	snapshots, err := raft.NewFileSnapshotStore(dir, 5, os.Stderr)
+	require.NoError(t, err)
+
+	store, err := NewEncryptedSnapshotStoreMode(snapshots, "123", SnapshotEncryptionCTR)
+	require.NoError(t, err)
+
+	write := func(s raft.SnapshotStore, index uint64, wrap func(sink raft.SnapshotSink) raft.SnapshotSink) string {
+		sink, err := s.Create(raft.SnapshotVersionMax, index, 1, raft.Configuration{}, 0, nil)
+		require.NoError(t, err)
+		_, err = wrap(sink).Write([]byte("Hello World!"))
+		require.NoError(t, err)
+		require.NoError(t, sink.Close())
+		return sink.ID()
+	}
+	read := func(id string) (string, error) {
+		_, reader, err := store.Open(id)
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+		content, err := io.ReadAll(reader)
+		return string(content), err
+	}
+	same := func(sink raft.SnapshotSink) raft.SnapshotSink { return sink }
+
+	// data key of the CTR mode is wrapped in the versioned header
+	id := write(store, 100, same)
+	_, raw, err := snapshots.Open(id)
+	require.NoError(t, err)
+	magic := make([]byte, len(ctrStreamMagic))
+	_, err = io.ReadFull(raw, magic)
+	require.NoError(t, err)
+	raw.Close()
+	require.Equal(t, ctrStreamMagic, magic)
+	content, err := read(id)
+	require.NoError(t, err)
+	require.Equal(t, "Hello World!", content)
+
+	// legacy snapshot starts with IV
+	masterKey := TokenKeyProvider("123").(masterKeyProvider).masterKey()
+	id = write(snapshots, 101, func(sink raft.SnapshotSink) raft.SnapshotSink {
+		enc, err := StreamEncrypter(masterKey, sink)
+		require.NoError(t, err)
+		return enc
+	})
+	content, err = read(id)
+	require.NoError(t, err)
+	require.Equal(t, "Hello World!", content)
+
+	// format of the newer version
+	id = write(snapshots, 102, func(sink raft.SnapshotSink) raft.SnapshotSink {
+		_, err := sink.Write([]byte("RAFTGCM9"))
+		require.NoError(t, err)
+		return sink
+	})
+	_, err = read(id)
+	require.Error(t, err)
+}
+
+func TestAuthenticatedSnapshotStore(t *testing.T) {
+
+	dir, err := os.MkdirTemp(os.TempDir(), "raftmodtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	snapshots, err := raft.NewFileSnapshotStore(dir, 5, os.Stderr)
+	require.NoError(t, err)
+
+	store, err := NewEncryptedSnapshotStore(snapshots, "123")
+	require.NoError(t, err)
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), gcmChunkSize / 8)
+
+	sink, err := store.Create(raft.SnapshotVersionMax, 100, 1, raft.Configuration{}, 0, nil)
+	require.NoError(t, err)
+	_, err = sink.Write(content[:100])
+	require.NoError(t, err)
+	_, err = sink.Write(content[100:])
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+
+	_, reader, err := store.Open(sink.ID())
+	require.NoError(t, err)
+	actual, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(content, actual))
+	require.NoError(t, reader.Close())
+
+	aad := snapshotAAD(100, 1)
+	key := TokenKeyProvider("123")
+
+	var buf memSink
+	enc, err := AuthStreamEncrypter(key, aad, &buf)
+	require.NoError(t, err)
+	_, err = enc.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, enc.Close())
+
+	decrypt := func(data []byte, aad []byte) error {
+		r := bytes.NewReader(data[len(gcmStreamMagic):])
+		dec, err := AuthStreamDecrypter(key, aad, io.NopCloser(r))
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadAll(dec)
+		return err
+	}
+
+	data := buf.Bytes()
+	require.NoError(t, decrypt(data, aad))
+
+	// snapshot file of another index
+	require.True(t, errors.Is(decrypt(data, snapshotAAD(101, 1)), ErrSnapshotIntegrity))
+
+	// flipped bit in the last chunk fails on read
+	data[len(data)-1] ^= 1
+	require.True(t, errors.Is(decrypt(data, aad), ErrSnapshotIntegrity))
+	data[len(data)-1] ^= 1
+
+	// truncated stream
+	require.True(t, errors.Is(decrypt(data[:len(data)-20], aad), ErrSnapshotIntegrity))
+
+	// extended stream
+	require.True(t, errors.Is(decrypt(append(append([]byte(nil), data...), 0), aad), ErrSnapshotIntegrity))
+
+	// data key is random per snapshot and wrapped by the master key
+	var other memSink
+	enc, err = AuthStreamEncrypter(key, aad, &other)
+	require.NoError(t, err)
+	require.NoError(t, enc.Close())
+	// nonce, key and tag of AES-GCM
+	headerSize := len(gcmStreamMagic) + 1 + len(TokenKeyProviderName) + 2 + tokenKDFHeaderSize + 12 + gcmKeySize + 16
+	require.False(t, bytes.Equal(data[:headerSize], other.Bytes()[:headerSize]))
+
+	wrongKey := TokenKeyProvider("456")
+	_, err = AuthStreamDecrypter(wrongKey, aad, io.NopCloser(bytes.NewReader(data[len(gcmStreamMagic):])))
+	require.True(t, errors.Is(err, ErrSnapshotIntegrity))
+}
+
+func TestTokenKeyProvider(t *testing.T) {
+
+	// test vector of RFC 7914
+	key := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64)
+	require.Equal(t, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+		"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783", hex.EncodeToString(key))
+
+	aad := snapshotAAD(100, 1)
+	dataKey := bytes.Repeat([]byte{7}, gcmKeySize)
+
+	keys := TokenKeyProviderKDF("123", 1000)
+	wrapped, err := keys.WrapKey(dataKey, aad)
+	require.NoError(t, err)
+	require.Equal(t, tokenKDFHeaderSize + 12 + gcmKeySize + 16, len(wrapped))
+
+	// salt and iterations are taken from the wrapped key
+	unwrapped, err := TokenKeyProviderKDF("123", 5000).UnwrapKey(wrapped, aad)
+	require.NoError(t, err)
+	require.Equal(t, dataKey, unwrapped)
+
+	_, err = TokenKeyProviderKDF("456", 1000).UnwrapKey(wrapped, aad)
+	require.True(t, errors.Is(err, ErrSnapshotIntegrity))
+
+	tampered := append([]byte(nil), wrapped...)
+	tampered[4]++
+	_, err = keys.UnwrapKey(tampered, aad)
+	require.True(t, errors.Is(err, ErrSnapshotIntegrity))
+}
+
+func TestVaultKeyProvider(t *testing.T) {
+
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/raft":
+			fmt.Fprintf(w, `{"data":{"ciphertext":"vault:v1:%s"}}`, req["plaintext"])
+		case "/v1/transit/decrypt/raft":
+			fmt.Fprintf(w, `{"data":{"plaintext":"%s"}}`, strings.TrimPrefix(req["ciphertext"], "vault:v1:"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+
+	keys, err := VaultKeyProvider(vault.URL, "s.token", "", "raft", time.Second)
+	require.NoError(t, err)
+
+	dir, err := os.MkdirTemp(os.TempDir(), "raftmodtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	snapshots, err := raft.NewFileSnapshotStore(dir, 5, os.Stderr)
+	require.NoError(t, err)
+
+	_, err = NewKeyProviderSnapshotStore(snapshots, keys, "ecb")
+	require.Error(t, err)
+
+	store, err := NewKeyProviderSnapshotStore(snapshots, keys, SnapshotEncryptionGCM)
+	require.NoError(t, err)
+
+	sink, err := store.Create(raft.SnapshotVersionMax, 100, 1, raft.Configuration{}, 0, nil)
+	require.NoError(t, err)
+	_, err = sink.Write([]byte("Hello World!"))
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+
+	_, reader, err := store.Open(sink.ID())
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "Hello World!", string(content))
+	require.NoError(t, reader.Close())
+
+	// snapshot of the vault key is not readable by the token key
+	other, err := NewEncryptedSnapshotStore(snapshots, "123")
+	require.NoError(t, err)
+	_, _, err = other.Open(sink.ID())
+	require.Error(t, err)
+}
+
+type memSink struct {
+	bytes.Buffer
+}
+
+func (t *memSink) ID() string {
+	return "mem"
+}
+
+func (t *memSink) Cancel() error {
+	return nil
+}
+
+func (t *memSink) Close() error {
+	return nil
+}
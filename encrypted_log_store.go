@@ -0,0 +1,274 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+/**
+RECORD ENCRYPTION
+
+Every value is 'RAFTREC1' magic, 12 bytes of the nonce and AES-GCM sealed value.
+The data key is generated once per store, wrapped by the KeyProvider and kept in the keyring stable store.
+The keyring also keeps the first log index written encrypted, entries before it were written before
+the encryption was enabled and are returned as is, entries from it must be encrypted.
+ */
+
+const (
+	encryptedRecordMagic = "RAFTREC1"
+	logRecordKeyName     = "raftmod-log-key"
+	logEncryptedFromName = "raftmod-log-encrypted-from"
+	stableRecordKeyName  = "raftmod-stable-key"
+)
+
+/**
+Returns the cipher of the data key kept under the name in the keyring, the key is created on the first use
+ */
+func loadRecordCipher(keyring raft.StableStore, keys KeyProvider, name string) (cipher.AEAD, error) {
+
+	wrapped, err := keyring.Get([]byte(name))
+	// the same check of the missing key as in raft.NewRaft
+	if err != nil && err.Error() != "not found" {
+		return nil, errors.Errorf("get data key '%s', %v", name, err)
+	}
+
+	var dataKey []byte
+	if len(wrapped) > 0 {
+		dataKey, err = keys.UnwrapKey(wrapped, []byte(name))
+		if err != nil {
+			return nil, errors.Errorf("unwrap data key '%s' by provider '%s', %v", name, keys.KeyProviderName(), err)
+		}
+	} else {
+		dataKey = make([]byte, 32)
+		if _, err := rand.Read(dataKey); err != nil {
+			return nil, err
+		}
+		wrapped, err = keys.WrapKey(dataKey, []byte(name))
+		if err != nil {
+			return nil, errors.Errorf("wrap data key '%s' by provider '%s', %v", name, keys.KeyProviderName(), err)
+		}
+		if err := keyring.Set([]byte(name), wrapped); err != nil {
+			return nil, errors.Errorf("set data key '%s', %v", name, err)
+		}
+	}
+	return newGCM(dataKey)
+}
+
+func sealRecord(aead cipher.AEAD, value, aad []byte) ([]byte, error) {
+	out := make([]byte, len(encryptedRecordMagic) + aead.NonceSize(), len(encryptedRecordMagic) + aead.NonceSize() + len(value) + aead.Overhead())
+	copy(out, encryptedRecordMagic)
+	nonce := out[len(encryptedRecordMagic):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, value, aad), nil
+}
+
+func openRecord(aead cipher.AEAD, value, aad []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, []byte(encryptedRecordMagic)) {
+		return nil, errors.New("record is not encrypted")
+	}
+	sealed := value[len(encryptedRecordMagic):]
+	if len(sealed) < aead.NonceSize() + aead.Overhead() {
+		return nil, errors.New("truncated encrypted record")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+}
+
+/**
+Log store decorator encrypting data and extensions of entries, the index, term and type are bound to them
+ */
+type encryptedLogStore struct {
+	raft.LogStore
+	aead     cipher.AEAD
+	keyring  raft.StableStore
+	mutex    sync.Mutex
+	from     uint64  // first index written encrypted
+}
+
+func newEncryptedLogStore(delegate raft.LogStore, keyring raft.StableStore, keys KeyProvider) (raft.LogStore, error) {
+	aead, err := loadRecordCipher(keyring, keys, logRecordKeyName)
+	if err != nil {
+		return nil, err
+	}
+	from, err := keyring.GetUint64([]byte(logEncryptedFromName))
+	if err != nil && err.Error() != "not found" {
+		return nil, errors.Errorf("get '%s', %v", logEncryptedFromName, err)
+	}
+	t := &encryptedLogStore{LogStore: delegate, aead: aead, keyring: keyring, from: from}
+	if from == 0 {
+		// entries of the store are plain, the next one is the first encrypted
+		last, err := delegate.LastIndex()
+		if err != nil {
+			return nil, err
+		}
+		if err := t.setFrom(last + 1); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *encryptedLogStore) setFrom(index uint64) error {
+	if err := t.keyring.SetUint64([]byte(logEncryptedFromName), index); err != nil {
+		return errors.Errorf("set '%s', %v", logEncryptedFromName, err)
+	}
+	t.from = index
+	return nil
+}
+
+func (t *encryptedLogStore) encryptedFrom() uint64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.from
+}
+
+// raft deletes the conflicting plain entries before it stores the new ones in their place
+func (t *encryptedLogStore) lowerFrom(logs []*raft.Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if logs[0].Index < t.from {
+		return t.setFrom(logs[0].Index)
+	}
+	return nil
+}
+
+func logRecordAAD(log *raft.Log, field byte) []byte {
+	aad := make([]byte, 18)
+	binary.BigEndian.PutUint64(aad, log.Index)
+	binary.BigEndian.PutUint64(aad[8:], log.Term)
+	aad[16] = byte(log.Type)
+	aad[17] = field
+	return aad
+}
+
+func (t *encryptedLogStore) GetLog(index uint64, log *raft.Log) error {
+	if err := t.LogStore.GetLog(index, log); err != nil {
+		return err
+	}
+	if index < t.encryptedFrom() {
+		return nil
+	}
+	var err error
+	if len(log.Data) > 0 {
+		if log.Data, err = openRecord(t.aead, log.Data, logRecordAAD(log, 'd')); err != nil {
+			return errors.Errorf("decrypt data of log entry %d, %v", index, err)
+		}
+	}
+	if len(log.Extensions) > 0 {
+		if log.Extensions, err = openRecord(t.aead, log.Extensions, logRecordAAD(log, 'e')); err != nil {
+			return errors.Errorf("decrypt extensions of log entry %d, %v", index, err)
+		}
+	}
+	return nil
+}
+
+func (t *encryptedLogStore) StoreLog(log *raft.Log) error {
+	return t.StoreLogs([]*raft.Log{log})
+}
+
+func (t *encryptedLogStore) StoreLogs(logs []*raft.Log) error {
+	if err := t.lowerFrom(logs); err != nil {
+		return err
+	}
+	sealed, err := t.seal(logs)
+	if err != nil {
+		return err
+	}
+	return t.LogStore.StoreLogs(sealed)
+}
+
+// sealed entries keep the positions, so the side keys of the plain entries go along with them
+func (t *encryptedLogStore) storeLogsWith(logs []*raft.Log, side func(txn *badger.Txn, i int) error) error {
+	delegate, ok := t.LogStore.(sideLogStore)
+	if !ok {
+		return errors.New("log store does not support side keys")
+	}
+	if err := t.lowerFrom(logs); err != nil {
+		return err
+	}
+	sealed, err := t.seal(logs)
+	if err != nil {
+		return err
+	}
+	return delegate.storeLogsWith(sealed, side)
+}
+
+func (t *encryptedLogStore) seal(logs []*raft.Log) ([]*raft.Log, error) {
+	// raft keeps the entries in memory, so they are copied
+	sealed := make([]*raft.Log, len(logs))
+	for i, log := range logs {
+		c := *log
+		var err error
+		if len(c.Data) > 0 {
+			if c.Data, err = sealRecord(t.aead, log.Data, logRecordAAD(log, 'd')); err != nil {
+				return nil, err
+			}
+		}
+		if len(c.Extensions) > 0 {
+			if c.Extensions, err = sealRecord(t.aead, log.Extensions, logRecordAAD(log, 'e')); err != nil {
+				return nil, err
+			}
+		}
+		sealed[i] = &c
+	}
+	return sealed, nil
+}
+
+func (t *encryptedLogStore) IsMonotonic() bool {
+	if m, ok := t.LogStore.(raft.MonotonicLogStore); ok {
+		return m.IsMonotonic()
+	}
+	return false
+}
+
+/**
+Stable store decorator encrypting values of Set bound to their keys, the term and the vote of SetUint64 stay plain.
+Values without the magic were written before the encryption was enabled and are returned as is.
+ */
+type encryptedStableStore struct {
+	raft.StableStore
+	aead  cipher.AEAD
+}
+
+func newEncryptedStableStore(delegate raft.StableStore, keys KeyProvider) (raft.StableStore, error) {
+	aead, err := loadRecordCipher(delegate, keys, stableRecordKeyName)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedStableStore{StableStore: delegate, aead: aead}, nil
+}
+
+func (t *encryptedStableStore) Set(key []byte, val []byte) error {
+	sealed, err := sealRecord(t.aead, val, key)
+	if err != nil {
+		return err
+	}
+	return t.StableStore.Set(key, sealed)
+}
+
+func (t *encryptedStableStore) Get(key []byte) ([]byte, error) {
+	val, err := t.StableStore.Get(key)
+	if err != nil || len(val) == 0 || !bytes.HasPrefix(val, []byte(encryptedRecordMagic)) {
+		return val, err
+	}
+	plain, err := openRecord(t.aead, val, key)
+	if err != nil {
+		return nil, errors.Errorf("decrypt value of '%s', %v", key, err)
+	}
+	return plain, nil
+}
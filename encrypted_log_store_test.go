@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestEncryptedLogStore(t *testing.T) {
+
+	raw := raft.NewInmemStore()
+
+	// entries written before the encryption was enabled, the plain value may start with the magic
+	require.NoError(t, raw.StoreLog(&raft.Log{Index: 1, Term: 1, Type: raft.LogCommand, Data: []byte(encryptedRecordMagic + "plain")}))
+
+	store, err := newEncryptedLogStore(raw, raw, TokenKeyProviderKDF("secret", 1000))
+	require.NoError(t, err)
+
+	entries := []*raft.Log{
+		{Index: 2, Term: 1, Type: raft.LogCommand, Data: []byte("second"), Extensions: []byte("ext")},
+		{Index: 3, Term: 2, Type: raft.LogCommand, Data: []byte("third")},
+		{Index: 4, Term: 2, Type: raft.LogNoop},
+	}
+	require.NoError(t, store.StoreLogs(entries))
+	require.Equal(t, "second", string(entries[0].Data))
+
+	var log raft.Log
+	require.NoError(t, raw.GetLog(2, &log))
+	require.True(t, bytes.HasPrefix(log.Data, []byte(encryptedRecordMagic)))
+	require.False(t, bytes.Contains(log.Data, []byte("second")))
+
+	for index, expected := range map[uint64]string{1: encryptedRecordMagic + "plain", 2: "second", 3: "third", 4: ""} {
+		require.NoError(t, store.GetLog(index, &log))
+		require.Equal(t, expected, string(log.Data))
+	}
+	require.NoError(t, store.GetLog(2, &log))
+	require.Equal(t, "ext", string(log.Extensions))
+
+	// the data key is kept in the keyring
+	store, err = newEncryptedLogStore(raw, raw, TokenKeyProviderKDF("secret", 1000))
+	require.NoError(t, err)
+	require.NoError(t, store.GetLog(3, &log))
+	require.Equal(t, "third", string(log.Data))
+
+	_, err = newEncryptedLogStore(raw, raw, TokenKeyProviderKDF("wrong", 1000))
+	require.Error(t, err)
+
+	// entry moved to the other index
+	require.NoError(t, raw.GetLog(2, &log))
+	log.Index = 5
+	require.NoError(t, raw.StoreLog(&log))
+	require.Error(t, store.GetLog(5, &log))
+
+	// plain entry after the encryption was enabled
+	require.NoError(t, raw.StoreLog(&raft.Log{Index: 6, Term: 2, Type: raft.LogCommand, Data: []byte("injected")}))
+	require.Error(t, store.GetLog(6, &log))
+}
+
+func TestEncryptedLogStoreFrom(t *testing.T) {
+
+	raw := raft.NewInmemStore()
+	for i := uint64(1); i <= 3; i++ {
+		require.NoError(t, raw.StoreLog(&raft.Log{Index: i, Term: 1, Type: raft.LogCommand, Data: []byte("plain")}))
+	}
+
+	store, err := newEncryptedLogStore(raw, raw, TokenKeyProviderKDF("secret", 1000))
+	require.NoError(t, err)
+	from, err := raw.GetUint64([]byte(logEncryptedFromName))
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), from)
+
+	// the new leader overwrites the conflicting plain entry
+	require.NoError(t, store.DeleteRange(3, 3))
+	require.NoError(t, store.StoreLogs([]*raft.Log{{Index: 3, Term: 2, Type: raft.LogCommand, Data: []byte("third")}}))
+	from, err = raw.GetUint64([]byte(logEncryptedFromName))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), from)
+
+	var log raft.Log
+	require.NoError(t, store.GetLog(2, &log))
+	require.Equal(t, "plain", string(log.Data))
+	require.NoError(t, store.GetLog(3, &log))
+	require.Equal(t, "third", string(log.Data))
+
+	// the index is kept in the keyring
+	store, err = newEncryptedLogStore(raw, raw, TokenKeyProviderKDF("secret", 1000))
+	require.NoError(t, err)
+	require.NoError(t, store.GetLog(3, &log))
+	require.Equal(t, "third", string(log.Data))
+}
+
+func TestEncryptedStableStore(t *testing.T) {
+
+	raw := raft.NewInmemStore()
+	require.NoError(t, raw.Set([]byte("legacy"), []byte("plain")))
+
+	store, err := newEncryptedStableStore(raw, TokenKeyProviderKDF("secret", 1000))
+	require.NoError(t, err)
+
+	require.NoError(t, store.Set([]byte("LastVoteCand"), []byte("node-1")))
+	value, err := raw.Get([]byte("LastVoteCand"))
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(value, []byte("node-1")))
+
+	value, err = store.Get([]byte("LastVoteCand"))
+	require.NoError(t, err)
+	require.Equal(t, "node-1", string(value))
+
+	value, err = store.Get([]byte("legacy"))
+	require.NoError(t, err)
+	require.Equal(t, "plain", string(value))
+
+	// raft checks the message of the missing key
+	_, err = store.Get([]byte("missing"))
+	require.Error(t, err)
+	require.Equal(t, "not found", err.Error())
+
+	// value moved to the other key
+	sealed, err := raw.Get([]byte("LastVoteCand"))
+	require.NoError(t, err)
+	require.NoError(t, raw.Set([]byte("other"), sealed))
+	_, err = store.Get([]byte("other"))
+	require.Error(t, err)
+
+	require.NoError(t, store.SetUint64([]byte("CurrentTerm"), 7))
+	term, err := raw.GetUint64([]byte("CurrentTerm"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), term)
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package kvfsm
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"github.com/sprintframework/raftmod"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	OpSet    = "set"
+	OpDelete = "delete"
+)
+
+/**
+Command replicated through the raft log
+ */
+type Command struct {
+	Op     string  `json:"op"`
+	Key    string  `json:"key"`
+	Value  string  `json:"value,omitempty"`
+}
+
+/**
+Stored value with the leader-assigned update time
+ */
+type Entry struct {
+	Value    string     `json:"value"`
+	Updated  time.Time  `json:"updated"`
+}
+
+/**
+Result of the Apply returned through ApplyFuture.Response
+ */
+type Result struct {
+	Index  uint64
+	Err    error
+}
+
+/**
+Sample in-memory key-value FSM for the quickstart, implements raftmod.StateHasher and GetStats
+ */
+type KVFSM struct {
+	mutex     sync.RWMutex
+	data      map[string]*Entry
+	applied   uint64
+}
+
+func New() *KVFSM {
+	return &KVFSM{
+		data: make(map[string]*Entry),
+	}
+}
+
+/**
+Applies the command on the leader with deterministic time, must be called on the leader
+ */
+func Apply(r *raft.Raft, cmd *Command, timeout time.Duration) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	future := raftmod.ApplyDeterministic(r, data, timeout)
+	if err := future.Error(); err != nil {
+		return err
+	}
+	if result, ok := future.Response().(*Result); ok {
+		return result.Err
+	}
+	return nil
+}
+
+func (t *KVFSM) Apply(log *raft.Log) interface{} {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.applied = log.Index
+
+	var cmd Command
+	if err := json.Unmarshal(log.Data, &cmd); err != nil {
+		return &Result{Index: log.Index, Err: errors.Errorf("invalid command at index %d, %v", log.Index, err)}
+	}
+
+	switch cmd.Op {
+	case OpSet:
+		t.data[cmd.Key] = &Entry{Value: cmd.Value, Updated: raftmod.EntryTime(log)}
+	case OpDelete:
+		delete(t.data, cmd.Key)
+	default:
+		return &Result{Index: log.Index, Err: errors.Errorf("unknown op '%s' at index %d", cmd.Op, log.Index)}
+	}
+	return &Result{Index: log.Index}
+}
+
+func (t *KVFSM) Get(key string) (*Entry, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	entry, ok := t.data[key]
+	return entry, ok
+}
+
+func (t *KVFSM) Snapshot() (raft.FSMSnapshot, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	data := make(map[string]*Entry, len(t.data))
+	for k, v := range t.data {
+		data[k] = v
+	}
+	return &kvSnapshot{data: data}, nil
+}
+
+func (t *KVFSM) Restore(reader io.ReadCloser) error {
+	defer reader.Close()
+	data := make(map[string]*Entry)
+	if err := json.NewDecoder(reader).Decode(&data); err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	t.data = data
+	t.mutex.Unlock()
+	return nil
+}
+
+/**
+Hash of the sorted keys and values at the applied index
+ */
+func (t *KVFSM) StateHash() (uint64, []byte, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	keys := make([]string, 0, len(t.data))
+	for k := range t.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(t.data[k].Value))
+		h.Write([]byte{0})
+	}
+	return t.applied, h.Sum(nil), nil
+}
+
+func (t *KVFSM) GetStats(cb func(name, value string) bool) error {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	cb("keys", strconv.Itoa(len(t.data)))
+	cb("applied", strconv.FormatUint(t.applied, 10))
+	return nil
+}
+
+type kvSnapshot struct {
+	data  map[string]*Entry
+}
+
+func (t *kvSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := json.NewEncoder(sink).Encode(t.data); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (t *kvSnapshot) Release() {
+}
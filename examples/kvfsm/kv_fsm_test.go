@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package kvfsm_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/hashicorp/raft"
+	"github.com/sprintframework/raftmod"
+	"github.com/sprintframework/raftmod/examples/kvfsm"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+)
+
+func TestKVFSM(t *testing.T) {
+
+	leader, follower := kvfsm.New(), kvfsm.New()
+
+	for i, cmd := range []*kvfsm.Command{
+		{Op: kvfsm.OpSet, Key: "a", Value: "1"},
+		{Op: kvfsm.OpSet, Key: "b", Value: "2"},
+		{Op: kvfsm.OpDelete, Key: "a"},
+	} {
+		data, err := json.Marshal(cmd)
+		require.NoError(t, err)
+		log, err := raftmod.NewDeterministicLog(data)
+		require.NoError(t, err)
+		log.Index, log.Term = uint64(i + 1), 1
+
+		require.NoError(t, leader.Apply(&log).(*kvfsm.Result).Err)
+		require.NoError(t, follower.Apply(&log).(*kvfsm.Result).Err)
+	}
+
+	_, ok := leader.Get("a")
+	require.False(t, ok)
+	b, ok := leader.Get("b")
+	require.True(t, ok)
+	require.Equal(t, "2", b.Value)
+
+	// replicas stay identical, including the leader-assigned time
+	lb, _ := follower.Get("b")
+	require.Equal(t, b.Updated, lb.Updated)
+
+	index, hash, err := leader.StateHash()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), index)
+	_, followerHash, err := follower.StateHash()
+	require.NoError(t, err)
+	require.Equal(t, hash, followerHash)
+
+	snapshot, err := leader.Snapshot()
+	require.NoError(t, err)
+	sink := &memorySink{}
+	require.NoError(t, snapshot.Persist(sink))
+
+	restored := kvfsm.New()
+	require.NoError(t, restored.Restore(ioutil.NopCloser(&sink.buf)))
+	b, ok = restored.Get("b")
+	require.True(t, ok)
+	require.Equal(t, "2", b.Value)
+}
+
+type memorySink struct {
+	buf bytes.Buffer
+}
+
+func (t *memorySink) Write(p []byte) (int, error) {
+	return t.buf.Write(p)
+}
+
+func (t *memorySink) Close() error {
+	return nil
+}
+
+func (t *memorySink) ID() string {
+	return "test"
+}
+
+func (t *memorySink) Cancel() error {
+	return nil
+}
+
+var _ raft.SnapshotSink = (*memorySink)(nil)
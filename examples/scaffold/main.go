@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+/**
+Quickstart scaffold generator: writes the bean list with the sample KV FSM,
+properties of the local cluster and the script starting and joining the nodes.
+
+	go run ./examples/scaffold -name demo -dir ./demo -nodes 3
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+type scaffold struct {
+	Name       string
+	Package    string
+	Nodes      []int
+	SerfPort   int
+	RPCPort    int
+	RaftPort   int
+}
+
+var files = map[string]string {
+
+	"beans.go": `package {{.Package}}
+
+import (
+	"github.com/sprintframework/raftmod"
+	"github.com/sprintframework/raftmod/examples/kvfsm"
+	"github.com/sprintframework/raftmod/raftcmd"
+)
+
+// FSM replicated by the raft server, replace with the application state machine
+var FSM = kvfsm.New()
+
+/**
+Beans of the '{{.Name}}' server application, pass them to the sprint application
+ */
+func Beans() []interface{} {
+	beans := append([]interface{}{FSM}, raftmod.RaftServices...)
+	return append(beans, raftcmd.RaftCommands...)
+}
+`,
+
+	"application.properties": `# ports are shifted by the node number on the same host
+serf.bind-address=127.0.0.1:{{.SerfPort}}
+serf-server.rpc-address=127.0.0.1:{{.RPCPort}}
+raft.bind-address=127.0.0.1:{{.RaftPort}}
+raft.autopilot=true
+raft.fsm-instrumentation=true
+raft.state-hash=true
+raft.state-hash-interval=1m
+`,
+
+	"cluster.sh": `#!/bin/sh
+# Local cluster of {{len .Nodes}} '{{.Name}}' nodes, APP is the built application binary
+APP=${APP:-./{{.Name}}}
+
+case "$1" in
+start)
+{{- range .Nodes}}
+	$APP run --node {{.}} > node{{.}}.log 2>&1 &
+	echo $! > node{{.}}.pid
+{{- end}}
+	;;
+join)
+{{- range .Nodes}}{{if .}}
+	$APP --node {{.}} serf join 127.0.0.1:{{$.SerfPort}}
+{{- end}}{{end}}
+	;;
+status)
+	$APP serf members
+	$APP serf fsck
+	;;
+stop)
+{{- range .Nodes}}
+	[ -f node{{.}}.pid ] && kill $(cat node{{.}}.pid) && rm node{{.}}.pid
+{{- end}}
+	;;
+*)
+	echo "Usage: $0 start|join|status|stop"
+	exit 1
+	;;
+esac
+`,
+}
+
+func main() {
+
+	var (
+		name  string
+		dir   string
+		nodes int
+		s     scaffold
+	)
+
+	flag.StringVar(&name, "name", "demo", "application name")
+	flag.StringVar(&dir, "dir", "", "output directory, by default the application name")
+	flag.StringVar(&s.Package, "package", "main", "go package of the generated beans")
+	flag.IntVar(&nodes, "nodes", 3, "number of local nodes")
+	flag.IntVar(&s.SerfPort, "serf-port", 7946, "serf bind port of the first node")
+	flag.IntVar(&s.RPCPort, "rpc-port", 8700, "serf rpc port of the first node")
+	flag.IntVar(&s.RaftPort, "raft-port", 8300, "raft port of the first node")
+	flag.Parse()
+
+	if nodes < 1 {
+		fmt.Fprintln(os.Stderr, "at least one node is required")
+		os.Exit(1)
+	}
+	if dir == "" {
+		dir = name
+	}
+
+	s.Name = name
+	for i := 0; i < nodes; i++ {
+		s.Nodes = append(s.Nodes, i)
+	}
+
+	if err := generate(dir, &s); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Scaffold of '%s' with %d nodes generated in '%s'\n", name, nodes, dir)
+}
+
+func generate(dir string, s *scaffold) error {
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for name, text := range files {
+
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return fmt.Errorf("template '%s', %v", name, err)
+		}
+
+		perm := os.FileMode(0644)
+		if filepath.Ext(name) == ".sh" {
+			perm = 0755
+		}
+
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("file '%s' already exists", path)
+		}
+
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, perm)
+		if err != nil {
+			return err
+		}
+		err = tmpl.Execute(f, s)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("generate '%s', %v", path, err)
+		}
+	}
+
+	return nil
+}
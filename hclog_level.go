@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/go-hclog"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+/**
+Logger dropping messages below the level without changing the level of the shared logger,
+sub-loggers of hclog share the level with the parent
+ */
+type levelLogger struct {
+	hclog.Logger
+	level  hclog.Level
+}
+
+func newLevelLogger(logger hclog.Logger, level hclog.Level) hclog.Logger {
+	return &levelLogger{Logger: logger, level: level}
+}
+
+/**
+Parses 'trace', 'debug', 'info', 'warn', 'error' or 'off'
+ */
+func parseLogLevel(level string) (hclog.Level, error) {
+	l := hclog.LevelFromString(strings.TrimSpace(level))
+	if l == hclog.NoLevel {
+		return l, errors.Errorf("invalid log level '%s', expected 'trace', 'debug', 'info', 'warn', 'error' or 'off'", level)
+	}
+	return l, nil
+}
+
+func (t *levelLogger) Log(level hclog.Level, msg string, args ...interface{}) {
+	if level >= t.level {
+		t.Logger.Log(level, msg, args...)
+	}
+}
+
+func (t *levelLogger) Trace(msg string, args ...interface{}) {
+	t.Log(hclog.Trace, msg, args...)
+}
+
+func (t *levelLogger) Debug(msg string, args ...interface{}) {
+	t.Log(hclog.Debug, msg, args...)
+}
+
+func (t *levelLogger) Info(msg string, args ...interface{}) {
+	t.Log(hclog.Info, msg, args...)
+}
+
+func (t *levelLogger) Warn(msg string, args ...interface{}) {
+	t.Log(hclog.Warn, msg, args...)
+}
+
+func (t *levelLogger) Error(msg string, args ...interface{}) {
+	t.Log(hclog.Error, msg, args...)
+}
+
+func (t *levelLogger) IsTrace() bool {
+	return t.level <= hclog.Trace && t.Logger.IsTrace()
+}
+
+func (t *levelLogger) IsDebug() bool {
+	return t.level <= hclog.Debug && t.Logger.IsDebug()
+}
+
+func (t *levelLogger) IsInfo() bool {
+	return t.level <= hclog.Info && t.Logger.IsInfo()
+}
+
+func (t *levelLogger) IsWarn() bool {
+	return t.level <= hclog.Warn && t.Logger.IsWarn()
+}
+
+func (t *levelLogger) IsError() bool {
+	return t.level <= hclog.Error && t.Logger.IsError()
+}
+
+func (t *levelLogger) GetLevel() hclog.Level {
+	if level := t.Logger.GetLevel(); level > t.level {
+		return level
+	}
+	return t.level
+}
+
+func (t *levelLogger) SetLevel(level hclog.Level) {
+	t.level = level
+}
+
+func (t *levelLogger) With(args ...interface{}) hclog.Logger {
+	return &levelLogger{Logger: t.Logger.With(args...), level: t.level}
+}
+
+func (t *levelLogger) Named(name string) hclog.Logger {
+	return &levelLogger{Logger: t.Logger.Named(name), level: t.level}
+}
+
+func (t *levelLogger) ResetNamed(name string) hclog.Logger {
+	return &levelLogger{Logger: t.Logger.ResetNamed(name), level: t.level}
+}
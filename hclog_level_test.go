@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestLevelLogger(t *testing.T) {
+
+	var buf bytes.Buffer
+	base := hclog.New(&hclog.LoggerOptions{Output: &buf, Level: hclog.Debug})
+
+	level, err := parseLogLevel("warn")
+	require.NoError(t, err)
+	logger := newLevelLogger(base.Named("raft-snapshot"), level)
+
+	logger.Info("hidden")
+	logger.Named("reaper").Debug("hidden")
+	logger.Warn("shown")
+	require.False(t, logger.IsInfo())
+
+	// the shared logger keeps its level
+	base.Debug("application")
+
+	out := buf.String()
+	require.False(t, strings.Contains(out, "hidden"), out)
+	require.True(t, strings.Contains(out, "raft-snapshot: shown"), out)
+	require.True(t, strings.Contains(out, "application"), out)
+
+	_, err = parseLogLevel("loud")
+	require.Error(t, err)
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/raft"
+	"go.uber.org/atomic"
+	"io"
+	"strconv"
+	"time"
+)
+
+/**
+FSM decorator measuring apply latency and throughput, snapshot and restore durations
+ */
+type InstrumentedFSM struct {
+	raft.FSM
+
+	started          time.Time
+	applies          atomic.Uint64
+	applyNanos       atomic.Uint64
+	maxApplyNanos    atomic.Uint64
+	snapshotNanos    atomic.Int64
+	restoreNanos     atomic.Int64
+}
+
+type instrumentedBatchingFSM struct {
+	*InstrumentedFSM
+	batching raft.BatchingFSM
+}
+
+/**
+Wraps the FSM, the result implements raft.BatchingFSM if the delegate does
+ */
+func NewInstrumentedFSM(delegate raft.FSM) (raft.FSM, *InstrumentedFSM) {
+	fsm := &InstrumentedFSM{FSM: delegate, started: time.Now()}
+	if batching, ok := delegate.(raft.BatchingFSM); ok {
+		return &instrumentedBatchingFSM{InstrumentedFSM: fsm, batching: batching}, fsm
+	}
+	return fsm, fsm
+}
+
+func (t *InstrumentedFSM) Apply(log *raft.Log) interface{} {
+	start := time.Now()
+	result := t.FSM.Apply(log)
+	t.record(start, 1)
+	return result
+}
+
+func (t *instrumentedBatchingFSM) ApplyBatch(logs []*raft.Log) []interface{} {
+	start := time.Now()
+	result := t.batching.ApplyBatch(logs)
+	t.record(start, len(logs))
+	return result
+}
+
+func (t *InstrumentedFSM) record(start time.Time, n int) {
+	elapsed := time.Since(start)
+	metrics.MeasureSince([]string{"raft", "fsm", "apply_latency"}, start)
+	t.applies.Add(uint64(n))
+	t.applyNanos.Add(uint64(elapsed))
+	for {
+		max := t.maxApplyNanos.Load()
+		if uint64(elapsed) <= max || t.maxApplyNanos.CompareAndSwap(max, uint64(elapsed)) {
+			break
+		}
+	}
+}
+
+func (t *InstrumentedFSM) Snapshot() (raft.FSMSnapshot, error) {
+	start := time.Now()
+	snapshot, err := t.FSM.Snapshot()
+	metrics.MeasureSince([]string{"raft", "fsm", "snapshot"}, start)
+	t.snapshotNanos.Store(int64(time.Since(start)))
+	return snapshot, err
+}
+
+func (t *InstrumentedFSM) Restore(reader io.ReadCloser) error {
+	start := time.Now()
+	err := t.FSM.Restore(reader)
+	metrics.MeasureSince([]string{"raft", "fsm", "restore"}, start)
+	t.restoreNanos.Store(int64(time.Since(start)))
+	return err
+}
+
+func (t *InstrumentedFSM) GetStats(cb func(name, value string) bool) error {
+	applies := t.applies.Load()
+	var avg time.Duration
+	if applies > 0 {
+		avg = time.Duration(t.applyNanos.Load() / applies)
+	}
+	rate := float64(applies) / time.Since(t.started).Seconds()
+
+	cb("fsm_applies", strconv.FormatUint(applies, 10))
+	cb("fsm_apply_latency_avg", avg.String())
+	cb("fsm_apply_latency_max", time.Duration(t.maxApplyNanos.Load()).String())
+	cb("fsm_apply_rate", strconv.FormatFloat(rate, 'f', 2, 64))
+	cb("fsm_snapshot_duration", time.Duration(t.snapshotNanos.Load()).String())
+	cb("fsm_restore_duration", time.Duration(t.restoreNanos.Load()).String())
+	return nil
+}
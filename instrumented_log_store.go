@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/raft"
+	"go.uber.org/atomic"
+	"strconv"
+	"time"
+)
+
+// approximate bytes of the index, term, type and encoding of the stored entry besides data and extensions
+const logEntryOverhead = 32
+
+/**
+Log store decorator measuring append and read latencies, deletions and the approximate size of retained entries,
+the size is the average size of appended entries multiplied by the number of retained entries
+ */
+type InstrumentedLogStore struct {
+	raft.LogStore
+
+	started          time.Time
+	appends          atomic.Uint64
+	appendedEntries  atomic.Uint64
+	appendedBytes    atomic.Uint64
+	appendNanos      atomic.Uint64
+	maxAppendNanos   atomic.Uint64
+	reads            atomic.Uint64
+	readNanos        atomic.Uint64
+	deletedEntries   atomic.Uint64
+}
+
+func NewInstrumentedLogStore(delegate raft.LogStore) *InstrumentedLogStore {
+	return &InstrumentedLogStore{LogStore: delegate, started: time.Now()}
+}
+
+func (t *InstrumentedLogStore) GetLog(index uint64, log *raft.Log) error {
+	start := time.Now()
+	err := t.LogStore.GetLog(index, log)
+	metrics.MeasureSince([]string{"raft", "logstore", "read"}, start)
+	t.reads.Inc()
+	t.readNanos.Add(uint64(time.Since(start)))
+	return err
+}
+
+func (t *InstrumentedLogStore) StoreLog(log *raft.Log) error {
+	return t.StoreLogs([]*raft.Log{log})
+}
+
+func (t *InstrumentedLogStore) StoreLogs(logs []*raft.Log) error {
+	start := time.Now()
+	err := t.LogStore.StoreLogs(logs)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	metrics.MeasureSince([]string{"raft", "logstore", "append"}, start)
+	metrics.IncrCounter([]string{"raft", "logstore", "appended_entries"}, float32(len(logs)))
+
+	var size uint64
+	for _, log := range logs {
+		size += uint64(len(log.Data) + len(log.Extensions) + logEntryOverhead)
+	}
+	t.appends.Inc()
+	t.appendedEntries.Add(uint64(len(logs)))
+	t.appendedBytes.Add(size)
+	t.appendNanos.Add(uint64(elapsed))
+	for {
+		max := t.maxAppendNanos.Load()
+		if uint64(elapsed) <= max || t.maxAppendNanos.CompareAndSwap(max, uint64(elapsed)) {
+			break
+		}
+	}
+	return nil
+}
+
+func (t *InstrumentedLogStore) DeleteRange(min, max uint64) error {
+	start := time.Now()
+	if err := t.LogStore.DeleteRange(min, max); err != nil {
+		return err
+	}
+	metrics.MeasureSince([]string{"raft", "logstore", "delete"}, start)
+	if max >= min {
+		metrics.IncrCounter([]string{"raft", "logstore", "deleted_entries"}, float32(max - min + 1))
+		t.deletedEntries.Add(max - min + 1)
+	}
+	if size, ok := t.sizeEstimate(); ok {
+		metrics.SetGauge([]string{"raft", "logstore", "size_estimate"}, float32(size))
+	}
+	return nil
+}
+
+func (t *InstrumentedLogStore) IsMonotonic() bool {
+	if m, ok := t.LogStore.(raft.MonotonicLogStore); ok {
+		return m.IsMonotonic()
+	}
+	return false
+}
+
+func (t *InstrumentedLogStore) sizeEstimate() (uint64, bool) {
+	entries := t.appendedEntries.Load()
+	if entries == 0 {
+		return 0, false
+	}
+	first, err := t.LogStore.FirstIndex()
+	if err != nil {
+		return 0, false
+	}
+	last, err := t.LogStore.LastIndex()
+	if err != nil {
+		return 0, false
+	}
+	if last == 0 || last < first {
+		// all entries are compacted
+		return 0, true
+	}
+	return (last - first + 1) * (t.appendedBytes.Load() / entries), true
+}
+
+func (t *InstrumentedLogStore) GetStats(cb func(name, value string) bool) error {
+	if first, err := t.LogStore.FirstIndex(); err == nil {
+		cb("log_store_first_index", strconv.FormatUint(first, 10))
+	}
+	if last, err := t.LogStore.LastIndex(); err == nil {
+		cb("log_store_last_index", strconv.FormatUint(last, 10))
+	}
+
+	appends := t.appends.Load()
+	var appendAvg time.Duration
+	if appends > 0 {
+		appendAvg = time.Duration(t.appendNanos.Load() / appends)
+	}
+	reads := t.reads.Load()
+	var readAvg time.Duration
+	if reads > 0 {
+		readAvg = time.Duration(t.readNanos.Load() / reads)
+	}
+	deleted := t.deletedEntries.Load()
+	deleteRate := float64(deleted) / time.Since(t.started).Seconds()
+
+	cb("log_store_appended_entries", strconv.FormatUint(t.appendedEntries.Load(), 10))
+	cb("log_store_append_latency_avg", appendAvg.String())
+	cb("log_store_append_latency_max", time.Duration(t.maxAppendNanos.Load()).String())
+	cb("log_store_reads", strconv.FormatUint(reads, 10))
+	cb("log_store_read_latency_avg", readAvg.String())
+	cb("log_store_deleted_entries", strconv.FormatUint(deleted, 10))
+	cb("log_store_delete_rate", strconv.FormatFloat(deleteRate, 'f', 2, 64))
+	if size, ok := t.sizeEstimate(); ok {
+		cb("log_store_size_estimate", strconv.FormatUint(size, 10))
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestInstrumentedLogStore(t *testing.T) {
+
+	store := NewInstrumentedLogStore(raft.NewInmemStore())
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, &raft.Log{Index: i, Term: 1, Type: raft.LogCommand, Data: bytes.Repeat([]byte("x"), 68)})
+	}
+	require.NoError(t, store.StoreLogs(logs))
+
+	var log raft.Log
+	require.NoError(t, store.GetLog(5, &log))
+	require.NoError(t, store.DeleteRange(1, 4))
+
+	stats := make(map[string]string)
+	require.NoError(t, store.GetStats(func(name, value string) bool {
+		stats[name] = value
+		return true
+	}))
+	require.Equal(t, "5", stats["log_store_first_index"])
+	require.Equal(t, "10", stats["log_store_last_index"])
+	require.Equal(t, "10", stats["log_store_appended_entries"])
+	require.Equal(t, "1", stats["log_store_reads"])
+	require.Equal(t, "4", stats["log_store_deleted_entries"])
+	// 6 entries of 68 bytes and the overhead
+	require.Equal(t, "600", stats["log_store_size_estimate"])
+}
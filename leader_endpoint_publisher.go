@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/sprintframework/raftapi"
+	"github.com/sprintframework/sprint"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// RaftLeaderTag is set by the leader to its API endpoint for leader-aware proxies
+const RaftLeaderTag = "raft-leader"
+
+/**
+Advertises API endpoint of the current leader for L7 proxies:
+the leader sets serf tag 'raft-leader' with the endpoint and every node optionally serves
+Envoy REST xDS endpoint discovery on 'raft.leader-xds.bind-address' by '/v3/discovery:endpoints',
+so writes are routed to the leader cluster by the proxy.
+ */
+type implLeaderEndpointPublisher struct {
+
+	Log             *zap.Logger             `inject`
+	Application     sprint.Application      `inject`
+	SerfServer      raftapi.SerfServer      `inject:"optional"`
+	RaftClientPool  raftapi.RaftClientPool  `inject:"optional"`
+
+	LeaderTag       bool    `value:"raft.leader-tag,default=true"`
+	XDSAddress      string  `value:"raft.leader-xds.bind-address,default="`
+	XDSCluster      string  `value:"raft.leader-xds.cluster,default="`
+
+	mutex      sync.RWMutex
+	endpoint   string
+	version    uint64
+
+	server     *http.Server
+}
+
+func LeaderEndpointPublisher() LeaderChangePublisher {
+	return &implLeaderEndpointPublisher{}
+}
+
+func (t *implLeaderEndpointPublisher) PostConstruct() error {
+	if t.XDSCluster == "" {
+		t.XDSCluster = t.Application.Name() + "-leader"
+	}
+	if t.XDSAddress == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", t.XDSAddress)
+	if err != nil {
+		return errors.Errorf("bind property 'raft.leader-xds.bind-address' '%s', %v", t.XDSAddress, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/discovery:endpoints", t.serveEndpoints)
+	t.server = &http.Server{Handler: mux}
+
+	go func() {
+		if err := t.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			t.Log.Error("LeaderXDSServe", zap.String("addr", t.XDSAddress), zap.Error(err))
+		}
+	}()
+
+	t.Log.Info("LeaderXDSServe", zap.String("addr", listener.Addr().String()), zap.String("cluster", t.XDSCluster))
+	return nil
+}
+
+func (t *implLeaderEndpointPublisher) Destroy() error {
+	if t.server != nil {
+		return t.server.Close()
+	}
+	return nil
+}
+
+func (t *implLeaderEndpointPublisher) PublishLeaderChange(change *LeaderChange) error {
+
+	var endpoint string
+	if change.LeaderAddress != "" && t.RaftClientPool != nil {
+		if resolver, ok := t.RaftClientPool.(interface{ GetAPIEndpoint(string) (string, error) }); ok {
+			var err error
+			if endpoint, err = resolver.GetAPIEndpoint(change.LeaderAddress); err != nil {
+				return errors.Errorf("leader api endpoint of '%s', %v", change.LeaderAddress, err)
+			}
+		}
+	}
+
+	t.mutex.Lock()
+	t.endpoint = endpoint
+	t.version++
+	t.mutex.Unlock()
+
+	if t.LeaderTag {
+		return t.updateTag(change.Local, endpoint)
+	}
+	return nil
+}
+
+func (t *implLeaderEndpointPublisher) updateTag(local bool, endpoint string) error {
+	if t.SerfServer == nil {
+		return nil
+	}
+	a, ok := t.SerfServer.Agent()
+	if !ok || a == nil || a.Serf() == nil {
+		return nil
+	}
+
+	current := a.Serf().LocalMember().Tags
+	value, present := current[RaftLeaderTag]
+	if local && present && value == endpoint || !local && !present {
+		return nil
+	}
+
+	tags := make(map[string]string, len(current) + 1)
+	for k, v := range current {
+		tags[k] = v
+	}
+	if local && endpoint != "" {
+		tags[RaftLeaderTag] = endpoint
+	} else {
+		delete(tags, RaftLeaderTag)
+	}
+	return a.SetTags(tags)
+}
+
+type xdsSocketAddress struct {
+	Address    string  `json:"address"`
+	PortValue  int     `json:"port_value"`
+}
+
+type xdsLbEndpoint struct {
+	Endpoint struct {
+		Address struct {
+			SocketAddress xdsSocketAddress `json:"socket_address"`
+		} `json:"address"`
+	} `json:"endpoint"`
+}
+
+type xdsLocalityEndpoints struct {
+	LbEndpoints []*xdsLbEndpoint `json:"lb_endpoints"`
+}
+
+type xdsClusterLoadAssignment struct {
+	Type         string                   `json:"@type"`
+	ClusterName  string                   `json:"cluster_name"`
+	Endpoints    []*xdsLocalityEndpoints  `json:"endpoints"`
+}
+
+type xdsDiscoveryResponse struct {
+	VersionInfo  string                       `json:"version_info"`
+	TypeURL      string                       `json:"type_url"`
+	Resources    []*xdsClusterLoadAssignment  `json:"resources"`
+}
+
+const xdsEndpointType = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+
+func (t *implLeaderEndpointPublisher) serveEndpoints(w http.ResponseWriter, r *http.Request) {
+
+	t.mutex.RLock()
+	endpoint, version := t.endpoint, t.version
+	t.mutex.RUnlock()
+
+	cla := &xdsClusterLoadAssignment{
+		Type:        xdsEndpointType,
+		ClusterName: t.XDSCluster,
+		Endpoints:   []*xdsLocalityEndpoints{{}},
+	}
+
+	if host, portStr, err := net.SplitHostPort(endpoint); err == nil {
+		if port, err := strconv.Atoi(portStr); err == nil {
+			ep := new(xdsLbEndpoint)
+			ep.Endpoint.Address.SocketAddress = xdsSocketAddress{Address: host, PortValue: port}
+			cla.Endpoints[0].LbEndpoints = append(cla.Endpoints[0].LbEndpoints, ep)
+		}
+	}
+
+	resp := &xdsDiscoveryResponse{
+		VersionInfo: strconv.FormatUint(version, 10),
+		TypeURL:     xdsEndpointType,
+		Resources:   []*xdsClusterLoadAssignment{cla},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		t.Log.Error("LeaderXDSResponse", zap.Error(err))
+	}
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+/**
+Executes the command with LeaderChange fields in the environment, for example 'update-lb.sh --leader {{.LeaderAddress}}'
+gets RAFT_LEADER_ID, RAFT_LEADER_ADDRESS, RAFT_NODE_ID and RAFT_LEADER_LOCAL.
+The command is split by spaces outside of the template actions, then every argument is rendered by text/template
+with LeaderChange, so a rendered value stays the single argument and the command runs without shell.
+ */
+type implLeaderExecPublisher struct {
+
+	Log       *zap.Logger     `inject`
+
+	Command   string          `value:"raft.leader-hook.exec,default="`
+	Timeout   time.Duration   `value:"raft.leader-hook.timeout,default=30s"`
+
+	argv      []*template.Template
+}
+
+func LeaderExecPublisher() LeaderChangePublisher {
+	return &implLeaderExecPublisher{}
+}
+
+func (t *implLeaderExecPublisher) PostConstruct() error {
+	args, err := splitCommand(t.Command)
+	if err != nil {
+		return errors.Errorf("issue in property 'raft.leader-hook.exec', %v", err)
+	}
+	for i, arg := range args {
+		tmpl, err := template.New(strconv.Itoa(i)).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return errors.Errorf("issue in property 'raft.leader-hook.exec', %v", err)
+		}
+		t.argv = append(t.argv, tmpl)
+	}
+	return nil
+}
+
+/**
+Splits the command by spaces, the spaces inside of the template actions do not split the argument
+ */
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	depth := 0
+	for i := 0; i < len(command); i++ {
+		switch {
+		case strings.HasPrefix(command[i:], "{{"):
+			depth++
+			arg.WriteString("{{")
+			i++
+		case depth > 0 && strings.HasPrefix(command[i:], "}}"):
+			depth--
+			arg.WriteString("}}")
+			i++
+		case depth == 0 && (command[i] == ' ' || command[i] == '\t'):
+			if arg.Len() > 0 {
+				args = append(args, arg.String())
+				arg.Reset()
+			}
+		default:
+			arg.WriteByte(command[i])
+		}
+	}
+	if depth > 0 {
+		return nil, errors.Errorf("unclosed template action in '%s'", command)
+	}
+	if arg.Len() > 0 {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+func leaderChangeEnv(change *LeaderChange) []string {
+	return []string{
+		"RAFT_LEADER_ID=" + change.LeaderID,
+		"RAFT_LEADER_ADDRESS=" + change.LeaderAddress,
+		"RAFT_NODE_ID=" + change.NodeID,
+		"RAFT_LEADER_LOCAL=" + strconv.FormatBool(change.Local),
+	}
+}
+
+func (t *implLeaderExecPublisher) PublishLeaderChange(change *LeaderChange) error {
+	if len(t.argv) == 0 {
+		return nil
+	}
+
+	argv := make([]string, len(t.argv))
+	for i, tmpl := range t.argv {
+		var arg strings.Builder
+		if err := tmpl.Execute(&arg, change); err != nil {
+			return errors.Errorf("leader hook '%s', %v", t.Command, err)
+		}
+		argv[i] = arg.String()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), leaderChangeEnv(change)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Errorf("leader hook '%s' failed, %v, output: %s", t.Command, err, string(out))
+	}
+
+	t.Log.Info("LeaderHookExec", zap.String("cmd", t.Command), zap.String("leaderId", change.LeaderID), zap.String("output", string(out)))
+	return nil
+}
+
+/**
+Posts LeaderChange in JSON to the webhook URL
+ */
+type implLeaderWebhookPublisher struct {
+
+	URL       string          `value:"raft.leader-hook.url,default="`
+	Timeout   time.Duration   `value:"raft.leader-hook.timeout,default=30s"`
+
+	client    *http.Client
+}
+
+func LeaderWebhookPublisher() LeaderChangePublisher {
+	return &implLeaderWebhookPublisher{}
+}
+
+func (t *implLeaderWebhookPublisher) PostConstruct() error {
+	t.client = &http.Client{Timeout: t.Timeout}
+	return nil
+}
+
+func (t *implLeaderWebhookPublisher) PublishLeaderChange(change *LeaderChange) error {
+	if t.URL == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Post(t.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Errorf("leader webhook '%s', %v", t.URL, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("leader webhook '%s' returned status %s", t.URL, resp.Status)
+	}
+	return nil
+}
+
+/**
+Updates DNS record with the leader IP by the DNSProvider bean, only the new leader updates the record
+ */
+type implLeaderDNSPublisher struct {
+
+	DNSProvider  DNSProvider   `inject:"optional"`
+
+	RecordName   string        `value:"raft.leader-hook.dns-name,default="`
+}
+
+func LeaderDNSPublisher() LeaderChangePublisher {
+	return &implLeaderDNSPublisher{}
+}
+
+func (t *implLeaderDNSPublisher) PostConstruct() error {
+	if t.RecordName != "" && t.DNSProvider == nil {
+		return errors.New("property 'raft.leader-hook.dns-name' requires DNSProvider bean")
+	}
+	return nil
+}
+
+func (t *implLeaderDNSPublisher) PublishLeaderChange(change *LeaderChange) error {
+	if t.RecordName == "" || !change.Local {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(change.LeaderAddress)
+	if err != nil {
+		return errors.Errorf("invalid leader address '%s', %v", change.LeaderAddress, err)
+	}
+	return t.DNSProvider.UpdateRecord(t.RecordName, host)
+}
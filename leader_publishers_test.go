@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLeaderExecPublisher(t *testing.T) {
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "hook.sh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\nprintf '%s' \"$RAFT_LEADER_ADDRESS\" > \"$1\"\n"), 0700))
+	out := filepath.Join(dir, "out")
+
+	p := &implLeaderExecPublisher{Log: zap.NewNop(), Command: script + " " + out, Timeout: 10 * time.Second}
+	require.NoError(t, p.PostConstruct())
+
+	address := "10.0.0.1:8300; touch " + filepath.Join(dir, "pwned")
+	require.NoError(t, p.PublishLeaderChange(&LeaderChange{LeaderID: "n1", LeaderAddress: address}))
+
+	content, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, address, string(content))
+
+	_, err = os.Stat(filepath.Join(dir, "pwned"))
+	require.True(t, os.IsNotExist(err))
+
+	// rendered value is the single argument even with spaces and shell syntax
+	p = &implLeaderExecPublisher{Log: zap.NewNop(), Command: script + " " + out + "-{{ .LeaderID }} --leader={{ .LeaderAddress }}", Timeout: 10 * time.Second}
+	require.NoError(t, p.PostConstruct())
+	require.Equal(t, 3, len(p.argv))
+	require.NoError(t, p.PublishLeaderChange(&LeaderChange{LeaderID: "n1", LeaderAddress: address}))
+
+	content, err = os.ReadFile(out + "-n1")
+	require.NoError(t, err)
+	require.Equal(t, address, string(content))
+
+	_, err = os.Stat(filepath.Join(dir, "pwned"))
+	require.True(t, os.IsNotExist(err))
+
+	p = &implLeaderExecPublisher{Log: zap.NewNop(), Command: "update-lb.sh {{.LeaderAddress"}
+	require.Error(t, p.PostConstruct())
+	p = &implLeaderExecPublisher{Log: zap.NewNop(), Command: "update-lb.sh {{.Unknown}}", Timeout: time.Second}
+	require.NoError(t, p.PostConstruct())
+	require.Error(t, p.PublishLeaderChange(&LeaderChange{LeaderID: "n1"}))
+}
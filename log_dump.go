@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"encoding/json"
+	"github.com/hashicorp/go-msgpack/codec"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"io"
+	"time"
+)
+
+const (
+	LogDumpJSON    = "json"
+	LogDumpMsgpack = "msgpack"
+)
+
+/**
+Exported log entry, data of commands is decoded by the LogEntryDecoder of the FSM and configurations by raft
+ */
+type LogDumpEntry struct {
+	Index        uint64       `json:"index" codec:"index"`
+	Term         uint64       `json:"term" codec:"term"`
+	Type         string       `json:"type" codec:"type"`
+	AppendedAt   time.Time    `json:"appended_at,omitempty" codec:"appended_at,omitempty"`
+	Data         []byte       `json:"data,omitempty" codec:"data,omitempty"`
+	Extensions   []byte       `json:"extensions,omitempty" codec:"extensions,omitempty"`
+	Decoded      interface{}  `json:"decoded,omitempty" codec:"decoded,omitempty"`
+	DecodeError  string       `json:"decode_error,omitempty" codec:"decode_error,omitempty"`
+}
+
+/**
+Writes entries of the index range to the writer in the format, JSON as one object per line and msgpack as the stream
+of objects. Zero bounds are the first and the last index of the store. Entries of encrypted stores are exported
+as stored unless the store decrypts them. Returns the number of exported entries.
+ */
+func DumpLog(store raft.LogStore, from, to uint64, format string, decoder LogEntryDecoder, w io.Writer) (int, error) {
+
+	var encode func(interface{}) error
+	switch format {
+	case LogDumpJSON:
+		encode = json.NewEncoder(w).Encode
+	case LogDumpMsgpack:
+		encode = codec.NewEncoder(w, &codec.MsgpackHandle{}).Encode
+	default:
+		return 0, errors.Errorf("unknown format '%s', expected '%s' or '%s'", format, LogDumpJSON, LogDumpMsgpack)
+	}
+
+	first, err := store.FirstIndex()
+	if err != nil {
+		return 0, errors.Errorf("first index, %v", err)
+	}
+	last, err := store.LastIndex()
+	if err != nil {
+		return 0, errors.Errorf("last index, %v", err)
+	}
+	if from == 0 || from < first {
+		from = first
+	}
+	if to == 0 || to > last {
+		to = last
+	}
+	if last == 0 || from > to {
+		return 0, nil
+	}
+
+	n := 0
+	for index := from; index <= to; index++ {
+		var log raft.Log
+		if err := store.GetLog(index, &log); err != nil {
+			return n, errors.Errorf("get log %d, %v", index, err)
+		}
+		if err := encode(newLogDumpEntry(&log, decoder)); err != nil {
+			return n, errors.Errorf("encode log %d, %v", index, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+func newLogDumpEntry(log *raft.Log, decoder LogEntryDecoder) *LogDumpEntry {
+
+	entry := &LogDumpEntry{
+		Index:      log.Index,
+		Term:       log.Term,
+		Type:       log.Type.String(),
+		AppendedAt: log.AppendedAt,
+		Data:       log.Data,
+		Extensions: log.Extensions,
+	}
+
+	var err error
+	switch log.Type {
+	case raft.LogCommand:
+		if decoder != nil && len(log.Data) > 0 {
+			entry.Decoded, err = decoder.DecodeLogEntry(log.Data)
+		}
+	case raft.LogConfiguration:
+		entry.Decoded, err = decodeConfiguration(log.Data)
+	}
+	if err != nil {
+		entry.Decoded = nil
+		entry.DecodeError = err.Error()
+	} else if entry.Decoded != nil {
+		entry.Data = nil
+	}
+	return entry
+}
+
+func decodeConfiguration(data []byte) (configuration raft.Configuration, err error) {
+	// raft panics on the invalid configuration
+	defer panicToError(&err)
+	return raft.DecodeConfiguration(data), nil
+}
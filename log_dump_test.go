@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/hashicorp/go-msgpack/codec"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type upperDecoder struct{}
+
+func (upperDecoder) DecodeLogEntry(data []byte) (interface{}, error) {
+	if string(data) == "bad" {
+		return nil, errors.New("bad command")
+	}
+	return map[string]string{"command": string(bytes.ToUpper(data))}, nil
+}
+
+func TestDumpLog(t *testing.T) {
+
+	store := raft.NewInmemStore()
+	conf := raft.Configuration{Servers: []raft.Server{{Suffrage: raft.Voter, ID: "node-1", Address: "127.0.0.1:8300"}}}
+	require.NoError(t, store.StoreLogs([]*raft.Log{
+		{Index: 1, Term: 1, Type: raft.LogConfiguration, Data: raft.EncodeConfiguration(conf)},
+		{Index: 2, Term: 1, Type: raft.LogCommand, Data: []byte("put")},
+		{Index: 3, Term: 2, Type: raft.LogCommand, Data: []byte("bad")},
+		{Index: 4, Term: 2, Type: raft.LogNoop},
+	}))
+
+	var out bytes.Buffer
+	n, err := DumpLog(store, 0, 0, LogDumpJSON, upperDecoder{}, &out)
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+
+	var entries []map[string]interface{}
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 4)
+	require.Equal(t, "LogConfiguration", entries[0]["type"])
+	require.Contains(t, entries[0]["decoded"], "Servers")
+	require.Equal(t, map[string]interface{}{"command": "PUT"}, entries[1]["decoded"])
+	require.Nil(t, entries[1]["data"])
+	require.Equal(t, "bad command", entries[2]["decode_error"])
+	require.NotNil(t, entries[2]["data"])
+
+	out.Reset()
+	n, err = DumpLog(store, 2, 3, LogDumpMsgpack, nil, &out)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	dec := codec.NewDecoder(&out, &codec.MsgpackHandle{})
+	var entry LogDumpEntry
+	require.NoError(t, dec.Decode(&entry))
+	require.Equal(t, uint64(2), entry.Index)
+	require.Equal(t, "put", string(entry.Data))
+
+	_, err = DumpLog(store, 0, 0, "xml", nil, &out)
+	require.Error(t, err)
+}
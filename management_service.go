@@ -0,0 +1,557 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"github.com/sprintframework/raftapi"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"strings"
+)
+
+const (
+	ManagementServiceName = "raftmod.Management"
+
+	// trailer with API endpoint of the leader returned by leader-only methods on followers
+	LeaderEndpointTrailer = "raft-leader"
+
+	// content subtype of the management service messages
+	ManagementCodec = "json"
+)
+
+/**
+Management service messages are plain Go structs encoded in JSON, clients call with grpc.CallContentSubtype(ManagementCodec)
+ */
+type jsonCodec struct {
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return ManagementCodec
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+/**
+Subscription on cluster events, empty types mean all events.
+Resume token of the last received event continues the stream after reconnect.
+ */
+type SubscribeRequest struct {
+	Types        []ClusterEventType  `json:"types,omitempty"`
+	ResumeToken  string              `json:"resumeToken,omitempty"`
+}
+
+type SubscribeEvent struct {
+	Token   string         `json:"token"`
+	Event   *ClusterEvent  `json:"event"`
+}
+
+type LeaderRequest struct {
+}
+
+type LeaderInfo struct {
+	ID        string  `json:"id,omitempty"`
+	Address   string  `json:"address,omitempty"`
+	Endpoint  string  `json:"endpoint,omitempty"`
+	Local     bool    `json:"local"`
+}
+
+type StatsRequest struct {
+}
+
+type StatsResponse struct {
+	Stats  map[string]string  `json:"stats"`
+}
+
+type HealthRequest struct {
+	ID  string  `json:"id"`
+}
+
+type SnapshotRequest struct {
+}
+
+type RemoveServerRequest struct {
+	ID  string  `json:"id"`
+}
+
+type RemoveServerResponse struct {
+	Index  uint64  `json:"index"`
+}
+
+type ScrubRequest struct {
+}
+
+type ScrubResponse struct {
+}
+
+/**
+Empty id clears the whole quarantine of the node
+ */
+type ClearQuarantineRequest struct {
+	ID  string  `json:"id,omitempty"`
+}
+
+type ClearQuarantineResponse struct {
+	Removed  int  `json:"removed"`
+}
+
+type ReplaceRequest struct {
+	Old  string  `json:"old"`
+	New  string  `json:"new"`
+}
+
+/**
+Management gRPC service of the raft node
+ */
+type ManagementServer interface {
+
+	Leader(ctx context.Context, req *LeaderRequest) (*LeaderInfo, error)
+
+	Stats(ctx context.Context, req *StatsRequest) (*StatsResponse, error)
+
+	Health(ctx context.Context, req *HealthRequest) (*NodeHealth, error)
+
+	Snapshot(ctx context.Context, req *SnapshotRequest) (*SnapshotInfo, error)
+
+	/**
+	Leader-only, followers return FailedPrecondition with the leader endpoint in the trailer
+	 */
+	RemoveServer(ctx context.Context, req *RemoveServerRequest) (*RemoveServerResponse, error)
+
+	/**
+	Starts the log scrub of the node in the background, results are reported in the node log
+	 */
+	Scrub(ctx context.Context, req *ScrubRequest) (*ScrubResponse, error)
+
+	ClearQuarantine(ctx context.Context, req *ClearQuarantineRequest) (*ClearQuarantineResponse, error)
+
+	/**
+	Leader-only, starts or resumes the server replacement, followers return FailedPrecondition with the leader endpoint in the trailer
+	 */
+	ReplaceServer(ctx context.Context, req *ReplaceRequest) (*ReplaceOperation, error)
+
+	Subscribe(req *SubscribeRequest, stream grpc.ServerStream) error
+
+}
+
+type implManagementService struct {
+
+	Log             *zap.Logger             `inject`
+	EventBus        ClusterEventPublisher   `inject`
+	RaftServer      raftapi.RaftServer      `inject:"optional"`
+	RaftClientPool  raftapi.RaftClientPool  `inject:"optional"`
+
+	/**
+	gRPC server of the application, the management service is registered on it
+	 */
+	GrpcServer      *grpc.Server            `inject:"optional"`
+
+	Buffer    int     `value:"raft.management.subscribe-buffer,default=256"`
+
+	/**
+	Bearer token required in 'authorization' metadata, the service is not registered without it
+	 */
+	Token     string  `value:"raft.management.token,default="`
+
+	/**
+	Registers the service without the token, any client reaching the gRPC port manages the cluster
+	 */
+	Insecure  bool    `value:"raft.management.insecure,default=false"`
+
+	/**
+	Bearer token accepted only by the read-only methods Leader, Stats, Health and Subscribe, empty disables it
+	 */
+	ReadToken  string  `value:"raft.management.read-token,default="`
+}
+
+/**
+Management gRPC service, it is not in RaftServices and must be added to the application beans explicitly
+together with 'raft.management.token'
+ */
+func ManagementService() ManagementServer {
+	return &implManagementService{}
+}
+
+func (t *implManagementService) BeanName() string {
+	return "raft-management"
+}
+
+func (t *implManagementService) PostConstruct() error {
+	if t.GrpcServer == nil {
+		t.Log.Warn("ManagementServiceNotRegistered", zap.String("reason", "no gRPC server"))
+		return nil
+	}
+	if t.Token == "" {
+		if !t.Insecure {
+			return errors.New("empty property 'raft.management.token', set it or opt in to the unauthenticated management by 'raft.management.insecure=true'")
+		}
+		t.Log.Warn("ManagementServiceInsecure", zap.String("reason", "empty 'raft.management.token'"))
+	}
+	RegisterManagementService(t.GrpcServer, t)
+	return nil
+}
+
+/**
+Registers the management service in the application gRPC server
+ */
+func RegisterManagementService(server grpc.ServiceRegistrar, svc ManagementServer) {
+	server.RegisterService(&ManagementServiceDesc, svc)
+}
+
+func unaryHandler(method string, newReq func() interface{}, call func(srv ManagementServer, ctx context.Context, req interface{}) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newReq()
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(ManagementServer), ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ManagementServiceName + "/" + method}
+			return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(ManagementServer), ctx, req)
+			})
+		},
+	}
+}
+
+var ManagementServiceDesc = grpc.ServiceDesc{
+	ServiceName: ManagementServiceName,
+	HandlerType: (*ManagementServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryHandler("Leader", func() interface{} { return new(LeaderRequest) }, func(srv ManagementServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.Leader(ctx, req.(*LeaderRequest))
+		}),
+		unaryHandler("Stats", func() interface{} { return new(StatsRequest) }, func(srv ManagementServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.Stats(ctx, req.(*StatsRequest))
+		}),
+		unaryHandler("Health", func() interface{} { return new(HealthRequest) }, func(srv ManagementServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.Health(ctx, req.(*HealthRequest))
+		}),
+		unaryHandler("Snapshot", func() interface{} { return new(SnapshotRequest) }, func(srv ManagementServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.Snapshot(ctx, req.(*SnapshotRequest))
+		}),
+		unaryHandler("RemoveServer", func() interface{} { return new(RemoveServerRequest) }, func(srv ManagementServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.RemoveServer(ctx, req.(*RemoveServerRequest))
+		}),
+		unaryHandler("Scrub", func() interface{} { return new(ScrubRequest) }, func(srv ManagementServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.Scrub(ctx, req.(*ScrubRequest))
+		}),
+		unaryHandler("ClearQuarantine", func() interface{} { return new(ClearQuarantineRequest) }, func(srv ManagementServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.ClearQuarantine(ctx, req.(*ClearQuarantineRequest))
+		}),
+		unaryHandler("ReplaceServer", func() interface{} { return new(ReplaceRequest) }, func(srv ManagementServer, ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.ReplaceServer(ctx, req.(*ReplaceRequest))
+		}),
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       subscribeHandler,
+			ServerStreams: true,
+		},
+	},
+}
+
+func subscribeHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := new(SubscribeRequest)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(ManagementServer).Subscribe(req, stream)
+}
+
+/**
+Accepts the management token for every method and the read token for the read-only ones
+ */
+func (t *implManagementService) authorize(ctx context.Context, write bool) error {
+	// empty token passes PostConstruct only with 'raft.management.insecure'
+	if t.Token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		token := strings.TrimPrefix(value, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			return nil
+		}
+		if t.ReadToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t.ReadToken)) == 1 {
+			if write {
+				return status.Error(codes.PermissionDenied, "read token is not accepted by the mutating method")
+			}
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid or missing management token")
+}
+
+func (t *implManagementService) raftServer() (*implRaftServer, error) {
+	srv, ok := t.RaftServer.(*implRaftServer)
+	if !ok || !srv.Alive() {
+		return nil, status.Error(codes.Unavailable, "raft server is not running")
+	}
+	return srv, nil
+}
+
+func (t *implManagementService) leaderEndpoint(address string) string {
+	if address == "" || t.RaftClientPool == nil {
+		return ""
+	}
+	if resolver, ok := t.RaftClientPool.(interface{ GetAPIEndpoint(string) (string, error) }); ok {
+		if endpoint, err := resolver.GetAPIEndpoint(address); err == nil {
+			return endpoint
+		}
+	}
+	return ""
+}
+
+func (t *implManagementService) Leader(ctx context.Context, req *LeaderRequest) (*LeaderInfo, error) {
+	if err := t.authorize(ctx, false); err != nil {
+		return nil, err
+	}
+	srv, err := t.raftServer()
+	if err != nil {
+		return nil, err
+	}
+	info := &LeaderInfo{
+		ID:      string(srv.LeaderID()),
+		Address: string(srv.LeaderAddress()),
+		Local:   srv.IsLeader(),
+	}
+	info.Endpoint = t.leaderEndpoint(info.Address)
+	return info, nil
+}
+
+func (t *implManagementService) Stats(ctx context.Context, req *StatsRequest) (*StatsResponse, error) {
+	if err := t.authorize(ctx, false); err != nil {
+		return nil, err
+	}
+	srv, err := t.raftServer()
+	if err != nil {
+		return nil, err
+	}
+	resp := &StatsResponse{Stats: make(map[string]string)}
+	err = srv.GetStats(func(name, value string) bool {
+		resp.Stats[name] = value
+		return true
+	})
+	return resp, err
+}
+
+func (t *implManagementService) Health(ctx context.Context, req *HealthRequest) (*NodeHealth, error) {
+	if err := t.authorize(ctx, false); err != nil {
+		return nil, err
+	}
+	srv, err := t.raftServer()
+	if err != nil {
+		return nil, err
+	}
+	return srv.NodeHealth(req.ID)
+}
+
+func (t *implManagementService) Snapshot(ctx context.Context, req *SnapshotRequest) (*SnapshotInfo, error) {
+	if err := t.authorize(ctx, true); err != nil {
+		return nil, err
+	}
+	srv, err := t.raftServer()
+	if err != nil {
+		return nil, err
+	}
+	meta, err := srv.Snapshot()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &SnapshotInfo{ID: meta.ID, Index: meta.Index, Term: meta.Term, Size: meta.Size}, nil
+}
+
+func (t *implManagementService) RemoveServer(ctx context.Context, req *RemoveServerRequest) (*RemoveServerResponse, error) {
+	if err := t.authorize(ctx, true); err != nil {
+		return nil, err
+	}
+	srv, err := t.raftServer()
+	if err != nil {
+		return nil, err
+	}
+	if !srv.IsLeader() {
+		return nil, t.notLeader(ctx, srv)
+	}
+	future := srv.raft.RemoveServer(raft.ServerID(req.ID), 0, srv.Timeout)
+	if err := future.Error(); err != nil {
+		return nil, status.Errorf(codes.Internal, "remove server '%s', %v", req.ID, err)
+	}
+	t.Log.Info("ManagementRemoveServer", zap.String("id", req.ID), zap.Uint64("index", future.Index()))
+	return &RemoveServerResponse{Index: future.Index()}, nil
+}
+
+// returns FailedPrecondition with the leader endpoint in the trailer
+func (t *implManagementService) notLeader(ctx context.Context, srv *implRaftServer) error {
+	if endpoint := t.leaderEndpoint(string(srv.LeaderAddress())); endpoint != "" {
+		grpc.SetTrailer(ctx, metadata.Pairs(LeaderEndpointTrailer, endpoint))
+	}
+	return status.Error(codes.FailedPrecondition, "not leader")
+}
+
+func (t *implManagementService) Scrub(ctx context.Context, req *ScrubRequest) (*ScrubResponse, error) {
+	if err := t.authorize(ctx, true); err != nil {
+		return nil, err
+	}
+	srv, err := t.raftServer()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := srv.LogStore.(LogScrubber); !ok {
+		return nil, status.Error(codes.FailedPrecondition, "log store does not support checksums, enable 'raft-storage.log-checksum'")
+	}
+	if srv.scrubbing.Load() {
+		return nil, status.Error(codes.AlreadyExists, "log scrub is already in progress")
+	}
+	go srv.ScrubLog()
+	t.Log.Info("ManagementScrub")
+	return &ScrubResponse{}, nil
+}
+
+func (t *implManagementService) ClearQuarantine(ctx context.Context, req *ClearQuarantineRequest) (*ClearQuarantineResponse, error) {
+	if err := t.authorize(ctx, true); err != nil {
+		return nil, err
+	}
+	srv, err := t.raftServer()
+	if err != nil {
+		return nil, err
+	}
+	removed := srv.quarantine.Clear(req.ID)
+	t.Log.Info("ManagementClearQuarantine", zap.String("id", req.ID), zap.Int("removed", removed))
+	return &ClearQuarantineResponse{Removed: removed}, nil
+}
+
+func (t *implManagementService) ReplaceServer(ctx context.Context, req *ReplaceRequest) (*ReplaceOperation, error) {
+	if err := t.authorize(ctx, true); err != nil {
+		return nil, err
+	}
+	srv, err := t.raftServer()
+	if err != nil {
+		return nil, err
+	}
+	if !srv.IsLeader() {
+		return nil, t.notLeader(ctx, srv)
+	}
+	op, err := srv.ReplaceServer(req.Old, req.New)
+	if err == raft.ErrNotLeader {
+		return nil, t.notLeader(ctx, srv)
+	}
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	t.Log.Info("ManagementReplaceServer", zap.String("old", req.Old), zap.String("new", req.New))
+	return op, nil
+}
+
+func (t *implManagementService) Subscribe(req *SubscribeRequest, stream grpc.ServerStream) error {
+
+	if err := t.authorize(stream.Context(), false); err != nil {
+		return err
+	}
+
+	filter := make(map[ClusterEventType]bool)
+	for _, typ := range req.Types {
+		filter[typ] = true
+	}
+	matches := func(e *ClusterEvent) bool {
+		return len(filter) == 0 || filter[e.Type]
+	}
+
+	// new subscription starts after the latest published event
+	var last uint64
+	if req.ResumeToken == "" {
+		if recent, _ := t.EventBus.Since(0); len(recent) > 0 {
+			last = recent[len(recent)-1].Seq
+		}
+	}
+
+	// subscribe before replay to not miss events published in between
+	ch, unsubscribe := t.EventBus.Subscribe(t.Buffer)
+	defer unsubscribe()
+
+	if req.ResumeToken != "" {
+		seq, err := strconv.ParseUint(req.ResumeToken, 10, 64)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid resume token '%s'", req.ResumeToken)
+		}
+		missed, complete := t.EventBus.Since(seq)
+		if !complete {
+			return status.Errorf(codes.OutOfRange, "events after resume token '%s' are evicted, resubscribe without token", req.ResumeToken)
+		}
+		last = seq
+		for _, e := range missed {
+			if err := t.send(stream, e, matches); err != nil {
+				return err
+			}
+			last = e.Seq
+		}
+	}
+
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return status.Error(codes.Unavailable, "event bus is closed")
+			}
+			if e.Seq <= last {
+				continue
+			}
+			if e.Seq > last + 1 {
+				// the bus dropped events for the slow subscriber, replay them from the history
+				missed, complete := t.EventBus.Since(last)
+				if !complete {
+					return status.Errorf(codes.DataLoss, "events after '%d' are dropped and evicted, resubscribe", last)
+				}
+				for _, m := range missed {
+					if err := t.send(stream, m, matches); err != nil {
+						return err
+					}
+					last = m.Seq
+				}
+				continue
+			}
+			if err := t.send(stream, e, matches); err != nil {
+				return err
+			}
+			last = e.Seq
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (t *implManagementService) send(stream grpc.ServerStream, e *ClusterEvent, matches func(*ClusterEvent) bool) error {
+	if !matches(e) {
+		return nil
+	}
+	if err := stream.SendMsg(&SubscribeEvent{Token: strconv.FormatUint(e.Seq, 10), Event: e}); err != nil {
+		return errors.Errorf("send event %d, %v", e.Seq, err)
+	}
+	return nil
+}
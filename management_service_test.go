@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+type subscribeTestStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	entered  chan struct{}
+	sent     chan *SubscribeEvent
+}
+
+func (t *subscribeTestStream) Context() context.Context {
+	return t.ctx
+}
+
+func (t *subscribeTestStream) SendMsg(m interface{}) error {
+	t.entered <- struct{}{}
+	t.sent <- m.(*SubscribeEvent)
+	return nil
+}
+
+func startSubscribe(t *testing.T, bus ClusterEventPublisher) (*subscribeTestStream, chan error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	svc := &implManagementService{Log: zap.NewNop(), EventBus: bus, Buffer: 1}
+	stream := &subscribeTestStream{ctx: ctx, entered: make(chan struct{}, 16), sent: make(chan *SubscribeEvent)}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- svc.Subscribe(&SubscribeRequest{}, stream)
+	}()
+	return stream, errCh
+}
+
+// publishes after the subscription is registered on the bus and waits for the subscriber to block in send
+func publishSubscribed(bus *implClusterEventBus, stream *subscribeTestStream, event *ClusterEvent) {
+	for {
+		bus.mutex.RLock()
+		n := len(bus.subs)
+		bus.mutex.RUnlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	bus.Publish(event)
+	<-stream.entered
+}
+
+func TestManagementSubscribeGap(t *testing.T) {
+
+	bus := ClusterEventBus().(*implClusterEventBus)
+	bus.Log = zap.NewNop()
+	bus.Publish(&ClusterEvent{Type: EventSnapshotTaken})
+
+	stream, _ := startSubscribe(t, bus)
+
+	publishSubscribed(bus, stream, &ClusterEvent{Type: EventLeaderElected})
+	bus.Publish(&ClusterEvent{Type: EventMemberJoined})
+	// dropped, the subscriber is blocked in send and the buffer is full
+	bus.Publish(&ClusterEvent{Type: EventMemberFailed})
+
+	require.Equal(t, uint64(2), (<-stream.sent).Event.Seq)
+	require.Equal(t, uint64(3), (<-stream.sent).Event.Seq)
+
+	bus.Publish(&ClusterEvent{Type: EventMemberUpdated})
+
+	e := <-stream.sent
+	require.Equal(t, uint64(4), e.Event.Seq)
+	require.Equal(t, EventMemberFailed, e.Event.Type)
+	require.Equal(t, "5", (<-stream.sent).Token)
+}
+
+func TestManagementSubscribeDataLoss(t *testing.T) {
+
+	bus := ClusterEventBus().(*implClusterEventBus)
+	bus.Log = zap.NewNop()
+
+	stream, errCh := startSubscribe(t, bus)
+
+	publishSubscribed(bus, stream, &ClusterEvent{Type: EventLeaderElected})
+	for i := 0; i <= clusterEventHistory; i++ {
+		bus.Publish(&ClusterEvent{Type: EventMemberUpdated})
+	}
+
+	require.Equal(t, uint64(1), (<-stream.sent).Event.Seq)
+	require.Equal(t, uint64(2), (<-stream.sent).Event.Seq)
+
+	bus.Publish(&ClusterEvent{Type: EventMemberJoined})
+
+	err := <-errCh
+	require.Equal(t, codes.DataLoss, status.Code(err))
+}
+
+func TestManagementServiceRegister(t *testing.T) {
+
+	server := grpc.NewServer()
+	defer server.Stop()
+
+	svc := &implManagementService{Log: zap.NewNop(), GrpcServer: server}
+	require.Error(t, svc.PostConstruct())
+
+	_, ok := server.GetServiceInfo()[ManagementServiceName]
+	require.False(t, ok)
+
+	svc.Token = "secret"
+	require.NoError(t, svc.PostConstruct())
+
+	_, ok = server.GetServiceInfo()[ManagementServiceName]
+	require.True(t, ok)
+}
+
+func TestManagementServiceInsecure(t *testing.T) {
+
+	server := grpc.NewServer()
+	defer server.Stop()
+
+	svc := &implManagementService{Log: zap.NewNop(), GrpcServer: server, Insecure: true}
+	require.NoError(t, svc.PostConstruct())
+
+	_, ok := server.GetServiceInfo()[ManagementServiceName]
+	require.True(t, ok)
+	require.NoError(t, svc.authorize(context.Background(), true))
+}
+
+func TestManagementReadToken(t *testing.T) {
+
+	svc := &implManagementService{Log: zap.NewNop(), Token: "secret", ReadToken: "viewer"}
+
+	withToken := func(token string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer " + token))
+	}
+
+	require.NoError(t, svc.authorize(withToken("secret"), true))
+	require.NoError(t, svc.authorize(withToken("secret"), false))
+	require.NoError(t, svc.authorize(withToken("viewer"), false))
+	require.Equal(t, codes.PermissionDenied, status.Code(svc.authorize(withToken("viewer"), true)))
+	require.Equal(t, codes.Unauthenticated, status.Code(svc.authorize(withToken("wrong"), false)))
+	require.Equal(t, codes.Unauthenticated, status.Code(svc.authorize(context.Background(), false)))
+
+	_, err := svc.Snapshot(withToken("viewer"), &SnapshotRequest{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = svc.RemoveServer(withToken("viewer"), &RemoveServerRequest{ID: "node-2"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	// authorized, fails on the missing raft server
+	_, err = svc.Stats(withToken("viewer"), &StatsRequest{})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
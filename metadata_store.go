@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	metadataKeyPrefix     = "meta:"
+	metadataIndexPrefix   = "meta-index:"
+	metadataNamespacesKey = "meta-namespaces"
+)
+
+/**
+Metadata store over raft.StableStore. Stable store does not support iteration and deletion,
+therefore keys of every namespace are tracked in the separate index entry, namespaces are tracked
+in the registry entry and deleted keys are overwritten by empty value.
+ */
+type implMetadataStore struct {
+	StableStore  raft.StableStore  `inject`
+
+	mutex  sync.Mutex
+}
+
+func NodeMetadataStore() MetadataStore {
+	return &implMetadataStore{}
+}
+
+func NewMetadataStore(stable raft.StableStore) MetadataStore {
+	return &implMetadataStore{StableStore: stable}
+}
+
+func (t *implMetadataStore) BeanName() string {
+	return "metadata-store"
+}
+
+func metadataKey(namespace, key string) []byte {
+	return []byte(metadataKeyPrefix + namespace + ":" + key)
+}
+
+func validateMetadataKey(namespace, key string) error {
+	if namespace == "" || strings.Contains(namespace, ":") {
+		return errors.Errorf("invalid metadata namespace '%s'", namespace)
+	}
+	if key == "" || strings.Contains(key, "\n") {
+		return errors.Errorf("invalid metadata key '%s'", key)
+	}
+	return nil
+}
+
+func (t *implMetadataStore) Get(namespace, key string) ([]byte, bool, error) {
+	if err := validateMetadataKey(namespace, key); err != nil {
+		return nil, false, err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	keys, err := t.index(namespace)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, ok := keys[key]; !ok {
+		return nil, false, nil
+	}
+	value, err := t.StableStore.Get(metadataKey(namespace, key))
+	if err != nil {
+		return nil, false, errors.Errorf("get metadata '%s:%s', %v", namespace, key, err)
+	}
+	return value, true, nil
+}
+
+func (t *implMetadataStore) Set(namespace, key string, value []byte) error {
+	if err := validateMetadataKey(namespace, key); err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := t.StableStore.Set(metadataKey(namespace, key), value); err != nil {
+		return errors.Errorf("set metadata '%s:%s', %v", namespace, key, err)
+	}
+
+	keys, err := t.index(namespace)
+	if err != nil {
+		return err
+	}
+	if _, ok := keys[key]; ok {
+		return nil
+	}
+	if len(keys) == 0 {
+		if err := t.register(namespace); err != nil {
+			return err
+		}
+	}
+	keys[key] = struct{}{}
+	return t.saveIndex(namespace, keys)
+}
+
+func (t *implMetadataStore) Delete(namespace, key string) error {
+	if err := validateMetadataKey(namespace, key); err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	keys, err := t.index(namespace)
+	if err != nil {
+		return err
+	}
+	if _, ok := keys[key]; !ok {
+		return nil
+	}
+	delete(keys, key)
+	if err := t.saveIndex(namespace, keys); err != nil {
+		return err
+	}
+	return t.StableStore.Set(metadataKey(namespace, key), []byte{})
+}
+
+func (t *implMetadataStore) List(namespace string) ([]string, error) {
+	if err := validateMetadataKey(namespace, "-"); err != nil {
+		return nil, err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	keys, err := t.index(namespace)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]string, 0, len(keys))
+	for key := range keys {
+		list = append(list, key)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+func (t *implMetadataStore) index(namespace string) (map[string]struct{}, error) {
+	keys := make(map[string]struct{})
+	value, err := t.StableStore.Get([]byte(metadataIndexPrefix + namespace))
+	if err != nil {
+		// the same check of the missing key as in raft.NewRaft
+		if err.Error() == "not found" {
+			return keys, nil
+		}
+		return nil, errors.Errorf("get metadata index '%s', %v", namespace, err)
+	}
+	for _, key := range strings.Split(string(value), "\n") {
+		if key != "" {
+			keys[key] = struct{}{}
+		}
+	}
+	return keys, nil
+}
+
+func (t *implMetadataStore) saveIndex(namespace string, keys map[string]struct{}) error {
+	list := make([]string, 0, len(keys))
+	for key := range keys {
+		list = append(list, key)
+	}
+	sort.Strings(list)
+	indexKey := []byte(metadataIndexPrefix + namespace)
+	if err := t.StableStore.Set(indexKey, []byte(strings.Join(list, "\n"))); err != nil {
+		return errors.Errorf("set metadata index '%s', %v", namespace, err)
+	}
+	return nil
+}
+
+// namespaces stay registered after the deletion of all their keys
+func (t *implMetadataStore) register(namespace string) error {
+	namespaces, err := metadataNamespaces(t.StableStore)
+	if err != nil {
+		return err
+	}
+	for _, registered := range namespaces {
+		if registered == namespace {
+			return nil
+		}
+	}
+	namespaces = append(namespaces, namespace)
+	sort.Strings(namespaces)
+	if err := t.StableStore.Set([]byte(metadataNamespacesKey), []byte(strings.Join(namespaces, "\n"))); err != nil {
+		return errors.Errorf("set metadata namespaces, %v", err)
+	}
+	return nil
+}
+
+/**
+Returns namespaces registered in the stable store by the metadata store
+ */
+func metadataNamespaces(stable raft.StableStore) ([]string, error) {
+	value, err := stable.Get([]byte(metadataNamespacesKey))
+	if err != nil {
+		// the same check of the missing key as in raft.NewRaft
+		if err.Error() == "not found" {
+			return nil, nil
+		}
+		return nil, errors.Errorf("get metadata namespaces, %v", err)
+	}
+	var list []string
+	for _, namespace := range strings.Split(string(value), "\n") {
+		if namespace != "" {
+			list = append(list, namespace)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod_test
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/sprintframework/raftmod"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMetadataStore(t *testing.T) {
+
+	meta := raftmod.NewMetadataStore(raft.NewInmemStore())
+
+	_, ok, err := meta.Get("node", "identity")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, meta.Set("node", "identity", []byte("abc")))
+	require.NoError(t, meta.Set("node", "token", []byte("xyz")))
+	require.NoError(t, meta.Set("other", "identity", []byte("def")))
+
+	value, ok, err := meta.Get("node", "identity")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "abc", string(value))
+
+	keys, err := meta.List("node")
+	require.NoError(t, err)
+	require.Equal(t, []string{"identity", "token"}, keys)
+
+	require.NoError(t, meta.Delete("node", "identity"))
+
+	_, ok, err = meta.Get("node", "identity")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	keys, err = meta.List("node")
+	require.NoError(t, err)
+	require.Equal(t, []string{"token"}, keys)
+
+	_, err = meta.List("bad:ns")
+	require.Error(t, err)
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+Recently removed or failed server which autopilot does not add back until expiration
+ */
+type QuarantineEntry struct {
+	ID       string     `json:"id"`
+	Reason   string     `json:"reason"`
+	Expires  time.Time  `json:"expires"`
+}
+
+type serverQuarantine struct {
+	mutex    sync.Mutex
+	entries  map[string]*QuarantineEntry
+}
+
+func newServerQuarantine() *serverQuarantine {
+	return &serverQuarantine{
+		entries: make(map[string]*QuarantineEntry),
+	}
+}
+
+func (t *serverQuarantine) Add(id, reason string, ttl time.Duration) {
+	if ttl <= 0 || id == "" {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.entries[id] = &QuarantineEntry{ID: id, Reason: reason, Expires: time.Now().Add(ttl)}
+}
+
+func (t *serverQuarantine) Contains(id string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	e, ok := t.entries[id]
+	if !ok {
+		return false
+	}
+	if time.Now().After(e.Expires) {
+		delete(t.entries, id)
+		return false
+	}
+	return true
+}
+
+func (t *serverQuarantine) List() []*QuarantineEntry {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	var list []*QuarantineEntry
+	for id, e := range t.entries {
+		if now.After(e.Expires) {
+			delete(t.entries, id)
+			continue
+		}
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+/**
+Removes the server from quarantine, empty id clears all, returns number of removed entries
+ */
+func (t *serverQuarantine) Clear(id string) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if id == "" {
+		n := len(t.entries)
+		t.entries = make(map[string]*QuarantineEntry)
+		return n
+	}
+	if _, ok := t.entries[id]; ok {
+		delete(t.entries, id)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/options"
+	"github.com/pkg/errors"
+	"github.com/sprintframework/sprint"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+/**
+Badger instance of the log and stable stores tuned by 'raft-storage.badger.*' properties, used when 'raft-storage.bean' is empty
+instead of the managed data store of the application. Opened by the first of the factories and closed with the context.
+ */
+type RaftBadgerStore interface {
+
+	Store() (*badger.DB, error)
+
+}
+
+var RaftBadgerStoreClass = reflect.TypeOf((*RaftBadgerStore)(nil)).Elem()
+
+type implRaftBadgerStore struct {
+
+	Application sprint.Application   `inject`
+	Log         *zap.Logger          `inject`
+
+	/**
+	Directory of the instance, empty is 'raft-badger' in the data dir
+	 */
+	Dir               string  `value:"raft-storage.badger.dir,default="`
+	// below 2GB
+	ValueLogFileSize  string  `value:"raft-storage.badger.value-log-file-size,default=1GB"`
+	// 'none', 'snappy' or 'zstd'
+	Compression       string  `value:"raft-storage.badger.compression,default=snappy"`
+	NumMemtables      int     `value:"raft-storage.badger.num-memtables,default=5"`
+	BlockCacheSize    string  `value:"raft-storage.badger.block-cache-size,default=256MB"`
+	// raft expects the log and the vote on the disk when the write returns
+	SyncWrites        bool    `value:"raft-storage.badger.sync-writes,default=true"`
+
+	DataDir           string       `value:"application.data.dir,default="`
+	DataDirPerm       os.FileMode  `value:"application.perm.data.dir,default=-rwxrwx---"`
+	PermMode          string       `value:"application.perm.mode,default=auto"`
+	PermUID           int          `value:"application.perm.uid,default=-1"`
+	PermGID           int          `value:"application.perm.gid,default=-1"`
+
+	mutex  sync.Mutex
+	db     *badger.DB
+}
+
+func RaftBadgerStoreHolder() RaftBadgerStore {
+	return &implRaftBadgerStore{}
+}
+
+func (t *implRaftBadgerStore) Store() (*badger.DB, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.db != nil {
+		return t.db, nil
+	}
+
+	opts, err := t.options()
+	if err != nil {
+		return nil, err
+	}
+
+	perm, err := newDataDirPerm(t.DataDirPerm, t.PermMode, t.PermUID, t.PermGID)
+	if err != nil {
+		return nil, err
+	}
+	if err := createDirsIfNeeded(opts.Dir, perm); err != nil {
+		return nil, errors.Errorf("issue in property 'raft-storage.badger.dir', %v", err)
+	}
+
+	t.db, err = badger.Open(opts)
+	if err != nil {
+		return nil, errors.Errorf("open badger '%s', %v", opts.Dir, err)
+	}
+	return t.db, nil
+}
+
+func (t *implRaftBadgerStore) options() (badger.Options, error) {
+
+	dir := t.Dir
+	if dir == "" {
+		dataDir := t.DataDir
+		if dataDir == "" {
+			dataDir = filepath.Join(t.Application.ApplicationDir(), "db", t.Application.Name())
+		}
+		dir = filepath.Join(dataDir, "raft-badger")
+	}
+	opts := badger.DefaultOptions(dir).WithLogger(badgerLogger{t.Log.Named("raft-badger").Sugar()})
+
+	valueLogFileSize, err := ParseByteSize(t.ValueLogFileSize)
+	if err != nil {
+		return opts, errors.Errorf("issue in property 'raft-storage.badger.value-log-file-size', %v", err)
+	}
+	if valueLogFileSize < 1 << 20 || valueLogFileSize >= 2 << 30 {
+		return opts, errors.Errorf("issue in property 'raft-storage.badger.value-log-file-size', expected size from 1MB below 2GB instead of '%s'", t.ValueLogFileSize)
+	}
+
+	var compression options.CompressionType
+	switch t.Compression {
+	case "none":
+		compression = options.None
+	case "snappy":
+		compression = options.Snappy
+	case "zstd":
+		compression = options.ZSTD
+	default:
+		return opts, errors.Errorf("issue in property 'raft-storage.badger.compression', expected 'none', 'snappy' or 'zstd' instead of '%s'", t.Compression)
+	}
+
+	if t.NumMemtables < 1 {
+		return opts, errors.Errorf("issue in property 'raft-storage.badger.num-memtables', invalid value %d", t.NumMemtables)
+	}
+
+	blockCacheSize, err := ParseByteSize(t.BlockCacheSize)
+	if err != nil {
+		return opts, errors.Errorf("issue in property 'raft-storage.badger.block-cache-size', %v", err)
+	}
+	if compression != options.None && blockCacheSize == 0 {
+		// badger reads compressed tables only through the block cache
+		return opts, errors.New("property 'raft-storage.badger.block-cache-size' is required by the compression")
+	}
+
+	return opts.
+		WithValueLogFileSize(valueLogFileSize).
+		WithCompression(compression).
+		WithNumMemtables(t.NumMemtables).
+		WithBlockCacheSize(blockCacheSize).
+		WithSyncWrites(t.SyncWrites), nil
+}
+
+func (t *implRaftBadgerStore) Destroy() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.db == nil {
+		return nil
+	}
+	err := t.db.Close()
+	t.db = nil
+	return err
+}
+
+/**
+Messages of badger in the application log
+ */
+type badgerLogger struct {
+	log *zap.SugaredLogger
+}
+
+func (t badgerLogger) Errorf(format string, args ...interface{}) {
+	t.log.Errorf(format, args...)
+}
+
+func (t badgerLogger) Warningf(format string, args ...interface{}) {
+	t.log.Warnf(format, args...)
+}
+
+func (t badgerLogger) Infof(format string, args ...interface{}) {
+	t.log.Infof(format, args...)
+}
+
+func (t badgerLogger) Debugf(format string, args ...interface{}) {
+	t.log.Debugf(format, args...)
+}
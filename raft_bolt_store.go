@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft-boltdb/v2"
+	"github.com/pkg/errors"
+	"github.com/sprintframework/sprint"
+	"go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	RaftStoreBadger = "badger"
+	RaftStoreBolt   = "bolt"
+	RaftStoreInmem  = "inmem"
+)
+
+/**
+Single bolt file keeping both the raft log and the stable store, opened by the first of the factories
+when 'raft-storage.backend' is 'bolt' and closed with the context
+ */
+type RaftBoltStore interface {
+
+	Store() (*raftboltdb.BoltStore, error)
+
+}
+
+var RaftBoltStoreClass = reflect.TypeOf((*RaftBoltStore)(nil)).Elem()
+
+type implRaftBoltStore struct {
+
+	Application sprint.Application   `inject`
+
+	/**
+	Path of the bolt file, empty is 'raft.db' in the data dir
+	 */
+	File         string         `value:"raft-storage.bolt-file,default="`
+	NoSync       bool           `value:"raft-storage.bolt-no-sync,default=false"`
+	OpenTimeout  time.Duration  `value:"raft-storage.bolt-open-timeout,default=10s"`
+
+	DataDir           string       `value:"application.data.dir,default="`
+	DataDirPerm       os.FileMode  `value:"application.perm.data.dir,default=-rwxrwx---"`
+	PermMode          string       `value:"application.perm.mode,default=auto"`
+	PermUID           int          `value:"application.perm.uid,default=-1"`
+	PermGID           int          `value:"application.perm.gid,default=-1"`
+
+	mutex  sync.Mutex
+	store  *raftboltdb.BoltStore
+}
+
+func RaftBoltStoreHolder() RaftBoltStore {
+	return &implRaftBoltStore{}
+}
+
+func (t *implRaftBoltStore) Store() (*raftboltdb.BoltStore, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.store != nil {
+		return t.store, nil
+	}
+
+	perm, err := newDataDirPerm(t.DataDirPerm, t.PermMode, t.PermUID, t.PermGID)
+	if err != nil {
+		return nil, err
+	}
+
+	file := t.File
+	if file == "" {
+		dataDir := t.DataDir
+		if dataDir == "" {
+			dataDir = filepath.Join(t.Application.ApplicationDir(), "db", t.Application.Name())
+		}
+		file = filepath.Join(dataDir, "raft.db")
+	}
+	if err := createDirsIfNeeded(filepath.Dir(file), perm); err != nil {
+		return nil, errors.Errorf("issue in property 'raft-storage.bolt-file', %v", err)
+	}
+
+	// bolt waits for the file lock forever without the timeout, when the other process holds it
+	t.store, err = raftboltdb.New(raftboltdb.Options{
+		Path:        file,
+		BoltOptions: &bbolt.Options{Timeout: t.OpenTimeout},
+		NoSync:      t.NoSync,
+	})
+	if err != nil {
+		return nil, errors.Errorf("open bolt file '%s', %v", file, err)
+	}
+	return t.store, nil
+}
+
+func (t *implRaftBoltStore) Destroy() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.store == nil {
+		return nil
+	}
+	err := t.store.Close()
+	t.store = nil
+	return err
+}
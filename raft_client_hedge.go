@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"context"
+	"github.com/go-errors/errors"
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc"
+	"sort"
+	"sync"
+	"time"
+)
+
+const hedgeLatencySamples = 128
+
+/**
+Read operation on the replica API connection, must respect context cancellation
+ */
+type HedgedReadFunc func(ctx context.Context, conn *grpc.ClientConn) (interface{}, error)
+
+/**
+Sliding window of the successful read latencies
+ */
+type latencyWindow struct {
+	mutex    sync.Mutex
+	samples  []time.Duration
+	next     int
+}
+
+func (t *latencyWindow) add(d time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.samples) < hedgeLatencySamples {
+		t.samples = append(t.samples, d)
+		return
+	}
+	t.samples[t.next] = d
+	t.next = (t.next + 1) % hedgeLatencySamples
+}
+
+func (t *latencyWindow) percentile(p int) (time.Duration, bool) {
+	t.mutex.Lock()
+	sorted := append([]time.Duration(nil), t.samples...)
+	t.mutex.Unlock()
+	if len(sorted) == 0 {
+		return 0, false
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	i := len(sorted) * p / 100
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i], true
+}
+
+func (t *implRaftClientPool) hedgeDelay() time.Duration {
+	delay, ok := t.hedgeLatency.percentile(t.HedgePercentile)
+	if !ok || delay < t.HedgeMinDelay {
+		return t.HedgeMinDelay
+	}
+	return delay
+}
+
+/**
+Orders replicas by the estimated RTT from serf coordinates, replicas without coordinates go last
+ */
+func (t *implRaftClientPool) nearest(replicas []raft.ServerAddress) []raft.ServerAddress {
+
+	ordered := append([]raft.ServerAddress(nil), replicas...)
+	if t.SerfServer == nil || t.ServerLookup == nil {
+		return ordered
+	}
+	s, ok := t.SerfServer.Serf()
+	if !ok || s == nil {
+		return ordered
+	}
+	local, err := s.GetCoordinate()
+	if err != nil {
+		return ordered
+	}
+
+	names := make(map[raft.ServerAddress]string)
+	for _, server := range t.ServerLookup.Servers() {
+		names[RaftServerAddress(server)] = server.Name
+	}
+
+	rtt := make(map[raft.ServerAddress]time.Duration)
+	for _, addr := range ordered {
+		rtt[addr] = time.Duration(1<<63 - 1)
+		if name, ok := names[addr]; ok {
+			if coord, ok := s.GetCachedCoordinate(name); ok && coord != nil {
+				rtt[addr] = local.DistanceTo(coord)
+			}
+		}
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return rtt[ordered[i]] < rtt[ordered[j]]
+	})
+	return ordered
+}
+
+type hedgedResult struct {
+	value  interface{}
+	err    error
+}
+
+/**
+Issues the read to the nearest replica and hedges it to the second nearest one if there is no
+response after the configured percentile of the recent read latencies or on failure,
+the first successful response wins and the loser is cancelled.
+ */
+func (t *implRaftClientPool) HedgedRead(ctx context.Context, replicas []raft.ServerAddress, read HedgedReadFunc) (interface{}, error) {
+
+	ordered := t.nearest(replicas)
+	if len(ordered) == 0 {
+		return nil, errors.New("no replicas for hedged read")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// buffered to not leak goroutines of the losers
+	results := make(chan hedgedResult, 2)
+	launch := func(addr raft.ServerAddress) {
+		go func() {
+			start := time.Now()
+			conn, err := t.GetAPIConn(addr)
+			if err != nil {
+				results <- hedgedResult{err: err}
+				return
+			}
+			value, err := read(ctx, conn)
+			if err == nil {
+				t.hedgeLatency.add(time.Since(start))
+			}
+			results <- hedgedResult{value: value, err: err}
+		}()
+	}
+
+	attempts := 2
+	if len(ordered) < attempts {
+		attempts = len(ordered)
+	}
+
+	launch(ordered[0])
+	launched, inflight := 1, 1
+
+	timer := time.NewTimer(t.hedgeDelay())
+	defer timer.Stop()
+
+	var lastErr error
+	for {
+		select {
+		case r := <-results:
+			inflight--
+			if r.err == nil {
+				return r.value, nil
+			}
+			lastErr = r.err
+			if launched < attempts {
+				launch(ordered[launched])
+				launched++
+				inflight++
+			} else if inflight == 0 {
+				return nil, lastErr
+			}
+		case <-timer.C:
+			if launched < attempts {
+				launch(ordered[launched])
+				launched++
+				inflight++
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -8,7 +8,6 @@ package raftmod
 import (
 	"context"
 	"crypto/tls"
-	"fmt"
 	"github.com/codeallergy/glue"
 	"github.com/go-errors/errors"
 	"github.com/hashicorp/raft"
@@ -20,7 +19,10 @@ import (
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
 	"io"
+	"net"
+	"strconv"
 	"sync"
+	"time"
 )
 
 type implRaftClientPool struct {
@@ -32,6 +34,15 @@ type implRaftClientPool struct {
 	RPCBean        string `value:"raft.rpc-bean-name,default="`
 	RPCServiceName string `value:"raft.rpc-service-name,default="`
 
+	/**
+	Hedged reads order replicas by serf coordinates and hedge after the percentile of the recent read latencies
+	 */
+	SerfServer      raftapi.SerfServer    `inject:"optional"`
+	ServerLookup    raftapi.ServerLookup  `inject:"optional"`
+	HedgePercentile int                   `value:"raft.hedge-percentile,default=95"`
+	HedgeMinDelay   time.Duration         `value:"raft.hedge-min-delay,default=10ms"`
+	hedgeLatency    latencyWindow
+
 	portDiff          int
 
 	clients   sync.Map   // key - raft.ServerAddress, value - *clientConnection or *connectingClient
@@ -55,12 +66,17 @@ func RaftClientPool() raftapi.RaftClientPool {
 }
 
 func (t *implRaftClientPool) PostConstruct() error {
+	if t.HedgePercentile <= 0 || t.HedgePercentile > 100 {
+		return errors.Errorf("invalid property 'raft.hedge-percentile' value %d, expected 1..100", t.HedgePercentile)
+	}
 	if t.RPCServiceName == "" {
 		t.Log.Warn("property 'raft.rpc-service-name' is empty, health check would be disabled")
 	}
 
-	if t.RaftAddress != "" && t.RPCBean != "" {
-		raftPort, err := getPortNumber(t.RaftAddress)
+	if _, ok := unixSocketPath(t.RaftAddress); ok {
+		t.Log.Warn("property 'raft.bind-address' is unix socket, API endpoints can not be derived from raft addresses")
+	} else if t.RaftAddress != "" && t.RPCBean != "" {
+		raftPort, err := getPortNumber(primaryBindAddress(t.RaftAddress))
 		if err != nil {
 			return errors.Errorf("invalid port in property 'raft.bind-address', %v", err)
 		}
@@ -87,7 +103,7 @@ func (t *implRaftClientPool) GetAPIEndpoint(raftAddress string) (string, error)
 		return "", err
 	}
 
-	return fmt.Sprintf("%s:%d", raftHost, raftPort + t.portDiff), nil
+	return net.JoinHostPort(raftHost, strconv.Itoa(raftPort + t.portDiff)), nil
 }
 
 func (t *implRaftClientPool) GetAPIConn(raftAddress raft.ServerAddress) (*grpc.ClientConn, error) {
@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/codeallergy/glue"
+	"github.com/pkg/errors"
+	"github.com/sprintframework/sprint"
+	"os"
+	"sync"
+	"time"
+)
+
+type implKeyResolver struct {
+
+	Properties  glue.Properties      `inject`
+	SystemEnvironmentPropertyResolver sprint.SystemEnvironmentPropertyResolver `inject`
+
+	// property with the token of the 'token' provider, prompted when empty
+	KeyProperty         string `value:"raft.snapshot-key-bean,default="`
+
+	/**
+	Provider of the master key wrapping data keys of snapshots and encrypted raft stores: 'token' is the key from 'raft.snapshot-key-bean' property or prompt,
+	'vault' is the HashiCorp Vault transit key, 'gcp-kms' is the Google Cloud KMS key, other names select the injected KeyProvider beans
+	 */
+	KeyProvider         string `value:"raft.snapshot-key-provider,default=token"`
+
+	// PBKDF2 iterations deriving the master key from the token of new snapshots
+	KDFIterations       int    `value:"raft.snapshot-kdf-iterations,default=600000"`
+
+	VaultAddress        string        `value:"raft.vault.address,default="`
+	VaultToken          string        `value:"raft.vault.token,default="`
+	VaultTransitMount   string        `value:"raft.vault.transit-mount,default=transit"`
+	VaultTransitKey     string        `value:"raft.vault.transit-key,default="`
+	VaultTimeout        time.Duration `value:"raft.vault.timeout,default=10s"`
+
+	// full resource name 'projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>'
+	GCPKMSKey           string        `value:"raft.gcp-kms.key,default="`
+	// empty token is taken from the GCE metadata server
+	GCPKMSToken         string        `value:"raft.gcp-kms.token,default="`
+	GCPKMSTimeout       time.Duration `value:"raft.gcp-kms.timeout,default=10s"`
+
+	// custom key providers selected by name
+	KeyProviders  []KeyProvider  `inject:"optional"`
+
+	mutex     sync.Mutex
+	provider  KeyProvider
+}
+
+func RaftKeyResolver() KeyResolver {
+	return &implKeyResolver{}
+}
+
+func (t *implKeyResolver) KeysConfigured() bool {
+	return t.KeyProperty != "" || t.KeyProvider != TokenKeyProviderName
+}
+
+func (t *implKeyResolver) ResolveKeyProvider() (KeyProvider, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.provider == nil {
+		keys, err := t.keyProvider()
+		if err != nil {
+			return nil, err
+		}
+		t.provider = keys
+	}
+	return t.provider, nil
+}
+
+func (t *implKeyResolver) keyProvider() (KeyProvider, error) {
+
+	switch t.KeyProvider {
+	case TokenKeyProviderName:
+		token, err := t.encryptionToken()
+		if err != nil {
+			return nil, err
+		}
+		if t.KDFIterations < 1 {
+			return nil, errors.Errorf("issue in property 'raft.snapshot-kdf-iterations', invalid value %d", t.KDFIterations)
+		}
+		return TokenKeyProviderKDF(token, t.KDFIterations), nil
+
+	case VaultKeyProviderName:
+		address, token := t.VaultAddress, t.VaultToken
+		// the same variables as the vault cli
+		if address == "" {
+			address = os.Getenv("VAULT_ADDR")
+		}
+		if token == "" {
+			token = os.Getenv("VAULT_TOKEN")
+		}
+		keys, err := VaultKeyProvider(address, token, t.VaultTransitMount, t.VaultTransitKey, t.VaultTimeout)
+		if err != nil {
+			return nil, errors.Errorf("issue in property 'raft.snapshot-key-provider', %v", err)
+		}
+		return keys, nil
+
+	case GCPKMSKeyProviderName:
+		keys, err := GCPKMSKeyProvider(t.GCPKMSKey, t.GCPKMSToken, t.GCPKMSTimeout)
+		if err != nil {
+			return nil, errors.Errorf("issue in property 'raft.gcp-kms.key', %v", err)
+		}
+		return keys, nil
+	}
+
+	for _, keys := range t.KeyProviders {
+		if keys.KeyProviderName() == t.KeyProvider {
+			return keys, nil
+		}
+	}
+	return nil, errors.Errorf("unknown key provider '%s' in property 'raft.snapshot-key-provider'", t.KeyProvider)
+}
+
+func (t *implKeyResolver) encryptionToken() (string, error) {
+	if t.KeyProperty == "" {
+		return "", errors.New("property 'raft.snapshot-key-bean' is required for encryption")
+	}
+	encryptionToken := t.Properties.GetString(t.KeyProperty, "")
+	if encryptionToken == "" {
+		var ok bool
+		encryptionToken, ok = t.SystemEnvironmentPropertyResolver.PromptProperty(t.KeyProperty)
+		if !ok || encryptionToken == "" {
+			return "", errors.Errorf("'%s' encryption token is required", t.KeyProperty)
+		}
+	}
+	return encryptionToken, nil
+}
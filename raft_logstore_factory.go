@@ -13,14 +13,48 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sprintframework/raft-badger"
 	"reflect"
+	"strings"
 )
 
 var LogStoreClass = reflect.TypeOf((*raft.LogStore)(nil)).Elem()
 
 type implRaftLogStoreFactory struct {
 
-	RaftStore     store.ManagedDataStore    `inject:"bean=raft-store"`
+	DataStores    []store.ManagedDataStore  `inject:"optional"`
+	/**
+	Name of the managed data store of the 'badger' backend shared by the log and stable stores under distinct prefixes,
+	empty is the own instance tuned by 'raft-storage.badger.*' properties
+	 */
+	RaftStoreBean string                    `value:"raft-storage.bean,default=raft-store"`
+	BadgerStore   RaftBadgerStore           `inject`
+	BoltStore     RaftBoltStore             `inject`
+	WALStore      RaftWALStore              `inject`
+
+	/**
+	Storage of the log and stable store, 'badger' in the managed data store 'raft-store', 'bolt' in the single file
+	or 'wal' in segments of the write-ahead log, 'inmem' keeps nothing on disk for tests and single node dev runs
+	 */
+	Backend       string `value:"raft-storage.backend,default=badger"`
 	RaftLogPrefix string `value:"raft-store.log-prefix,default=log"`
+	RaftConfPrefix string `value:"raft-store.conf-prefix,default=conf"`
+
+	/**
+	Encrypt data of log entries by AES-GCM with the data key wrapped by the key provider of snapshots,
+	entries written before are readable
+	 */
+	Encrypt       bool          `value:"raft-storage.encrypt,default=false"`
+	Keys          KeyResolver   `inject`
+
+	/**
+	Keep CRC32C checksum of every log entry and verify it on read
+	 */
+	LogChecksum       bool   `value:"raft-storage.log-checksum,default=false"`
+	LogChecksumPrefix string `value:"raft-storage.log-checksum-prefix,default=crc"`
+
+	/**
+	Number of recent entries kept in memory, replication to followers reads them without the store, zero disables the cache
+	 */
+	LogCacheSize      int    `value:"raft-storage.log-cache-size,default=512"`
 
 }
 
@@ -32,13 +66,172 @@ func (t *implRaftLogStoreFactory) Object() (object interface{}, err error) {
 
 	defer panicToError(&err)
 
-	db, ok := t.RaftStore.Instance().(*badger.DB)
-	if !ok {
-		return nil, errors.New("managed data delegate 'raft-store' must have badger backend")
+	if t.Backend, err = storageBackend(t.Backend); err != nil {
+		return nil, err
+	}
+
+	logStore, err := t.newLogStore()
+	if err != nil {
+		return nil, err
+	}
+
+	if t.LogCacheSize < 0 {
+		return nil, errors.Errorf("issue in property 'raft-storage.log-cache-size', negative size %d", t.LogCacheSize)
+	}
+	if t.LogCacheSize == 0 || t.Backend == RaftStoreInmem {
+		return logStore, nil
+	}
+	return newLogCache(t.LogCacheSize, logStore)
+
+}
+
+func (t *implRaftLogStoreFactory) newLogStore() (raft.LogStore, error) {
+
+	if t.LogChecksum && t.Backend != "" && t.Backend != RaftStoreBadger {
+		return nil, errors.New("property 'raft-storage.log-checksum' requires 'badger' in property 'raft-storage.backend'")
+	}
+
+	var logStore raft.LogStore
+	// stable store keeping the wrapped data key of the encryption
+	var keyring raft.StableStore
+	var db *badger.DB
+
+	switch t.Backend {
+	case "", RaftStoreBadger:
+		if err := checkStorePrefixes(t.RaftLogPrefix, t.RaftConfPrefix, t.LogChecksum, t.LogChecksumPrefix); err != nil {
+			return nil, err
+		}
+		var err error
+		db, err = badgerDataStore(t.DataStores, t.RaftStoreBean, t.BadgerStore)
+		if err != nil {
+			return nil, err
+		}
+		// the whole batch of StoreLogs in one transaction
+		logStore = newBatchedLogStore(raftbadger.NewLogStore(db, []byte(t.RaftLogPrefix)), db, []byte(t.RaftLogPrefix))
+		keyring = raftbadger.NewStableStore(db, []byte(t.RaftConfPrefix))
+
+	case RaftStoreBolt:
+		// bolt keeps the CRC of pages, entries are not checked on read
+		store, err := t.BoltStore.Store()
+		if err != nil {
+			return nil, err
+		}
+		logStore, keyring = store, store
+
+	case RaftStoreWAL:
+		// segments keep the CRC of every entry, the log is monotonic
+		store, err := t.WALStore.Store()
+		if err != nil {
+			return nil, err
+		}
+		logStore, keyring = store, store
+
+	case RaftStoreInmem:
+		store := raft.NewInmemStore()
+		logStore, keyring = store, store
+
+	default:
+		return nil, errors.Errorf("unknown backend '%s' in property 'raft-storage.backend', expected '%s', '%s', '%s' or '%s'", t.Backend, RaftStoreBadger, RaftStoreBolt, RaftStoreWAL, RaftStoreInmem)
+	}
+
+	if t.Encrypt {
+		keys, err := t.Keys.ResolveKeyProvider()
+		if err != nil {
+			return nil, errors.Errorf("issue in property 'raft-storage.encrypt', %v", err)
+		}
+		// under the checksums, so they are verified on the plain entries
+		logStore, err = newEncryptedLogStore(logStore, keyring, keys)
+		if err != nil {
+			return nil, errors.Errorf("issue in property 'raft-storage.encrypt', %v", err)
+		}
+	}
+
+	if t.LogChecksum {
+		logStore = NewChecksumLogStore(logStore, db, []byte(t.LogChecksumPrefix))
+	}
+
+	return logStore, nil
+}
+
+/**
+Returns the backend of the property 'raft-storage.backend' ignoring the case and surrounding spaces, empty is 'badger'.
+Both factories select the store by it, so switching the persistence engine is the change of the property only.
+ */
+func storageBackend(backend string) (string, error) {
+	switch b := strings.ToLower(strings.TrimSpace(backend)); b {
+	case "":
+		return RaftStoreBadger, nil
+	case RaftStoreBadger, RaftStoreBolt, RaftStoreWAL, RaftStoreInmem:
+		return b, nil
+	default:
+		return "", errors.Errorf("unknown backend '%s' in property 'raft-storage.backend', expected '%s', '%s', '%s' or '%s'", backend, RaftStoreBadger, RaftStoreBolt, RaftStoreWAL, RaftStoreInmem)
+	}
+}
+
+/**
+Returns the badger instance of the managed data store with the name, the own instance if the name is empty
+ */
+func badgerDataStore(stores []store.ManagedDataStore, name string, own RaftBadgerStore) (*badger.DB, error) {
+	if name == "" {
+		return own.Store()
+	}
+	for _, s := range stores {
+		if named, ok := s.(interface{ BeanName() string }); ok && named.BeanName() == name {
+			db, ok := s.Instance().(*badger.DB)
+			if !ok {
+				return nil, errors.Errorf("managed data delegate '%s' of property 'raft-storage.bean' must have badger backend", name)
+			}
+			return db, nil
+		}
+	}
+	return nil, errors.Errorf("managed data delegate '%s' of property 'raft-storage.bean' is required by the 'badger' backend", name)
+}
+
+/**
+Keys of the log, the stable store and checksums share the badger instance, so no prefix may start with the other one
+ */
+func checkStorePrefixes(logPrefix, confPrefix string, checksum bool, checksumPrefix string) error {
+	prefixes := map[string]string{
+		"raft-store.log-prefix":  logPrefix,
+		"raft-store.conf-prefix": confPrefix,
 	}
+	if checksum {
+		prefixes["raft-storage.log-checksum-prefix"] = checksumPrefix
+	}
+	for name, prefix := range prefixes {
+		if prefix == "" {
+			return errors.Errorf("empty property '%s'", name)
+		}
+		for otherName, other := range prefixes {
+			if name != otherName && strings.HasPrefix(other, prefix) {
+				return errors.Errorf("property '%s' must not be the prefix of '%s'", name, otherName)
+			}
+		}
+	}
+	return nil
+}
 
-	return raftbadger.NewLogStore(db, []byte(t.RaftLogPrefix)), nil
+/**
+Log cache keeping the scrubber of the delegate, entries of the cache were verified on write
+ */
+type scrubbableLogCache struct {
+	*raft.LogCache
+	scrubber  LogScrubber
+}
+
+func newLogCache(capacity int, delegate raft.LogStore) (raft.LogStore, error) {
+	cache, err := raft.NewLogCache(capacity, delegate)
+	if err != nil {
+		return nil, err
+	}
+	if scrubber, ok := delegate.(LogScrubber); ok {
+		return &scrubbableLogCache{LogCache: cache, scrubber: scrubber}, nil
+	}
+	return cache, nil
+}
 
+func (t *scrubbableLogCache) ScrubLog(cb func(log *raft.Log, err error) bool) error {
+	return t.scrubber.ScrubLog(cb)
 }
 
 func (t *implRaftLogStoreFactory) ObjectType() reflect.Type {
@@ -7,7 +7,6 @@ package raftmod
 
 import (
 	"crypto/tls"
-	"fmt"
 	"github.com/codeallergy/glue"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/raft"
@@ -16,7 +15,12 @@ import (
 	"github.com/sprintframework/sprint"
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
 	"net"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -37,10 +41,26 @@ type implRaftServer struct {
 	FileSnapshotStore  raft.SnapshotStore  `inject`
 
 	ServerLookup       raftapi.ServerLookup  `inject`
+	SerfServer         raftapi.SerfServer    `inject:"optional"`
+
+	LeaderChangePublishers  []LeaderChangePublisher  `inject:"optional"`
+	EventBus                ClusterEventPublisher    `inject:"optional"`
+	Registrars              []ServiceRegistrar       `inject:"optional"`
+	LeadershipHooks         []LeadershipHook         `inject:"optional"`
+	SnapshotHandlers        []SnapshotCompletedHandler  `inject:"optional"`
+	LogArchivers            []LogArchiver            `inject:"optional"`
+	MetadataStore           MetadataStore            `inject:"optional"`
+
+	// readiness is published as serving status of the 'raft.rpc-service-name'
+	HealthChecker      *health.Server        `inject:"optional"`
+	RPCServiceName     string                `value:"raft.rpc-service-name,default="`
 
 	SerfAddress       string       `value:"serf.bind-address,default="`
 	SerfQueueSize     int          `value:"serf.queue-size,default=2048"`
 
+	// bounds the chunks of the assembled user events, see EventAssembler
+	MaxChunkedPayload  int         `value:"serf.max-chunked-payload,default=1048576"`
+
 	//SerfConfig   *serf.Config `inject`
 	//serf         *serf.Serf
 	//serfChLAN    chan  serf.Event
@@ -53,16 +73,278 @@ type implRaftServer struct {
 	// should be defined by application
 	FSM      raft.FSM   `inject`
 
+	/**
+	Wraps FSM to measure apply latency, throughput, snapshot and restore durations reported by GetStats
+	 */
+	FSMInstrumentation  bool  `value:"raft.fsm-instrumentation,default=false"`
+
+	/**
+	Wraps the log store to measure append and read latencies, deletions and the approximate size reported by GetStats
+	 */
+	LogStoreInstrumentation  bool  `value:"raft.log-store-instrumentation,default=false"`
+
+	/**
+	Reads the whole log before the start and fails on gaps, misplaced entries or the term and vote behind the log tail
+	 */
+	VerifyStores  bool  `value:"raft.verify-stores,default=false"`
+
+	/**
+	Entries read from the log and passed to the LogArchiver beans at once before the truncation
+	 */
+	LogArchiveBatch  int  `value:"raft.log-archive-batch,default=256"`
+
+	/**
+	Snapshots failed to restore by FSM are skipped on the next attempts
+	 */
+	SnapshotQuarantine  bool  `value:"raft.snapshot-quarantine,default=false"`
+
 	RaftAddress  string          `value:"raft.bind-address,default="`
+	RaftRole     string          `value:"raft.role,default=server"`
+	ProtocolVersion int          `value:"raft-server.protocol-version,default=3"`
+
+	/**
+	Snapshot frequency and log truncation, defaults are the raft defaults
+	 */
+	SnapshotInterval   time.Duration  `value:"raft-server.snapshot-interval,default=120s"`
+	SnapshotThreshold  int            `value:"raft-server.snapshot-threshold,default=8192"`
+	TrailingLogs       int            `value:"raft-server.trailing-logs,default=10240"`
+	HeartbeatTimeout   time.Duration  `value:"raft-server.heartbeat-timeout,default=1s"`
+	ElectionTimeout    time.Duration  `value:"raft-server.election-timeout,default=1s"`
+	LeaderLeaseTimeout time.Duration  `value:"raft-server.leader-lease-timeout,default=500ms"`
+
+	/**
+	Replication pipelining: AppendEntries in flight per follower (1 disables pipelining) and entries per request,
+	high-latency links benefit from larger values
+	 */
+	MaxRPCsInFlight    int            `value:"raft-server.max-rpcs-in-flight,default=2"`
+	MaxAppendEntries   int            `value:"raft-server.max-append-entries,default=64"`
+
+	/**
+	Allowance for the clock rate difference subtracted from the leader lease
+	 */
+	LeaseClockDrift    time.Duration  `value:"raft.lease-clock-drift,default=50ms"`
+
+	/**
+	Pre-vote election reduces disruptive elections from rejoining partitioned nodes,
+	requires hashicorp/raft v1.7.0 or later, the start fails when enabled with the current dependency
+	 */
+	PreVote      bool            `value:"raft.pre-vote,default=false"`
+
+	/**
+	Transport TLS mode: 'auto' uses TLS if configured, 'mixed' accepts TLS and plaintext and dials TLS
+	only to peers advertising it, 'plain' disables TLS.
+	The client certificate checks can not be enforced in 'mixed' mode, the start fails when they are configured.
+	 */
+	TLSMode      string          `value:"raft.tls-mode,default=auto"`
+
+	/**
+	Transport TLS verification: server certificate by CA and name or SAN pattern on dial,
+	client certificate on accept with 'raft.tls.client-auth=require'
+	 */
+	TLSVerify       bool    `value:"raft.tls.verify,default=false"`
+	TLSCAFile       string  `value:"raft.tls.ca-file,default="`
+	TLSServerName   string  `value:"raft.tls.server-name,default="`
+	TLSSANPattern   string  `value:"raft.tls.san-pattern,default="`
+	TLSClientAuth   string  `value:"raft.tls.client-auth,default=none"`
+
+	/**
+	Comma separated patterns of CN, DNS, IP or URI (SPIFFE id) SANs of the accepted client certificates,
+	empty accepts any certificate verified by the CA
+	 */
+	TLSClientAllow  string  `value:"raft.tls.client-allow,default="`
+
+	/**
+	Certificate files watched for rotation, they replace certificates of the injected TLS config
+	or enable TLS when it is not injected
+	 */
+	TLSCertFile        string         `value:"raft.tls.cert-file,default="`
+	TLSKeyFile         string         `value:"raft.tls.key-file,default="`
+	TLSReloadInterval  time.Duration  `value:"raft.tls.reload-interval,default=1m"`
+
+	/**
+	Compression of the raft RPC payloads: 'none' or 'snappy', negotiated per connection with peers advertising it
+	 */
+	Compression  string          `value:"raft.compression,default=none"`
+
+	/**
+	Stages InstallSnapshot streams on disk, so the leader continues interrupted transfer from the staged offset,
+	used with peers advertising it
+	 */
+	SnapshotResume  bool         `value:"raft.snapshot-resume,default=false"`
+
+	/**
+	Gossips the hash of the FSM implementing StateHasher after the startup replay and on interval,
+	the leader alarms when hashes differ at the same index
+	 */
+	StateHash          bool           `value:"raft.state-hash,default=false"`
+	StateHashInterval  time.Duration  `value:"raft.state-hash-interval,default=0"`
+
 	MaxPool      int             `value:"raft.max-pool,default=3"`
+
+	/**
+	Multiplexes the gRPC API on the raft port, the injected gRPC server serves connections of APIListener,
+	connections silent longer than the sniff timeout go to the raft transport, connections not accepted
+	within the accept timeout are closed
+	 */
+	SharedPort              bool           `value:"raft.shared-port,default=false"`
+	SharedPortSniffTimeout  time.Duration  `value:"raft.shared-port-sniff-timeout,default=5s"`
+	SharedPortAcceptTimeout time.Duration  `value:"raft.shared-port-accept-timeout,default=5s"`
+	APIServer               *grpc.Server   `inject:"optional"`
+
+	/**
+	Limits of the inbound transport connections against misbehaving peers and port scanners, zero is unlimited
+	 */
+	MaxConnections     int      `value:"raft.max-connections,default=0"`
+	ConnRatePerIP      int      `value:"raft.conn-rate-per-ip,default=0"`
+	ConnBurstPerIP     int      `value:"raft.conn-burst-per-ip,default=10"`
+
 	Timeout      time.Duration   `value:"raft.timeout,default=10s"`
 
+	/**
+	Snapshot transfer timeout grows by 'raft.timeout' per scale bytes, slow WAN peers override the timeout
+	by 'address=timeout' or 'id=timeout' comma separated pairs
+	 */
+	TimeoutScale  int     `value:"raft.timeout-scale,default=262144"`
+	PeerTimeouts  string  `value:"raft.peer-timeouts,default="`
+	peerTimeouts  map[string]time.Duration
+
+	/**
+	TCP options of the transport: keepalive period (negative disables), TCP_USER_TIMEOUT on linux
+	and connect timeout capping 'raft.timeout' for dials, zero keeps the defaults
+	 */
+	TCPKeepAlive       time.Duration  `value:"raft.tcp.keepalive,default=0"`
+	TCPUserTimeout     time.Duration  `value:"raft.tcp.user-timeout,default=0"`
+	TCPConnectTimeout  time.Duration  `value:"raft.tcp.connect-timeout,default=0"`
+
+	/**
+	Socket tuning of the transport: Nagle's algorithm is disabled by default, zero buffer sizes
+	and negative linger keep the OS defaults, zero linger resets connections on close, positive linger is whole seconds
+	 */
+	TCPNoDelay         bool           `value:"raft.tcp.nodelay,default=true"`
+	TCPReadBuffer      int            `value:"raft.tcp.read-buffer,default=0"`
+	TCPWriteBuffer     int            `value:"raft.tcp.write-buffer,default=0"`
+	TCPLinger          time.Duration  `value:"raft.tcp.linger,default=-1s"`
+
+	/**
+	Attempts of the dial refused by the restarting peer, the interval doubles on each attempt within 'raft.timeout'
+	 */
+	DialRetries        int            `value:"raft.dial-retries,default=3"`
+	DialRetryInterval  time.Duration  `value:"raft.dial-retry-interval,default=50ms"`
+
+	/**
+	PROXY protocol v1/v2 header of the inbound connections from TCP load balancers: 'none', 'optional' or 'required'.
+	Headers are read only from the comma separated CIDRs of the balancers, 'optional' requires them
+	 */
+	ProxyProtocol         string         `value:"raft.proxy-protocol,default=none"`
+	ProxyProtocolTrusted  string         `value:"raft.proxy-protocol-trusted,default="`
+	ProxyProtocolTimeout  time.Duration  `value:"raft.proxy-protocol-timeout,default=5s"`
+
+	/**
+	Background scrub of the log and snapshots, zero interval disables it
+	 */
+	ScrubInterval  time.Duration  `value:"raft.scrub-interval,default=0"`
+	ScrubRate      int            `value:"raft.scrub-rate-mb,default=4"`
+
+	/**
+	Apply rate of the follower lagging more than the threshold behind the last log index, zero is unlimited
+	 */
+	ReplayEntriesPerSec  int     `value:"raft.replay-entries-per-sec,default=0"`
+	ReplayMBPerSec       int     `value:"raft.replay-mb-per-sec,default=0"`
+	ReplayLagThreshold   int     `value:"raft.replay-lag-threshold,default=1000"`
+
+	/**
+	Write rate of snapshot sinks protecting the disk and network during compaction, zero is unlimited.
+	The limit applies to the stream of the FSM before compression and encryption.
+	 */
+	SnapshotWriteMBPerSec  int   `value:"raft.snapshot-write-mb-per-sec,default=0"`
+
+	/**
+	Snapshot is refused when the free space of the snapshot directory is below the size of the last snapshot
+	multiplied by the percent, zero disables the check. The directory is the one of the snapshot factory.
+	 */
+	SnapshotDiskPercent    int     `value:"raft.snapshot-disk-percent,default=150"`
+	SnapshotDir            string  `value:"raft-snapshot.dir,default="`
+
+	/**
+	Autopilot adds alive servers as non-voters and promotes them after stabilization time
+	 */
+	Autopilot               bool           `value:"raft.autopilot,default=false"`
+	AutopilotInterval       time.Duration  `value:"raft.autopilot-interval,default=10s"`
+	ServerStabilizationTime time.Duration  `value:"raft.server-stabilization-time,default=10s"`
+	MaxTrailingLogs         int            `value:"raft.max-trailing-logs,default=250"`
+	LastContactThreshold    time.Duration  `value:"raft.last-contact-threshold,default=200ms"`
+
+	/**
+	Removed or failed servers are not added back by autopilot during TTL, zero disables quarantine
+	 */
+	QuarantineTTL           time.Duration  `value:"raft.quarantine-ttl,default=5m"`
+
+	/**
+	Time for the new server of the replacement to catch up with the leader before the promotion
+	 */
+	ReplaceCatchUpTimeout   time.Duration  `value:"raft.replace-catchup-timeout,default=10m"`
+
+	/**
+	Recovery mode, forces configuration 'id@address,id@address' once before start, the same value is skipped on restarts
+	 */
+	RecoverConfiguration    string         `value:"raft.recover-configuration,default="`
+
+	DataDir      string        `value:"application.data.dir,default="`
+
+	/**
+	Periodic (index, term, time) checkpoints in the metadata store for LookupTime, zero interval disables them
+	 */
+	CheckpointInterval  time.Duration  `value:"raft.checkpoint-interval,default=1m"`
+	CheckpointRetain    int            `value:"raft.checkpoint-retain,default=1440"`
+
+	/**
+	Node is not ready when apply lag or fsm queue exceed thresholds longer than the window
+	 */
+	ReadinessInterval  time.Duration  `value:"raft.readiness-interval,default=1s"`
+	ReadinessWindow    time.Duration  `value:"raft.readiness-window,default=5s"`
+	MaxApplyLag        int            `value:"raft.readiness-max-apply-lag,default=1000"`
+	MaxFSMPending      int            `value:"raft.readiness-max-fsm-pending,default=64"`
+
+	/**
+	Budgets of the shutdown phases
+	 */
+	ShutdownApplyTimeout      time.Duration  `value:"raft.shutdown-apply-timeout,default=5s"`
+	ShutdownSnapshotTimeout   time.Duration  `value:"raft.shutdown-snapshot-timeout,default=30s"`
+	ShutdownTransportTimeout  time.Duration  `value:"raft.shutdown-transport-timeout,default=5s"`
+
 	listener  net.Listener
+	apiListener net.Listener
 	transport *raft.NetworkTransport
 
 	raft      *raft.Raft
+	fsmStats  *InstrumentedFSM
+	logStats  *InstrumentedLogStore
 
 	alive        atomic.Bool
+	scrubbing    atomic.Bool
+	replacing    atomic.Bool
+	replaceOp    atomic.Value  // *ReplaceOperation last applied
+	healthySince map[raft.ServerID]time.Time
+	quarantine   *serverQuarantine
+	assembler    *EventAssembler
+	saturation   atomic.Value
+	snapshotMutex  sync.Mutex  // guards snapshotWG.Add against Wait of the shutdown
+	snapshotClosed bool
+	snapshotWG   sync.WaitGroup
+	snapshotProgress *progressSnapshotStore
+	snapshotDiskGuard *diskGuardSnapshotStore
+	tlsPeers     sync.Map  // key - raft.ServerAddress, value - bool
+	compressPeers sync.Map  // key - raft.ServerAddress, value - string codec
+	resumePeers   sync.Map  // key - raft.ServerAddress, value - bool
+	resumeTransport *resumableTransport
+	stateHash       atomic.String
+	certReloader    *certReloader
+	connLimiter     *connLimiter
+	stateDivergence sync.Map  // key - alarmed index, value - bool
+	notifyCh     chan bool
+	leaderSubs   leaderSubscribers
+	leadership   atomic.Value  // context.Context of the current leadership
+	raftRef      atomic.Value  // *raft.Raft visible to the FSM goroutine started inside raft.NewRaft
 	shutdownOnce sync.Once
 	shutdownCh   chan struct{}
 
@@ -71,10 +353,18 @@ type implRaftServer struct {
 func RaftServer() raftapi.RaftServer {
 	return &implRaftServer{
 		shutdownCh:  make(chan struct{}),
+		assembler:   NewEventAssembler(time.Minute, defaultUserEventSizeLimit, DefaultMaxChunkedPayload),
+		quarantine:  newServerQuarantine(),
+		notifyCh:    make(chan bool, 16),
 	}
 }
 
 func (t *implRaftServer) PostConstruct() error {
+	if t.SerfServer != nil {
+		if conf, ok := t.SerfServer.Config(); ok {
+			t.assembler = NewEventAssembler(time.Minute, conf.UserEventSizeLimit, t.MaxChunkedPayload)
+		}
+	}
 	//t.serfChLAN = make(chan serf.Event, t.SerfQueueSize)
 	//t.SerfConfig.EventCh = t.serfChLAN
 	return nil
@@ -89,12 +379,75 @@ func (t *implRaftServer) GetStats(cb func(name, value string) bool) error {
 		for k, v := range t.raft.Stats() {
 			cb(k, v)
 		}
+		cb("pre_vote", "unsupported")
+		ready, reason := t.Ready()
+		cb("ready", strconv.FormatBool(ready))
+		if reason != "" {
+			cb("not_ready_reason", reason)
+		}
+	}
+
+	if value := t.stateHash.Load(); value != "" {
+		cb("fsm_state_hash", value)
+	}
+
+	if t.certReloader != nil {
+		cb("tls_cert_not_after", t.certReloader.NotAfter().Format(time.RFC3339))
+	}
+
+	if t.connLimiter != nil {
+		cb("transport_connections", strconv.FormatInt(t.connLimiter.Active(), 10))
+		cb("transport_rejected", strconv.FormatUint(t.connLimiter.Rejected(), 10))
+	}
+
+	cb("server_lookup_size", strconv.Itoa(len(t.ServerLookup.Servers())))
+	cb("quarantined", strconv.Itoa(len(t.quarantine.List())))
+
+	if t.SerfServer != nil {
+		if s, ok := t.SerfServer.Serf(); ok && s != nil {
+			counts := make(map[string]int)
+			for _, m := range s.Members() {
+				counts[m.Status.String()]++
+			}
+			cb("serf_members", strconv.Itoa(s.NumMembers()))
+			for status, n := range counts {
+				cb("serf_members_" + status, strconv.Itoa(n))
+			}
+		}
+	}
+
+	if t.snapshotProgress != nil {
+		t.snapshotProgress.GetStats(cb)
+	}
+
+	if t.snapshotDiskGuard != nil {
+		t.snapshotDiskGuard.GetStats(cb)
+	}
+
+	if t.fsmStats != nil {
+		t.fsmStats.GetStats(cb)
+	}
+
+	if t.logStats != nil {
+		t.logStats.GetStats(cb)
+	}
+
+	// applications expose FSM stats by implementing the same GetStats method
+	if stats, ok := t.FSM.(interface{ GetStats(func(name, value string) bool) error }); ok {
+		return stats.GetStats(func(name, value string) bool {
+			return cb("fsm_" + name, value)
+		})
 	}
 	return nil
 }
 
 func (t *implRaftServer) Bind() (err error) {
 
+	if t.RaftRole == RaftRoleClient {
+		t.Log.Info("RaftClientRole", zap.String("prop", "raft.role"))
+		return nil
+	}
+
 	if t.RaftAddress == "" {
 		t.Log.Warn("RaftAddressEmpty", zap.String("prop", "raft.bind-address"))
 		return nil
@@ -105,17 +458,52 @@ func (t *implRaftServer) Bind() (err error) {
 		return nil
 	}
 
-	raftAddr, err := ParseAndAdjustTCPAddr(t.RaftAddress, t.NodeService.NodeSeq())
+	switch t.TLSMode {
+	case TLSModeAuto, TLSModeMixed, TLSModePlain:
+	default:
+		return errors.Errorf("invalid property 'raft.tls-mode' value '%s'", t.TLSMode)
+	}
+
+	if t.MaxRPCsInFlight < 1 {
+		return errors.Errorf("invalid property 'raft-server.max-rpcs-in-flight' value %d, expected at least 1", t.MaxRPCsInFlight)
+	}
+
+	if t.TimeoutScale <= 0 {
+		return errors.Errorf("invalid property 'raft.timeout-scale' value %d, expected positive", t.TimeoutScale)
+	}
+
+	if t.peerTimeouts, err = parsePeerTimeouts(t.PeerTimeouts); err != nil {
+		return errors.Errorf("issue in property 'raft.peer-timeouts', %v", err)
+	}
+
+	if path, ok := unixSocketPath(t.RaftAddress); ok {
+		if t.SharedPort {
+			return errors.New("property 'raft.shared-port' needs TCP 'raft.bind-address'")
+		}
+		return t.bindUnix(path)
+	}
+
+	if t.SharedPort && t.ProxyProtocol != ProxyProtocolNone {
+		return errors.New("property 'raft.shared-port' is not compatible with 'raft.proxy-protocol'")
+	}
+
+	raftAddrs, err := ResolveBindAddresses(t.RaftAddress, t.NodeService.NodeSeq())
 	if err != nil {
 		return errors.Errorf("issue in property 'raft.bind-address', %v", err)
 	}
-	t.RaftAddress = fmt.Sprintf("%s:%d", raftAddr.IP.String(), raftAddr.Port)
+	t.RaftAddress = raftAddrs[0].String()
 
-	t.listener, err = net.Listen("tcp", t.RaftAddress)
+	t.listener, err = listenAll(raftAddrs)
 	if err != nil {
 		return errors.Errorf("bind failed on '%s', %v", t.RaftAddress, err)
 	}
 
+	if t.SharedPort {
+		mux := newMuxListener(t.listener, t.SharedPortSniffTimeout, t.SharedPortAcceptTimeout)
+		t.listener, t.apiListener = mux.raft, mux.api
+		t.Log.Info("RaftSharedPort", zap.String("bind", t.listener.Addr().String()))
+	}
+
 	advertise, err := net.ResolveTCPAddr("tcp", ReplaceToPrivateIP(t.RaftAddress))
 	if err != nil {
 		return errors.Errorf("tcp address resolve '%s', %v", t.listener.Addr().String(), err)
@@ -123,10 +511,101 @@ func (t *implRaftServer) Bind() (err error) {
 
 	t.Log.Info("RaftServerFactory", zap.String("bind", t.listener.Addr().String()), zap.String("advertise", advertise.String()))
 
-	t.transport, err = newTCPTransport(t.listener, advertise, t.TlsConfig, func(stream raft.StreamLayer) *raft.NetworkTransport {
+	t.connLimiter = newConnLimiter(t.MaxConnections, float64(t.ConnRatePerIP), t.ConnBurstPerIP)
+
+	compression, err := compressionCode(t.Compression)
+	if err != nil {
+		return errors.Errorf("issue in property 'raft.compression', %v", err)
+	}
+
+	options := tcpStreamOptions{
+		tlsConfig:    t.TlsConfig,
+		mixedTLS:     t.TLSMode == TLSModeMixed,
+		peerTLS:      t.isPeerTLS,
+		compression:  compression,
+		peerCompress: t.isPeerCompress,
+		limiter:      t.connLimiter,
+		keepAlive:    t.TCPKeepAlive,
+		userTimeout:  t.TCPUserTimeout,
+		connectTimeout: t.TCPConnectTimeout,
+		noDelay:        t.TCPNoDelay,
+		readBuffer:     t.TCPReadBuffer,
+		writeBuffer:    t.TCPWriteBuffer,
+		linger:         t.TCPLinger,
+		proxyProtocol:  t.ProxyProtocol,
+		proxyTimeout:   t.ProxyProtocolTimeout,
+		dialRetries:    t.DialRetries,
+		dialBackoff:    t.DialRetryInterval,
+		timeout:        t.Timeout,
+	}
+
+	if len(t.peerTimeouts) > 0 {
+		options.peerTimeout = t.peerTimeout
+	}
+
+	if t.DialRetries > 0 && t.DialRetryInterval <= 0 {
+		return errors.Errorf("property 'raft.dial-retry-interval' must be positive with 'raft.dial-retries' %d", t.DialRetries)
+	}
+
+	if t.TCPLinger > 0 && t.TCPLinger % time.Second != 0 {
+		// SO_LINGER has the resolution of seconds, sub-second value would reset connections on close
+		return errors.Errorf("property 'raft.tcp.linger' must be whole seconds instead of '%v'", t.TCPLinger)
+	}
+
+	switch t.ProxyProtocol {
+	case ProxyProtocolNone, ProxyProtocolOptional, ProxyProtocolRequired:
+	default:
+		return errors.Errorf("invalid property 'raft.proxy-protocol' value '%s'", t.ProxyProtocol)
+	}
+
+	options.proxyTrusted, err = parseProxyTrusted(t.ProxyProtocolTrusted)
+	if err != nil {
+		return errors.Errorf("issue in property 'raft.proxy-protocol-trusted', %v", err)
+	}
+	if t.ProxyProtocol == ProxyProtocolOptional && len(options.proxyTrusted) == 0 {
+		// any client could claim the address of the peer otherwise
+		return errors.New("property 'raft.proxy-protocol-trusted' is required by 'optional' in property 'raft.proxy-protocol'")
+	}
+
+	if t.TCPUserTimeout > 0 && !tcpUserTimeoutSupported {
+		t.Log.Warn("TCPUserTimeoutNotSupported", zap.String("prop", "raft.tcp.user-timeout"), zap.String("os", runtime.GOOS))
+	}
+
+	if options.tlsConfig == nil && t.TLSCertFile != "" {
+		options.tlsConfig = &tls.Config{}
+	}
+
+	if t.TLSMode == TLSModePlain {
+		options.tlsConfig = nil
+	}
+
+	if options.tlsConfig != nil {
+		if t.TLSCertFile != "" || t.TLSKeyFile != "" {
+			if t.certReloader, err = newCertReloader(t.TLSCertFile, t.TLSKeyFile); err != nil {
+				return err
+			}
+		}
+		options.dialConfig, options.tlsConfig, err = buildTransportTLS(options.tlsConfig, transportTLSOptions{
+			verify:      t.TLSVerify,
+			caFile:      t.TLSCAFile,
+			serverName:  t.TLSServerName,
+			sanPattern:  t.TLSSANPattern,
+			clientAuth:  t.TLSClientAuth,
+			clientAllow: t.TLSClientAllow,
+			mixed:       t.TLSMode == TLSModeMixed,
+			reloader:    t.certReloader,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	t.transport, err = newTCPTransport(t.listener, advertise, options, func(stream raft.StreamLayer) *raft.NetworkTransport {
 		config := &raft.NetworkTransportConfig{Stream: stream, MaxPool: t.MaxPool, Timeout: t.Timeout, Logger: t.HCLog.Named("raft-transport"),
-			ServerAddressProvider: t.ServerLookup}
-		return raft.NewNetworkTransportWithConfig(config)
+			ServerAddressProvider: t.ServerLookup, MaxRPCsInFlight: t.MaxRPCsInFlight}
+		trans := raft.NewNetworkTransportWithConfig(config)
+		trans.TimeoutScale = t.TimeoutScale
+		return trans
 
 		//return raft.NewNetworkTransport(stream, t.MaxPool, t.Timeout, os.Stderr)
 	})
@@ -137,6 +616,92 @@ func (t *implRaftServer) Bind() (err error) {
 	return nil
 }
 
+func (t *implRaftServer) bindUnix(path string) (err error) {
+
+	// peers of the unix socket are not authenticated at all
+	if t.TLSClientAuth == TLSClientAuthRequire || t.TLSClientAllow != "" {
+		return errors.Errorf("properties 'raft.tls.client-auth=require' and 'raft.tls.client-allow' can not be enforced on unix socket '%s'", path)
+	}
+
+	if t.TlsConfig != nil && t.TLSMode != TLSModePlain {
+		t.Log.Warn("RaftUnixSocketPlain", zap.String("prop", "raft.tls-mode"), zap.String("reason", "unix socket transport does not use TLS"))
+	}
+
+	t.listener, err = listenUnix(path)
+	if err != nil {
+		return errors.Errorf("bind failed on unix socket '%s', %v", path, err)
+	}
+
+	t.Log.Info("RaftServerFactory", zap.String("bind", t.listener.Addr().String()), zap.String("network", "unix"))
+
+	t.transport, err = newUnixTransport(t.listener, func(stream raft.StreamLayer) *raft.NetworkTransport {
+		config := &raft.NetworkTransportConfig{Stream: stream, MaxPool: t.MaxPool, Timeout: t.Timeout, Logger: t.HCLog.Named("raft-transport"),
+			ServerAddressProvider: t.ServerLookup, MaxRPCsInFlight: t.MaxRPCsInFlight}
+		trans := raft.NewNetworkTransportWithConfig(config)
+		trans.TimeoutScale = t.TimeoutScale
+		return trans
+	})
+	if err != nil {
+		return errors.Errorf("raft transport creation error for unix socket '%s', %v", path, err)
+	}
+
+	return nil
+}
+
+func (t *implRaftServer) publish(event *ClusterEvent) {
+	if t.EventBus != nil {
+		t.EventBus.Publish(event)
+	}
+}
+
+// FSM goroutine checks the lag against the last log index
+func (t *implRaftServer) isLagging(index uint64) bool {
+	r, ok := t.raftRef.Load().(*raft.Raft)
+	if !ok || r.State() == raft.Leader {
+		return false
+	}
+	last := r.LastIndex()
+	return last > index && last - index > uint64(t.ReplayLagThreshold)
+}
+
+// raft goroutine truncating the log archives applied entries only
+func (t *implRaftServer) appliedIndex() uint64 {
+	r, ok := t.raftRef.Load().(*raft.Raft)
+	if !ok {
+		return 0
+	}
+	return r.AppliedIndex()
+}
+
+func (t *implRaftServer) isPeerCompress(address raft.ServerAddress) bool {
+	codec, ok := t.compressPeers.Load(address)
+	return ok && codec == t.Compression
+}
+
+/**
+Listener of the gRPC connections multiplexed on the raft port by 'raft.shared-port'
+ */
+func (t *implRaftServer) APIListener() (net.Listener, bool) {
+	return t.apiListener, t.apiListener != nil
+}
+
+func (t *implRaftServer) serveAPI() {
+	t.Log.Info("RaftSharedPortServe", zap.String("addr", t.apiListener.Addr().String()))
+	if err := t.APIServer.Serve(t.apiListener); err != nil && t.alive.Load() {
+		t.Log.Error("RaftSharedPortServe", zap.Error(err))
+	}
+}
+
+func (t *implRaftServer) isPeerResume(address raft.ServerAddress) bool {
+	val, ok := t.resumePeers.Load(address)
+	return ok && val.(bool)
+}
+
+func (t *implRaftServer) isPeerTLS(address raft.ServerAddress) bool {
+	val, ok := t.tlsPeers.Load(address)
+	return ok && val.(bool)
+}
+
 func (t *implRaftServer) Alive() bool {
 	return t.alive.Load()
 }
@@ -153,6 +718,32 @@ func (t *implRaftServer) IsLeader() bool {
 	return t.alive.Load() && t.raft.State() == raft.Leader
 }
 
+func (t *implRaftServer) Snapshot() (*raft.SnapshotMeta, error) {
+	t.snapshotMutex.Lock()
+	if t.snapshotClosed || !t.alive.Load() {
+		t.snapshotMutex.Unlock()
+		return nil, errors.New("raft server is not running")
+	}
+	t.snapshotWG.Add(1)
+	t.snapshotMutex.Unlock()
+	defer t.snapshotWG.Done()
+
+	future := t.raft.Snapshot()
+	if err := future.Error(); err != nil {
+		return nil, errors.Errorf("raft snapshot, %v", err)
+	}
+
+	meta, source, err := future.Open()
+	if err != nil {
+		return nil, errors.Errorf("open snapshot, %v", err)
+	}
+	source.Close()
+
+	t.Log.Info("RaftSnapshot", zap.String("id", meta.ID), zap.Uint64("index", meta.Index), zap.Uint64("term", meta.Term), zap.Int64("size", meta.Size))
+	t.publish(&ClusterEvent{Type: EventSnapshotTaken, ID: meta.ID, Index: meta.Index, Term: meta.Term})
+	return meta, nil
+}
+
 func (t *implRaftServer) ListenAddress() net.Addr {
 	if t.listener != nil {
 		return t.listener.Addr()
@@ -165,18 +756,134 @@ func (t *implRaftServer) Serve() (err error) {
 
 	panicToError(&err)
 
-	t.Log.Info("RaftServerServe", zap.String("addr", t.RaftAddress), zap.Bool("tls", t.TlsConfig != nil))
+	if t.transport == nil {
+		t.Log.Warn("RaftServerNotBound", zap.String("role", t.RaftRole))
+		return nil
+	}
+
+	t.Log.Info("RaftServerServe", zap.String("addr", t.RaftAddress), zap.Bool("tls", t.TlsConfig != nil || t.TLSCertFile != ""))
 
 	t.alive.Store(false)
 
 	config := raft.DefaultConfig()
 	config.LocalID = raft.ServerID(t.NodeService.NodeIdHex())
 	config.Logger = t.HCLog.Named("raft")
+	config.ProtocolVersion = raft.ProtocolVersion(t.ProtocolVersion)
+	config.NotifyCh = t.notifyCh
+	config.SnapshotInterval = t.SnapshotInterval
+	config.SnapshotThreshold = uint64(t.SnapshotThreshold)
+	config.TrailingLogs = uint64(t.TrailingLogs)
+	config.HeartbeatTimeout = t.HeartbeatTimeout
+	config.ElectionTimeout = t.ElectionTimeout
+	config.LeaderLeaseTimeout = t.LeaderLeaseTimeout
+	config.MaxAppendEntries = t.MaxAppendEntries
+
+	if t.LeaseClockDrift < 0 || t.LeaseClockDrift >= t.LeaderLeaseTimeout {
+		return errors.New("property 'raft.lease-clock-drift' must be non-negative and less than 'raft-server.leader-lease-timeout'")
+	}
+
+	// pre-vote appeared in hashicorp/raft v1.7.0, the classic election must not run silently instead
+	if t.PreVote {
+		return errors.New("property 'raft.pre-vote' requires hashicorp/raft v1.7.0 or later")
+	}
+
+	if t.SnapshotThreshold < 0 || t.TrailingLogs < 0 {
+		return errors.New("properties 'raft-server.snapshot-threshold' and 'raft-server.trailing-logs' must not be negative")
+	}
+
+	if err := raft.ValidateConfig(config); err != nil {
+		return errors.Errorf("issue in 'raft-server.*' properties, %v", err)
+	}
+
+	if t.RecoverConfiguration != "" {
+		configuration, err := ParseRecoverConfiguration(t.RecoverConfiguration)
+		if err != nil {
+			return errors.Errorf("issue in property 'raft.recover-configuration', %v", err)
+		}
+		if err := t.recoverConfigurationOnce(config, configuration); err != nil {
+			return err
+		}
+	} else if err := t.recoverPeersJSON(config); err != nil {
+		return err
+	}
+
+	fsm := t.FSM
+	if t.FSMInstrumentation {
+		fsm, t.fsmStats = NewInstrumentedFSM(t.FSM)
+	}
+
+	if t.ReplayEntriesPerSec > 0 || t.ReplayMBPerSec > 0 {
+		fsm = newReplayThrottleFSM(fsm, float64(t.ReplayEntriesPerSec), float64(t.ReplayMBPerSec) * 1024 * 1024, t.isLagging, t.shutdownCh)
+	}
+
+	fsm = newReplaceStateFSM(fsm, t.applyReplace)
+
+	snapshots := raft.SnapshotStore(t.FileSnapshotStore)
+	if t.SnapshotQuarantine {
+		store := newQuarantineSnapshotStore(t.FileSnapshotStore, t.LogStore, t.MetadataStore, t.Log)
+		fsm = newRestoreGuardFSM(fsm, store, func(id string, err error) {
+			t.publish(&ClusterEvent{Type: EventSnapshotQuarantined, ID: id, Status: err.Error()})
+		})
+		snapshots = store
+	}
+
+	if len(t.SnapshotHandlers) > 0 {
+		snapshots = newNotifySnapshotStore(snapshots, t.SnapshotHandlers, t.Log, t.shutdownCh)
+	}
+
+	if t.SnapshotDiskPercent > 0 {
+		dir := t.SnapshotDir
+		if dir == "" {
+			dir = filepath.Join(t.raftDataDir(), "raft-snapshot")
+		}
+		t.snapshotDiskGuard = newDiskGuardSnapshotStore(snapshots, dir, t.SnapshotDiskPercent)
+		snapshots = t.snapshotDiskGuard
+	}
+
+	t.snapshotProgress = newProgressSnapshotStore(snapshots, float64(t.SnapshotWriteMBPerSec) * 1024 * 1024, t.shutdownCh)
+	snapshots = t.snapshotProgress
+
+	var transport raft.Transport = t.transport
+	if t.SnapshotResume {
+		store := snapshots
+		t.resumeTransport, err = newResumableTransport(t.transport, filepath.Join(t.raftDataDir(), snapshotStagingDir), t.Log,
+			t.isPeerResume, t.stagedPeerOffset, func(args *raft.InstallSnapshotRequest) (string, bool) {
+				return snapshotIDOf(store, args)
+			}, t.shutdownCh)
+		if err != nil {
+			return err
+		}
+		transport = t.resumeTransport
+	}
+
+	if t.VerifyStores {
+		report, err := VerifyRaftStores(t.LogStore, t.StableStore)
+		if err != nil {
+			return errors.Errorf("issue in property 'raft.verify-stores', %v", err)
+		}
+		if !report.Consistent() {
+			return errors.Errorf("inconsistent raft stores, %s", report)
+		}
+		t.Log.Info("RaftStoresVerified", zap.Uint64("first", report.FirstIndex), zap.Uint64("last", report.LastIndex), zap.Uint64("term", report.CurrentTerm))
+	}
+
+	logStore := t.LogStore
+	if len(t.LogArchivers) > 0 {
+		if t.LogArchiveBatch < 1 {
+			return errors.Errorf("invalid property 'raft.log-archive-batch' value %d", t.LogArchiveBatch)
+		}
+		logStore = newArchivingLogStore(logStore, t.LogArchivers, t.LogArchiveBatch, t.appliedIndex)
+	}
+	if t.LogStoreInstrumentation {
+		t.logStats = NewInstrumentedLogStore(logStore)
+		logStore = t.logStats
+	}
 
-	t.raft, err = raft.NewRaft(config, t.FSM, t.LogStore, t.StableStore, t.FileSnapshotStore, t.transport)
+	t.raft, err = raft.NewRaft(config, fsm, logStore, t.StableStore, snapshots, transport)
 	if err != nil {
 		return err
 	}
+	t.raftRef.Store(t.raft)
 
 	/*
 	t.serf, err = serf.Create(t.SerfConfig)
@@ -200,7 +907,48 @@ func (t *implRaftServer) Serve() (err error) {
 	t.Log.Info("SerfServerServe", zap.String("addr", serfAddr), zap.Any("stats", t.serf.Stats()))
 	 */
 
+	go t.observeLeadership()
+	go t.notifyLeadership()
+
+	if t.apiListener != nil {
+		if t.APIServer != nil {
+			go t.serveAPI()
+		} else {
+			t.Log.Warn("RaftSharedPortNoServer", zap.String("prop", "raft.shared-port"), zap.String("reason", "no gRPC server to serve the API connections"))
+			t.apiListener.Close()
+		}
+	}
+
+	if t.ReadinessInterval > 0 {
+		go t.readinessLoop()
+	}
+
+	if t.ScrubInterval > 0 {
+		go t.scrubLoop()
+	}
+
+	if t.Autopilot {
+		go t.autopilotLoop()
+	}
+
+	if t.CheckpointInterval > 0 && t.MetadataStore != nil {
+		go t.checkpointLoop()
+	}
+
+	if t.certReloader != nil && t.TLSReloadInterval > 0 {
+		go t.certReloader.watch(t.TLSReloadInterval, t.Log, t.shutdownCh)
+	}
+
+	if t.StateHash {
+		if hasher, ok := t.FSM.(StateHasher); ok {
+			go t.stateHashLoop(hasher)
+		} else {
+			t.Log.Warn("StateHashNotSupported", zap.String("prop", "raft.state-hash"), zap.String("reason", "FSM does not implement StateHasher"))
+		}
+	}
+
 	t.alive.Store(true)
+	t.registerService(nil)
 	return nil
 }
 
@@ -211,6 +959,9 @@ func (t *implRaftServer) Shutdown() error {
 
 		t.Log.Info("RaftServerShutdown", zap.String("addr", t.RaftAddress))
 		close(t.shutdownCh)
+		if t.raft != nil {
+			t.deregisterService()
+		}
 		/*
 		if t.serf != nil {
 			if err := t.serf.Leave(); err != nil {
@@ -223,15 +974,28 @@ func (t *implRaftServer) Shutdown() error {
 		 */
 
 		if t.raft != nil {
-			future := t.raft.Shutdown()
-			go func() {
-				if err := future.Error(); err != nil {
-					t.Log.Error("RaftShutdown", zap.Error(err))
-				}
-			}()
+
+			if t.raft.State() == raft.Leader {
+				waitPhase(t.Log, "applies", t.ShutdownApplyTimeout, func() error {
+					return t.raft.Barrier(t.ShutdownApplyTimeout).Error()
+				})
+			}
+
+			// no new snapshots after this point
+			t.snapshotMutex.Lock()
+			t.snapshotClosed = true
+			t.snapshotMutex.Unlock()
+
+			waitPhase(t.Log, "snapshot", t.ShutdownSnapshotTimeout, func() error {
+				t.snapshotWG.Wait()
+				return t.raft.Shutdown().Error()
+			})
 		}
 		if t.transport != nil {
-			t.transport.Close()
+			waitPhase(t.Log, "transport", t.ShutdownTransportTimeout, t.transport.Close)
+		}
+		if t.apiListener != nil {
+			t.apiListener.Close()
 		}
 		if t.listener != nil {
 			t.listener.Close()
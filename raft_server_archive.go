@@ -0,0 +1,251 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+/**
+SNAPSHOT ARCHIVE
+
+Gzipped tar of 'meta.json' with raft.SnapshotMeta, 'state.bin' with the plain state of the FSM
+and 'SHA256SUMS' with hashes of both files, the same layout as 'consul snapshot save'.
+ */
+
+const (
+	archiveMetaFile  = "meta.json"
+	archiveStateFile = "state.bin"
+	archiveSumsFile  = "SHA256SUMS"
+)
+
+func (t *implRaftServer) ExportSnapshot(w io.Writer) (*raft.SnapshotMeta, error) {
+	return t.ExportSnapshotID("", w)
+}
+
+func (t *implRaftServer) ExportSnapshotID(id string, w io.Writer) (*raft.SnapshotMeta, error) {
+
+	if id == "" {
+		list, err := t.FileSnapshotStore.List()
+		if err != nil {
+			return nil, errors.Errorf("list snapshots, %v", err)
+		}
+		if len(list) == 0 {
+			return nil, errors.New("no snapshots to export")
+		}
+		id = list[0].ID
+	}
+
+	meta, source, err := t.FileSnapshotStore.Open(id)
+	if err != nil {
+		return nil, errors.Errorf("open snapshot '%s', %v", id, err)
+	}
+	defer source.Close()
+
+	if err := writeSnapshotArchive(w, meta, source, t.raftDataDir()); err != nil {
+		return nil, errors.Errorf("export snapshot '%s', %v", id, err)
+	}
+
+	t.Log.Info("RaftSnapshotExported", zap.String("id", meta.ID), zap.Uint64("index", meta.Index), zap.Uint64("term", meta.Term))
+	return meta, nil
+}
+
+func (t *implRaftServer) ImportSnapshot(r io.Reader) (*raft.SnapshotMeta, error) {
+	if !t.alive.Load() {
+		return nil, errors.New("raft server is not running")
+	}
+
+	meta, state, err := readSnapshotArchive(r, t.raftDataDir())
+	if err != nil {
+		return nil, errors.Errorf("import snapshot, %v", err)
+	}
+	defer func() {
+		state.Close()
+		os.Remove(state.Name())
+	}()
+
+	t.Log.Warn("RaftSnapshotImport", zap.String("id", meta.ID), zap.Uint64("index", meta.Index), zap.Uint64("term", meta.Term), zap.Int64("size", meta.Size))
+
+	// the leader takes the state and installs it to followers
+	if err := t.raft.Restore(meta, bufio.NewReader(state), 0); err != nil {
+		return nil, errors.Errorf("restore snapshot, %v", err)
+	}
+
+	t.publish(&ClusterEvent{Type: EventSnapshotRestored, ID: meta.ID, Index: meta.Index, Term: meta.Term})
+	return meta, nil
+}
+
+/**
+Writes the archive of the snapshot, the state is spooled to the temp file in the dir first,
+because sizes of encrypted stores are sizes of the cipher text
+ */
+func writeSnapshotArchive(w io.Writer, meta *raft.SnapshotMeta, source io.Reader, spoolDir string) error {
+
+	spool, err := os.CreateTemp(spoolDir, "export-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+
+	stateHash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, stateHash), source)
+	if err != nil {
+		return errors.Errorf("read state, %v", err)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	exported := *meta
+	exported.Size = size
+	metaJSON, err := json.Marshal(&exported)
+	if err != nil {
+		return err
+	}
+	metaHash := sha256.Sum256(metaJSON)
+
+	var sums bytes.Buffer
+	fmt.Fprintf(&sums, "%x  %s\n", metaHash, archiveMetaFile)
+	fmt.Fprintf(&sums, "%x  %s\n", stateHash.Sum(nil), archiveStateFile)
+
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	now := time.Now()
+
+	files := []struct {
+		name    string
+		size    int64
+		reader  io.Reader
+	}{
+		{archiveMetaFile, int64(len(metaJSON)), bytes.NewReader(metaJSON)},
+		{archiveStateFile, size, spool},
+		{archiveSumsFile, int64(sums.Len()), &sums},
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0600, Size: f.size, ModTime: now}); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, f.reader); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+/**
+Reads the archive, verifies hashes and returns the meta and the state spooled to the temp file in the dir,
+the caller removes the file
+ */
+func readSnapshotArchive(r io.Reader, spoolDir string) (*raft.SnapshotMeta, *os.File, error) {
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, errors.Errorf("invalid archive, %v", err)
+	}
+	defer zr.Close()
+
+	spool, err := os.CreateTemp(spoolDir, "import-*.tmp")
+	if err != nil {
+		return nil, nil, err
+	}
+	fail := func(err error) (*raft.SnapshotMeta, *os.File, error) {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, nil, err
+	}
+
+	var metaJSON, sums []byte
+	hashes := make(map[string]string)
+	stateRead := false
+
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(errors.Errorf("invalid archive, %v", err))
+		}
+
+		h := sha256.New()
+		switch hdr.Name {
+		case archiveMetaFile:
+			metaJSON, err = io.ReadAll(io.TeeReader(io.LimitReader(tr, 1 << 20), h))
+		case archiveStateFile:
+			_, err = io.Copy(io.MultiWriter(spool, h), tr)
+			stateRead = true
+		case archiveSumsFile:
+			sums, err = io.ReadAll(io.LimitReader(tr, 1 << 16))
+		default:
+			return fail(errors.Errorf("unexpected file '%s' in archive", hdr.Name))
+		}
+		if err != nil {
+			return fail(errors.Errorf("read '%s', %v", hdr.Name, err))
+		}
+		hashes[hdr.Name] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	if metaJSON == nil || !stateRead || sums == nil {
+		return fail(errors.Errorf("archive requires '%s', '%s' and '%s'", archiveMetaFile, archiveStateFile, archiveSumsFile))
+	}
+
+	verified := 0
+	for _, line := range strings.Split(string(sums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		name := strings.TrimPrefix(fields[1], "*")
+		if name != archiveMetaFile && name != archiveStateFile {
+			continue
+		}
+		if hashes[name] != fields[0] {
+			return fail(errors.Wrapf(ErrSnapshotIntegrity, "hash mismatch of '%s' in archive", name))
+		}
+		verified++
+	}
+	if verified != 2 {
+		return fail(errors.Errorf("'%s' has no hashes of '%s' and '%s'", archiveSumsFile, archiveMetaFile, archiveStateFile))
+	}
+
+	meta := new(raft.SnapshotMeta)
+	if err := json.Unmarshal(metaJSON, meta); err != nil {
+		return fail(errors.Errorf("invalid '%s', %v", archiveMetaFile, err))
+	}
+	fi, err := spool.Stat()
+	if err != nil {
+		return fail(err)
+	}
+	if fi.Size() != meta.Size {
+		return fail(errors.Wrapf(ErrSnapshotIntegrity, "state has %d bytes whereas meta has %d bytes", fi.Size(), meta.Size))
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	return meta, spool, nil
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestSnapshotArchive(t *testing.T) {
+
+	dir, err := os.MkdirTemp(os.TempDir(), "raftmodtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte("fsm state "), 1000)
+	// size of the encrypted store differs from the plain state
+	meta := &raft.SnapshotMeta{ID: "1-100-1", Index: 100, Term: 1, Size: 12345}
+
+	var archive bytes.Buffer
+	require.NoError(t, writeSnapshotArchive(&archive, meta, bytes.NewReader(content), dir))
+
+	imported, state, err := readSnapshotArchive(bytes.NewReader(archive.Bytes()), dir)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), imported.Index)
+	require.Equal(t, int64(len(content)), imported.Size)
+	actual, err := io.ReadAll(state)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(content, actual))
+	state.Close()
+	os.Remove(state.Name())
+
+	// tampered state
+	var tampered bytes.Buffer
+	zr, err := gzip.NewReader(bytes.NewReader(archive.Bytes()))
+	require.NoError(t, err)
+	tr := tar.NewReader(zr)
+	zw := gzip.NewWriter(&tampered)
+	tw := tar.NewWriter(zw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		if hdr.Name == archiveStateFile {
+			data[10] ^= 1
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err = tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+
+	_, _, err = readSnapshotArchive(&tampered, dir)
+	require.True(t, errors.Is(err, ErrSnapshotIntegrity))
+
+	_, _, err = readSnapshotArchive(bytes.NewReader([]byte("not an archive")), dir)
+	require.Error(t, err)
+
+	// spooled files are removed
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(files))
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/serf/serf"
+	"github.com/sprintframework/raftapi"
+	"go.uber.org/zap"
+	"time"
+)
+
+func (t *implRaftServer) autopilotLoop() {
+
+	t.Log.Info("AutopilotStarted", zap.Duration("interval", t.AutopilotInterval), zap.Duration("stabilization", t.ServerStabilizationTime))
+
+	t.healthySince = make(map[raft.ServerID]time.Time)
+
+	ticker := time.NewTicker(t.AutopilotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if t.IsLeader() {
+				if err := t.reconcileServers(); err != nil {
+					t.Log.Error("AutopilotReconcile", zap.Error(err))
+				}
+			} else if len(t.healthySince) > 0 {
+				t.healthySince = make(map[raft.ServerID]time.Time)
+			}
+		case <-t.shutdownCh:
+			return
+		}
+	}
+}
+
+func (t *implRaftServer) reconcileServers() error {
+
+	future := t.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return err
+	}
+
+	known := make(map[raft.ServerID]raft.Server)
+	for _, srv := range future.Configuration().Servers {
+		known[srv.ID] = srv
+	}
+
+	for _, server := range t.ServerLookup.Servers() {
+
+		id := raft.ServerID(server.ID)
+		addr := RaftServerAddress(server)
+
+		if server.Status != serf.StatusAlive.String() {
+			delete(t.healthySince, id)
+			continue
+		}
+
+		current, ok := known[id]
+		if !ok {
+			if t.quarantine.Contains(server.ID) {
+				t.Log.Debug("AutopilotQuarantined", zap.String("id", server.ID))
+				continue
+			}
+			t.Log.Info("AutopilotAddNonvoter", zap.String("id", server.ID), zap.String("addr", string(addr)))
+			if err := t.raft.AddNonvoter(id, addr, 0, t.Timeout).Error(); err != nil {
+				t.Log.Error("AutopilotAddNonvoter", zap.String("id", server.ID), zap.Error(err))
+			}
+			delete(t.healthySince, id)
+			continue
+		}
+
+		if current.Suffrage != raft.Nonvoter {
+			delete(t.healthySince, id)
+			continue
+		}
+
+		// demoted by the replacement or removed recently
+		if t.quarantine.Contains(server.ID) {
+			delete(t.healthySince, id)
+			continue
+		}
+
+		if !t.isHealthy(server) {
+			delete(t.healthySince, id)
+			continue
+		}
+
+		since, ok := t.healthySince[id]
+		if !ok {
+			t.healthySince[id] = time.Now()
+			continue
+		}
+
+		if time.Since(since) < t.ServerStabilizationTime {
+			continue
+		}
+
+		t.Log.Info("AutopilotPromote", zap.String("id", server.ID), zap.String("addr", string(current.Address)), zap.Duration("healthy", time.Since(since)))
+		if err := t.raft.AddVoter(id, current.Address, 0, t.Timeout).Error(); err != nil {
+			t.Log.Error("AutopilotPromote", zap.String("id", server.ID), zap.Error(err))
+			continue
+		}
+		delete(t.healthySince, id)
+	}
+
+	return nil
+}
+
+func (t *implRaftServer) isHealthy(server *raftapi.Server) bool {
+
+	health, err := t.NodeHealth(server.ID)
+	if err != nil {
+		t.Log.Debug("AutopilotNodeHealth", zap.String("id", server.ID), zap.Error(err))
+		return false
+	}
+
+	if !health.Healthy {
+		t.Log.Debug("AutopilotNodeUnhealthy", zap.String("id", server.ID), zap.Strings("reasons", health.Reasons))
+		return false
+	}
+
+	return true
+}
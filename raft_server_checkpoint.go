@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+// metadata namespace of the index to wall-clock checkpoints
+const checkpointNamespace = "index-time"
+
+/**
+Wall-clock time of the applied log index
+ */
+type IndexCheckpoint struct {
+	Index  uint64     `json:"index"`
+	Term   uint64     `json:"term"`
+	Time   time.Time  `json:"time"`
+}
+
+/**
+Approximate time of the log index
+ */
+type IndexTime struct {
+	Index   uint64           `json:"index"`
+	Time    time.Time        `json:"time"`
+	Exact   bool             `json:"exact"`
+	Before  *IndexCheckpoint `json:"before,omitempty"`
+	After   *IndexCheckpoint `json:"after,omitempty"`
+}
+
+func checkpointKey(index uint64) string {
+	return fmt.Sprintf("%020d", index)
+}
+
+func (t *implRaftServer) checkpointLoop() {
+
+	t.Log.Info("IndexCheckpointScheduled", zap.Duration("interval", t.CheckpointInterval), zap.Int("retain", t.CheckpointRetain))
+
+	ticker := time.NewTicker(t.CheckpointInterval)
+	defer ticker.Stop()
+
+	var lastIndex uint64
+	for {
+		select {
+		case <-ticker.C:
+			index := t.raft.AppliedIndex()
+			if index == lastIndex {
+				continue
+			}
+			if err := t.recordCheckpoint(index); err != nil {
+				t.Log.Error("IndexCheckpoint", zap.Uint64("index", index), zap.Error(err))
+				continue
+			}
+			lastIndex = index
+		case <-t.shutdownCh:
+			return
+		}
+	}
+}
+
+func (t *implRaftServer) recordCheckpoint(index uint64) error {
+
+	term, err := t.indexTerm(index)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(&IndexCheckpoint{Index: index, Term: term, Time: time.Now()})
+	if err != nil {
+		return err
+	}
+	if err := t.MetadataStore.Set(checkpointNamespace, checkpointKey(index), value); err != nil {
+		return err
+	}
+
+	keys, err := t.MetadataStore.List(checkpointNamespace)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(keys) - t.CheckpointRetain; i++ {
+		if err := t.MetadataStore.Delete(checkpointNamespace, keys[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+Term of the log entry, the entry compacted by the snapshot has the term of the snapshot
+ */
+func (t *implRaftServer) indexTerm(index uint64) (uint64, error) {
+	var entry raft.Log
+	err := t.LogStore.GetLog(index, &entry)
+	if err == nil {
+		return entry.Term, nil
+	}
+	if err != raft.ErrLogNotFound {
+		return 0, err
+	}
+	list, listErr := t.FileSnapshotStore.List()
+	if listErr != nil {
+		return 0, listErr
+	}
+	for _, meta := range list {
+		if meta.Index == index {
+			return meta.Term, nil
+		}
+	}
+	return 0, errors.Errorf("term of the index %d, %v", index, err)
+}
+
+func (t *implRaftServer) loadCheckpoint(key string) (*IndexCheckpoint, error) {
+	value, ok, err := t.MetadataStore.Get(checkpointNamespace, key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	cp := new(IndexCheckpoint)
+	if err := json.Unmarshal(value, cp); err != nil {
+		return nil, errors.Errorf("invalid checkpoint '%s', %v", key, err)
+	}
+	return cp, nil
+}
+
+/**
+Translates the log index to the wall-clock time by interpolation between the nearest checkpoints
+ */
+func (t *implRaftServer) LookupTime(index uint64) (*IndexTime, error) {
+
+	if t.MetadataStore == nil {
+		return nil, errors.New("metadata store is not available")
+	}
+
+	keys, err := t.MetadataStore.List(checkpointNamespace)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no index checkpoints recorded, check 'raft.checkpoint-interval'")
+	}
+
+	key := checkpointKey(index)
+	i := sort.SearchStrings(keys, key)
+
+	result := &IndexTime{Index: index}
+	if i < len(keys) {
+		if result.After, err = t.loadCheckpoint(keys[i]); err != nil {
+			return nil, err
+		}
+	}
+	if i < len(keys) && keys[i] == key {
+		result.Before = result.After
+	} else if i > 0 {
+		if result.Before, err = t.loadCheckpoint(keys[i-1]); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case result.Before != nil && result.After != nil:
+		if result.Before.Index == result.After.Index {
+			result.Time, result.Exact = result.Before.Time, true
+		} else {
+			ratio := float64(index - result.Before.Index) / float64(result.After.Index - result.Before.Index)
+			span := result.After.Time.Sub(result.Before.Time)
+			result.Time = result.Before.Time.Add(time.Duration(ratio * float64(span)))
+		}
+	case result.Before != nil:
+		result.Time = result.Before.Time
+	case result.After != nil:
+		result.Time = result.After.Time
+	}
+	return result, nil
+}
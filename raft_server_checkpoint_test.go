@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestCheckpointTerm(t *testing.T) {
+
+	logs := raft.NewInmemStore()
+	require.NoError(t, logs.StoreLogs([]*raft.Log{
+		{Index: 6, Term: 2, Type: raft.LogCommand},
+		{Index: 7, Term: 4, Type: raft.LogCommand},
+	}))
+
+	snapshots := raft.NewInmemSnapshotStore()
+	sink, err := snapshots.Create(raft.SnapshotVersionMax, 5, 2, raft.Configuration{}, 1, nil)
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+
+	server := &implRaftServer{
+		Log:               zap.NewNop(),
+		LogStore:          logs,
+		FileSnapshotStore: snapshots,
+		MetadataStore:     NewMetadataStore(raft.NewInmemStore()),
+		CheckpointRetain:  10,
+	}
+
+	require.NoError(t, server.recordCheckpoint(7))
+	cp, err := server.loadCheckpoint(checkpointKey(7))
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), cp.Term)
+
+	// compacted by the snapshot
+	require.NoError(t, server.recordCheckpoint(5))
+	cp, err = server.loadCheckpoint(checkpointKey(5))
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), cp.Term)
+
+	require.Error(t, server.recordCheckpoint(3))
+}
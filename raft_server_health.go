@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"fmt"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/serf/serf"
+	"github.com/pkg/errors"
+	"time"
+)
+
+/**
+Composite health of the cluster node from the point of view of the local raft server
+ */
+type NodeHealth struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name,omitempty"`
+	Healthy      bool       `json:"healthy"`
+	SerfStatus   string     `json:"serfStatus,omitempty"`
+	RaftState    string     `json:"raftState,omitempty"`
+	LastContact  time.Time  `json:"lastContact,omitempty"`
+	LastIndex    uint64     `json:"lastIndex"`
+	Lag          uint64     `json:"lag"`
+	Maintenance  bool       `json:"maintenance,omitempty"`
+	Reasons      []string   `json:"reasons,omitempty"`
+}
+
+/**
+Serf tag marking the node in maintenance
+ */
+const MaintenanceTag = "maintenance"
+
+func (t *implRaftServer) NodeHealth(id string) (*NodeHealth, error) {
+
+	if !t.alive.Load() {
+		return nil, errors.New("raft server is not running")
+	}
+
+	health := &NodeHealth{ID: id}
+
+	member, ok := t.findMember(id)
+	if !ok {
+		health.Reasons = append(health.Reasons, "not a serf member")
+		return health, nil
+	}
+
+	health.Name = member.Name
+	health.SerfStatus = member.Status.String()
+	health.Maintenance = member.Tags[MaintenanceTag] == "true"
+
+	if member.Status != serf.StatusAlive {
+		health.Reasons = append(health.Reasons, fmt.Sprintf("serf status is '%s'", health.SerfStatus))
+	}
+	if health.Maintenance {
+		health.Reasons = append(health.Reasons, "node is in maintenance")
+	}
+
+	var stats *NodeStats
+	var err error
+	if raft.ServerID(id) == raft.ServerID(t.NodeService.NodeIdHex()) {
+		stats, err = t.localStats()
+	} else if member.Status == serf.StatusAlive {
+		stats = new(NodeStats)
+		err = t.queryNode(member.Name, "raft-stats", nil, 0, stats)
+	} else {
+		err = errors.New("node is not reachable")
+	}
+
+	if err != nil {
+		health.Reasons = append(health.Reasons, fmt.Sprintf("raft stats are not available, %v", err))
+	} else {
+		health.RaftState = stats.State
+		health.LastContact = stats.LastContact
+		health.LastIndex = stats.LastIndex
+
+		if leaderIndex, err := t.leaderLastIndex(id, stats); err != nil {
+			health.Reasons = append(health.Reasons, fmt.Sprintf("leader index is not available, %v", err))
+		} else {
+			if leaderIndex > stats.LastIndex {
+				health.Lag = leaderIndex - stats.LastIndex
+			}
+			if health.Lag > uint64(t.MaxTrailingLogs) {
+				health.Reasons = append(health.Reasons, fmt.Sprintf("log lag %d exceeds %d entries", health.Lag, t.MaxTrailingLogs))
+			}
+		}
+
+		if stats.State == raft.Follower.String() || stats.State == raft.Candidate.String() {
+			if stats.LastContact.IsZero() {
+				health.Reasons = append(health.Reasons, "no contact with leader")
+			} else if since := time.Since(stats.LastContact); since > t.LastContactThreshold {
+				health.Reasons = append(health.Reasons, fmt.Sprintf("last contact with leader %v ago exceeds %v", since.Truncate(time.Millisecond), t.LastContactThreshold))
+			}
+		}
+	}
+
+	health.Healthy = len(health.Reasons) == 0
+	return health, nil
+}
+
+/**
+Returns the last index of the leader, the lag is measured against it, since the local server could be the lagging follower itself
+ */
+func (t *implRaftServer) leaderLastIndex(id string, stats *NodeStats) (uint64, error) {
+	if t.raft.State() == raft.Leader {
+		return t.raft.LastIndex(), nil
+	}
+	_, leaderID := t.raft.LeaderWithID()
+	if leaderID == "" {
+		return 0, errors.New("no leader")
+	}
+	if string(leaderID) == id {
+		return stats.LastIndex, nil
+	}
+	member, ok := t.findMember(string(leaderID))
+	if !ok {
+		return 0, errors.Errorf("leader '%s' is not a serf member", leaderID)
+	}
+	leaderStats := new(NodeStats)
+	if err := t.queryNode(member.Name, "raft-stats", nil, 0, leaderStats); err != nil {
+		return 0, err
+	}
+	return leaderStats.LastIndex, nil
+}
+
+func (t *implRaftServer) findMember(id string) (serf.Member, bool) {
+	if t.SerfServer != nil {
+		if s, ok := t.SerfServer.Serf(); ok && s != nil {
+			for _, m := range s.Members() {
+				if m.Tags["id"] == id {
+					return m, true
+				}
+			}
+		}
+	}
+	return serf.Member{}, false
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+/**
+Leadership change observed by the local raft server
+ */
+type LeaderChange struct {
+	LeaderID       string     `json:"leaderId"`
+	LeaderAddress  string     `json:"leaderAddress"`
+	NodeID         string     `json:"nodeId"`
+	Local          bool       `json:"local"`
+	Time           time.Time  `json:"time"`
+}
+
+func (t *implRaftServer) observeLeadership() {
+
+	ch := make(chan raft.Observation, 16)
+	observer := raft.NewObserver(ch, false, func(o *raft.Observation) bool {
+		switch o.Data.(type) {
+		case raft.LeaderObservation, raft.PeerObservation:
+			return true
+		}
+		return false
+	})
+
+	t.raft.RegisterObserver(observer)
+	defer t.raft.DeregisterObserver(observer)
+
+	// external publishers may be slow, they must not block the observer
+	changeCh := make(chan *LeaderChange, 1)
+	go t.leaderChangeLoop(changeCh)
+
+	nodeID := t.NodeService.NodeIdHex()
+
+	for {
+		select {
+		case o := <-ch:
+			if po, ok := o.Data.(raft.PeerObservation); ok {
+				status := po.Peer.Suffrage.String()
+				if po.Removed {
+					status = "removed"
+					t.quarantine.Add(string(po.Peer.ID), status, t.QuarantineTTL)
+				}
+				t.Log.Info("ConfigurationChange", zap.String("id", string(po.Peer.ID)), zap.String("addr", string(po.Peer.Address)), zap.String("status", status))
+				t.publish(&ClusterEvent{Type: EventConfigurationChanged, ID: string(po.Peer.ID), Address: string(po.Peer.Address), Status: status})
+				continue
+			}
+			lo := o.Data.(raft.LeaderObservation)
+			change := &LeaderChange{
+				LeaderID:      string(lo.LeaderID),
+				LeaderAddress: string(lo.LeaderAddr),
+				NodeID:        nodeID,
+				Local:         lo.LeaderID != "" && string(lo.LeaderID) == nodeID,
+				Time:          time.Now(),
+			}
+			t.Log.Info("LeaderChange", zap.String("leaderId", change.LeaderID), zap.String("leaderAddress", change.LeaderAddress), zap.Bool("local", change.Local))
+			offerLeaderChange(changeCh, change)
+			if change.LeaderID != "" {
+				t.publish(&ClusterEvent{Type: EventLeaderElected, ID: change.LeaderID, Address: change.LeaderAddress, Time: change.Time})
+			}
+
+		case <-t.shutdownCh:
+			return
+		}
+	}
+}
+
+/**
+Publishes leader changes one by one, the change not yet picked up is replaced by the newer one
+ */
+func (t *implRaftServer) leaderChangeLoop(changeCh <-chan *LeaderChange) {
+	for {
+		select {
+		case change := <-changeCh:
+			t.publishLeaderChange(change)
+			t.registerService(change)
+		case <-t.shutdownCh:
+			return
+		}
+	}
+}
+
+func offerLeaderChange(changeCh chan *LeaderChange, change *LeaderChange) {
+	for {
+		select {
+		case changeCh <- change:
+			return
+		default:
+		}
+		select {
+		case <-changeCh:
+		default:
+		}
+	}
+}
+
+func (t *implRaftServer) publishLeaderChange(change *LeaderChange) {
+	for _, p := range t.LeaderChangePublishers {
+		if err := p.PublishLeaderChange(change); err != nil {
+			t.Log.Error("PublishLeaderChange", zap.String("leaderId", change.LeaderID), zap.Error(err))
+		}
+	}
+}
+
+func (t *implRaftServer) LeaderAddress() raft.ServerAddress {
+	if !t.alive.Load() {
+		return ""
+	}
+	addr, _ := t.raft.LeaderWithID()
+	return addr
+}
+
+func (t *implRaftServer) LeaderID() raft.ServerID {
+	if !t.alive.Load() {
+		return ""
+	}
+	_, id := t.raft.LeaderWithID()
+	return id
+}
+
+/**
+Payload of the application "new-leader" serf user event
+ */
+type NewLeaderEvent struct {
+	ID       string  `json:"id"`
+	Address  string  `json:"address"`
+}
+
+/**
+Announces the local node as the new leader to all serf members
+ */
+func (t *implRaftServer) broadcastNewLeader() error {
+	emitter, ok := t.SerfServer.(EventEmitter)
+	if !ok {
+		return errors.New("serf server does not support user events")
+	}
+	payload, err := json.Marshal(&NewLeaderEvent{
+		ID:      t.NodeService.NodeIdHex(),
+		Address: string(t.transport.LocalAddr()),
+	})
+	if err != nil {
+		return err
+	}
+	return emitter.EmitEvent(t.Application.Name() + ":new-leader", payload, false)
+}
+
+/**
+Subscribers of the local leadership transitions
+ */
+type leaderSubscribers struct {
+	mutex   sync.Mutex
+	list    []chan bool
+	closed  bool
+}
+
+/**
+Returns the new subscription receiving true when the local node becomes leader and false when it loses leadership,
+the slow subscriber receives only the latest state. Channel is closed on shutdown.
+ */
+func (t *implRaftServer) LeaderCh() <-chan bool {
+	ch := make(chan bool, 1)
+	t.leaderSubs.mutex.Lock()
+	defer t.leaderSubs.mutex.Unlock()
+	if t.leaderSubs.closed {
+		close(ch)
+	} else {
+		t.leaderSubs.list = append(t.leaderSubs.list, ch)
+	}
+	return ch
+}
+
+func (t *implRaftServer) notifyLeadership() {
+
+	var leading bool
+	var cancel context.CancelFunc
+
+	defer func() {
+		if leading {
+			t.loseLeadership(cancel)
+		}
+		t.leaderSubs.mutex.Lock()
+		defer t.leaderSubs.mutex.Unlock()
+		t.leaderSubs.closed = true
+		for _, ch := range t.leaderSubs.list {
+			close(ch)
+		}
+		t.leaderSubs.list = nil
+	}()
+
+	for {
+		select {
+		case isLeader := <-t.notifyCh:
+			t.Log.Info("LeadershipTransition", zap.Bool("leader", isLeader))
+			if isLeader {
+				if err := t.broadcastNewLeader(); err != nil {
+					t.Log.Error("BroadcastNewLeader", zap.Error(err))
+				}
+			}
+
+			if isLeader != leading {
+				leading = isLeader
+				if leading {
+					cancel = t.becomeLeader()
+				} else {
+					t.loseLeadership(cancel)
+					cancel = nil
+				}
+			}
+
+			t.leaderSubs.mutex.Lock()
+			for _, ch := range t.leaderSubs.list {
+				select {
+				case <-ch:
+				default:
+				}
+				ch <- isLeader
+			}
+			t.leaderSubs.mutex.Unlock()
+
+		case <-t.shutdownCh:
+			return
+		}
+	}
+}
+
+func (t *implRaftServer) becomeLeader() context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.leadership.Store(ctx)
+	go t.resumeReplace(ctx)
+	for _, hook := range t.LeadershipHooks {
+		t.invokeHook("OnBecomeLeader", func() {
+			hook.OnBecomeLeader(ctx)
+		})
+	}
+	return cancel
+}
+
+func (t *implRaftServer) loseLeadership(cancel context.CancelFunc) {
+	if cancel != nil {
+		cancel()
+	}
+	for _, hook := range t.LeadershipHooks {
+		t.invokeHook("OnLoseLeadership", hook.OnLoseLeadership)
+	}
+}
+
+func (t *implRaftServer) invokeHook(name string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Log.Error("LeadershipHook", zap.String("hook", name), zap.Any("recover", r))
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"strconv"
+	"time"
+)
+
+var ErrLeadershipLost = errors.New("leadership lost while acquiring the lease")
+
+/**
+Leader lease with the fencing token. The term is monotonic across leaders, external storage
+rejects writes carrying a term lower than the last seen. The lease is invalid after Expires
+or when Done is closed on step-down, a new lease must be acquired to continue writing.
+ */
+type LeaderLease struct {
+	Term     uint64
+	ID       string
+	Expires  time.Time
+	done     <-chan struct{}
+}
+
+/**
+Fencing token '<term>:<leader id>', compare tokens by Term
+ */
+func (t *LeaderLease) Token() string {
+	return fmt.Sprintf("%d:%s", t.Term, t.ID)
+}
+
+/**
+Closed when the node loses leadership
+ */
+func (t *LeaderLease) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *LeaderLease) Valid() bool {
+	select {
+	case <-t.done:
+		return false
+	default:
+	}
+	return time.Now().Before(t.Expires)
+}
+
+func (t *implRaftServer) currentTerm() uint64 {
+	term, _ := strconv.ParseUint(t.raft.Stats()["term"], 10, 64)
+	return term
+}
+
+/**
+Confirms leadership with the quorum and returns the lease lasting for the leader lease timeout
+from the start of the confirmation minus the clock drift allowance
+ */
+func (t *implRaftServer) LeaderLease() (*LeaderLease, error) {
+
+	if t.raft == nil {
+		return nil, errors.New("raft server is not running")
+	}
+
+	ctx, ok := t.leadership.Load().(context.Context)
+	if !ok || ctx.Err() != nil || t.raft.State() != raft.Leader {
+		return nil, raft.ErrNotLeader
+	}
+
+	term := t.currentTerm()
+	start := time.Now()
+	if err := t.raft.VerifyLeader().Error(); err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil || t.currentTerm() != term {
+		return nil, ErrLeadershipLost
+	}
+
+	return &LeaderLease{
+		Term:    term,
+		ID:      t.NodeService.NodeIdHex(),
+		Expires: start.Add(t.LeaderLeaseTimeout - t.LeaseClockDrift),
+		done:    ctx.Done(),
+	}, nil
+}
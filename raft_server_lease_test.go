@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"context"
+	"github.com/hashicorp/raft"
+	"github.com/sprintframework/sprint"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+	"time"
+)
+
+type leaseTestNode struct {
+	sprint.NodeService
+}
+
+func (t leaseTestNode) NodeIdHex() string {
+	return "a"
+}
+
+func TestLeaderLease(t *testing.T) {
+
+	srv := &implRaftServer{
+		NodeService:        leaseTestNode{},
+		LeaderLeaseTimeout: 500 * time.Millisecond,
+		LeaseClockDrift:    50 * time.Millisecond,
+	}
+
+	_, err := srv.LeaderLease()
+	require.Error(t, err)
+
+	addr, trans := raft.NewInmemTransport("a")
+	store := raft.NewInmemStore()
+
+	config := raft.DefaultConfig()
+	config.LocalID = "a"
+	config.HeartbeatTimeout = 50 * time.Millisecond
+	config.ElectionTimeout = 50 * time.Millisecond
+	config.LeaderLeaseTimeout = 50 * time.Millisecond
+	config.CommitTimeout = 5 * time.Millisecond
+	config.LogOutput = io.Discard
+
+	r, err := raft.NewRaft(config, &raft.MockFSM{}, store, store, raft.NewInmemSnapshotStore(), trans)
+	require.NoError(t, err)
+	srv.raft = r
+	t.Cleanup(func() {
+		r.Shutdown().Error()
+	})
+	require.NoError(t, r.BootstrapCluster(raft.Configuration{Servers: []raft.Server{
+		{ID: "a", Address: addr},
+	}}).Error())
+
+	require.Eventually(t, func() bool {
+		return r.State() == raft.Leader
+	}, 5 * time.Second, 10 * time.Millisecond)
+
+	// leader without the leadership context of the observer
+	_, err = srv.LeaderLease()
+	require.Equal(t, raft.ErrNotLeader, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv.leadership.Store(ctx)
+
+	before := time.Now()
+	lease, err := srv.LeaderLease()
+	require.NoError(t, err)
+	after := time.Now()
+
+	require.Equal(t, srv.currentTerm(), lease.Term)
+	require.NotEqual(t, uint64(0), lease.Term)
+	require.Equal(t, "a", lease.ID)
+	require.Equal(t, "1:a", (&LeaderLease{Term: 1, ID: "a"}).Token())
+
+	// counted from the start of the confirmation minus the clock drift
+	window := srv.LeaderLeaseTimeout - srv.LeaseClockDrift
+	require.False(t, lease.Expires.Before(before.Add(window)))
+	require.False(t, lease.Expires.After(after.Add(window)))
+	require.True(t, lease.Valid())
+
+	expired := &LeaderLease{Expires: time.Now().Add(-time.Millisecond), done: ctx.Done()}
+	require.False(t, expired.Valid())
+
+	// step-down invalidates the lease before the expiration
+	cancel()
+	require.False(t, lease.Valid())
+	select {
+	case <-lease.Done():
+	default:
+		t.Fatal("lease is not done after the step-down")
+	}
+
+	_, err = srv.LeaderLease()
+	require.Equal(t, raft.ErrNotLeader, err)
+}
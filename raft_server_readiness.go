@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"strconv"
+	"time"
+)
+
+/**
+Returns false with the reason when the node is not running or saturated and should not receive the traffic
+ */
+func (t *implRaftServer) Ready() (bool, string) {
+	if !t.alive.Load() {
+		return false, "raft server is not running"
+	}
+	if reason, ok := t.saturation.Load().(string); ok && reason != "" {
+		return false, reason
+	}
+	return true, ""
+}
+
+func (t *implRaftServer) readinessLoop() {
+
+	t.Log.Info("ReadinessMonitor", zap.Duration("interval", t.ReadinessInterval), zap.Duration("window", t.ReadinessWindow),
+		zap.Int("maxApplyLag", t.MaxApplyLag), zap.Int("maxFSMPending", t.MaxFSMPending))
+
+	ticker := time.NewTicker(t.ReadinessInterval)
+	defer ticker.Stop()
+
+	var saturatedSince time.Time
+	ready := true
+
+	for {
+		select {
+		case <-ticker.C:
+			reason := t.checkSaturation()
+			if reason == "" {
+				saturatedSince = time.Time{}
+			} else if saturatedSince.IsZero() {
+				saturatedSince = time.Now()
+			}
+
+			if reason != "" && time.Since(saturatedSince) < t.ReadinessWindow {
+				continue
+			}
+
+			t.saturation.Store(reason)
+			if (reason == "") != ready {
+				ready = reason == ""
+				t.Log.Warn("ReadinessChanged", zap.Bool("ready", ready), zap.String("reason", reason))
+				t.setServingStatus(ready)
+				t.publish(&ClusterEvent{Type: EventReadinessChanged, ID: t.NodeService.NodeIdHex(), Status: readinessStatus(ready, reason)})
+			}
+
+		case <-t.shutdownCh:
+			return
+		}
+	}
+}
+
+func (t *implRaftServer) checkSaturation() string {
+
+	stats := t.raft.Stats()
+
+	commitIndex, _ := strconv.ParseUint(stats["commit_index"], 10, 64)
+	appliedIndex := t.raft.AppliedIndex()
+	if commitIndex > appliedIndex && commitIndex - appliedIndex > uint64(t.MaxApplyLag) {
+		return fmt.Sprintf("apply lag %d exceeds %d entries", commitIndex - appliedIndex, t.MaxApplyLag)
+	}
+
+	fsmPending, _ := strconv.Atoi(stats["fsm_pending"])
+	if fsmPending > t.MaxFSMPending {
+		return fmt.Sprintf("fsm pending %d exceeds %d", fsmPending, t.MaxFSMPending)
+	}
+
+	return ""
+}
+
+func (t *implRaftServer) setServingStatus(ready bool) {
+	if t.HealthChecker == nil || t.RPCServiceName == "" {
+		return
+	}
+	status := grpc_health_v1.HealthCheckResponse_SERVING
+	if !ready {
+		status = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	}
+	t.HealthChecker.SetServingStatus(t.RPCServiceName, status)
+}
+
+func readinessStatus(ready bool, reason string) string {
+	if ready {
+		return "ready"
+	}
+	return "not ready: " + reason
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/**
+Recovery file with the forced configuration in the raft data directory
+ */
+const PeersFile = "peers.json"
+
+/**
+Stable store key of the hash of the last applied 'raft.recover-configuration'
+ */
+var recoverConfigurationKey = []byte("raft-recover-configuration")
+
+/**
+Parses recovery configuration in format 'id@address,id@address', servers with suffix '/nonvoter' join as non-voters
+ */
+func ParseRecoverConfiguration(value string) (raft.Configuration, error) {
+
+	var configuration raft.Configuration
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		suffrage := raft.Voter
+		if strings.HasSuffix(entry, "/nonvoter") {
+			suffrage = raft.Nonvoter
+			entry = strings.TrimSuffix(entry, "/nonvoter")
+		}
+
+		i := strings.Index(entry, "@")
+		if i <= 0 || i == len(entry) - 1 {
+			return configuration, errors.Errorf("invalid server '%s', expected 'id@address'", entry)
+		}
+
+		configuration.Servers = append(configuration.Servers, raft.Server{
+			Suffrage: suffrage,
+			ID:       raft.ServerID(entry[:i]),
+			Address:  raft.ServerAddress(entry[i+1:]),
+		})
+	}
+
+	if len(configuration.Servers) == 0 {
+		return configuration, errors.New("empty recovery configuration")
+	}
+
+	return configuration, nil
+}
+
+/**
+Forces the new cluster configuration in local stores, must be called before raft.NewRaft
+ */
+func (t *implRaftServer) recoverCluster(config *raft.Config, configuration raft.Configuration) error {
+
+	for _, srv := range configuration.Servers {
+		t.Log.Warn("RaftRecoverServer", zap.String("id", string(srv.ID)), zap.String("addr", string(srv.Address)), zap.String("suffrage", srv.Suffrage.String()))
+	}
+
+	if err := raft.RecoverCluster(config, t.FSM, t.LogStore, t.StableStore, t.FileSnapshotStore, t.transport, configuration); err != nil {
+		return errors.Errorf("raft recover cluster, %v", err)
+	}
+
+	t.Log.Warn("RaftRecovered", zap.Int("servers", len(configuration.Servers)))
+	return nil
+}
+
+/**
+Hash of the recovery configuration independent of the formatting of the property
+ */
+func recoverConfigurationHash(configuration raft.Configuration) []byte {
+	h := sha256.New()
+	for _, srv := range configuration.Servers {
+		h.Write([]byte(string(srv.ID) + "@" + string(srv.Address) + "/" + srv.Suffrage.String() + "\n"))
+	}
+	return h.Sum(nil)
+}
+
+/**
+Forces the configuration of 'raft.recover-configuration' once, the hash of the applied configuration
+is kept in the stable store and the same value is skipped on the next restarts
+ */
+func (t *implRaftServer) recoverConfigurationOnce(config *raft.Config, configuration raft.Configuration) error {
+
+	hash := recoverConfigurationHash(configuration)
+
+	applied, err := t.StableStore.Get(recoverConfigurationKey)
+	if err != nil && err.Error() != "not found" {
+		return errors.Errorf("get recovery marker, %v", err)
+	}
+
+	if bytes.Equal(applied, hash) {
+		t.Log.Info("RaftRecoverConfigurationApplied", zap.String("action", "skip already applied 'raft.recover-configuration'"))
+		return nil
+	}
+
+	if err := t.recoverCluster(config, configuration); err != nil {
+		return err
+	}
+
+	if err := t.StableStore.Set(recoverConfigurationKey, hash); err != nil {
+		return errors.Errorf("set recovery marker, %v", err)
+	}
+
+	t.Log.Warn("RaftRecoverConfiguration", zap.String("action", "remove property 'raft.recover-configuration', it is skipped on the next restarts"))
+	return nil
+}
+
+func (t *implRaftServer) raftDataDir() string {
+	if t.DataDir != "" {
+		return t.DataDir
+	}
+	return filepath.Join(t.Application.ApplicationDir(), "db", t.Application.Name())
+}
+
+/**
+Applies configuration from peers.json file if exist and removes the file after the successful recovery
+ */
+func (t *implRaftServer) recoverPeersJSON(config *raft.Config) error {
+
+	peersFile := filepath.Join(t.raftDataDir(), PeersFile)
+	if _, err := os.Stat(peersFile); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Errorf("stat recovery file '%s', %v", peersFile, err)
+	}
+
+	t.Log.Warn("RaftPeersJSON", zap.String("file", peersFile))
+
+	configuration, err := raft.ReadConfigJSON(peersFile)
+	if err != nil {
+		return errors.Errorf("read recovery file '%s', %v", peersFile, err)
+	}
+
+	if err := t.recoverCluster(config, configuration); err != nil {
+		return err
+	}
+
+	if err := os.Remove(peersFile); err != nil {
+		return errors.Errorf("delete recovery file '%s', %v", peersFile, err)
+	}
+
+	t.Log.Warn("RaftPeersJSONApplied", zap.String("file", peersFile), zap.Int("servers", len(configuration.Servers)))
+	return nil
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"io"
+	"testing"
+)
+
+type recoverTestFSM struct {
+	snapshots int
+}
+
+func (t *recoverTestFSM) Apply(*raft.Log) interface{} {
+	return nil
+}
+
+func (t *recoverTestFSM) Snapshot() (raft.FSMSnapshot, error) {
+	t.snapshots++
+	return t, nil
+}
+
+func (t *recoverTestFSM) Restore(rc io.ReadCloser) error {
+	return rc.Close()
+}
+
+func (t *recoverTestFSM) Persist(sink raft.SnapshotSink) error {
+	return nil
+}
+
+func (t *recoverTestFSM) Release() {
+}
+
+func TestRecoverConfigurationOnce(t *testing.T) {
+
+	fsm := &recoverTestFSM{}
+	logs := raft.NewInmemStore()
+	require.NoError(t, logs.StoreLog(&raft.Log{Index: 1, Term: 1, Type: raft.LogCommand, Data: []byte("a")}))
+	require.NoError(t, logs.SetUint64([]byte("CurrentTerm"), 1))
+
+	server := &implRaftServer{
+		Log:               zap.NewNop(),
+		FSM:               fsm,
+		LogStore:          logs,
+		StableStore:       logs,
+		FileSnapshotStore: raft.NewInmemSnapshotStore(),
+	}
+
+	config := raft.DefaultConfig()
+	config.LocalID = "a"
+
+	configuration, err := ParseRecoverConfiguration("a@127.0.0.1:8300, b@127.0.0.1:8301")
+	require.NoError(t, err)
+
+	require.NoError(t, server.recoverConfigurationOnce(config, configuration))
+	require.Equal(t, 1, fsm.snapshots)
+
+	// restart with the forgotten property
+	require.NoError(t, server.recoverConfigurationOnce(config, configuration))
+	require.Equal(t, 1, fsm.snapshots)
+
+	// formatting of the property does not matter
+	configuration, err = ParseRecoverConfiguration("a@127.0.0.1:8300,b@127.0.0.1:8301,")
+	require.NoError(t, err)
+	require.NoError(t, server.recoverConfigurationOnce(config, configuration))
+	require.Equal(t, 1, fsm.snapshots)
+
+	// new recovery value is applied
+	configuration, err = ParseRecoverConfiguration("a@127.0.0.1:8300")
+	require.NoError(t, err)
+	require.NoError(t, server.recoverConfigurationOnce(config, configuration))
+	require.Equal(t, 2, fsm.snapshots)
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"go.uber.org/zap"
+)
+
+/**
+Registration of the raft node in the external service registry
+ */
+type ServiceRegistration struct {
+	ID             string  `json:"id"`
+	Name           string  `json:"name"`
+	Address        string  `json:"address"`
+	Leader         bool    `json:"leader"`
+	LeaderID       string  `json:"leaderId,omitempty"`
+	LeaderAddress  string  `json:"leaderAddress,omitempty"`
+}
+
+func (t *implRaftServer) registerService(change *LeaderChange) {
+	if len(t.Registrars) == 0 {
+		return
+	}
+
+	reg := &ServiceRegistration{
+		ID:      t.NodeService.NodeIdHex(),
+		Name:    t.Application.Name(),
+		Address: string(t.transport.LocalAddr()),
+	}
+	if change != nil {
+		reg.Leader = change.Local
+		reg.LeaderID = change.LeaderID
+		reg.LeaderAddress = change.LeaderAddress
+	}
+
+	for _, r := range t.Registrars {
+		if err := r.Register(reg); err != nil {
+			t.Log.Error("ServiceRegister", zap.String("id", reg.ID), zap.Bool("leader", reg.Leader), zap.Error(err))
+		}
+	}
+}
+
+func (t *implRaftServer) deregisterService() {
+	id := t.NodeService.NodeIdHex()
+	for _, r := range t.Registrars {
+		if err := r.Deregister(id); err != nil {
+			t.Log.Error("ServiceDeregister", zap.String("id", id), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+func (t *implRaftServer) durationProperty(name string, current time.Duration) (time.Duration, error) {
+	value := t.Properties.GetString(name, "")
+	if value == "" {
+		return current, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Errorf("invalid property '%s' value '%s', %v", name, value, err)
+	}
+	return d, nil
+}
+
+func (t *implRaftServer) uintProperty(name string, current uint64) (uint64, error) {
+	value := t.Properties.GetString(name, "")
+	if value == "" {
+		return current, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid property '%s' value '%s', %v", name, value, err)
+	}
+	return n, nil
+}
+
+/**
+Re-reads 'raft-server.snapshot-interval', 'raft-server.snapshot-threshold', 'raft-server.trailing-logs',
+'raft-server.heartbeat-timeout' and 'raft-server.election-timeout' properties and applies them to the running raft
+ */
+func (t *implRaftServer) ReloadConfig() error {
+
+	if !t.alive.Load() {
+		return errors.New("raft server is not running")
+	}
+
+	current := t.raft.ReloadableConfig()
+	rc := current
+
+	var err error
+	if rc.SnapshotInterval, err = t.durationProperty("raft-server.snapshot-interval", rc.SnapshotInterval); err != nil {
+		return err
+	}
+	if rc.SnapshotThreshold, err = t.uintProperty("raft-server.snapshot-threshold", rc.SnapshotThreshold); err != nil {
+		return err
+	}
+	if rc.TrailingLogs, err = t.uintProperty("raft-server.trailing-logs", rc.TrailingLogs); err != nil {
+		return err
+	}
+	if rc.HeartbeatTimeout, err = t.durationProperty("raft-server.heartbeat-timeout", rc.HeartbeatTimeout); err != nil {
+		return err
+	}
+	if rc.ElectionTimeout, err = t.durationProperty("raft-server.election-timeout", rc.ElectionTimeout); err != nil {
+		return err
+	}
+
+	if rc == current {
+		return nil
+	}
+
+	if err := t.raft.ReloadConfig(rc); err != nil {
+		return errors.Errorf("reload raft config, %v", err)
+	}
+
+	t.Log.Info("RaftReloadConfig", zap.Duration("snapshotInterval", rc.SnapshotInterval), zap.Uint64("snapshotThreshold", rc.SnapshotThreshold),
+		zap.Uint64("trailingLogs", rc.TrailingLogs), zap.Duration("heartbeatTimeout", rc.HeartbeatTimeout), zap.Duration("electionTimeout", rc.ElectionTimeout))
+	return nil
+}
+
+/**
+Currently applied reloadable part of the raft config
+ */
+func (t *implRaftServer) ReloadableConfig() (raft.ReloadableConfig, bool) {
+	if !t.alive.Load() {
+		return raft.ReloadableConfig{}, false
+	}
+	return t.raft.ReloadableConfig(), true
+}
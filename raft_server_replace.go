@@ -0,0 +1,391 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"time"
+)
+
+// metadata namespace of the server replacement progress
+const (
+	replaceNamespace = "replace"
+	replaceKey       = "current"
+)
+
+/**
+Phases of the server replacement, each phase is derived from the raft configuration,
+so the operation resumes from the first unfinished one
+ */
+const (
+	ReplaceAddNonvoter = "add-nonvoter"
+	ReplaceCatchUp     = "catch-up"
+	ReplaceDemote      = "demote"
+	ReplaceRemove      = "remove"
+	ReplaceDone        = "done"
+)
+
+var replacePollInterval = time.Second
+
+/**
+Extensions of the replicated ReplaceOperation entry: the reserved magic, the record name and the version.
+Application entries with the Extensions starting by the magic never reach the application FSM,
+they fail with ErrReservedExtensions in the response of the apply future.
+ */
+const (
+	replaceEntryMagic   = 0xD8
+	replaceEntryVersion = 1
+)
+
+var replaceEntryHeader = []byte{replaceEntryMagic, 'R', 'P', 'L', 'C', replaceEntryVersion}
+
+var ErrReservedExtensions = errors.New("log extensions starting with 0xD8 are reserved by raftmod")
+
+/**
+Progress of the replacement of the old server by the new one
+ */
+type ReplaceOperation struct {
+	Old      string     `json:"old"`
+	New      string     `json:"new"`
+	Phase    string     `json:"phase"`
+	Error    string     `json:"error,omitempty"`
+	Started  time.Time  `json:"started"`
+	Updated  time.Time  `json:"updated"`
+}
+
+/**
+Replaces the old server by the new one on the leader in the background: adds the new server as non-voter,
+waits for the catch-up, promotes it, demotes and removes the old server.
+The progress is replicated through the raft log, so the next leader resumes the unfinished operation,
+running it again with the same servers resumes it as well.
+ */
+func (t *implRaftServer) ReplaceServer(oldID, newID string) (*ReplaceOperation, error) {
+
+	if oldID == "" || newID == "" || oldID == newID {
+		return nil, errors.Errorf("invalid servers to replace, old '%s', new '%s'", oldID, newID)
+	}
+
+	ctx, ok := t.leadership.Load().(context.Context)
+	if !ok || ctx.Err() != nil || t.raft.State() != raft.Leader {
+		return nil, raft.ErrNotLeader
+	}
+
+	if oldID == t.NodeService.NodeIdHex() {
+		return nil, errors.Errorf("old server '%s' is the leader, transfer leadership first", oldID)
+	}
+
+	if !t.replacing.CompareAndSwap(false, true) {
+		return nil, errors.New("server replacement is already in progress")
+	}
+
+	op, err := t.loadReplace()
+	if err != nil {
+		t.replacing.Store(false)
+		return nil, err
+	}
+
+	if op == nil || op.Old != oldID || op.New != newID {
+		if op != nil && op.Phase != ReplaceDone && op.Error == "" {
+			t.replacing.Store(false)
+			return nil, errors.Errorf("replacement of '%s' by '%s' is not finished, run it again to resume", op.Old, op.New)
+		}
+		op = &ReplaceOperation{Old: oldID, New: newID, Started: time.Now()}
+	}
+	op.Error = ""
+
+	// autopilot must not promote the old server back until it is removed
+	t.quarantine.Add(oldID, "replacing", t.QuarantineTTL)
+
+	go t.runReplace(ctx, op)
+	return op, nil
+}
+
+/**
+Returns the last server replacement known by the node, nil if none
+ */
+func (t *implRaftServer) ReplaceStatus() (*ReplaceOperation, error) {
+	return t.loadReplace()
+}
+
+func (t *implRaftServer) resumeReplace(ctx context.Context) {
+	op, err := t.loadReplace()
+	if err != nil {
+		t.Log.Error("ReplaceServerResume", zap.Error(err))
+		return
+	}
+	if op == nil || op.Phase == ReplaceDone || op.Error != "" {
+		return
+	}
+	if !t.replacing.CompareAndSwap(false, true) {
+		return
+	}
+	t.Log.Info("ReplaceServerResume", zap.String("old", op.Old), zap.String("new", op.New), zap.String("phase", op.Phase))
+	go t.runReplace(ctx, op)
+}
+
+func (t *implRaftServer) runReplace(ctx context.Context, op *ReplaceOperation) {
+
+	defer t.replacing.Store(false)
+	audit := t.Log.Named("audit")
+
+	for {
+		if ctx.Err() != nil {
+			// leadership lost, the next leader resumes the operation
+			t.Log.Warn("ReplaceServerInterrupted", zap.String("old", op.Old), zap.String("new", op.New), zap.String("phase", op.Phase))
+			return
+		}
+
+		phase, err := t.replacePhase(op)
+		if err == nil {
+			if phase != op.Phase {
+				audit.Info("ReplaceServer", zap.String("old", op.Old), zap.String("new", op.New), zap.String("phase", phase))
+			}
+			op.Phase = phase
+			t.saveReplace(op)
+			if phase == ReplaceDone {
+				return
+			}
+			err = t.replaceStep(ctx, op)
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			audit.Error("ReplaceServer", zap.String("old", op.Old), zap.String("new", op.New), zap.String("phase", op.Phase), zap.Error(err))
+			op.Error = err.Error()
+			t.saveReplace(op)
+			return
+		}
+	}
+}
+
+/**
+Returns the first unfinished phase from the current raft configuration
+ */
+func (t *implRaftServer) replacePhase(op *ReplaceOperation) (string, error) {
+
+	future := t.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return "", err
+	}
+
+	var oldSrv, newSrv *raft.Server
+	for _, srv := range future.Configuration().Servers {
+		srv := srv
+		switch string(srv.ID) {
+		case op.Old:
+			oldSrv = &srv
+		case op.New:
+			newSrv = &srv
+		}
+	}
+
+	switch {
+	case newSrv == nil:
+		if oldSrv == nil && op.Phase != "" {
+			return "", errors.Errorf("server '%s' is not in the configuration anymore", op.New)
+		}
+		return ReplaceAddNonvoter, nil
+	case newSrv.Suffrage != raft.Voter:
+		return ReplaceCatchUp, nil
+	case oldSrv == nil:
+		return ReplaceDone, nil
+	case oldSrv.Suffrage == raft.Voter:
+		return ReplaceDemote, nil
+	default:
+		return ReplaceRemove, nil
+	}
+}
+
+func (t *implRaftServer) replaceStep(ctx context.Context, op *ReplaceOperation) error {
+
+	switch op.Phase {
+	case ReplaceAddNonvoter:
+		addr, err := t.ServerLookup.ServerAddr(raft.ServerID(op.New))
+		if err != nil {
+			return errors.Errorf("address of the server '%s' is unknown, %v", op.New, err)
+		}
+		return t.raft.AddNonvoter(raft.ServerID(op.New), addr, 0, t.Timeout).Error()
+
+	case ReplaceCatchUp:
+		if err := t.waitCatchUp(ctx, op.New); err != nil {
+			return err
+		}
+		addr, err := t.ServerLookup.ServerAddr(raft.ServerID(op.New))
+		if err != nil {
+			return errors.Errorf("address of the server '%s' is unknown, %v", op.New, err)
+		}
+		return t.raft.AddVoter(raft.ServerID(op.New), addr, 0, t.Timeout).Error()
+
+	case ReplaceDemote:
+		return t.raft.DemoteVoter(raft.ServerID(op.Old), 0, t.Timeout).Error()
+
+	case ReplaceRemove:
+		// keep autopilot from adding the old server back
+		t.quarantine.Add(op.Old, "replaced", t.QuarantineTTL)
+		return t.raft.RemoveServer(raft.ServerID(op.Old), 0, t.Timeout).Error()
+	}
+
+	return errors.Errorf("unknown replace phase '%s'", op.Phase)
+}
+
+/**
+Waits until the new server is healthy and its log lag is within 'raft.max-trailing-logs'
+ */
+func (t *implRaftServer) waitCatchUp(ctx context.Context, id string) error {
+
+	timer := time.NewTimer(t.ReplaceCatchUpTimeout)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(replacePollInterval)
+	defer ticker.Stop()
+
+	var reasons []string
+	for {
+		health, err := t.NodeHealth(id)
+		if err != nil {
+			return err
+		}
+		if health.Healthy {
+			return nil
+		}
+		reasons = health.Reasons
+
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			return errors.Errorf("server '%s' did not catch up in %v, %v", id, t.ReplaceCatchUpTimeout, reasons)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.shutdownCh:
+			return errors.New("raft server is shutting down")
+		}
+	}
+}
+
+func (t *implRaftServer) loadReplace() (*ReplaceOperation, error) {
+	if t.MetadataStore == nil {
+		op, _ := t.replaceOp.Load().(*ReplaceOperation)
+		return op, nil
+	}
+	value, ok, err := t.MetadataStore.Get(replaceNamespace, replaceKey)
+	if err != nil || !ok {
+		return nil, err
+	}
+	op := new(ReplaceOperation)
+	if err := json.Unmarshal(value, op); err != nil {
+		return nil, errors.Errorf("invalid replace operation record, %v", err)
+	}
+	return op, nil
+}
+
+/**
+Replicates the operation through the raft log, every server keeps it in the local metadata store
+ */
+func (t *implRaftServer) saveReplace(op *ReplaceOperation) {
+	op.Updated = time.Now()
+	value, err := json.Marshal(op)
+	if err == nil {
+		err = t.raft.ApplyLog(raft.Log{Data: value, Extensions: replaceEntryHeader}, t.Timeout).Error()
+	}
+	if err != nil {
+		t.Log.Error("ReplaceServerSave", zap.String("old", op.Old), zap.String("new", op.New), zap.Error(err))
+	}
+}
+
+/**
+Applies the replicated operation on the server, invoked by the FSM goroutine
+ */
+func (t *implRaftServer) applyReplace(value []byte) {
+	op := new(ReplaceOperation)
+	if err := json.Unmarshal(value, op); err != nil {
+		t.Log.Error("ReplaceServerApply", zap.Error(err))
+		return
+	}
+	if op.Phase != ReplaceDone && op.Error == "" {
+		t.quarantine.Add(op.Old, "replacing", t.QuarantineTTL)
+	}
+	t.replaceOp.Store(op)
+	if t.MetadataStore == nil {
+		return
+	}
+	if err := t.MetadataStore.Set(replaceNamespace, replaceKey, value); err != nil {
+		t.Log.Error("ReplaceServerApply", zap.String("old", op.Old), zap.String("new", op.New), zap.Error(err))
+	}
+}
+
+/**
+FSM decorator consuming the replicated ReplaceOperation entries
+ */
+type replaceStateFSM struct {
+	raft.FSM
+	apply  func(value []byte)
+}
+
+type replaceStateBatchingFSM struct {
+	*replaceStateFSM
+	batching raft.BatchingFSM
+}
+
+func newReplaceStateFSM(delegate raft.FSM, apply func(value []byte)) raft.FSM {
+	fsm := &replaceStateFSM{FSM: delegate, apply: apply}
+	if batching, ok := delegate.(raft.BatchingFSM); ok {
+		return &replaceStateBatchingFSM{replaceStateFSM: fsm, batching: batching}
+	}
+	return fsm
+}
+
+// reserved entries are the replace records and the application entries colliding with them
+func isReservedEntry(log *raft.Log) bool {
+	return log.Type == raft.LogCommand && len(log.Extensions) > 0 && log.Extensions[0] == replaceEntryMagic
+}
+
+func (t *replaceStateFSM) applyReserved(log *raft.Log) interface{} {
+	if !bytes.Equal(log.Extensions, replaceEntryHeader) {
+		return ErrReservedExtensions
+	}
+	t.apply(log.Data)
+	return nil
+}
+
+func (t *replaceStateFSM) Apply(log *raft.Log) interface{} {
+	if isReservedEntry(log) {
+		return t.applyReserved(log)
+	}
+	return t.FSM.Apply(log)
+}
+
+func (t *replaceStateBatchingFSM) ApplyBatch(logs []*raft.Log) []interface{} {
+	var commands []*raft.Log
+	resp := make([]interface{}, len(logs))
+	for i, log := range logs {
+		if isReservedEntry(log) {
+			resp[i] = t.applyReserved(log)
+		} else {
+			commands = append(commands, log)
+		}
+	}
+	if len(commands) == len(logs) {
+		return t.batching.ApplyBatch(logs)
+	}
+	if len(commands) > 0 {
+		results := t.batching.ApplyBatch(commands)
+		j := 0
+		for i, log := range logs {
+			if !isReservedEntry(log) {
+				resp[i] = results[j]
+				j++
+			}
+		}
+	}
+	return resp
+}
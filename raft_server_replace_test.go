@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"io"
+	"testing"
+	"time"
+)
+
+type replaceTestFSM struct {
+	recoverTestFSM
+	applied  []string
+}
+
+func (t *replaceTestFSM) ApplyBatch(logs []*raft.Log) []interface{} {
+	var resp []interface{}
+	for _, log := range logs {
+		t.applied = append(t.applied, string(log.Data))
+		resp = append(resp, string(log.Data))
+	}
+	return resp
+}
+
+func TestReplaceStateFSM(t *testing.T) {
+
+	delegate := &replaceTestFSM{}
+	var replicated []string
+	fsm := newReplaceStateFSM(delegate, func(value []byte) {
+		replicated = append(replicated, string(value))
+	}).(raft.BatchingFSM)
+
+	resp := fsm.ApplyBatch([]*raft.Log{
+		{Type: raft.LogCommand, Data: []byte("a")},
+		{Type: raft.LogCommand, Data: []byte("op"), Extensions: replaceEntryHeader},
+		{Type: raft.LogCommand, Data: []byte("b")},
+		// application entries colliding with the reserved magic fail instead of being hijacked
+		{Type: raft.LogCommand, Data: []byte("c"), Extensions: []byte{replaceEntryMagic}},
+		{Type: raft.LogCommand, Data: []byte("d"), Extensions: []byte{replaceEntryMagic, 'R', 'P', 'L', 'C', 2}},
+		{Type: raft.LogCommand, Data: []byte("e"), Extensions: EncodeEntryMetadata(&EntryMetadata{Time: time.Now()})},
+	})
+
+	require.Equal(t, []interface{}{"a", nil, "b", ErrReservedExtensions, ErrReservedExtensions, "e"}, resp)
+	require.Equal(t, []string{"a", "b", "e"}, delegate.applied)
+	require.Equal(t, []string{"op"}, replicated)
+
+	single := newReplaceStateFSM(&raft.MockFSM{}, func(value []byte) {
+		t.Fatal("application entry is applied as the replace record")
+	})
+	require.Equal(t, ErrReservedExtensions, single.Apply(&raft.Log{Type: raft.LogCommand, Data: []byte("x"), Extensions: []byte{replaceEntryMagic}}))
+}
+
+func TestReplaceStateReplicated(t *testing.T) {
+
+	addrA, transA := raft.NewInmemTransport("a")
+	addrB, transB := raft.NewInmemTransport("b")
+	transA.Connect(addrB, transB)
+	transB.Connect(addrA, transA)
+
+	var servers []*implRaftServer
+	for _, trans := range []*raft.InmemTransport{transA, transB} {
+		store := raft.NewInmemStore()
+		srv := &implRaftServer{
+			Log:           zap.NewNop(),
+			MetadataStore: NewMetadataStore(store),
+			Timeout:       5 * time.Second,
+			QuarantineTTL: time.Minute,
+			quarantine:    newServerQuarantine(),
+		}
+
+		config := raft.DefaultConfig()
+		config.LocalID = raft.ServerID(trans.LocalAddr())
+		config.HeartbeatTimeout = 50 * time.Millisecond
+		config.ElectionTimeout = 50 * time.Millisecond
+		config.LeaderLeaseTimeout = 50 * time.Millisecond
+		config.CommitTimeout = 5 * time.Millisecond
+		config.LogOutput = io.Discard
+
+		r, err := raft.NewRaft(config, newReplaceStateFSM(&recoverTestFSM{}, srv.applyReplace), store, store, raft.NewInmemSnapshotStore(), trans)
+		require.NoError(t, err)
+		srv.raft = r
+		t.Cleanup(func() {
+			r.Shutdown().Error()
+		})
+		servers = append(servers, srv)
+	}
+
+	leader, follower := servers[0], servers[1]
+	require.NoError(t, leader.raft.BootstrapCluster(raft.Configuration{Servers: []raft.Server{
+		{ID: "a", Address: addrA},
+		{ID: "b", Address: addrB},
+	}}).Error())
+
+	require.Eventually(t, func() bool {
+		return leader.raft.State() == raft.Leader
+	}, 5 * time.Second, 10 * time.Millisecond)
+
+	leader.saveReplace(&ReplaceOperation{Old: "c", New: "d", Phase: ReplaceCatchUp, Started: time.Now()})
+
+	// the follower becoming the next leader resumes the operation from its own store
+	require.Eventually(t, func() bool {
+		op, err := follower.ReplaceStatus()
+		return err == nil && op != nil && op.Phase == ReplaceCatchUp
+	}, 5 * time.Second, 10 * time.Millisecond)
+
+	op, err := follower.ReplaceStatus()
+	require.NoError(t, err)
+	require.Equal(t, "c", op.Old)
+	require.Equal(t, "d", op.New)
+	require.True(t, follower.quarantine.Contains("c"))
+}
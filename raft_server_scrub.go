@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"io"
+	"time"
+)
+
+/**
+Result of the log and snapshots scrub
+ */
+type ScrubResult struct {
+	Entries            uint64    `json:"entries"`
+	Corrupted          []uint64  `json:"corrupted,omitempty"`
+	Missing            uint64    `json:"missing"`
+	Snapshots          int       `json:"snapshots"`
+	CorruptedSnapshots []string  `json:"corruptedSnapshots,omitempty"`
+	Bytes              int64     `json:"bytes"`
+}
+
+/**
+Verifies checksums of the whole log store and all snapshots, returns error if log store does not support checksums
+ */
+func (t *implRaftServer) ScrubLog() (*ScrubResult, error) {
+
+	scrubber, ok := t.LogStore.(LogScrubber)
+	if !ok {
+		return nil, errors.New("log store does not support checksums, enable 'raft-storage.log-checksum'")
+	}
+
+	if !t.scrubbing.CompareAndSwap(false, true) {
+		return nil, errors.New("log scrub is already in progress")
+	}
+	defer t.scrubbing.Store(false)
+
+	started := time.Now()
+	result := new(ScrubResult)
+	limiter := newBandwidthLimiter(float64(t.ScrubRate) * 1024 * 1024)
+	audit := t.Log.Named("audit")
+
+	err := scrubber.ScrubLog(func(log *raft.Log, err error) bool {
+		result.Entries++
+		if err == raft.ErrLogNotFound {
+			result.Missing++
+		} else if err != nil {
+			result.Corrupted = append(result.Corrupted, log.Index)
+			metrics.IncrCounter([]string{"raft", "scrub", "log", "corrupted"}, 1)
+			audit.Error("LogChecksum", zap.Uint64("index", log.Index), zap.Error(err))
+		}
+		n := len(log.Data) + len(log.Extensions)
+		result.Bytes += int64(n)
+		return limiter.Wait(n, t.shutdownCh)
+	})
+	if err != nil {
+		return result, err
+	}
+
+	metrics.SetGauge([]string{"raft", "scrub", "log", "entries"}, float32(result.Entries))
+
+	if err := t.scrubSnapshots(result, limiter, audit); err != nil {
+		return result, err
+	}
+
+	metrics.MeasureSince([]string{"raft", "scrub", "duration"}, started)
+	t.Log.Info("LogScrub", zap.Uint64("entries", result.Entries), zap.Int("corrupted", len(result.Corrupted)), zap.Uint64("missing", result.Missing),
+		zap.Int("snapshots", result.Snapshots), zap.Int("corruptedSnapshots", len(result.CorruptedSnapshots)), zap.Int64("bytes", result.Bytes), zap.Duration("elapsed", time.Since(started)))
+	return result, nil
+}
+
+func (t *implRaftServer) scrubSnapshots(result *ScrubResult, limiter *bandwidthLimiter, audit *zap.Logger) error {
+
+	list, err := t.FileSnapshotStore.List()
+	if err != nil {
+		return errors.Errorf("list snapshots, %v", err)
+	}
+
+	for _, meta := range list {
+		result.Snapshots++
+		n, err := t.verifySnapshot(meta.ID, limiter)
+		result.Bytes += n
+		if err != nil {
+			result.CorruptedSnapshots = append(result.CorruptedSnapshots, meta.ID)
+			metrics.IncrCounter([]string{"raft", "scrub", "snapshot", "corrupted"}, 1)
+			audit.Error("SnapshotChecksum", zap.String("id", meta.ID), zap.Error(err))
+		}
+		select {
+		case <-t.shutdownCh:
+			return nil
+		default:
+		}
+	}
+
+	return nil
+}
+
+// file snapshot store verifies CRC on open, reading of the content also verifies decoders
+func (t *implRaftServer) verifySnapshot(id string, limiter *bandwidthLimiter) (int64, error) {
+	_, source, err := t.FileSnapshotStore.Open(id)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	var total int64
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := source.Read(buf)
+		total += int64(n)
+		if !limiter.Wait(n, t.shutdownCh) {
+			return total, nil
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+func (t *implRaftServer) scrubLoop() {
+
+	t.Log.Info("LogScrubScheduled", zap.Duration("interval", t.ScrubInterval), zap.Int("rateMB", t.ScrubRate))
+
+	ticker := time.NewTicker(t.ScrubInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := t.ScrubLog(); err != nil {
+				t.Log.Error("LogScrub", zap.Error(err))
+			}
+		case <-t.shutdownCh:
+			return
+		}
+	}
+}
@@ -6,9 +6,13 @@
 package raftmod
 
 import (
+	"encoding/json"
 	"github.com/hashicorp/serf/serf"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -33,7 +37,8 @@ func (t *implRaftServer) HandleEvent(e serf.Event) {
 	case serf.EventMemberUpdate:
 		t.nodeUpdateLAN(e.(serf.MemberEvent))
 		t.localMemberEvent(e.(serf.MemberEvent))
-	case serf.EventQuery: // Ignore
+	case serf.EventQuery:
+		t.localQuery(e.(*serf.Query))
 	default:
 		t.Log.Warn("UnknownSerfEvent", zap.String("network", "LAN"), zap.Any("event", e))
 	}
@@ -60,11 +65,20 @@ func (t *implRaftServer) nodeJoinLAN(me serf.MemberEvent) {
 			t.Log.Debug("SerfNodeJoinLAN", zap.Error(err))
 			continue
 		}
+		if err := CheckRaftProtocol(m, t.ProtocolVersion); err != nil {
+			t.Log.Warn("SerfNodeJoinLAN", zap.String("server", server.String()), zap.Error(err))
+			continue
+		}
 		t.Log.Info("SerfNodeJoinLAN", zap.String("server", server.String()))
+		t.publish(&ClusterEvent{Type: EventMemberJoined, ID: server.ID, Name: server.Name, Address: string(RaftServerAddress(server)), Status: server.Status})
+		t.tlsPeers.Store(RaftServerAddress(server), m.Tags[RaftTLSTag] == "true")
+		t.compressPeers.Store(RaftServerAddress(server), m.Tags[RaftCompressTag])
+		t.resumePeers.Store(RaftServerAddress(server), m.Tags[RaftSnapshotResumeTag] == "true")
 
 		// Update server lookup
 		t.ServerLookup.AddServer(server)
 	}
+	t.checkStateHashes()
 }
 
 func (t *implRaftServer) nodeUpdateLAN(me serf.MemberEvent) {
@@ -72,12 +86,34 @@ func (t *implRaftServer) nodeUpdateLAN(me serf.MemberEvent) {
 		server, err := ParseServerTags(m, t.Application.Name())
 		if err != nil {
 			t.Log.Debug("SerfNodeUpdateLAN", zap.Error(err))
+			if err == ErrClientMember {
+				t.removeServerByID(m.Tags["id"])
+			}
+			continue
+		}
+		if err := CheckRaftProtocol(m, t.ProtocolVersion); err != nil {
+			t.Log.Warn("SerfNodeUpdateLAN", zap.String("server", server.String()), zap.Error(err))
+			t.ServerLookup.RemoveServer(server)
 			continue
 		}
 		t.Log.Info("SerfNodeUpdateLAN", zap.String("server", server.String()))
+		t.publish(&ClusterEvent{Type: EventMemberUpdated, ID: server.ID, Name: server.Name, Address: string(RaftServerAddress(server)), Status: server.Status})
+		t.tlsPeers.Store(RaftServerAddress(server), m.Tags[RaftTLSTag] == "true")
+		t.compressPeers.Store(RaftServerAddress(server), m.Tags[RaftCompressTag])
+		t.resumePeers.Store(RaftServerAddress(server), m.Tags[RaftSnapshotResumeTag] == "true")
 
 		t.ServerLookup.AddServer(server)
 	}
+	t.checkStateHashes()
+}
+
+func (t *implRaftServer) removeServerByID(id string) {
+	for _, server := range t.ServerLookup.Servers() {
+		if server.ID == id {
+			t.Log.Info("SerfNodeRemoveLAN", zap.String("server", server.String()))
+			t.ServerLookup.RemoveServer(server)
+		}
+	}
 }
 
 func (t *implRaftServer) nodeFailedLAN(me serf.MemberEvent) {
@@ -88,6 +124,11 @@ func (t *implRaftServer) nodeFailedLAN(me serf.MemberEvent) {
 			continue
 		}
 		t.Log.Info("SerfNodeFailedLAN", zap.String("server", server.String()))
+		t.publish(&ClusterEvent{Type: EventMemberFailed, ID: server.ID, Name: server.Name, Address: string(RaftServerAddress(server)), Status: server.Status})
+		t.tlsPeers.Delete(RaftServerAddress(server))
+		t.compressPeers.Delete(RaftServerAddress(server))
+		t.resumePeers.Delete(RaftServerAddress(server))
+		t.quarantine.Add(server.ID, "serf " + server.Status, t.QuarantineTTL)
 
 		// Update id to address map
 		t.ServerLookup.RemoveServer(server)
@@ -122,6 +163,16 @@ func (t *implRaftServer) localEvent(event serf.UserEvent) {
 
 	t.Log.Info("UserEvent", zap.String("event", event.Name), zap.String("payload", string(event.Payload)))
 
+	name, payload, complete, err := t.assembler.Add(event)
+	if err != nil {
+		t.Log.Warn("UserEventChunk", zap.String("event", event.Name), zap.Error(err))
+		return
+	}
+	if !complete {
+		return
+	}
+	event.Name, event.Payload = name, payload
+
 	prefix := t.Application.Name() + ":"
 	if !strings.HasPrefix(event.Name,  prefix) {
 		return
@@ -129,8 +180,213 @@ func (t *implRaftServer) localEvent(event serf.UserEvent) {
 	eventName := event.Name[len(prefix):]
 
 	if eventName == "new-leader" {
-		t.Log.Info("NewLeaderElected", zap.String("payload", string(event.Payload)))
+		var leader NewLeaderEvent
+		if err := json.Unmarshal(event.Payload, &leader); err != nil {
+			t.Log.Warn("NewLeaderElected", zap.String("payload", string(event.Payload)), zap.Error(err))
+			return
+		}
+		t.Log.Info("NewLeaderElected", zap.String("id", leader.ID), zap.String("address", leader.Address))
+	}
+
+}
+
+/**
+Response payload of the application queries handled by the raft server
+ */
+type QueryResponse struct {
+	Error   string           `json:"error,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+}
+
+/**
+Compact snapshot metadata fitting in the serf query response size limit
+ */
+type SnapshotInfo struct {
+	ID     string  `json:"id"`
+	Index  uint64  `json:"index"`
+	Term   uint64  `json:"term"`
+	Size   int64   `json:"size"`
+}
+
+/**
+Answers read-only application queries, mutating operations are served by the authenticated management API only,
+because any gossip member can send a query
+ */
+func (t *implRaftServer) localQuery(query *serf.Query) {
+
+	prefix := t.Application.Name() + ":"
+	if !strings.HasPrefix(query.Name,  prefix) {
+		return
+	}
+	queryName := query.Name[len(prefix):]
+
+	var handler func() (interface{}, error)
+
+	switch queryName {
+	case "raft-stats":
+		handler = func() (interface{}, error) {
+			return t.localStats()
+		}
+	case "raft-configuration":
+		handler = func() (interface{}, error) {
+			return t.localConfiguration()
+		}
+	case "quarantine-list":
+		handler = func() (interface{}, error) {
+			return t.quarantine.List(), nil
+		}
+	case "index-time":
+		handler = func() (interface{}, error) {
+			index, err := strconv.ParseUint(string(query.Payload), 10, 64)
+			if err != nil {
+				return nil, errors.Errorf("invalid index '%s', %v", string(query.Payload), err)
+			}
+			return t.LookupTime(index)
+		}
+	case "node-health":
+		handler = func() (interface{}, error) {
+			return t.NodeHealth(string(query.Payload))
+		}
+	case "snapshot-offset":
+		handler = func() (interface{}, error) {
+			if t.resumeTransport == nil {
+				return nil, errors.New("resumable snapshots are not enabled, set 'raft.snapshot-resume'")
+			}
+			return t.resumeTransport.stagedOffset(string(query.Payload))
+		}
+	case "replace-status":
+		handler = func() (interface{}, error) {
+			return t.ReplaceStatus()
+		}
+	default:
+		return
+	}
+
+	// do not block serf event loop by long running queries
+	go func() {
+		result, err := handler()
+		t.respondQuery(query, result, err)
+	}()
+}
+
+func (t *implRaftServer) respondQuery(query *serf.Query, result interface{}, err error) {
+	var resp QueryResponse
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Result, err = json.Marshal(result)
+		if err != nil {
+			resp.Error = err.Error()
+		}
+	}
+	payload, err := json.Marshal(&resp)
+	if err == nil {
+		err = query.Respond(payload)
+	}
+	if err != nil {
+		t.Log.Error("SerfQueryRespond", zap.String("query", query.Name), zap.Error(err))
+	}
+}
+
+/**
+Raft replication state of the single node
+ */
+type NodeStats struct {
+	State         string     `json:"state"`
+	LastIndex     uint64     `json:"lastIndex"`
+	AppliedIndex  uint64     `json:"appliedIndex"`
+	LastContact   time.Time  `json:"lastContact"`
+}
+
+func (t *implRaftServer) localStats() (*NodeStats, error) {
+	if !t.alive.Load() {
+		return nil, errors.New("raft server is not running")
+	}
+	return &NodeStats{
+		State:        t.raft.State().String(),
+		LastIndex:    t.raft.LastIndex(),
+		AppliedIndex: t.raft.AppliedIndex(),
+		LastContact:  t.raft.LastContact(),
+	}, nil
+}
+
+/**
+Sends application query to the single serf member and decodes the response into result
+ */
+func (t *implRaftServer) queryNode(node, queryName string, payload []byte, timeout time.Duration, result interface{}) error {
+
+	if t.SerfServer == nil {
+		return errors.New("serf server is not available")
 	}
+	s, ok := t.SerfServer.Serf()
+	if !ok || s == nil {
+		return errors.New("serf is not running")
+	}
+
+	params := s.DefaultQueryParams()
+	params.FilterNodes = []string{node}
+	if timeout > 0 {
+		params.Timeout = timeout
+	}
+
+	name := t.Application.Name() + ":" + queryName
+	resp, err := s.Query(name, payload, params)
+	if err != nil {
+		return errors.Errorf("query '%s' on node '%s', %v", name, node, err)
+	}
+	defer resp.Close()
+
+	r, ok := <-resp.ResponseCh()
+	if !ok {
+		return errors.Errorf("no response for query '%s' from node '%s'", name, node)
+	}
+
+	var qr QueryResponse
+	if err := json.Unmarshal(r.Payload, &qr); err != nil {
+		return errors.Errorf("invalid response for query '%s' from node '%s', %v", name, node, err)
+	}
+	if qr.Error != "" {
+		return errors.Errorf("query '%s' failed on node '%s', %s", name, node, qr.Error)
+	}
+	if result != nil && len(qr.Result) > 0 {
+		return json.Unmarshal(qr.Result, result)
+	}
+	return nil
+}
+
+/**
+Raft server in the cluster configuration
+ */
+type ConfigurationServer struct {
+	ID        string  `json:"id"`
+	Address   string  `json:"address"`
+	Suffrage  string  `json:"suffrage"`
+}
 
+/**
+Latest raft configuration with the known leader as seen by the single node
+ */
+type ClusterConfiguration struct {
+	LeaderID  string                  `json:"leaderId,omitempty"`
+	Servers   []*ConfigurationServer  `json:"servers"`
 }
 
+func (t *implRaftServer) localConfiguration() (*ClusterConfiguration, error) {
+	if !t.alive.Load() {
+		return nil, errors.New("raft server is not running")
+	}
+	future := t.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, errors.Errorf("get raft configuration, %v", err)
+	}
+	_, leaderID := t.raft.LeaderWithID()
+	result := &ClusterConfiguration{LeaderID: string(leaderID)}
+	for _, server := range future.Configuration().Servers {
+		result.Servers = append(result.Servers, &ConfigurationServer{
+			ID:       string(server.ID),
+			Address:  string(server.Address),
+			Suffrage: server.Suffrage.String(),
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/hashicorp/serf/serf"
+	"github.com/pkg/errors"
+	"github.com/sprintframework/raftapi"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StateHashTag gossips '<applied index>:<hex hash>' of the FSM state computed by StateHasher
+const StateHashTag = "fsm-hash"
+
+// serf tags are limited, only the prefix of the application hash is gossiped
+const stateHashTagBytes = 16
+
+/**
+Parsed value of the StateHashTag
+ */
+type StateHash struct {
+	Index  uint64  `json:"index"`
+	Hash   string  `json:"hash"`
+}
+
+func FormatStateHash(index uint64, hash []byte) string {
+	if len(hash) > stateHashTagBytes {
+		hash = hash[:stateHashTagBytes]
+	}
+	return fmt.Sprintf("%d:%s", index, hex.EncodeToString(hash))
+}
+
+func ParseStateHash(value string) (*StateHash, error) {
+	i := strings.IndexByte(value, ':')
+	if i <= 0 {
+		return nil, errors.Errorf("invalid state hash '%s'", value)
+	}
+	index, err := strconv.ParseUint(value[:i], 10, 64)
+	if err != nil {
+		return nil, errors.Errorf("invalid index in state hash '%s', %v", value, err)
+	}
+	return &StateHash{Index: index, Hash: value[i+1:]}, nil
+}
+
+/**
+Groups the state hashes of the nodes by applied index and returns indexes with more than one distinct hash,
+value of the map is node name to hash
+ */
+func FindStateDivergence(hashes map[string]*StateHash) map[uint64]map[string]string {
+	byIndex := make(map[uint64]map[string]string)
+	for node, h := range hashes {
+		nodes, ok := byIndex[h.Index]
+		if !ok {
+			nodes = make(map[string]string)
+			byIndex[h.Index] = nodes
+		}
+		nodes[node] = h.Hash
+	}
+	for index, nodes := range byIndex {
+		distinct := make(map[string]bool)
+		for _, hash := range nodes {
+			distinct[hash] = true
+		}
+		if len(distinct) < 2 {
+			delete(byIndex, index)
+		}
+	}
+	return byIndex
+}
+
+func (t *implRaftServer) stateHashLoop(hasher StateHasher) {
+
+	// wait for the replay of the logs existing on startup
+	replayIndex := t.raft.LastIndex()
+	for t.raft.AppliedIndex() < replayIndex {
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-t.shutdownCh:
+			return
+		}
+	}
+
+	t.Log.Info("StateHashReplayed", zap.Uint64("index", replayIndex), zap.Duration("interval", t.StateHashInterval))
+	t.publishStateHash(hasher)
+
+	if t.StateHashInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(t.StateHashInterval)
+	defer ticker.Stop()
+
+	var lastIndex uint64
+	for {
+		select {
+		case <-ticker.C:
+			if index := t.raft.AppliedIndex(); index != lastIndex {
+				lastIndex = index
+				t.publishStateHash(hasher)
+			}
+		case <-t.shutdownCh:
+			return
+		}
+	}
+}
+
+func (t *implRaftServer) publishStateHash(hasher StateHasher) {
+	index, hash, err := hasher.StateHash()
+	if err != nil {
+		t.Log.Error("StateHash", zap.Error(err))
+		return
+	}
+	value := FormatStateHash(index, hash)
+	t.stateHash.Store(value)
+	if err := setSerfTag(t.SerfServer, StateHashTag, value); err != nil {
+		t.Log.Error("StateHashTag", zap.String("value", value), zap.Error(err))
+		return
+	}
+	t.Log.Info("StateHash", zap.String("value", value))
+}
+
+/**
+Leader compares gossiped state hashes at identical indexes and alarms on divergence once per index
+ */
+func (t *implRaftServer) checkStateHashes() {
+
+	if !t.StateHash || t.SerfServer == nil || !t.IsLeader() {
+		return
+	}
+	s, ok := t.SerfServer.Serf()
+	if !ok || s == nil {
+		return
+	}
+
+	hashes := make(map[string]*StateHash)
+	for _, m := range s.Members() {
+		value, ok := m.Tags[StateHashTag]
+		if !ok || m.Status != serf.StatusAlive {
+			continue
+		}
+		h, err := ParseStateHash(value)
+		if err != nil {
+			t.Log.Debug("StateHashTag", zap.String("node", m.Name), zap.Error(err))
+			continue
+		}
+		hashes[m.Name] = h
+	}
+
+	for index, nodes := range FindStateDivergence(hashes) {
+		if _, alarmed := t.stateDivergence.LoadOrStore(index, true); alarmed {
+			continue
+		}
+		t.Log.Error("StateHashDivergence", zap.Uint64("index", index), zap.Any("nodes", nodes))
+		t.publish(&ClusterEvent{Type: EventStateDivergence, Index: index, Status: fmt.Sprintf("%v", nodes)})
+	}
+}
+
+func setSerfTag(serfServer raftapi.SerfServer, name, value string) error {
+	if serfServer == nil {
+		return nil
+	}
+	a, ok := serfServer.Agent()
+	if !ok || a == nil || a.Serf() == nil {
+		return errors.New("serf agent is not running")
+	}
+	current := a.Serf().LocalMember().Tags
+	if current[name] == value {
+		return nil
+	}
+	tags := make(map[string]string, len(current) + 1)
+	for k, v := range current {
+		tags[k] = v
+	}
+	tags[name] = value
+	return a.SetTags(tags)
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestStateHashTag(t *testing.T) {
+
+	value := FormatStateHash(120, bytes.Repeat([]byte{0xab}, 32))
+	require.Equal(t, "120:" + strings.Repeat("ab", stateHashTagBytes), value)
+
+	h, err := ParseStateHash(value)
+	require.NoError(t, err)
+	require.Equal(t, uint64(120), h.Index)
+	require.Equal(t, strings.Repeat("ab", stateHashTagBytes), h.Hash)
+
+	for _, invalid := range []string{"", "abcd", ":abcd", "x:abcd"} {
+		_, err = ParseStateHash(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestStateDivergence(t *testing.T) {
+
+	divergence := FindStateDivergence(map[string]*StateHash{
+		"node-1": {Index: 100, Hash: "aa"},
+		"node-2": {Index: 100, Hash: "aa"},
+		"node-3": {Index: 100, Hash: "bb"},
+		// different indexes are not compared
+		"node-4": {Index: 101, Hash: "cc"},
+		"node-5": {Index: 102, Hash: "dd"},
+		"node-6": {Index: 102, Hash: "dd"},
+	})
+
+	require.Equal(t, map[uint64]map[string]string{
+		100: {"node-1": "aa", "node-2": "aa", "node-3": "bb"},
+	}, divergence)
+
+	require.Empty(t, FindStateDivergence(nil))
+}
@@ -9,11 +9,14 @@ import (
 	"fmt"
 	"github.com/codeallergy/glue"
 	"github.com/sprintframework/sprint"
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/raft"
 	"github.com/pkg/errors"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
+	"time"
 )
 
 var SnapshotStoreClass = reflect.TypeOf((*raft.SnapshotStore)(nil)).Elem()
@@ -21,15 +24,89 @@ var SnapshotStoreClass = reflect.TypeOf((*raft.SnapshotStore)(nil)).Elem()
 type implRaftSnapshotFactory struct {
 
 	Application sprint.Application   `inject`
-	Properties  glue.Properties      `inject`
-	SystemEnvironmentPropertyResolver sprint.SystemEnvironmentPropertyResolver `inject`
+	NodeService      sprint.NodeService   `inject`
+	HCLog            hclog.Logger         `inject`
+
+	// level of the file snapshot store messages, the application logger filters them as well
+	LogLevel            string `value:"raft-snapshot.log-level,default=info"`
 
 	RetainSnapshotCount int    `value:"raft.snapshot-retain-count,default=5"`
-	KeyProperty         string `value:"raft.snapshot-key-bean,default="`
+
+	/**
+	Directory of snapshots, for example on the dedicated fast disk, missing directories are created with 'application.perm.*'.
+	Empty is 'raft-snapshot' in the data dir.
+	 */
+	SnapshotDir         string `value:"raft-snapshot.dir,default="`
+
+	/**
+	Snapshots older than the age or beyond the total size, for example '168h' or '10GB', are removed after
+	each new snapshot, the newest one is always kept. 'raft.snapshot-retain-count' still limits the count.
+	 */
+	RetainAge           time.Duration `value:"raft-snapshot.retain-age,default=0s"`
+	RetainTotalSize     string        `value:"raft-snapshot.retain-total-size,default="`
+
+	/**
+	SHA-256 of the stored snapshot is recorded in 'checksum.json' next to it for SnapshotVerifier,
+	non-empty chunk size, for example '4MB', records per-chunk checksums as well to locate the damage
+	 */
+	Checksum            bool   `value:"raft-snapshot.checksum,default=true"`
+	ChecksumChunkSize   string `value:"raft-snapshot.checksum-chunk-size,default="`
+
+	/**
+	Storage of snapshots: 'file' is the data dir, 's3' is the S3-compatible object storage for diskless or ephemeral nodes,
+	the data dir keeps only in-progress snapshots then
+	 */
+	Backend             string `value:"raft-snapshot.backend,default=file"`
+
+	/**
+	Former backend during the live migration of snapshots to 'raft-snapshot.backend', for example 'file' when moving to 's3'.
+	New snapshots are written to both, reads prefer the new backend. Empty after the migration.
+	 */
+	MigrateFrom         string `value:"raft-snapshot.migrate-from,default="`
+
+	S3Endpoint          string        `value:"raft-snapshot.s3.endpoint,default="`
+	S3Region            string        `value:"raft-snapshot.s3.region,default=us-east-1"`
+	S3Bucket            string        `value:"raft-snapshot.s3.bucket,default="`
+	// empty prefix is '<application>/<node id>', every node needs its own prefix
+	S3Prefix            string        `value:"raft-snapshot.s3.prefix,default="`
+	// empty keys are taken from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+	S3AccessKey         string        `value:"raft-snapshot.s3.access-key,default="`
+	S3SecretKey         string        `value:"raft-snapshot.s3.secret-key,default="`
+	S3SessionToken      string        `value:"raft-snapshot.s3.session-token,default="`
+	S3PathStyle         bool          `value:"raft-snapshot.s3.path-style,default=false"`
+	S3Timeout           time.Duration `value:"raft-snapshot.s3.timeout,default=30s"`
+	// states above the part size are uploaded by parts, S3 requires at least 5 MiB
+	S3PartSizeMB        int           `value:"raft-snapshot.s3.part-size-mb,default=64"`
+	/**
+	Encryption of new snapshots: 'gcm' authenticates them, 'ctr' is the legacy mode without integrity check,
+	snapshots of both modes are readable
+	 */
+	EncryptionMode      string `value:"raft.snapshot-encryption,default=gcm"`
+
+	// master key of the 'encrypt' decorator
+	Keys                KeyResolver  `inject`
+
+	/**
+	Comma separated ordered list of decorators applied to the snapshot stream before it reaches the disk,
+	for example 'compress,encrypt,verify'. 'verify' checks the SHA-256 of the stream at its position on every read.
+	Empty pipeline means 'encrypt' if 'raft.snapshot-key-bean' is defined.
+	 */
+	Pipeline            string `value:"raft-snapshot.pipeline,default="`
+
+	// codec of the 'compress' decorator, 'zstd' or 'gzip'
+	Compression         string `value:"raft.snapshot-compression,default=zstd"`
+	// zero is the default level of the codec
+	CompressionLevel    int    `value:"raft.snapshot-compression-level,default=0"`
+
+	// custom decorators registered by name
+	Decorators  []SnapshotStoreDecorator  `inject:"optional"`
 
 	DataDir           string       `value:"application.data.dir,default="`
 	DataDirPerm       os.FileMode  `value:"application.perm.data.dir,default=-rwxrwx---"`
 	DataFilePerm      os.FileMode  `value:"application.perm.data.file,default=-rw-rw-r--"`
+	PermMode          string       `value:"application.perm.mode,default=auto"`
+	PermUID           int          `value:"application.perm.uid,default=-1"`
+	PermGID           int          `value:"application.perm.gid,default=-1"`
 }
 
 func RaftSnapshotFactory() glue.FactoryBean {
@@ -40,46 +117,215 @@ func (t *implRaftSnapshotFactory) Object() (object interface{}, err error) {
 
 	defer panicToError(&err)
 
+	perm, err := newDataDirPerm(t.DataDirPerm, t.PermMode, t.PermUID, t.PermGID)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotsFolder, err := t.snapshotsFolder(perm)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the snapshot delegate. This allows the Raft to truncate the log.
+	snapshots, remove, err := t.newBackend(t.Backend, snapshotsFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	sidecar, ok := snapshots.(snapshotSidecar)
+	if !ok {
+		sidecar = fileSnapshotSidecar(snapshotsFolder)
+	}
+
+	if t.MigrateFrom != "" {
+		if t.MigrateFrom == t.Backend || (t.MigrateFrom == "file" && t.Backend == "") {
+			return nil, errors.Errorf("issue in property 'raft-snapshot.migrate-from', backend '%s' is the current one", t.MigrateFrom)
+		}
+		old, removeOld, err := t.newBackend(t.MigrateFrom, snapshotsFolder)
+		if err != nil {
+			return nil, errors.Errorf("issue in property 'raft-snapshot.migrate-from', %v", err)
+		}
+		dual := newDualSnapshotStore(snapshots, old)
+		snapshots, remove = dual, dual.remover(remove, removeOld)
+	}
+
+	var checksums *implChecksumSnapshotStore
+	if t.Checksum {
+		chunkSize, err := ParseByteSize(t.ChecksumChunkSize)
+		if err != nil {
+			return nil, errors.Errorf("issue in property 'raft-snapshot.checksum-chunk-size', %v", err)
+		}
+		// checksums of the stored bytes are verified without keys of the pipeline
+		checksums = newChecksumSnapshotStore(snapshots, sidecar, chunkSize)
+		snapshots = checksums
+	}
+
+	maxSize, err := ParseByteSize(t.RetainTotalSize)
+	if err != nil {
+		return nil, errors.Errorf("issue in property 'raft-snapshot.retain-total-size', %v", err)
+	}
+	if t.RetainAge < 0 {
+		return nil, errors.Errorf("issue in property 'raft-snapshot.retain-age', negative age %v", t.RetainAge)
+	}
+	if t.RetainAge > 0 || maxSize > 0 {
+		// sizes of the backend are sizes on the disk after all decorators
+		snapshots = newRetentionSnapshotStore(snapshots, remove, t.RetainAge, maxSize)
+	}
+
+	pipeline := t.Pipeline
+	if pipeline == "" && t.Keys.KeysConfigured() {
+		pipeline = "encrypt"
+	}
+
+	snapshots, err = t.buildPipeline(snapshots, pipeline, sidecar)
+	if err != nil || checksums == nil {
+		return snapshots, err
+	}
+	return &verifiableSnapshotStore{SnapshotStore: snapshots, checksums: checksums}, nil
+}
+
+func (t *implRaftSnapshotFactory) snapshotsFolder(perm dataDirPerm) (string, error) {
+
+	if t.SnapshotDir != "" {
+		if err := createDirsIfNeeded(t.SnapshotDir, perm); err != nil {
+			return "", errors.Errorf("issue in property 'raft-snapshot.dir', %v", err)
+		}
+		return t.SnapshotDir, nil
+	}
+
 	dataDir := t.DataDir
 	if dataDir == "" {
 		dataDir = filepath.Join(t.Application.ApplicationDir(), "db")
 
-		if err := createDirIfNeeded(dataDir, t.DataDirPerm); err != nil {
-			return nil, err
+		if err := createDirIfNeeded(dataDir, perm); err != nil {
+			return "", err
 		}
 
 		dataDir = filepath.Join(dataDir, t.Application.Name())
 	}
 
-	if err := createDirIfNeeded(dataDir, t.DataDirPerm); err != nil {
-		return nil, err
+	if err := createDirIfNeeded(dataDir, perm); err != nil {
+		return "", err
 	}
 
 	snapshotsFolder := filepath.Join(dataDir, "raft-snapshot")
 
-	if err := createDirIfNeeded(snapshotsFolder, t.DataDirPerm); err != nil {
-		return nil, err
+	if err := createDirIfNeeded(snapshotsFolder, perm); err != nil {
+		return "", err
 	}
+	return snapshotsFolder, nil
+}
 
-	// Create the snapshot delegate. This allows the Raft to truncate the log.
-	snapshots, err := raft.NewFileSnapshotStore(snapshotsFolder, t.RetainSnapshotCount, os.Stderr)
-	if err != nil {
-		return nil, fmt.Errorf("raft snapshots '%s' creation error, %v", snapshotsFolder, err)
+/**
+Returns the snapshot store of the backend and the function removing snapshots from it
+ */
+func (t *implRaftSnapshotFactory) newBackend(backend, snapshotsFolder string) (raft.SnapshotStore, func(id string) error, error) {
+
+	switch backend {
+	case "", "file":
+		level, err := parseLogLevel(t.LogLevel)
+		if err != nil {
+			return nil, nil, errors.Errorf("issue in property 'raft-snapshot.log-level', %v", err)
+		}
+		logger := newLevelLogger(t.HCLog.Named("raft-snapshot"), level)
+		snapshots, err := raft.NewFileSnapshotStoreWithLogger(snapshotsFolder, t.RetainSnapshotCount, logger)
+		if err != nil {
+			return nil, nil, fmt.Errorf("raft snapshots '%s' creation error, %v", snapshotsFolder, err)
+		}
+		return snapshots, fileSnapshotRemover(snapshotsFolder), nil
+
+	case "s3":
+		prefix := t.S3Prefix
+		if prefix == "" {
+			prefix = t.Application.Name() + "/" + t.NodeService.NodeIdHex()
+		}
+		if t.S3PartSizeMB < 5 {
+			return nil, nil, errors.Errorf("invalid property 'raft-snapshot.s3.part-size-mb' value %d, expected at least 5", t.S3PartSizeMB)
+		}
+		snapshots, err := S3SnapshotStore(S3Config{
+			Endpoint:     t.S3Endpoint,
+			Region:       t.S3Region,
+			Bucket:       t.S3Bucket,
+			Prefix:       prefix,
+			AccessKey:    t.S3AccessKey,
+			SecretKey:    t.S3SecretKey,
+			SessionToken: t.S3SessionToken,
+			PathStyle:    t.S3PathStyle,
+			Timeout:      t.S3Timeout,
+			PartSize:     int64(t.S3PartSizeMB) << 20,
+		}, snapshotsFolder, t.RetainSnapshotCount)
+		if err != nil {
+			return nil, nil, errors.Errorf("issue in property 'raft-snapshot.s3', %v", err)
+		}
+		return snapshots, snapshots.(*implS3SnapshotStore).removeSnapshot, nil
 	}
 
-	if t.KeyProperty != "" {
-		encryptionToken := t.Properties.GetString(t.KeyProperty, "")
-		if encryptionToken == "" {
-			var ok bool
-			encryptionToken, ok = t.SystemEnvironmentPropertyResolver.PromptProperty(t.KeyProperty)
-			if !ok || encryptionToken == "" {
-				return nil, errors.Errorf("'%s' encryption token is required", t.KeyProperty)
-			}
+	return nil, nil, errors.Errorf("unknown snapshot backend '%s' in property 'raft-snapshot.backend', expected 'file' or 's3'", backend)
+}
+
+func (t *implRaftSnapshotFactory) buildPipeline(store raft.SnapshotStore, pipeline string, sidecar snapshotSidecar) (raft.SnapshotStore, error) {
+
+	if pipeline == "" {
+		return store, nil
+	}
+
+	decorators := map[string]func(raft.SnapshotStore) (raft.SnapshotStore, error) {
+		"encrypt": t.encrypt,
+		"compress": t.compress,
+		"verify": func(store raft.SnapshotStore) (raft.SnapshotStore, error) {
+			return newVerifySnapshotStore(store, sidecar), nil
+		},
+	}
+	for _, d := range t.Decorators {
+		decorators[d.DecoratorName()] = d.Decorate
+	}
+
+	names := strings.Split(pipeline, ",")
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name != "" && seen[name] {
+			return nil, errors.Errorf("duplicate snapshot decorator '%s' in property 'raft-snapshot.pipeline'", name)
+		}
+		seen[name] = true
+	}
+
+	// the first decorator in the pipeline sees the raw stream, so it has to be the outermost
+	for i := len(names) - 1; i >= 0; i-- {
+		name := strings.TrimSpace(names[i])
+		if name == "" {
+			continue
+		}
+		decorate, ok := decorators[name]
+		if !ok {
+			return nil, errors.Errorf("unknown snapshot decorator '%s' in property 'raft-snapshot.pipeline'", name)
 		}
-		return NewEncryptedSnapshotStore(snapshots, encryptionToken)
+		var err error
+		store, err = decorate(store)
+		if err != nil {
+			return nil, errors.Errorf("snapshot decorator '%s', %v", name, err)
+		}
+	}
+
+	return store, nil
+}
+
+func (t *implRaftSnapshotFactory) encrypt(store raft.SnapshotStore) (raft.SnapshotStore, error) {
+	keys, err := t.Keys.ResolveKeyProvider()
+	if err != nil {
+		return nil, err
 	}
+	return NewKeyProviderSnapshotStore(store, keys, t.EncryptionMode)
+}
 
-	return snapshots, nil
+func (t *implRaftSnapshotFactory) compress(store raft.SnapshotStore) (raft.SnapshotStore, error) {
+	compressed, err := CompressedSnapshotStore(store, t.Compression, t.CompressionLevel)
+	if err != nil {
+		return nil, errors.Errorf("issue in property 'raft.snapshot-compression', %v", err)
+	}
+	return compressed, nil
 }
 
 func (t *implRaftSnapshotFactory) ObjectType() reflect.Type {
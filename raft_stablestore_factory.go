@@ -9,7 +9,6 @@ import (
 	"github.com/codeallergy/glue"
 	"github.com/sprintframework/raft-badger"
 	"github.com/keyvalstore/store"
-	"github.com/dgraph-io/badger/v3"
 	"github.com/hashicorp/raft"
 	"github.com/pkg/errors"
 	"reflect"
@@ -19,8 +18,20 @@ var StableStoreClass = reflect.TypeOf((*raft.StableStore)(nil)).Elem()
 
 type implRaftStableStoreFactory struct {
 
-	RaftStore     store.ManagedDataStore    `inject:"bean=raft-store"`
+	DataStores    []store.ManagedDataStore  `inject:"optional"`
+	RaftStoreBean string                    `value:"raft-storage.bean,default=raft-store"`
+	BadgerStore   RaftBadgerStore           `inject`
+	BoltStore     RaftBoltStore             `inject`
+	WALStore      RaftWALStore              `inject`
+	Backend       string `value:"raft-storage.backend,default=badger"`
 	RaftConfPrefix string `value:"raft-store.conf-prefix,default=conf"`
+
+	// encrypt values of Set with the same key provider as the log store
+	Encrypt       bool          `value:"raft-storage.encrypt,default=false"`
+	Keys          KeyResolver   `inject`
+
+	// entries of the write-through cache, zero disables it
+	CacheSize     int           `value:"raft-storage.stable-cache-size,default=64"`
 }
 
 func RaftStableStoreFactory() glue.FactoryBean {
@@ -31,15 +42,63 @@ func (t *implRaftStableStoreFactory) Object() (object interface{}, err error) {
 
 	defer panicToError(&err)
 
-	db, ok := t.RaftStore.Instance().(*badger.DB)
-	if !ok {
-		return nil, errors.Errorf("managed data delegate 'raft-store' must have badger backend")
+	if t.Backend, err = storageBackend(t.Backend); err != nil {
+		return nil, err
 	}
 
-	return raftbadger.NewStableStore(db, []byte(t.RaftConfPrefix)), nil
+	stableStore, err := t.newStableStore()
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Encrypt {
+		keys, err := t.Keys.ResolveKeyProvider()
+		if err != nil {
+			return nil, errors.Errorf("issue in property 'raft-storage.encrypt', %v", err)
+		}
+		stableStore, err = newEncryptedStableStore(stableStore, keys)
+		if err != nil {
+			return nil, errors.Errorf("issue in property 'raft-storage.encrypt', %v", err)
+		}
+	}
+
+	if t.CacheSize < 0 {
+		return nil, errors.Errorf("issue in property 'raft-storage.stable-cache-size', invalid value %d", t.CacheSize)
+	}
+	if t.CacheSize > 0 && t.Backend != RaftStoreInmem {
+		// plain values are cached, so reads skip the decryption as well
+		stableStore = newCachedStableStore(stableStore, t.CacheSize)
+	}
+	return stableStore, nil
 
 }
 
+func (t *implRaftStableStoreFactory) newStableStore() (raft.StableStore, error) {
+
+	switch t.Backend {
+	case "", RaftStoreBadger:
+	case RaftStoreBolt:
+		// the same file as the log store
+		return t.BoltStore.Store()
+	case RaftStoreWAL:
+		// the meta file of the log store
+		return t.WALStore.Store()
+	case RaftStoreInmem:
+		// the term and the vote are lost on restart, the node must not rejoin the cluster with the same id
+		return raft.NewInmemStore(), nil
+	default:
+		return nil, errors.Errorf("unknown backend '%s' in property 'raft-storage.backend', expected '%s', '%s', '%s' or '%s'", t.Backend, RaftStoreBadger, RaftStoreBolt, RaftStoreWAL, RaftStoreInmem)
+	}
+
+	// the log store checks that prefixes in the shared instance do not overlap
+	db, err := badgerDataStore(t.DataStores, t.RaftStoreBean, t.BadgerStore)
+	if err != nil {
+		return nil, err
+	}
+
+	return raftbadger.NewStableStore(db, []byte(t.RaftConfPrefix)), nil
+}
+
 func (t *implRaftStableStoreFactory) ObjectType() reflect.Type {
 	return StableStoreClass
 }
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/options"
+	"github.com/hashicorp/raft"
+	"github.com/sprintframework/raft-badger"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"os"
+	"testing"
+)
+
+func TestInmemStoreBackend(t *testing.T) {
+
+	object, err := (&implRaftLogStoreFactory{Backend: RaftStoreInmem}).Object()
+	require.NoError(t, err)
+	logStore := object.(raft.LogStore)
+	require.NoError(t, logStore.StoreLog(&raft.Log{Index: 1, Term: 1, Type: raft.LogCommand, Data: []byte("first")}))
+	last, err := logStore.LastIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), last)
+
+	object, err = (&implRaftStableStoreFactory{Backend: RaftStoreInmem}).Object()
+	require.NoError(t, err)
+	stableStore := object.(raft.StableStore)
+	require.NoError(t, stableStore.SetUint64([]byte("CurrentTerm"), 2))
+	term, err := stableStore.GetUint64([]byte("CurrentTerm"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), term)
+
+	_, err = (&implRaftLogStoreFactory{Backend: RaftStoreInmem, LogChecksum: true}).Object()
+	require.Error(t, err)
+
+	_, err = (&implRaftLogStoreFactory{Backend: "rocksdb"}).Object()
+	require.Error(t, err)
+	_, err = (&implRaftStableStoreFactory{Backend: "rocksdb"}).Object()
+	require.Error(t, err)
+
+	// the property selects the backend of both stores
+	for _, backend := range []string{" InMem ", "INMEM"} {
+		object, err = (&implRaftLogStoreFactory{Backend: backend}).Object()
+		require.NoError(t, err)
+		_, ok := object.(*raft.InmemStore)
+		require.True(t, ok)
+		object, err = (&implRaftStableStoreFactory{Backend: backend}).Object()
+		require.NoError(t, err)
+		_, ok = object.(*raft.InmemStore)
+		require.True(t, ok)
+	}
+}
+
+func TestLogCache(t *testing.T) {
+
+	cache, err := newLogCache(16, raft.NewInmemStore())
+	require.NoError(t, err)
+	_, ok := cache.(LogScrubber)
+	require.False(t, ok)
+
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	defer db.Close()
+
+	cache, err = newLogCache(16, NewChecksumLogStore(raftbadger.NewLogStore(db, []byte("log")), db, []byte("crc")))
+	require.NoError(t, err)
+	require.NoError(t, cache.StoreLog(&raft.Log{Index: 1, Term: 1, Type: raft.LogCommand, Data: []byte("first")}))
+
+	var log raft.Log
+	require.NoError(t, cache.GetLog(1, &log))
+	require.Equal(t, "first", string(log.Data))
+
+	scrubbed := 0
+	err = cache.(LogScrubber).ScrubLog(func(log *raft.Log, err error) bool {
+		require.NoError(t, err)
+		scrubbed++
+		return true
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, scrubbed)
+
+	_, err = newLogCache(0, raft.NewInmemStore())
+	require.Error(t, err)
+}
+
+func TestStorePrefixes(t *testing.T) {
+
+	require.NoError(t, checkStorePrefixes("log", "conf", true, "crc"))
+	require.NoError(t, checkStorePrefixes("log", "conf", false, "log"))
+
+	require.Error(t, checkStorePrefixes("log", "log", false, ""))
+	require.Error(t, checkStorePrefixes("log", "logconf", false, ""))
+	require.Error(t, checkStorePrefixes("log", "conf", true, "log-crc"))
+	require.Error(t, checkStorePrefixes("", "conf", false, ""))
+
+	_, err := badgerDataStore(nil, "raft-store", nil)
+	require.Error(t, err)
+}
+
+func TestRaftBadgerStore(t *testing.T) {
+
+	dir, err := os.MkdirTemp(os.TempDir(), "raftmodtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	holder := &implRaftBadgerStore{
+		Log:              zap.NewNop(),
+		Dir:              dir,
+		ValueLogFileSize: "64MB",
+		Compression:      "zstd",
+		NumMemtables:     2,
+		BlockCacheSize:   "16MB",
+		SyncWrites:       true,
+		PermMode:         PermModeAuto,
+		DataDirPerm:      0770,
+		PermUID:          -1,
+		PermGID:          -1,
+	}
+
+	opts, err := holder.options()
+	require.NoError(t, err)
+	require.Equal(t, int64(64 << 20), opts.ValueLogFileSize)
+	require.Equal(t, options.ZSTD, opts.Compression)
+	require.Equal(t, 2, opts.NumMemtables)
+
+	db, err := badgerDataStore(nil, "", holder)
+	require.NoError(t, err)
+	same, err := holder.Store()
+	require.NoError(t, err)
+	require.True(t, db == same)
+	require.NoError(t, holder.Destroy())
+
+	holder.BlockCacheSize = "0"
+	_, err = holder.options()
+	require.Error(t, err)
+
+	holder.Compression = "lz4"
+	_, err = holder.options()
+	require.Error(t, err)
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/raft-boltdb/v2"
+	"github.com/hashicorp/raft-wal"
+	"github.com/pkg/errors"
+	"github.com/sprintframework/raft-badger"
+	"go.etcd.io/bbolt"
+	"io"
+	"strings"
+	"time"
+)
+
+// entries copied by one StoreLogs call
+const migrateBatchSize = 1024
+
+var (
+	// uint64 keys of raft.Raft
+	raftStableUint64Keys = []string{"CurrentTerm", "LastVoteTerm"}
+	// byte keys of raft.Raft and data keys of the encryption
+	raftStableKeys = []string{"LastVoteCand", logRecordKeyName, stableRecordKeyName}
+	// namespaces of the metadata store used by the raft server, stores written before the registry have no other
+	raftMetadataNamespaces = []string{checkpointNamespace, snapshotQuarantineNamespace, replaceNamespace}
+)
+
+type MigrateResult struct {
+	Entries      uint64
+	FirstIndex   uint64
+	LastIndex    uint64
+	StableKeys   int
+	// namespaces with the encrypted index, the metadata store is not able to list their keys
+	SkippedNamespaces  []string
+}
+
+/**
+Copies all log entries, known stable keys and all registered metadata namespaces of the stopped node to the empty stores
+of the other backend and verifies the indexes and the last entry. Records of encrypted stores are copied as is with their data keys.
+ */
+func MigrateRaftStores(fromLog raft.LogStore, fromStable raft.StableStore, toLog raft.LogStore, toStable raft.StableStore) (*MigrateResult, error) {
+
+	if last, err := toLog.LastIndex(); err != nil || last != 0 {
+		return nil, errors.Errorf("target log store must be empty, last index %d, %v", last, err)
+	}
+
+	first, err := fromLog.FirstIndex()
+	if err != nil {
+		return nil, errors.Errorf("first index of source, %v", err)
+	}
+	last, err := fromLog.LastIndex()
+	if err != nil {
+		return nil, errors.Errorf("last index of source, %v", err)
+	}
+
+	result := &MigrateResult{FirstIndex: first, LastIndex: last}
+	if last > 0 {
+		batch := make([]*raft.Log, 0, migrateBatchSize)
+		for index := first; index <= last; index++ {
+			log := new(raft.Log)
+			if err := fromLog.GetLog(index, log); err != nil {
+				return nil, errors.Errorf("get log %d of source, %v", index, err)
+			}
+			batch = append(batch, log)
+			if len(batch) == migrateBatchSize || index == last {
+				if err := toLog.StoreLogs(batch); err != nil {
+					return nil, errors.Errorf("store logs %d-%d to target, %v", batch[0].Index, index, err)
+				}
+				result.Entries += uint64(len(batch))
+				batch = batch[:0]
+			}
+		}
+	}
+
+	if err := verifyMigratedLog(fromLog, toLog, result); err != nil {
+		return nil, err
+	}
+
+	for _, key := range raftStableUint64Keys {
+		value, err := fromStable.GetUint64([]byte(key))
+		if err != nil && err.Error() == "not found" {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Errorf("get stable key '%s' of source, %v", key, err)
+		}
+		if err := toStable.SetUint64([]byte(key), value); err != nil {
+			return nil, errors.Errorf("set stable key '%s' to target, %v", key, err)
+		}
+		result.StableKeys++
+	}
+	for _, key := range raftStableKeys {
+		if ok, err := copyStableKey(fromStable, toStable, key); err != nil {
+			return nil, err
+		} else if ok {
+			result.StableKeys++
+		}
+	}
+
+	namespaces, err := migrateNamespaces(fromStable)
+	if err != nil {
+		return nil, err
+	}
+	for _, namespace := range namespaces {
+		indexKey := metadataIndexPrefix + namespace
+		index, err := fromStable.Get([]byte(indexKey))
+		if err != nil && err.Error() != "not found" {
+			return nil, errors.Errorf("get stable key '%s' of source, %v", indexKey, err)
+		}
+		if len(index) == 0 {
+			continue
+		}
+		if bytes.HasPrefix(index, []byte(encryptedRecordMagic)) {
+			result.SkippedNamespaces = append(result.SkippedNamespaces, namespace)
+			continue
+		}
+		for _, key := range strings.Split(string(index), "\n") {
+			if key == "" {
+				continue
+			}
+			if ok, err := copyStableKey(fromStable, toStable, string(metadataKey(namespace, key))); err != nil {
+				return nil, err
+			} else if ok {
+				result.StableKeys++
+			}
+		}
+		if _, err := copyStableKey(fromStable, toStable, indexKey); err != nil {
+			return nil, err
+		}
+		result.StableKeys++
+	}
+	if ok, err := copyStableKey(fromStable, toStable, metadataNamespacesKey); err != nil {
+		return nil, err
+	} else if ok {
+		result.StableKeys++
+	}
+
+	return result, nil
+}
+
+/**
+Returns all namespaces of the metadata store registered in the source, the application ones included,
+fails when the registry is encrypted, because the namespaces could not be listed
+ */
+func migrateNamespaces(fromStable raft.StableStore) ([]string, error) {
+	value, err := fromStable.Get([]byte(metadataNamespacesKey))
+	if err == nil && bytes.HasPrefix(value, []byte(encryptedRecordMagic)) {
+		return nil, errors.Errorf("stable key '%s' of source is encrypted, metadata namespaces could not be listed", metadataNamespacesKey)
+	}
+	registered, err := metadataNamespaces(fromStable)
+	if err != nil {
+		return nil, errors.Errorf("source, %v", err)
+	}
+	namespaces := append([]string{}, raftMetadataNamespaces...)
+	for _, namespace := range registered {
+		known := false
+		for _, n := range raftMetadataNamespaces {
+			if n == namespace {
+				known = true
+				break
+			}
+		}
+		if !known {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces, nil
+}
+
+func verifyMigratedLog(fromLog, toLog raft.LogStore, result *MigrateResult) error {
+	first, err := toLog.FirstIndex()
+	if err != nil {
+		return errors.Errorf("first index of target, %v", err)
+	}
+	last, err := toLog.LastIndex()
+	if err != nil {
+		return errors.Errorf("last index of target, %v", err)
+	}
+	if last != result.LastIndex || (last > 0 && first != result.FirstIndex) {
+		return errors.Errorf("target has indexes %d-%d whereas source has %d-%d", first, last, result.FirstIndex, result.LastIndex)
+	}
+	if last == 0 {
+		return nil
+	}
+	if expected := last - result.FirstIndex + 1; result.Entries != expected {
+		return errors.Errorf("copied %d entries whereas source has %d", result.Entries, expected)
+	}
+	var source, target raft.Log
+	if err := fromLog.GetLog(last, &source); err != nil {
+		return errors.Errorf("get log %d of source, %v", last, err)
+	}
+	if err := toLog.GetLog(last, &target); err != nil {
+		return errors.Errorf("get log %d of target, %v", last, err)
+	}
+	if source.Term != target.Term || source.Type != target.Type || !bytes.Equal(source.Data, target.Data) || !bytes.Equal(source.Extensions, target.Extensions) {
+		return errors.Errorf("last entry %d of target differs from source", last)
+	}
+	return nil
+}
+
+func copyStableKey(from, to raft.StableStore, key string) (bool, error) {
+	value, err := from.Get([]byte(key))
+	if err != nil {
+		// the same check of the missing key as in raft.NewRaft
+		if err.Error() == "not found" {
+			return false, nil
+		}
+		return false, errors.Errorf("get stable key '%s' of source, %v", key, err)
+	}
+	if err := to.Set([]byte(key), value); err != nil {
+		return false, errors.Errorf("set stable key '%s' to target, %v", key, err)
+	}
+	return true, nil
+}
+
+/**
+Opens the stores of the stopped node by the spec '<backend>:<path>', where backend is 'badger', 'bolt' or 'wal',
+the badger backend keeps the log and stable store under the prefixes. The wal backend has no read-only mode.
+ */
+func OpenRaftStores(spec, logPrefix, confPrefix string, readOnly bool) (raft.LogStore, raft.StableStore, io.Closer, error) {
+
+	i := strings.IndexByte(spec, ':')
+	if i <= 0 || i == len(spec) - 1 {
+		return nil, nil, nil, errors.Errorf("invalid store '%s', expected '<backend>:<path>'", spec)
+	}
+	backend, path := spec[:i], spec[i+1:]
+
+	switch backend {
+	case RaftStoreBadger:
+		if err := checkStorePrefixes(logPrefix, confPrefix, false, ""); err != nil {
+			return nil, nil, nil, err
+		}
+		db, err := badger.Open(badger.DefaultOptions(path).WithSyncWrites(true).WithReadOnly(readOnly).WithLogger(nil))
+		if err != nil {
+			return nil, nil, nil, errors.Errorf("open badger '%s', %v", path, err)
+		}
+		logStore := newBatchedLogStore(raftbadger.NewLogStore(db, []byte(logPrefix)), db, []byte(logPrefix))
+		return logStore, raftbadger.NewStableStore(db, []byte(confPrefix)), db, nil
+
+	case RaftStoreBolt:
+		store, err := raftboltdb.New(raftboltdb.Options{
+			Path:        path,
+			// the running node keeps the file lock
+			BoltOptions: &bbolt.Options{ReadOnly: readOnly, Timeout: time.Second},
+		})
+		if err != nil {
+			return nil, nil, nil, errors.Errorf("open bolt file '%s', %v", path, err)
+		}
+		return store, store, store, nil
+
+	case RaftStoreWAL:
+		store, err := wal.Open(path)
+		if err != nil {
+			return nil, nil, nil, errors.Errorf("open wal '%s', %v", path, err)
+		}
+		return store, store, store, nil
+	}
+
+	return nil, nil, nil, errors.Errorf("unknown backend '%s' of store '%s', expected '%s', '%s' or '%s'", backend, spec, RaftStoreBadger, RaftStoreBolt, RaftStoreWAL)
+}
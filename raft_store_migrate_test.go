@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMigrateRaftStores(t *testing.T) {
+
+	from := raft.NewInmemStore()
+	for i := uint64(10); i <= 2500; i++ {
+		require.NoError(t, from.StoreLog(&raft.Log{Index: i, Term: i / 1000 + 1, Type: raft.LogCommand, Data: []byte{byte(i)}}))
+	}
+	require.NoError(t, from.SetUint64([]byte("CurrentTerm"), 3))
+	require.NoError(t, from.SetUint64([]byte("LastVoteTerm"), 3))
+	require.NoError(t, from.Set([]byte("LastVoteCand"), []byte("node-1")))
+	require.NoError(t, from.Set([]byte(metadataIndexPrefix + checkpointNamespace), []byte("100\n200")))
+	require.NoError(t, from.Set(metadataKey(checkpointNamespace, "100"), []byte("t1")))
+	require.NoError(t, from.Set(metadataKey(checkpointNamespace, "200"), []byte("t2")))
+	require.NoError(t, from.Set([]byte(metadataIndexPrefix + replaceNamespace), []byte(encryptedRecordMagic + "sealed")))
+	// namespace of the application
+	require.NoError(t, NewMetadataStore(from).Set("app", "key", []byte("value")))
+
+	to := raft.NewInmemStore()
+	result, err := MigrateRaftStores(from, from, to, to)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2491), result.Entries)
+	require.Equal(t, uint64(10), result.FirstIndex)
+	require.Equal(t, uint64(2500), result.LastIndex)
+	require.Equal(t, []string{replaceNamespace}, result.SkippedNamespaces)
+
+	var log raft.Log
+	require.NoError(t, to.GetLog(1234, &log))
+	require.Equal(t, uint64(2), log.Term)
+	require.Equal(t, []byte{byte(1234 & 0xff)}, log.Data)
+
+	term, err := to.GetUint64([]byte("CurrentTerm"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), term)
+	value, err := to.Get([]byte("LastVoteCand"))
+	require.NoError(t, err)
+	require.Equal(t, "node-1", string(value))
+	value, err = to.Get(metadataKey(checkpointNamespace, "200"))
+	require.NoError(t, err)
+	require.Equal(t, "t2", string(value))
+	value, ok, err := NewMetadataStore(to).Get("app", "key")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "value", string(value))
+
+	// the target must be empty
+	_, err = MigrateRaftStores(from, from, to, to)
+	require.Error(t, err)
+
+	// namespaces are not known
+	require.NoError(t, from.Set([]byte(metadataNamespacesKey), []byte(encryptedRecordMagic + "sealed")))
+	_, err = MigrateRaftStores(from, from, raft.NewInmemStore(), raft.NewInmemStore())
+	require.Error(t, err)
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"fmt"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// problems kept in the report, the rest are only counted
+const maxVerifyProblems = 100
+
+/**
+Result of the consistency check of the log and stable stores
+ */
+type StoreVerifyReport struct {
+	FirstIndex    uint64
+	LastIndex     uint64
+	LastTerm      uint64
+	Entries       uint64
+	CurrentTerm   uint64
+	LastVoteTerm  uint64
+	LastVoteCand  string
+	Problems      []string
+	// all problems including the ones above the limit of the list
+	ProblemCount  int
+}
+
+func (r *StoreVerifyReport) Consistent() bool {
+	return r.ProblemCount == 0
+}
+
+func (r *StoreVerifyReport) problem(format string, args ...interface{}) {
+	if len(r.Problems) < maxVerifyProblems {
+		r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+	}
+	r.ProblemCount++
+}
+
+func (r *StoreVerifyReport) String() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "log [%d-%d] entries %d last term %d, current term %d, last vote term %d candidate '%s'",
+		r.FirstIndex, r.LastIndex, r.Entries, r.LastTerm, r.CurrentTerm, r.LastVoteTerm, r.LastVoteCand)
+	for _, p := range r.Problems {
+		out.WriteString("\n  ")
+		out.WriteString(p)
+	}
+	if r.ProblemCount > len(r.Problems) {
+		fmt.Fprintf(&out, "\n  and %d more problems", r.ProblemCount - len(r.Problems))
+	}
+	return out.String()
+}
+
+/**
+Reads every entry of the log and checks the continuity of the indexes, gaps, entries stored under the other index,
+decreasing terms and the term and vote of the stable store against the log tail. Errors are returned only when
+the stores are not readable, the inconsistencies are the problems of the report.
+ */
+func VerifyRaftStores(logStore raft.LogStore, stableStore raft.StableStore) (*StoreVerifyReport, error) {
+
+	r := new(StoreVerifyReport)
+
+	var err error
+	if r.FirstIndex, err = logStore.FirstIndex(); err != nil {
+		return nil, errors.Errorf("first index, %v", err)
+	}
+	if r.LastIndex, err = logStore.LastIndex(); err != nil {
+		return nil, errors.Errorf("last index, %v", err)
+	}
+
+	switch {
+	case r.LastIndex == 0 && r.FirstIndex != 0:
+		r.problem("first index %d of the empty log", r.FirstIndex)
+	case r.LastIndex != 0 && r.FirstIndex == 0:
+		r.problem("first index is zero whereas last index is %d", r.LastIndex)
+	case r.FirstIndex > r.LastIndex:
+		r.problem("first index %d is greater than last index %d", r.FirstIndex, r.LastIndex)
+	case r.LastIndex != 0:
+		var gapStart uint64
+		var prevTerm uint64
+		for index := r.FirstIndex; index <= r.LastIndex; index++ {
+			var log raft.Log
+			err := logStore.GetLog(index, &log)
+			if err == raft.ErrLogNotFound {
+				if gapStart == 0 {
+					gapStart = index
+				}
+				continue
+			}
+			if err != nil {
+				return nil, errors.Errorf("get log %d, %v", index, err)
+			}
+			if gapStart != 0 {
+				r.problem("gap of missing entries %d-%d", gapStart, index - 1)
+				gapStart = 0
+			}
+			r.Entries++
+			if log.Index != index {
+				r.problem("entry of index %d is stored under index %d", log.Index, index)
+			}
+			if log.Term < prevTerm {
+				r.problem("term %d of entry %d is less than term %d of the previous entry", log.Term, index, prevTerm)
+			}
+			prevTerm = log.Term
+			r.LastTerm = log.Term
+		}
+		if gapStart != 0 {
+			r.problem("gap of missing entries %d-%d", gapStart, r.LastIndex)
+		}
+	}
+
+	if r.CurrentTerm, err = getStableUint64(stableStore, "CurrentTerm"); err != nil {
+		return nil, err
+	}
+	if r.LastVoteTerm, err = getStableUint64(stableStore, "LastVoteTerm"); err != nil {
+		return nil, err
+	}
+	cand, err := stableStore.Get([]byte("LastVoteCand"))
+	if err != nil && err.Error() != "not found" {
+		return nil, errors.Errorf("get stable key 'LastVoteCand', %v", err)
+	}
+	r.LastVoteCand = string(cand)
+
+	if r.LastTerm > r.CurrentTerm {
+		r.problem("term %d of the last entry is greater than current term %d", r.LastTerm, r.CurrentTerm)
+	}
+	if r.LastVoteTerm > r.CurrentTerm {
+		r.problem("last vote term %d is greater than current term %d", r.LastVoteTerm, r.CurrentTerm)
+	}
+	if r.LastVoteTerm != 0 && r.LastVoteCand == "" {
+		r.problem("last vote term %d has no candidate", r.LastVoteTerm)
+	}
+
+	return r, nil
+}
+
+func getStableUint64(stableStore raft.StableStore, key string) (uint64, error) {
+	value, err := stableStore.GetUint64([]byte(key))
+	// the same check of the missing key as in raft.NewRaft
+	if err != nil && err.Error() != "not found" {
+		return 0, errors.Errorf("get stable key '%s', %v", key, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestVerifyRaftStores(t *testing.T) {
+
+	store := raft.NewInmemStore()
+	for i := uint64(5); i <= 20; i++ {
+		require.NoError(t, store.StoreLog(&raft.Log{Index: i, Term: 1 + i / 10, Type: raft.LogCommand}))
+	}
+	require.NoError(t, store.SetUint64([]byte("CurrentTerm"), 3))
+	require.NoError(t, store.SetUint64([]byte("LastVoteTerm"), 3))
+	require.NoError(t, store.Set([]byte("LastVoteCand"), []byte("node-1")))
+
+	report, err := VerifyRaftStores(store, store)
+	require.NoError(t, err)
+	require.True(t, report.Consistent(), report.String())
+	require.Equal(t, uint64(16), report.Entries)
+	require.Equal(t, uint64(3), report.LastTerm)
+
+	// gap, misplaced entry and decreasing term
+	require.NoError(t, store.DeleteRange(8, 9))
+	require.NoError(t, store.StoreLog(&raft.Log{Index: 12, Term: 1, Type: raft.LogCommand}))
+	require.NoError(t, store.SetUint64([]byte("CurrentTerm"), 2))
+
+	report, err = VerifyRaftStores(store, store)
+	require.NoError(t, err)
+	require.False(t, report.Consistent())
+	require.Equal(t, []string{
+		"gap of missing entries 8-9",
+		"term 1 of entry 12 is less than term 2 of the previous entry",
+		"term 3 of the last entry is greater than current term 2",
+		"last vote term 3 is greater than current term 2",
+	}, report.Problems)
+
+	empty := raft.NewInmemStore()
+	report, err = VerifyRaftStores(empty, empty)
+	require.NoError(t, err)
+	require.True(t, report.Consistent())
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft-wal"
+	"github.com/pkg/errors"
+	"github.com/sprintframework/sprint"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+const RaftStoreWAL = "wal"
+
+/**
+Segmented write-ahead log keeping the raft log in append-only files and the stable store in its meta file,
+opened by the first of the factories when 'raft-storage.backend' is 'wal' and closed with the context.
+The log is monotonic, raft removes all entries after the restore of the user snapshot instead of leaving the gap.
+ */
+type RaftWALStore interface {
+
+	Store() (*wal.WAL, error)
+
+}
+
+var RaftWALStoreClass = reflect.TypeOf((*RaftWALStore)(nil)).Elem()
+
+type implRaftWALStore struct {
+
+	Application sprint.Application   `inject`
+	HCLog       hclog.Logger         `inject`
+
+	/**
+	Directory of segments, empty is 'raft-wal' in the data dir
+	 */
+	Dir          string  `value:"raft-storage.wal-dir,default="`
+	SegmentSize  string  `value:"raft-storage.wal-segment-size,default=64MB"`
+
+	DataDir           string       `value:"application.data.dir,default="`
+	DataDirPerm       os.FileMode  `value:"application.perm.data.dir,default=-rwxrwx---"`
+	PermMode          string       `value:"application.perm.mode,default=auto"`
+	PermUID           int          `value:"application.perm.uid,default=-1"`
+	PermGID           int          `value:"application.perm.gid,default=-1"`
+
+	mutex  sync.Mutex
+	store  *wal.WAL
+}
+
+func RaftWALStoreHolder() RaftWALStore {
+	return &implRaftWALStore{}
+}
+
+func (t *implRaftWALStore) Store() (*wal.WAL, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.store != nil {
+		return t.store, nil
+	}
+
+	segmentSize, err := ParseByteSize(t.SegmentSize)
+	if err != nil {
+		return nil, errors.Errorf("issue in property 'raft-storage.wal-segment-size', %v", err)
+	}
+	if segmentSize <= 0 || segmentSize > 1 << 30 {
+		return nil, errors.Errorf("issue in property 'raft-storage.wal-segment-size', expected size up to 1GB instead of '%s'", t.SegmentSize)
+	}
+
+	perm, err := newDataDirPerm(t.DataDirPerm, t.PermMode, t.PermUID, t.PermGID)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := t.Dir
+	if dir == "" {
+		dataDir := t.DataDir
+		if dataDir == "" {
+			dataDir = filepath.Join(t.Application.ApplicationDir(), "db", t.Application.Name())
+		}
+		dir = filepath.Join(dataDir, "raft-wal")
+	}
+	if err := createDirsIfNeeded(dir, perm); err != nil {
+		return nil, errors.Errorf("issue in property 'raft-storage.wal-dir', %v", err)
+	}
+
+	t.store, err = wal.Open(dir, wal.WithSegmentSize(int(segmentSize)), wal.WithLogger(t.HCLog.Named("raft-wal")))
+	if err != nil {
+		return nil, errors.Errorf("open wal '%s', %v", dir, err)
+	}
+	return t.store, nil
+}
+
+func (t *implRaftWALStore) Destroy() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.store == nil {
+		return nil
+	}
+	err := t.store.Close()
+	t.store = nil
+	return err
+}
@@ -0,0 +1,341 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftclient
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/pkg/errors"
+	"github.com/sprintframework/raftmod"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"sync"
+	"time"
+)
+
+/**
+Configuration of the management API client
+ */
+type Config struct {
+
+	/**
+	API endpoints of the raft nodes, tried in order
+	 */
+	Endpoints     []string
+
+	/**
+	Management token, see 'raft.management.token'
+	 */
+	Token         string
+
+	/**
+	TLS of the API endpoints, nil means plaintext
+	 */
+	TLS           *tls.Config
+
+	/**
+	Timeout of the single call, default 10s
+	 */
+	Timeout       time.Duration
+
+	/**
+	Number of attempts on unavailable endpoints, default is the number of endpoints
+	 */
+	Retries       int
+
+	/**
+	Pause between attempts, default 200ms
+	 */
+	RetryBackoff  time.Duration
+}
+
+/**
+Client of the raftmod management gRPC service with retries across endpoints,
+redirection of the leader-only calls and token authentication
+ */
+type Client struct {
+	config   Config
+	mutex    sync.Mutex
+	conns    map[string]*grpc.ClientConn
+	next     int
+}
+
+func New(config Config) (*Client, error) {
+	if len(config.Endpoints) == 0 {
+		return nil, errors.New("at least one endpoint is required")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.Retries <= 0 {
+		config.Retries = len(config.Endpoints)
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = 200 * time.Millisecond
+	}
+	return &Client{
+		config: config,
+		conns:  make(map[string]*grpc.ClientConn),
+	}, nil
+}
+
+func (t *Client) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var lastErr error
+	for endpoint, conn := range t.conns {
+		if err := conn.Close(); err != nil {
+			lastErr = err
+		}
+		delete(t.conns, endpoint)
+	}
+	return lastErr
+}
+
+func (t *Client) conn(endpoint string) (*grpc.ClientConn, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if conn, ok := t.conns[endpoint]; ok {
+		return conn, nil
+	}
+
+	creds := insecure.NewCredentials()
+	if t.config.TLS != nil {
+		creds = credentials.NewTLS(t.config.TLS)
+	}
+
+	conn, err := grpc.Dial(endpoint,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(raftmod.ManagementCodec)))
+	if err != nil {
+		return nil, errors.Errorf("dial '%s', %v", endpoint, err)
+	}
+	t.conns[endpoint] = conn
+	return conn, nil
+}
+
+// round robin starting from the last successful endpoint
+func (t *Client) endpoint(attempt int) string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.config.Endpoints[(t.next + attempt) % len(t.config.Endpoints)]
+}
+
+func (t *Client) succeeded(endpoint string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for i, e := range t.config.Endpoints {
+		if e == endpoint {
+			t.next = i
+			return
+		}
+	}
+}
+
+func (t *Client) outgoing(ctx context.Context) context.Context {
+	if t.config.Token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer " + t.config.Token)
+	}
+	return ctx
+}
+
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+func (t *Client) invoke(ctx context.Context, method string, req, resp interface{}) error {
+
+	var lastErr error
+	for attempt := 0; attempt < t.config.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(t.config.RetryBackoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		endpoint := t.endpoint(attempt)
+		err := t.invokeOn(ctx, endpoint, method, req, resp, true)
+		if err == nil {
+			t.succeeded(endpoint)
+			return nil
+		}
+		if !retryable(err) {
+			return err
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+func (t *Client) invokeOn(ctx context.Context, endpoint, method string, req, resp interface{}, redirect bool) error {
+
+	conn, err := t.conn(endpoint)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	callCtx, cancel := context.WithTimeout(t.outgoing(ctx), t.config.Timeout)
+	defer cancel()
+
+	var trailer metadata.MD
+	err = conn.Invoke(callCtx, "/" + raftmod.ManagementServiceName + "/" + method, req, resp, grpc.Trailer(&trailer))
+	if err == nil {
+		return nil
+	}
+
+	if redirect && status.Code(err) == codes.FailedPrecondition {
+		if leader := trailer.Get(raftmod.LeaderEndpointTrailer); len(leader) > 0 && leader[0] != endpoint {
+			return t.invokeOn(ctx, leader[0], method, req, resp, false)
+		}
+	}
+	return err
+}
+
+/**
+Current leader as seen by the node
+ */
+func (t *Client) Leader(ctx context.Context) (*raftmod.LeaderInfo, error) {
+	resp := new(raftmod.LeaderInfo)
+	return resp, t.invoke(ctx, "Leader", &raftmod.LeaderRequest{}, resp)
+}
+
+func (t *Client) Stats(ctx context.Context) (map[string]string, error) {
+	resp := new(raftmod.StatsResponse)
+	if err := t.invoke(ctx, "Stats", &raftmod.StatsRequest{}, resp); err != nil {
+		return nil, err
+	}
+	return resp.Stats, nil
+}
+
+func (t *Client) Health(ctx context.Context, id string) (*raftmod.NodeHealth, error) {
+	resp := new(raftmod.NodeHealth)
+	return resp, t.invoke(ctx, "Health", &raftmod.HealthRequest{ID: id}, resp)
+}
+
+func (t *Client) Snapshot(ctx context.Context) (*raftmod.SnapshotInfo, error) {
+	resp := new(raftmod.SnapshotInfo)
+	return resp, t.invoke(ctx, "Snapshot", &raftmod.SnapshotRequest{}, resp)
+}
+
+/**
+Removes the server from the raft configuration, the call is redirected to the leader
+ */
+func (t *Client) RemoveServer(ctx context.Context, id string) (uint64, error) {
+	resp := new(raftmod.RemoveServerResponse)
+	if err := t.invoke(ctx, "RemoveServer", &raftmod.RemoveServerRequest{ID: id}, resp); err != nil {
+		return 0, err
+	}
+	return resp.Index, nil
+}
+
+/**
+Starts the log scrub on the node in the background
+ */
+func (t *Client) Scrub(ctx context.Context) error {
+	return t.invoke(ctx, "Scrub", &raftmod.ScrubRequest{}, new(raftmod.ScrubResponse))
+}
+
+/**
+Removes the server from the quarantine of the node, empty id clears all, returns number of removed entries
+ */
+func (t *Client) ClearQuarantine(ctx context.Context, id string) (int, error) {
+	resp := new(raftmod.ClearQuarantineResponse)
+	if err := t.invoke(ctx, "ClearQuarantine", &raftmod.ClearQuarantineRequest{ID: id}, resp); err != nil {
+		return 0, err
+	}
+	return resp.Removed, nil
+}
+
+/**
+Starts or resumes the replacement of the old server by the new one, the call is redirected to the leader
+ */
+func (t *Client) ReplaceServer(ctx context.Context, oldID, newID string) (*raftmod.ReplaceOperation, error) {
+	resp := new(raftmod.ReplaceOperation)
+	return resp, t.invoke(ctx, "ReplaceServer", &raftmod.ReplaceRequest{Old: oldID, New: newID}, resp)
+}
+
+var subscribeStreamDesc = &grpc.StreamDesc{
+	StreamName:    "Subscribe",
+	ServerStreams: true,
+}
+
+/**
+Streams cluster events to the callback until context is done or callback returns error,
+reconnects with the resume token of the last received event, the token is dropped on switch to another endpoint
+ */
+func (t *Client) Subscribe(ctx context.Context, types []raftmod.ClusterEventType, cb func(event *raftmod.SubscribeEvent) error) error {
+
+	req := &raftmod.SubscribeRequest{Types: types}
+	var tokenEndpoint string
+
+	for attempt := 0; ; {
+
+		endpoint := t.endpoint(attempt)
+		// resume tokens are sequence numbers of the node event bus
+		if endpoint != tokenEndpoint {
+			req.ResumeToken = ""
+		}
+		tokenEndpoint = endpoint
+		err := t.subscribeOn(ctx, endpoint, req, cb)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && err != io.EOF && !retryable(err) {
+			return err
+		}
+		if err != io.EOF {
+			attempt++
+		}
+
+		select {
+		case <-time.After(t.config.RetryBackoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (t *Client) subscribeOn(ctx context.Context, endpoint string, req *raftmod.SubscribeRequest, cb func(event *raftmod.SubscribeEvent) error) error {
+
+	conn, err := t.conn(endpoint)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	stream, err := conn.NewStream(t.outgoing(ctx), subscribeStreamDesc, "/" + raftmod.ManagementServiceName + "/Subscribe")
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		event := new(raftmod.SubscribeEvent)
+		if err := stream.RecvMsg(event); err != nil {
+			return err
+		}
+		req.ResumeToken = event.Token
+		if err := cb(event); err != nil {
+			return err
+		}
+	}
+}
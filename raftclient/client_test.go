@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftclient
+
+import (
+	"context"
+	"github.com/sprintframework/raftmod"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net"
+	"testing"
+)
+
+type testManagementServer struct {
+	token   string
+	leader  string
+	index   uint64
+}
+
+func (t *testManagementServer) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if value == "Bearer " + t.token {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid or missing management token")
+}
+
+func (t *testManagementServer) Leader(ctx context.Context, req *raftmod.LeaderRequest) (*raftmod.LeaderInfo, error) {
+	if err := t.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return &raftmod.LeaderInfo{Endpoint: t.leader, Local: t.leader == ""}, nil
+}
+
+func (t *testManagementServer) Stats(ctx context.Context, req *raftmod.StatsRequest) (*raftmod.StatsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "stats")
+}
+
+func (t *testManagementServer) Health(ctx context.Context, req *raftmod.HealthRequest) (*raftmod.NodeHealth, error) {
+	return nil, status.Error(codes.Unimplemented, "health")
+}
+
+func (t *testManagementServer) Snapshot(ctx context.Context, req *raftmod.SnapshotRequest) (*raftmod.SnapshotInfo, error) {
+	return nil, status.Error(codes.Unimplemented, "snapshot")
+}
+
+func (t *testManagementServer) RemoveServer(ctx context.Context, req *raftmod.RemoveServerRequest) (*raftmod.RemoveServerResponse, error) {
+	if err := t.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if t.leader != "" {
+		grpc.SetTrailer(ctx, metadata.Pairs(raftmod.LeaderEndpointTrailer, t.leader))
+		return nil, status.Error(codes.FailedPrecondition, "not leader")
+	}
+	t.index++
+	return &raftmod.RemoveServerResponse{Index: t.index}, nil
+}
+
+func (t *testManagementServer) Scrub(ctx context.Context, req *raftmod.ScrubRequest) (*raftmod.ScrubResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "scrub")
+}
+
+func (t *testManagementServer) ClearQuarantine(ctx context.Context, req *raftmod.ClearQuarantineRequest) (*raftmod.ClearQuarantineResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "clear quarantine")
+}
+
+func (t *testManagementServer) ReplaceServer(ctx context.Context, req *raftmod.ReplaceRequest) (*raftmod.ReplaceOperation, error) {
+	return nil, status.Error(codes.Unimplemented, "replace server")
+}
+
+func (t *testManagementServer) Subscribe(req *raftmod.SubscribeRequest, stream grpc.ServerStream) error {
+	return status.Error(codes.Unimplemented, "subscribe")
+}
+
+func startManagementServer(t *testing.T, svc *testManagementServer) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	raftmod.RegisterManagementService(server, svc)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+func TestClientLeaderRedirect(t *testing.T) {
+
+	leader := &testManagementServer{token: "secret", index: 41}
+	leaderEndpoint := startManagementServer(t, leader)
+	followerEndpoint := startManagementServer(t, &testManagementServer{token: "secret", leader: leaderEndpoint})
+
+	cli, err := New(Config{Endpoints: []string{followerEndpoint}, Token: "secret"})
+	require.NoError(t, err)
+	defer cli.Close()
+
+	index, err := cli.RemoveServer(context.Background(), "node-3")
+	require.NoError(t, err)
+	require.Equal(t, uint64(42), index)
+
+	info, err := cli.Leader(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, leaderEndpoint, info.Endpoint)
+	require.False(t, info.Local)
+}
+
+func TestClientToken(t *testing.T) {
+
+	endpoint := startManagementServer(t, &testManagementServer{token: "secret"})
+
+	cli, err := New(Config{Endpoints: []string{endpoint}, Token: "secret"})
+	require.NoError(t, err)
+	defer cli.Close()
+
+	info, err := cli.Leader(context.Background())
+	require.NoError(t, err)
+	require.True(t, info.Local)
+
+	for _, token := range []string{"", "wrong"} {
+		cli, err := New(Config{Endpoints: []string{endpoint}, Token: token})
+		require.NoError(t, err)
+		_, err = cli.Leader(context.Background())
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+		cli.Close()
+	}
+}
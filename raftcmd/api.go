@@ -5,7 +5,11 @@
 
 package raftcmd
 
-import "github.com/hashicorp/serf/client"
+import (
+	"github.com/hashicorp/serf/client"
+	"github.com/sprintframework/raftmod/raftclient"
+	"time"
+)
 
 type SerfCommand interface {
 
@@ -37,4 +41,9 @@ type ClientProvider interface {
 
 	DoWithClient(func(cli *client.RPCClient) error) error
 
+	/**
+	Management API client of the node, empty node name means the node of the connected agent
+	*/
+	DoWithManagement(node string, timeout time.Duration, cb func(cli *raftclient.Client) error) error
+
 }
\ No newline at end of file
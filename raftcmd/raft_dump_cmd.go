@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftcmd
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sprintframework/raftmod"
+	"github.com/sprintframework/sprint"
+	"io"
+	"os"
+	"strings"
+)
+
+type raftDumpCommand struct {
+	Application  sprint.Application         `inject`
+	Decoder      raftmod.LogEntryDecoder    `inject:"optional"`
+
+	RaftLogPrefix   string  `value:"raft-store.log-prefix,default=log"`
+	RaftConfPrefix  string  `value:"raft-store.conf-prefix,default=conf"`
+}
+
+func RaftDumpCommand() sprint.Command {
+	return &raftDumpCommand{}
+}
+
+func (t *raftDumpCommand) BeanName() string {
+	return "raft-dump"
+}
+
+func (t *raftDumpCommand) Help() string {
+	helpText := `
+Usage: ./%s raft-dump -store <backend>:<path> [options]
+
+  Exports the raft log entries of the stopped node opened read-only, for the post-mortem
+  debugging of the state machine divergence. Backend is 'badger', 'bolt' or 'wal'.
+  Commands are decoded by the FSM implementing LogEntryDecoder, configurations by raft.
+
+Options:
+
+  -store=<backend>:<path>  Log store.
+  -from=0                  First exported index, zero is the first index of the store.
+  -to=0                    Last exported index, zero is the last index of the store.
+  -format=json             Output format 'json' (one entry per line) or 'msgpack'.
+  -out=<file>              Output file, the standard output by default.
+  -log-prefix=log          Prefix of the log entries in badger.
+  -conf-prefix=conf        Prefix of the stable keys in badger.
+`
+	return strings.TrimSpace(fmt.Sprintf(helpText, t.Application.Executable()))
+}
+
+func (t *raftDumpCommand) Synopsis() string {
+	return "Exports the raft log of the stopped node"
+}
+
+func (t *raftDumpCommand) Run(args []string) error {
+
+	var spec, format, out, logPrefix, confPrefix string
+	var from, to uint64
+	cmdFlags := flag.NewFlagSet("raft-dump", flag.ContinueOnError)
+	cmdFlags.Usage = func() { println(t.Help()) }
+	cmdFlags.StringVar(&spec, "store", "", "log store")
+	cmdFlags.Uint64Var(&from, "from", 0, "first index")
+	cmdFlags.Uint64Var(&to, "to", 0, "last index")
+	cmdFlags.StringVar(&format, "format", raftmod.LogDumpJSON, "output format")
+	cmdFlags.StringVar(&out, "out", "", "output file")
+	cmdFlags.StringVar(&logPrefix, "log-prefix", t.RaftLogPrefix, "log prefix in badger")
+	cmdFlags.StringVar(&confPrefix, "conf-prefix", t.RaftConfPrefix, "conf prefix in badger")
+	if err := cmdFlags.Parse(args); err != nil {
+		return err
+	}
+
+	if spec == "" {
+		return errors.Errorf("-store is required, Usage: ./%s raft-dump -store <backend>:<path>", t.Application.Executable())
+	}
+	if to != 0 && from > to {
+		return errors.Errorf("-from %d is greater than -to %d", from, to)
+	}
+
+	logStore, _, closer, err := raftmod.OpenRaftStores(spec, logPrefix, confPrefix, true)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	var w io.Writer = os.Stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return errors.Errorf("create output file '%s', %v", out, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	bw := bufio.NewWriter(w)
+	n, err := raftmod.DumpLog(logStore, from, to, format, t.Decoder, bw)
+	if flushErr := bw.Flush(); err == nil && flushErr != nil {
+		err = flushErr
+	}
+	if err != nil {
+		return err
+	}
+	if out != "" {
+		fmt.Printf("Exported %d entries to '%s'\n", n, out)
+	}
+	return nil
+}
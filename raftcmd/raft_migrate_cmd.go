@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftcmd
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sprintframework/raftmod"
+	"github.com/sprintframework/sprint"
+	"strings"
+)
+
+type raftMigrateCommand struct {
+	Application  sprint.Application  `inject`
+
+	RaftLogPrefix   string  `value:"raft-store.log-prefix,default=log"`
+	RaftConfPrefix  string  `value:"raft-store.conf-prefix,default=conf"`
+}
+
+func RaftMigrateCommand() sprint.Command {
+	return &raftMigrateCommand{}
+}
+
+func (t *raftMigrateCommand) BeanName() string {
+	return "raft-migrate"
+}
+
+func (t *raftMigrateCommand) Help() string {
+	helpText := `
+Usage: ./%s raft-migrate -from <backend>:<path> -to <backend>:<path> [options]
+
+  Copies the raft log entries and the stable keys of the stopped node to the empty
+  store of the other backend, to switch 'raft-storage.backend' without resynchronizing
+  from the peers. Backend is 'badger', 'bolt' or 'wal', for example:
+
+    ./%s raft-migrate -from badger:/data/db/app -to wal:/data/db/app/raft-wal
+
+  The copy is verified by the number of entries, the first and last index and the
+  last entry. Records of encrypted stores are copied as is with their data keys.
+
+Options:
+
+  -from=<backend>:<path>  Source store.
+  -to=<backend>:<path>    Target store, the log must be empty.
+  -log-prefix=log         Prefix of the log entries in badger.
+  -conf-prefix=conf       Prefix of the stable keys in badger.
+`
+	return strings.TrimSpace(fmt.Sprintf(helpText, t.Application.Executable(), t.Application.Executable()))
+}
+
+func (t *raftMigrateCommand) Synopsis() string {
+	return "Copies the raft stores of the stopped node to the other backend"
+}
+
+func (t *raftMigrateCommand) Run(args []string) error {
+
+	var from, to, logPrefix, confPrefix string
+	cmdFlags := flag.NewFlagSet("raft-migrate", flag.ContinueOnError)
+	cmdFlags.Usage = func() { println(t.Help()) }
+	cmdFlags.StringVar(&from, "from", "", "source store")
+	cmdFlags.StringVar(&to, "to", "", "target store")
+	cmdFlags.StringVar(&logPrefix, "log-prefix", t.RaftLogPrefix, "log prefix in badger")
+	cmdFlags.StringVar(&confPrefix, "conf-prefix", t.RaftConfPrefix, "conf prefix in badger")
+	if err := cmdFlags.Parse(args); err != nil {
+		return err
+	}
+
+	if from == "" || to == "" {
+		return errors.Errorf("-from and -to are required, Usage: ./%s raft-migrate -from <backend>:<path> -to <backend>:<path>", t.Application.Executable())
+	}
+	if from == to {
+		return errors.Errorf("source and target are the same store '%s'", from)
+	}
+
+	fromLog, fromStable, fromCloser, err := raftmod.OpenRaftStores(from, logPrefix, confPrefix, true)
+	if err != nil {
+		return errors.Errorf("open source, %v", err)
+	}
+	defer fromCloser.Close()
+
+	toLog, toStable, toCloser, err := raftmod.OpenRaftStores(to, logPrefix, confPrefix, false)
+	if err != nil {
+		return errors.Errorf("open target, %v", err)
+	}
+
+	result, err := raftmod.MigrateRaftStores(fromLog, fromStable, toLog, toStable)
+	if closeErr := toCloser.Close(); err == nil && closeErr != nil {
+		err = errors.Errorf("close target, %v", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Migrated %d entries [%d-%d] and %d stable keys from '%s' to '%s'\n", result.Entries, result.FirstIndex, result.LastIndex, result.StableKeys, from, to)
+	for _, namespace := range result.SkippedNamespaces {
+		fmt.Printf("Skipped encrypted metadata namespace '%s'\n", namespace)
+	}
+	return nil
+}
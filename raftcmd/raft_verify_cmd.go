@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftcmd
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sprintframework/raftmod"
+	"github.com/sprintframework/sprint"
+	"strings"
+)
+
+type raftVerifyCommand struct {
+	Application  sprint.Application  `inject`
+
+	RaftLogPrefix   string  `value:"raft-store.log-prefix,default=log"`
+	RaftConfPrefix  string  `value:"raft-store.conf-prefix,default=conf"`
+}
+
+func RaftVerifyCommand() sprint.Command {
+	return &raftVerifyCommand{}
+}
+
+func (t *raftVerifyCommand) BeanName() string {
+	return "raft-verify"
+}
+
+func (t *raftVerifyCommand) Help() string {
+	helpText := `
+Usage: ./%s raft-verify -store <backend>:<path> [options]
+
+  Checks the raft stores of the stopped node opened read-only: continuity of the log
+  indexes, gaps, entries stored under the other index, decreasing terms and the term
+  and vote of the stable store against the log tail. Backend is 'badger', 'bolt' or 'wal'.
+  The same check runs before the start with 'raft.verify-stores' enabled.
+
+Options:
+
+  -store=<backend>:<path>  Raft stores.
+  -log-prefix=log          Prefix of the log entries in badger.
+  -conf-prefix=conf        Prefix of the stable keys in badger.
+`
+	return strings.TrimSpace(fmt.Sprintf(helpText, t.Application.Executable()))
+}
+
+func (t *raftVerifyCommand) Synopsis() string {
+	return "Checks consistency of the raft stores of the stopped node"
+}
+
+func (t *raftVerifyCommand) Run(args []string) error {
+
+	var spec, logPrefix, confPrefix string
+	cmdFlags := flag.NewFlagSet("raft-verify", flag.ContinueOnError)
+	cmdFlags.Usage = func() { println(t.Help()) }
+	cmdFlags.StringVar(&spec, "store", "", "raft stores")
+	cmdFlags.StringVar(&logPrefix, "log-prefix", t.RaftLogPrefix, "log prefix in badger")
+	cmdFlags.StringVar(&confPrefix, "conf-prefix", t.RaftConfPrefix, "conf prefix in badger")
+	if err := cmdFlags.Parse(args); err != nil {
+		return err
+	}
+
+	if spec == "" {
+		return errors.Errorf("-store is required, Usage: ./%s raft-verify -store <backend>:<path>", t.Application.Executable())
+	}
+
+	logStore, stableStore, closer, err := raftmod.OpenRaftStores(spec, logPrefix, confPrefix, true)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	report, err := raftmod.VerifyRaftStores(logStore, stableStore)
+	if err != nil {
+		return err
+	}
+	fmt.Println(report.String())
+	if !report.Consistent() {
+		return errors.Errorf("found %d problems in '%s'", report.ProblemCount, spec)
+	}
+	return nil
+}
@@ -16,5 +16,16 @@ var RaftCommands = []interface{}{
 	SerfReachabilityCommand(),
 	SerfRttCommand(),
 	SerfTagsCommand(),
+	SerfSnapshotCommand(),
+	SerfScrubCommand(),
+	SerfHealthCommand(),
+	SerfTopologyCommand(),
+	SerfQuarantineCommand(),
+	SerfIndexTimeCommand(),
+	SerfFsckCommand(),
+	SerfReplaceCommand(),
 	SerfCommands(),
+	RaftMigrateCommand(),
+	RaftDumpCommand(),
+	RaftVerifyCommand(),
 }
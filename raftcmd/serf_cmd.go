@@ -6,15 +6,19 @@
 package raftcmd
 
 import (
+	"crypto/tls"
 	"fmt"
 	"github.com/codeallergy/glue"
 	"github.com/hashicorp/serf/client"
 	"github.com/sprintframework/raftmod"
+	"github.com/sprintframework/raftmod/raftclient"
 	"github.com/pkg/errors"
 	"github.com/ryanuber/columnize"
 	"github.com/sprintframework/sprint"
+	"net"
 	"sort"
 	"strings"
+	"time"
 )
 
 type serfCommand struct {
@@ -28,6 +32,14 @@ type serfCommand struct {
 	SerfAddress   string    `value:"serf-server.rpc-address,default=127.0.0.1:8700"`
 	SerfToken     string    `value:"serf-server.rpc-auth,default="`
 
+	/**
+	Management API of the raft servers with raftmod.ManagementService() in beans, see 'raft.management.token'
+	 */
+	ManagementToken      string  `value:"raft.management.token,default="`
+	// used when the management token is not set, allows the read-only commands only
+	ManagementReadToken  string  `value:"raft.management.read-token,default="`
+	ManagementTLS        bool    `value:"raft.management.tls,default=true"`
+
 }
 
 func SerfCommands() sprint.Command {
@@ -109,9 +121,16 @@ func (t *serfCommand) doRun(handler SerfCommand, args []string) (err error) {
 	if err != nil {
 		return err
 	}
-	addr = fmt.Sprintf("%s:%d", tcpAddr.IP.String(), tcpAddr.Port)
-
-	prov := clientProviderImpl{Addr: addr, AuthKey: t.SerfToken}
+	addr = tcpAddr.String()
+
+	prov := clientProviderImpl{
+		Addr:                addr,
+		AuthKey:             t.SerfToken,
+		AppName:             t.Application.Name(),
+		ManagementToken:     t.ManagementToken,
+		ManagementReadToken: t.ManagementReadToken,
+		ManagementTLS:       t.ManagementTLS,
+	}
 	err = handler.Run(prov, args)
 	if err != nil {
 		return errors.Errorf("connect self client '%s', %v", addr, err)
@@ -122,6 +141,10 @@ func (t *serfCommand) doRun(handler SerfCommand, args []string) (err error) {
 type clientProviderImpl struct {
 	Addr string
 	AuthKey string
+	AppName string
+	ManagementToken string
+	ManagementReadToken string
+	ManagementTLS bool
 }
 
 func (t clientProviderImpl) DoWithClient(cb func(cli *client.RPCClient) error) error {
@@ -134,6 +157,41 @@ func (t clientProviderImpl) DoWithClient(cb func(cli *client.RPCClient) error) e
 	return cb(cli)
 }
 
+func (t clientProviderImpl) DoWithManagement(node string, timeout time.Duration, cb func(cli *raftclient.Client) error) error {
+
+	var endpoint string
+	err := t.DoWithClient(func(cli *client.RPCClient) (err error) {
+		endpoint, err = managementEndpoint(cli, t.AppName, node)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	config := raftclient.Config{
+		Endpoints: []string{endpoint},
+		Token:     t.ManagementToken,
+		Timeout:   timeout,
+	}
+	if config.Token == "" {
+		config.Token = t.ManagementReadToken
+	}
+	if t.ManagementTLS {
+		// same as the API connections of the raft client pool
+		config.TLS = &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos: []string {"h2"},
+		}
+	}
+
+	cli, err := raftclient.New(config)
+	if err != nil {
+		return errors.Errorf("management client '%s', %v", endpoint, err)
+	}
+	defer cli.Close()
+	return cb(cli)
+}
+
 func (t *serfCommand) subCommands() string {
 	var sub []string
 	for _, cmd := range t.SerfCommands {
@@ -153,11 +211,15 @@ func (t *serfCommand) Synopsis() string {
 }
 
 func (t *serfCommand) getConnectAddress(listenAddr string) string {
-	if strings.HasPrefix(listenAddr, "0.0.0.0:") {
-		return "127.0.0.1" + listenAddr[7:]
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return listenAddr
 	}
-	if strings.HasPrefix(listenAddr, ":") {
-		return "127.0.0.1" + listenAddr
+	switch host {
+	case "", "0.0.0.0":
+		return net.JoinHostPort("127.0.0.1", port)
+	case "::":
+		return net.JoinHostPort("::1", port)
 	}
 	return listenAddr
 }
\ No newline at end of file
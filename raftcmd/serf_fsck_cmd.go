@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftcmd
+
+import (
+	"flag"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/hashicorp/serf/client"
+	"github.com/ryanuber/columnize"
+	"github.com/sprintframework/raftmod"
+	"github.com/sprintframework/sprint"
+	"sort"
+	"strings"
+)
+
+type serfFsckCommand struct {
+	Application  sprint.Application   `inject`
+}
+
+func SerfFsckCommand() SerfCommand {
+	return &serfFsckCommand{}
+}
+
+func (t serfFsckCommand) Help() string {
+	helpText := `
+Usage: serf fsck
+
+  Compares FSM state hashes gossiped by the alive servers at identical applied
+  indexes and fails on divergence. Requires 'raft.state-hash' enabled and the
+  application FSM implementing StateHasher.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (t serfFsckCommand) SubCommand() string {
+	return "fsck"
+}
+
+func (t serfFsckCommand) Synopsis() string {
+	return "Detects divergence of the FSM state hashes"
+}
+
+func (t serfFsckCommand) Run(prov ClientProvider, args []string) error {
+
+	cmdFlags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	cmdFlags.Usage = func() { println(t.Help()) }
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return err
+	}
+
+	return prov.DoWithClient(func(cli *client.RPCClient) error {
+
+		members, err := cli.MembersFiltered(map[string]string{"role": t.Application.Name()}, "alive", "")
+		if err != nil {
+			return errors.Errorf("error retrieving members: %v", err)
+		}
+
+		hashes := make(map[string]*raftmod.StateHash)
+		for _, m := range members {
+			value, ok := m.Tags[raftmod.StateHashTag]
+			if !ok {
+				continue
+			}
+			h, err := raftmod.ParseStateHash(value)
+			if err != nil {
+				fmt.Printf("Node '%s': %v\n", m.Name, err)
+				continue
+			}
+			hashes[m.Name] = h
+		}
+
+		if len(hashes) == 0 {
+			return errors.New("no state hashes gossiped, check 'raft.state-hash' property")
+		}
+
+		names := make([]string, 0, len(hashes))
+		for name := range hashes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		lines := []string{"Node|Index|Hash"}
+		for _, name := range names {
+			lines = append(lines, fmt.Sprintf("%s|%d|%s", name, hashes[name].Index, hashes[name].Hash))
+		}
+		fmt.Println(columnize.SimpleFormat(lines))
+
+		divergence := raftmod.FindStateDivergence(hashes)
+		if len(divergence) > 0 {
+			indexes := make([]uint64, 0, len(divergence))
+			for index := range divergence {
+				indexes = append(indexes, index)
+			}
+			sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+			return errors.Errorf("state hashes diverge at indexes %v", indexes)
+		}
+
+		fmt.Println("No divergence at identical indexes")
+		return nil
+	})
+}
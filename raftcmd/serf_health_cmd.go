@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftcmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/hashicorp/serf/client"
+	"github.com/ryanuber/columnize"
+	"github.com/sprintframework/raftmod"
+	"github.com/sprintframework/raftmod/raftclient"
+	"github.com/sprintframework/sprint"
+	"sort"
+	"strings"
+)
+
+type serfHealthCommand struct {
+	Application  sprint.Application   `inject`
+}
+
+func SerfHealthCommand() SerfCommand {
+	return &serfHealthCommand{}
+}
+
+func (t serfHealthCommand) Help() string {
+	helpText := `
+Usage: serf health [options]
+
+  Outputs the health of the raft servers combining serf status and raft
+  replication state, as seen by the node of the connected agent.
+
+Options:
+
+  -format                   If provided, output is returned in the specified
+                            format. Valid formats are 'json', and 'text' (default)
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (t serfHealthCommand) SubCommand() string {
+	return "health"
+}
+
+func (t serfHealthCommand) Synopsis() string {
+	return "Outputs health of the raft servers"
+}
+
+func (t serfHealthCommand) Run(prov ClientProvider, args []string) error {
+
+	var format string
+	cmdFlags := flag.NewFlagSet("health", flag.ContinueOnError)
+	cmdFlags.Usage = func() { println(t.Help()) }
+	cmdFlags.StringVar(&format, "format", "text", "output format")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return err
+	}
+
+	var members []client.Member
+	err := prov.DoWithClient(func(cli *client.RPCClient) (err error) {
+		members, err = cli.MembersFiltered(map[string]string{"role": t.Application.Name()}, "", "")
+		if err != nil {
+			return errors.Errorf("retrieving members, %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return prov.DoWithManagement("", 0, func(cli *raftclient.Client) error {
+		return t.doRun(cli, members, format)
+	})
+}
+
+func (t serfHealthCommand) doRun(cli *raftclient.Client, members []client.Member, format string) error {
+
+	var result healthOutput
+	for _, m := range members {
+		id := m.Tags["id"]
+		if id == "" {
+			continue
+		}
+		health, err := cli.Health(context.Background(), id)
+		if err != nil {
+			health = &raftmod.NodeHealth{ID: id, Reasons: []string{err.Error()}}
+		}
+		health.Name = m.Name
+		result = append(result, health)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	output, err := formatOutput(result, format)
+	if err != nil {
+		return errors.Errorf("encoding error, %v", err)
+	}
+
+	println(string(output))
+	return nil
+}
+
+type healthOutput []*raftmod.NodeHealth
+
+func (t healthOutput) String() string {
+	result := []string{"Name|ID|Healthy|Serf|Raft|Lag|Reasons"}
+	for _, h := range t {
+		result = append(result, fmt.Sprintf("%s|%s|%v|%s|%s|%d|%s",
+			h.Name, h.ID, h.Healthy, h.SerfStatus, h.RaftState, h.Lag, strings.Join(h.Reasons, "; ")))
+	}
+	return columnize.SimpleFormat(result)
+}
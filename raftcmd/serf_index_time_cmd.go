@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftcmd
+
+import (
+	"flag"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/hashicorp/serf/client"
+	"github.com/sprintframework/raftmod"
+	"github.com/sprintframework/sprint"
+	"strings"
+	"time"
+)
+
+type serfIndexTimeCommand struct {
+	Application  sprint.Application   `inject`
+}
+
+func SerfIndexTimeCommand() SerfCommand {
+	return &serfIndexTimeCommand{}
+}
+
+func (t serfIndexTimeCommand) Help() string {
+	helpText := `
+Usage: serf index-time [options] index
+
+  Translates the raft log index to the approximate wall-clock time using the
+  checkpoints recorded by the node every 'raft.checkpoint-interval'.
+
+Options:
+
+  -node=<name>              Node name to query, by default the node of
+                            the connected agent.
+
+  -format                   If provided, output is returned in the specified
+                            format. Valid formats are 'json', and 'text' (default)
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (t serfIndexTimeCommand) SubCommand() string {
+	return "index-time"
+}
+
+func (t serfIndexTimeCommand) Synopsis() string {
+	return "Translates raft log index to time"
+}
+
+func (t serfIndexTimeCommand) Run(prov ClientProvider, args []string) error {
+
+	var node, format string
+	cmdFlags := flag.NewFlagSet("index-time", flag.ContinueOnError)
+	cmdFlags.Usage = func() { println(t.Help()) }
+	cmdFlags.StringVar(&node, "node", "", "node name")
+	cmdFlags.StringVar(&format, "format", "text", "output format")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return err
+	}
+
+	if cmdFlags.NArg() != 1 {
+		return errors.Errorf("index is required\n%s", t.Help())
+	}
+
+	return prov.DoWithClient(func(cli *client.RPCClient) error {
+		result := new(indexTimeOutput)
+		if _, err := queryNode(cli, t.Application.Name(), node, "index-time", []byte(cmdFlags.Arg(0)), 0, result); err != nil {
+			return err
+		}
+		output, err := formatOutput(result, format)
+		if err != nil {
+			return errors.Errorf("encoding error, %v", err)
+		}
+		println(string(output))
+		return nil
+	})
+}
+
+type indexTimeOutput raftmod.IndexTime
+
+func (t *indexTimeOutput) String() string {
+	if t.Exact {
+		return fmt.Sprintf("Index %d applied at %s", t.Index, t.Time.Format(time.RFC3339))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Index %d applied about %s", t.Index, t.Time.Format(time.RFC3339))
+	if t.Before != nil {
+		fmt.Fprintf(&b, "\n  after index %d (term %d) at %s", t.Before.Index, t.Before.Term, t.Before.Time.Format(time.RFC3339))
+	}
+	if t.After != nil {
+		fmt.Fprintf(&b, "\n  before index %d (term %d) at %s", t.After.Index, t.After.Term, t.After.Time.Format(time.RFC3339))
+	}
+	return b.String()
+}
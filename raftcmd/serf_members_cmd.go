@@ -15,6 +15,7 @@ import (
 	"net"
 	"sort"
 	"strings"
+	"time"
 )
 
 type MemberOutput struct {
@@ -28,9 +29,25 @@ type MemberOutput struct {
 }
 
 type MembersContainer struct {
+	columns []string
 	Members []*MemberOutput `json:"members"`
 }
 
+var memberColumns = map[string]func(m *MemberOutput) string {
+	"name":   func(m *MemberOutput) string { return m.Name },
+	"addr":   func(m *MemberOutput) string { return m.Addr },
+	"status": func(m *MemberOutput) string { return m.Status },
+	"tags": func(m *MemberOutput) string {
+		listOfTags := agent.MarshalTags(m.Tags)
+		sort.Strings(listOfTags)
+		return strings.Join(listOfTags, ",")
+	},
+	"protocol": func(m *MemberOutput) string {
+		return fmt.Sprintf("Protocol Version: %d|Available Protocol Range: [%d, %d]",
+			m.Proto["version"], m.Proto["min"], m.Proto["max"])
+	},
+}
+
 type serfMembersCommand struct {
 }
 
@@ -65,6 +82,19 @@ Options:
                             multiple keys. The regexp is anchored at the start and end,
                             and must be a full match.
 
+  -sort=<name|addr|status>  If provided, members are sorted by the given field.
+
+  -columns=<list>           Comma separated list of columns in text output.
+                            Valid columns are 'name', 'addr', 'status', 'tags'
+                            and 'protocol'. Default is 'name,addr,status,tags'.
+
+  -quiet                    Only member names are printed, one per line.
+
+  -watch                    After the output of the current members, prints
+                            membership changes as they happen, prefixed by
+                            timestamp and '+' (join), '-' (leave, failed, reap)
+                            or '~' (update) marker. Press Ctrl-C to exit.
+
 `
 	return strings.TrimSpace(helpText)
 }
@@ -80,8 +110,8 @@ func (t serfMembersCommand) Synopsis() string {
 
 func (t serfMembersCommand) Run(prov ClientProvider, args []string) error {
 
-	var detailed bool
-	var statusFilter, nameFilter, format string
+	var detailed, quiet, watch bool
+	var statusFilter, nameFilter, format, sortBy, columns string
 	var tags []string
 	cmdFlags := flag.NewFlagSet("members", flag.ContinueOnError)
 	cmdFlags.Usage = func() { println(t.Help()) }
@@ -90,22 +120,48 @@ func (t serfMembersCommand) Run(prov ClientProvider, args []string) error {
 	cmdFlags.StringVar(&format, "format", "text", "output format")
 	cmdFlags.Var((*agent.AppendSliceValue)(&tags), "tag", "tag filter")
 	cmdFlags.StringVar(&nameFilter, "name", "", "name filter")
+	cmdFlags.StringVar(&sortBy, "sort", "", "sort field")
+	cmdFlags.StringVar(&columns, "columns", "", "output columns")
+	cmdFlags.BoolVar(&quiet, "quiet", false, "print names only")
+	cmdFlags.BoolVar(&watch, "watch", false, "watch membership changes")
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return err
 	}
 
+	if sortBy != "" && sortBy != "name" && sortBy != "addr" && sortBy != "status" {
+		return errors.Errorf("invalid sort field '%s', valid fields are name, addr, status", sortBy)
+	}
+
+	var columnList []string
+	if columns != "" {
+		for _, col := range strings.Split(columns, ",") {
+			col = strings.TrimSpace(col)
+			if _, ok := memberColumns[col]; !ok {
+				return errors.Errorf("invalid column '%s'", col)
+			}
+			columnList = append(columnList, col)
+		}
+	}
+
 	reqTags, err := agent.UnmarshalTags(tags)
 	if err != nil {
 		return errors.Errorf("unmarshal tags, %v", err)
 	}
 
 	return prov.DoWithClient(func(cli *client.RPCClient) error {
-		return t.doRun(cli, reqTags, statusFilter, nameFilter, format, detailed)
+		if err := t.doRun(cli, reqTags, statusFilter, nameFilter, format, detailed, sortBy, columnList, quiet); err != nil {
+			return err
+		}
+		if watch {
+			return t.doWatch(cli)
+		}
+		return nil
 	})
 }
 
-func (t serfMembersCommand) doRun(client *client.RPCClient, tags map[string]string, statusFilter, nameFilter, format string, detailed bool) error {
+func (t serfMembersCommand) doRun(client *client.RPCClient, tags map[string]string, statusFilter, nameFilter, format string, detailed bool,
+	sortBy string, columns []string, quiet bool) error {
 
 	members, err := client.MembersFiltered(tags, statusFilter, nameFilter)
 	if err != nil {
@@ -113,6 +169,15 @@ func (t serfMembersCommand) doRun(client *client.RPCClient, tags map[string]stri
 	}
 
 	container := parseMembers(members, detailed)
+	container.columns = columns
+	container.sort(sortBy)
+
+	if quiet {
+		for _, member := range container.Members {
+			println(member.Name)
+		}
+		return nil
+	}
 
 	output, err := formatOutput(container, format)
 	if err != nil {
@@ -123,6 +188,69 @@ func (t serfMembersCommand) doRun(client *client.RPCClient, tags map[string]stri
 	return nil
 }
 
+func (t serfMembersCommand) doWatch(cli *client.RPCClient) error {
+
+	eventCh := make(chan map[string]interface{}, 1024)
+	streamHandle, err := cli.Stream("member-join,member-leave,member-failed,member-update,member-reap", eventCh)
+	if err != nil {
+		return errors.Errorf("starting stream, %v", err)
+	}
+	defer cli.Stop(streamHandle)
+
+	shutdownCh := makeShutdownCh()
+
+	for {
+		select {
+		case event := <-eventCh:
+			if event == nil {
+				println("Remote side ended the watch.")
+				return nil
+			}
+			printMemberEvent(event)
+		case <-shutdownCh:
+			return nil
+		}
+	}
+}
+
+func printMemberEvent(event map[string]interface{}) {
+
+	name, _ := event["Event"].(string)
+	marker := "~"
+	switch name {
+	case "member-join":
+		marker = "+"
+	case "member-leave", "member-failed", "member-reap":
+		marker = "-"
+	}
+
+	members, _ := event["Members"].([]interface{})
+	now := time.Now().Format(time.RFC3339)
+
+	for _, m := range members {
+		fields := toStringMap(m)
+		var addr string
+		if ip, ok := fields["Addr"].([]byte); ok {
+			addr = net.IP(ip).String()
+		}
+		fmt.Printf("%s %s %v %s %v %s\n", now, marker, fields["Name"], addr, fields["Status"], name)
+	}
+}
+
+func toStringMap(v interface{}) map[string]interface{} {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(m))
+		for k, val := range m {
+			result[fmt.Sprint(k)] = val
+		}
+		return result
+	}
+	return map[string]interface{}{}
+}
+
 func parseMembers(members []client.Member, detailed bool) MembersContainer {
 
 	result := MembersContainer{}
@@ -148,20 +276,31 @@ func parseMembers(members []client.Member, detailed bool) MembersContainer {
 	return result
 }
 
+func (t MembersContainer) sort(field string) {
+	if field == "" {
+		return
+	}
+	value := memberColumns[field]
+	sort.SliceStable(t.Members, func(i, j int) bool {
+		return value(t.Members[i]) < value(t.Members[j])
+	})
+}
+
 func (t MembersContainer) String() string {
 	var result []string
 	for _, member := range t.Members {
-		listOfTags := agent.MarshalTags(member.Tags)
-		sort.Strings(listOfTags)
-		tags := strings.Join(listOfTags, ",")
-		line := fmt.Sprintf("%s|%s|%s|%s",
-			member.Name, member.Addr, member.Status, tags)
-		if member.detail {
-			line += fmt.Sprintf(
-				"|Protocol Version: %d|Available Protocol Range: [%d, %d]",
-				member.Proto["version"], member.Proto["min"], member.Proto["max"])
+		columns := t.columns
+		if len(columns) == 0 {
+			columns = []string{"name", "addr", "status", "tags"}
+			if member.detail {
+				columns = append(columns, "protocol")
+			}
+		}
+		var values []string
+		for _, col := range columns {
+			values = append(values, memberColumns[col](member))
 		}
-		result = append(result, line)
+		result = append(result, strings.Join(values, "|"))
 	}
 	return columnize.SimpleFormat(result)
 }
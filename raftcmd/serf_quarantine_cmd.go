@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftcmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/hashicorp/serf/client"
+	"github.com/ryanuber/columnize"
+	"github.com/sprintframework/raftmod"
+	"github.com/sprintframework/raftmod/raftclient"
+	"github.com/sprintframework/sprint"
+	"strings"
+	"time"
+)
+
+type serfQuarantineCommand struct {
+	Application  sprint.Application   `inject`
+}
+
+func SerfQuarantineCommand() SerfCommand {
+	return &serfQuarantineCommand{}
+}
+
+func (t serfQuarantineCommand) Help() string {
+	helpText := `
+Usage: serf quarantine [options] list
+       serf quarantine [options] clear [id]
+
+  Manages recently removed or failed raft servers that autopilot does not add
+  back until the 'raft.quarantine-ttl' expires.
+
+  list   Outputs quarantined servers on the node.
+  clear  Removes the server with the given id, or all servers, from quarantine
+         on every raft server of the cluster through the management API.
+
+Options:
+
+  -node=<name>              Node name to list, by default the node of
+                            the connected agent.
+
+  -format                   If provided, output is returned in the specified
+                            format. Valid formats are 'json', and 'text' (default)
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (t serfQuarantineCommand) SubCommand() string {
+	return "quarantine"
+}
+
+func (t serfQuarantineCommand) Synopsis() string {
+	return "Lists or clears quarantined raft servers"
+}
+
+func (t serfQuarantineCommand) Run(prov ClientProvider, args []string) error {
+
+	var node, format string
+	cmdFlags := flag.NewFlagSet("quarantine", flag.ContinueOnError)
+	cmdFlags.Usage = func() { println(t.Help()) }
+	cmdFlags.StringVar(&node, "node", "", "node name")
+	cmdFlags.StringVar(&format, "format", "text", "output format")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return err
+	}
+
+	args = cmdFlags.Args()
+	if len(args) == 0 {
+		return errors.Errorf("action is required\n%s", t.Help())
+	}
+
+	switch args[0] {
+	case "list":
+		return prov.DoWithClient(func(cli *client.RPCClient) error {
+			return t.doList(cli, node, format)
+		})
+	case "clear":
+		var id string
+		if len(args) > 1 {
+			id = args[1]
+		}
+		return t.doClear(prov, id)
+	default:
+		return errors.Errorf("unknown action '%s'\n%s", args[0], t.Help())
+	}
+}
+
+func (t serfQuarantineCommand) doList(cli *client.RPCClient, node, format string) error {
+
+	var list quarantineOutput
+	if _, err := queryNode(cli, t.Application.Name(), node, "quarantine-list", nil, 0, &list); err != nil {
+		return err
+	}
+
+	output, err := formatOutput(list, format)
+	if err != nil {
+		return errors.Errorf("encoding error, %v", err)
+	}
+
+	println(string(output))
+	return nil
+}
+
+func (t serfQuarantineCommand) doClear(prov ClientProvider, id string) error {
+
+	var members []client.Member
+	err := prov.DoWithClient(func(cli *client.RPCClient) (err error) {
+		members, err = cli.MembersFiltered(map[string]string{"role": t.Application.Name()}, "alive", "")
+		return err
+	})
+	if err != nil {
+		return errors.Errorf("retrieving members, %v", err)
+	}
+
+	// quarantine is local to every server, clear it through the management API of each one
+	for _, m := range members {
+		if m.Tags[raftmod.RaftRoleTag] == raftmod.RaftRoleClient {
+			continue
+		}
+		err := prov.DoWithManagement(m.Name, 0, func(cli *raftclient.Client) error {
+			removed, err := cli.ClearQuarantine(context.Background(), id)
+			if err == nil {
+				fmt.Printf("%s: removed %d\n", m.Name, removed)
+			}
+			return err
+		})
+		if err != nil {
+			fmt.Printf("%s: %v\n", m.Name, err)
+		}
+	}
+	return nil
+}
+
+type quarantineOutput []*raftmod.QuarantineEntry
+
+func (t quarantineOutput) String() string {
+	result := []string{"ID|Reason|Expires"}
+	for _, e := range t {
+		result = append(result, fmt.Sprintf("%s|%s|%s", e.ID, e.Reason, time.Until(e.Expires).Round(time.Second)))
+	}
+	return columnize.SimpleFormat(result)
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftcmd
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+	"github.com/hashicorp/serf/client"
+	"github.com/sprintframework/raftmod"
+	"net"
+	"regexp"
+	"time"
+)
+
+/**
+Management API endpoint of the node from the 'grpc-port' tag of the serf member.
+Empty node name means the node of the connected agent.
+ */
+func managementEndpoint(cli *client.RPCClient, appName, node string) (string, error) {
+
+	if node == "" {
+		stats, err := cli.Stats()
+		if err != nil {
+			return "", errors.Errorf("querying agent, %v", err)
+		}
+		node = stats["agent"]["name"]
+	}
+
+	members, err := cli.MembersFiltered(map[string]string{"role": appName}, "", "^" + regexp.QuoteMeta(node) + "$")
+	if err != nil {
+		return "", errors.Errorf("retrieving member '%s', %v", node, err)
+	}
+
+	for _, m := range members {
+		if m.Name != node {
+			continue
+		}
+		port := m.Tags["grpc-port"]
+		if port == "" {
+			return "", errors.Errorf("node '%s' has no 'grpc-port' tag, set 'raft.rpc-bean-name' on the server", node)
+		}
+		return net.JoinHostPort(m.Addr.String(), port), nil
+	}
+
+	return "", errors.Errorf("node '%s' is not a member of '%s'", node, appName)
+}
+
+/**
+Sends application query to the single node and decodes the response into result.
+Empty node name means the node of the connected agent.
+ */
+func queryNode(cli *client.RPCClient, appName, node, query string, payload []byte, timeout time.Duration, result interface{}) (string, error) {
+
+	if node == "" {
+		stats, err := cli.Stats()
+		if err != nil {
+			return "", errors.Errorf("querying agent, %v", err)
+		}
+		node = stats["agent"]["name"]
+	}
+
+	respCh := make(chan client.NodeResponse, 1)
+	params := client.QueryParam{
+		FilterNodes: []string{node},
+		Timeout:     timeout,
+		Name:        appName + ":" + query,
+		Payload:     payload,
+		RespCh:      respCh,
+	}
+
+	if err := cli.Query(&params); err != nil {
+		return node, errors.Errorf("query '%s' on node '%s', %v", query, node, err)
+	}
+
+	r, ok := <-respCh
+	if !ok {
+		return node, errors.Errorf("no response for query '%s' from node '%s'", query, node)
+	}
+
+	var resp raftmod.QueryResponse
+	if err := json.Unmarshal(r.Payload, &resp); err != nil {
+		return node, errors.Errorf("invalid response for query '%s' from node '%s', %v", query, node, err)
+	}
+
+	if resp.Error != "" {
+		return node, errors.Errorf("query '%s' failed on node '%s', %s", query, node, resp.Error)
+	}
+
+	if result != nil && len(resp.Result) > 0 {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return node, errors.Errorf("decode result of query '%s' from node '%s', %v", query, node, err)
+		}
+	}
+
+	return node, nil
+}
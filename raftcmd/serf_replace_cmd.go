@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftcmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/hashicorp/serf/client"
+	"github.com/sprintframework/raftmod"
+	"github.com/sprintframework/raftmod/raftclient"
+	"github.com/sprintframework/sprint"
+	"regexp"
+	"strings"
+)
+
+type serfReplaceCommand struct {
+	Application  sprint.Application   `inject`
+}
+
+func SerfReplaceCommand() SerfCommand {
+	return &serfReplaceCommand{}
+}
+
+func (t serfReplaceCommand) Help() string {
+	helpText := `
+Usage: serf replace [options]
+
+  Replaces the raft server by the new one on the leader in the background:
+  adds the new server as non-voter, waits for it to catch up, promotes it,
+  then demotes and removes the old server. Every step is recorded in the
+  audit log of the leader. Running the command again with the same servers
+  resumes the unfinished replacement. The replacement is started through
+  the management API, see 'raft.management.token'.
+
+Options:
+
+  -old=<id>                 Node id of the server to replace.
+
+  -new=<id>                 Node id of the joined server replacing the old one.
+
+  -status                   Outputs progress of the last replacement instead.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (t serfReplaceCommand) SubCommand() string {
+	return "replace"
+}
+
+func (t serfReplaceCommand) Synopsis() string {
+	return "Replaces the raft server by the new one"
+}
+
+func (t serfReplaceCommand) Run(prov ClientProvider, args []string) error {
+
+	var oldID, newID string
+	var status bool
+	cmdFlags := flag.NewFlagSet("replace", flag.ContinueOnError)
+	cmdFlags.Usage = func() { println(t.Help()) }
+	cmdFlags.StringVar(&oldID, "old", "", "old node id")
+	cmdFlags.StringVar(&newID, "new", "", "new node id")
+	cmdFlags.BoolVar(&status, "status", false, "replacement status")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return err
+	}
+
+	if !status && (oldID == "" || newID == "") {
+		return errors.New("both -old and -new node ids are required")
+	}
+
+	var leader string
+	err := prov.DoWithClient(func(cli *client.RPCClient) (err error) {
+		leader, err = t.leaderNode(cli)
+		if err != nil || !status {
+			return err
+		}
+
+		var op raftmod.ReplaceOperation
+		if _, err := queryNode(cli, t.Application.Name(), leader, "replace-status", nil, 0, &op); err != nil {
+			return err
+		}
+		if op.Old == "" {
+			fmt.Printf("No replacement on leader '%s'\n", leader)
+			return nil
+		}
+		fmt.Printf("Replacement of '%s' by '%s' is in phase '%s', updated %s\n", op.Old, op.New, op.Phase, op.Updated.Format("2006-01-02 15:04:05"))
+		if op.Error != "" {
+			fmt.Printf("Failed: %s\n", op.Error)
+		}
+		return nil
+	})
+	if err != nil || status {
+		return err
+	}
+
+	// mutating call goes through the authenticated management API, followers redirect it to the leader
+	return prov.DoWithManagement(leader, 0, func(cli *raftclient.Client) error {
+		op, err := cli.ReplaceServer(context.Background(), oldID, newID)
+		if err != nil {
+			return errors.Errorf("replace server, %v", err)
+		}
+		if op.Phase != "" {
+			fmt.Printf("Replacement of '%s' by '%s' resumed from phase '%s' on leader '%s'\n", op.Old, op.New, op.Phase, leader)
+		} else {
+			fmt.Printf("Replacement of '%s' by '%s' started on leader '%s'\n", op.Old, op.New, leader)
+		}
+		return nil
+	})
+}
+
+func (t serfReplaceCommand) leaderNode(cli *client.RPCClient) (string, error) {
+
+	var conf raftmod.ClusterConfiguration
+	if _, err := queryNode(cli, t.Application.Name(), "", "raft-configuration", nil, 0, &conf); err != nil {
+		return "", err
+	}
+	if conf.LeaderID == "" {
+		return "", errors.New("raft cluster has no leader")
+	}
+
+	members, err := cli.MembersFiltered(map[string]string{"id": "^" + regexp.QuoteMeta(conf.LeaderID) + "$"}, "alive", "")
+	if err != nil {
+		return "", errors.Errorf("retrieving members, %v", err)
+	}
+	if len(members) == 0 {
+		return "", errors.Errorf("leader '%s' is not an alive serf member", conf.LeaderID)
+	}
+	return members[0].Name, nil
+}
@@ -6,11 +6,17 @@
 package raftcmd
 
 import (
+	"flag"
 	"fmt"
 	"github.com/go-errors/errors"
 	"github.com/hashicorp/serf/client"
+	"github.com/hashicorp/serf/cmd/serf/command/agent"
+	"github.com/hashicorp/serf/coordinate"
+	"github.com/ryanuber/columnize"
 	"github.com/sprintframework/sprint"
+	"sort"
 	"strings"
+	"time"
 )
 
 type serfRttCommand struct {
@@ -24,6 +30,7 @@ func SerfRttCommand() SerfCommand {
 func (t serfRttCommand) Help() string {
 	helpText := `
 Usage: serf rtt [options] node1 [node2]
+       serf rtt -all [options]
 
   Estimates the round trip time between two nodes using Serf's network
   coordinate model of the cluster.
@@ -32,6 +39,17 @@ Usage: serf rtt [options] node1 [node2]
   is set to the agent's node name. Note that these are node names as known to
   Serf as "serf members" would show, not IP addresses.
 
+Options:
+
+  -all                      Outputs the full matrix of estimated round trip
+                            times between all alive members, rows and columns
+                            are ordered by the node name.
+
+  -threshold=<duration>     Highlights with '*' the matrix cells exceeding the
+                            threshold, for example '-threshold=50ms'.
+
+  -tag <key>=<regexp>       Filters members of the matrix by the tag, can be
+                            specified multiple times.
 `
 	return strings.TrimSpace(helpText)
 }
@@ -45,11 +63,85 @@ func (t serfRttCommand) Synopsis() string {
 }
 
 func (t serfRttCommand) Run(prov ClientProvider, args []string) error {
+
+	var all bool
+	var threshold time.Duration
+	var tags []string
+	cmdFlags := flag.NewFlagSet("rtt", flag.ContinueOnError)
+	cmdFlags.Usage = func() { println(t.Help()) }
+	cmdFlags.BoolVar(&all, "all", false, "rtt matrix of all members")
+	cmdFlags.DurationVar(&threshold, "threshold", 0, "highlight threshold")
+	cmdFlags.Var((*agent.AppendSliceValue)(&tags), "tag", "tag filter")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return err
+	}
+
+	reqTags, err := agent.UnmarshalTags(tags)
+	if err != nil {
+		return errors.Errorf("unmarshal tags, %v", err)
+	}
+
 	return prov.DoWithClient(func(cli *client.RPCClient) error {
-		return t.doRun(cli, args)
+		if all {
+			return t.doMatrix(cli, reqTags, threshold)
+		}
+		return t.doRun(cli, cmdFlags.Args())
 	})
 }
 
+func (t serfRttCommand) doMatrix(cli *client.RPCClient, tags map[string]string, threshold time.Duration) error {
+
+	members, err := cli.MembersFiltered(tags, "alive", "")
+	if err != nil {
+		return errors.Errorf("retrieving members, %v", err)
+	}
+
+	var nodes []string
+	coords := make(map[string]*coordinate.Coordinate)
+	for _, m := range members {
+		coord, err := cli.GetCoordinate(m.Name)
+		if err != nil {
+			return errors.Errorf("getting coordinates of '%s', %v", m.Name, err)
+		}
+		if coord == nil {
+			continue
+		}
+		nodes = append(nodes, m.Name)
+		coords[m.Name] = coord
+	}
+
+	if len(nodes) == 0 {
+		return errors.New("no coordinates found for members")
+	}
+	sort.Strings(nodes)
+
+	lines := []string{" |" + strings.Join(nodes, "|")}
+	for _, row := range nodes {
+		cells := []string{row}
+		for _, col := range nodes {
+			if row == col {
+				cells = append(cells, "-")
+				continue
+			}
+			dist := coords[row].DistanceTo(coords[col])
+			cell := fmt.Sprintf("%.3f", dist.Seconds()*1000.0)
+			if threshold > 0 && dist > threshold {
+				cell += "*"
+			}
+			cells = append(cells, cell)
+		}
+		lines = append(lines, strings.Join(cells, "|"))
+	}
+
+	fmt.Println("Estimated rtt in ms:")
+	fmt.Println(columnize.SimpleFormat(lines))
+	if threshold > 0 {
+		fmt.Printf("* exceeds %s\n", threshold)
+	}
+	return nil
+}
+
 func (t serfRttCommand) doRun(client *client.RPCClient, args []string) error {
 
 	nodes := args
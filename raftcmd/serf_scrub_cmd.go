@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftcmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/sprintframework/raftmod/raftclient"
+	"strings"
+)
+
+type serfScrubCommand struct {
+}
+
+func SerfScrubCommand() SerfCommand {
+	return &serfScrubCommand{}
+}
+
+func (t serfScrubCommand) Help() string {
+	helpText := `
+Usage: serf scrub [options]
+
+  Starts verification of the raft log checksums on the node in the background.
+  Results are reported in the node log. Requires 'raft-storage.log-checksum' enabled
+  and the management API on the node, see 'raft.management.token'.
+
+Options:
+
+  -node=<name>              Node name to scrub, by default the node of
+                            the connected agent.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (t serfScrubCommand) SubCommand() string {
+	return "scrub"
+}
+
+func (t serfScrubCommand) Synopsis() string {
+	return "Verifies raft log checksums on the node"
+}
+
+func (t serfScrubCommand) Run(prov ClientProvider, args []string) error {
+
+	var node string
+	cmdFlags := flag.NewFlagSet("scrub", flag.ContinueOnError)
+	cmdFlags.Usage = func() { println(t.Help()) }
+	cmdFlags.StringVar(&node, "node", "", "node name")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return err
+	}
+
+	return prov.DoWithManagement(node, 0, func(cli *raftclient.Client) error {
+		if err := cli.Scrub(context.Background()); err != nil {
+			return errors.Errorf("scrub, %v", err)
+		}
+		fmt.Println("Log scrub started")
+		return nil
+	})
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftcmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/sprintframework/raftmod"
+	"github.com/sprintframework/raftmod/raftclient"
+	"strings"
+	"time"
+)
+
+type serfSnapshotCommand struct {
+}
+
+func SerfSnapshotCommand() SerfCommand {
+	return &serfSnapshotCommand{}
+}
+
+func (t serfSnapshotCommand) Help() string {
+	helpText := `
+Usage: serf snapshot [options]
+
+  Triggers the raft snapshot on the node and prints the snapshot metadata.
+
+Options:
+
+  -node=<name>              Node name to snapshot, by default the node of
+                            the connected agent.
+
+  -timeout=<duration>       Maximum time to wait for the snapshot. Default is 60s.
+
+  -format                   If provided, output is returned in the specified
+                            format. Valid formats are 'json', and 'text' (default)
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (t serfSnapshotCommand) SubCommand() string {
+	return "snapshot"
+}
+
+func (t serfSnapshotCommand) Synopsis() string {
+	return "Triggers the raft snapshot on the node"
+}
+
+func (t serfSnapshotCommand) Run(prov ClientProvider, args []string) error {
+
+	var node, format string
+	var timeout time.Duration
+	cmdFlags := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	cmdFlags.Usage = func() { println(t.Help()) }
+	cmdFlags.StringVar(&node, "node", "", "node name")
+	cmdFlags.DurationVar(&timeout, "timeout", time.Minute, "query timeout")
+	cmdFlags.StringVar(&format, "format", "text", "output format")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return err
+	}
+
+	return prov.DoWithManagement(node, timeout, func(cli *raftclient.Client) error {
+		return t.doRun(cli, format)
+	})
+}
+
+func (t serfSnapshotCommand) doRun(cli *raftclient.Client, format string) error {
+
+	snapshot, err := cli.Snapshot(context.Background())
+	if err != nil {
+		return errors.Errorf("snapshot, %v", err)
+	}
+	info := snapshotOutput{*snapshot}
+
+	output, err := formatOutput(info, format)
+	if err != nil {
+		return errors.Errorf("encoding error, %v", err)
+	}
+
+	println(string(output))
+	return nil
+}
+
+type snapshotOutput struct {
+	raftmod.SnapshotInfo
+}
+
+func (t snapshotOutput) String() string {
+	return fmt.Sprintf("ID: %s\nIndex: %d\nTerm: %d\nSize: %d", t.ID, t.Index, t.Term, t.Size)
+}
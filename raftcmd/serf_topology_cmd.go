@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftcmd
+
+import (
+	"flag"
+	"fmt"
+	"github.com/go-errors/errors"
+	"github.com/hashicorp/serf/client"
+	"github.com/hashicorp/serf/coordinate"
+	"github.com/sprintframework/raftmod"
+	"github.com/sprintframework/sprint"
+	"net"
+	"sort"
+	"strings"
+)
+
+const (
+	TopologyLeader   = "leader"
+	TopologyVoter    = "voter"
+	TopologyNonvoter = "nonvoter"
+	TopologyClient   = "client"
+	TopologyUnknown  = "unknown"
+)
+
+type TopologyNode struct {
+	Name     string  `json:"name"`
+	ID       string  `json:"id,omitempty"`
+	Addr     string  `json:"addr"`
+	Zone     string  `json:"zone,omitempty"`
+	Kind     string  `json:"kind"`
+	Status   string  `json:"status"`
+}
+
+type TopologyEdge struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	RttMs    float64  `json:"rttMs"`
+}
+
+type TopologyOutput struct {
+	Nodes  []*TopologyNode  `json:"nodes"`
+	Edges  []*TopologyEdge  `json:"edges"`
+}
+
+type serfTopologyCommand struct {
+	Application  sprint.Application   `inject`
+}
+
+func SerfTopologyCommand() SerfCommand {
+	return &serfTopologyCommand{}
+}
+
+func (t serfTopologyCommand) Help() string {
+	helpText := `
+Usage: serf topology [options]
+
+  Outputs the graph of the cluster: nodes with raft roles (leader, voter,
+  nonvoter, client), zones from the 'zone' tag and estimated RTT edges from
+  the network coordinates. The 'dot' format is renderable by Graphviz:
+
+    serf topology | dot -Tsvg > cluster.svg
+
+Options:
+
+  -format                   If provided, output is returned in the specified
+                            format. Valid formats are 'json', and 'dot' (default)
+
+  -rtt                      Include RTT edges between nodes (default true).
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (t serfTopologyCommand) SubCommand() string {
+	return "topology"
+}
+
+func (t serfTopologyCommand) Synopsis() string {
+	return "Outputs cluster topology graph"
+}
+
+func (t serfTopologyCommand) Run(prov ClientProvider, args []string) error {
+
+	var format string
+	var rtt bool
+	cmdFlags := flag.NewFlagSet("topology", flag.ContinueOnError)
+	cmdFlags.Usage = func() { println(t.Help()) }
+	cmdFlags.StringVar(&format, "format", "dot", "output format")
+	cmdFlags.BoolVar(&rtt, "rtt", true, "include rtt edges")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return err
+	}
+
+	switch format {
+	case "dot":
+		format = "text"
+	case "json":
+	default:
+		return errors.Errorf("invalid output format \"%s\"", format)
+	}
+
+	return prov.DoWithClient(func(cli *client.RPCClient) error {
+		return t.doRun(cli, format, rtt)
+	})
+}
+
+func (t serfTopologyCommand) doRun(cli *client.RPCClient, format string, rtt bool) error {
+
+	members, err := cli.MembersFiltered(map[string]string{"role": t.Application.Name()}, "", "")
+	if err != nil {
+		return errors.Errorf("retrieving members, %v", err)
+	}
+
+	var conf raftmod.ClusterConfiguration
+	if _, err := queryNode(cli, t.Application.Name(), "", "raft-configuration", nil, 0, &conf); err != nil {
+		return err
+	}
+
+	suffrage := make(map[string]string)
+	for _, s := range conf.Servers {
+		suffrage[s.ID] = s.Suffrage
+	}
+
+	result := new(TopologyOutput)
+	coords := make(map[string]*coordinate.Coordinate)
+
+	for _, m := range members {
+		id := m.Tags["id"]
+		node := &TopologyNode{
+			Name:   m.Name,
+			ID:     id,
+			Addr:   (&net.TCPAddr{IP: m.Addr, Port: int(m.Port)}).String(),
+			Zone:   m.Tags[raftmod.ZoneTag],
+			Kind:   TopologyUnknown,
+			Status: m.Status,
+		}
+		switch {
+		case m.Tags[raftmod.RaftRoleTag] == raftmod.RaftRoleClient:
+			node.Kind = TopologyClient
+		case id != "" && id == conf.LeaderID:
+			node.Kind = TopologyLeader
+		case suffrage[id] == "Voter":
+			node.Kind = TopologyVoter
+		case suffrage[id] == "Nonvoter" || suffrage[id] == "Staging":
+			node.Kind = TopologyNonvoter
+		}
+		result.Nodes = append(result.Nodes, node)
+
+		if rtt && m.Status == "alive" {
+			coord, err := cli.GetCoordinate(m.Name)
+			if err != nil {
+				return errors.Errorf("getting coordinates of '%s', %v", m.Name, err)
+			}
+			if coord != nil {
+				coords[m.Name] = coord
+			}
+		}
+	}
+
+	sort.Slice(result.Nodes, func(i, j int) bool {
+		return result.Nodes[i].Name < result.Nodes[j].Name
+	})
+
+	for i, from := range result.Nodes {
+		for _, to := range result.Nodes[i+1:] {
+			c1, ok1 := coords[from.Name]
+			c2, ok2 := coords[to.Name]
+			if ok1 && ok2 {
+				result.Edges = append(result.Edges, &TopologyEdge{
+					From:  from.Name,
+					To:    to.Name,
+					RttMs: c1.DistanceTo(c2).Seconds() * 1000.0,
+				})
+			}
+		}
+	}
+
+	output, err := formatOutput(result, format)
+	if err != nil {
+		return errors.Errorf("encoding error, %v", err)
+	}
+
+	println(string(output))
+	return nil
+}
+
+var topologyShapes = map[string]string {
+	TopologyLeader:   "shape=doublecircle,style=filled,fillcolor=gold",
+	TopologyVoter:    "shape=circle",
+	TopologyNonvoter: "shape=circle,style=dashed",
+	TopologyClient:   "shape=box",
+	TopologyUnknown:  "shape=circle,style=dotted",
+}
+
+/**
+Graphviz representation of the topology
+ */
+func (t *TopologyOutput) String() string {
+
+	var out strings.Builder
+	out.WriteString("graph cluster {\n")
+
+	zones := make(map[string][]*TopologyNode)
+	var zoneNames []string
+	for _, node := range t.Nodes {
+		if _, ok := zones[node.Zone]; !ok {
+			zoneNames = append(zoneNames, node.Zone)
+		}
+		zones[node.Zone] = append(zones[node.Zone], node)
+	}
+	sort.Strings(zoneNames)
+
+	for i, zone := range zoneNames {
+		indent := "  "
+		if zone != "" {
+			fmt.Fprintf(&out, "  subgraph cluster_%d {\n    label=%q;\n", i, zone)
+			indent = "    "
+		}
+		for _, node := range zones[zone] {
+			label := fmt.Sprintf("%s\\n%s\\n%s", node.Name, node.Kind, node.Status)
+			fmt.Fprintf(&out, "%s%q [label=\"%s\",%s];\n", indent, node.Name, label, topologyShapes[node.Kind])
+		}
+		if zone != "" {
+			out.WriteString("  }\n")
+		}
+	}
+
+	for _, edge := range t.Edges {
+		fmt.Fprintf(&out, "  %q -- %q [label=\"%.3f ms\"];\n", edge.From, edge.To, edge.RttMs)
+	}
+
+	out.WriteString("}")
+	return out.String()
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+)
+
+/**
+FSM decorator limiting the apply rate of the follower lagging behind the last log index,
+so the catch-up does not saturate the local database serving reads. Leader is never throttled.
+ */
+type replayThrottleFSM struct {
+	raft.FSM
+
+	lagging        func(index uint64) bool
+	entriesPerSec  float64
+	bytesPerSec    float64
+	closeCh        <-chan struct{}
+	clock          limiterClock
+
+	// recreated on every catch-up, accessed only by the FSM goroutine
+	active   bool
+	entries  *bandwidthLimiter
+	bytes    *bandwidthLimiter
+}
+
+type replayThrottleBatchingFSM struct {
+	*replayThrottleFSM
+	batching raft.BatchingFSM
+}
+
+func newReplayThrottleFSM(delegate raft.FSM, entriesPerSec, bytesPerSec float64, lagging func(index uint64) bool, closeCh <-chan struct{}) raft.FSM {
+	fsm := &replayThrottleFSM{
+		FSM:           delegate,
+		lagging:       lagging,
+		entriesPerSec: entriesPerSec,
+		bytesPerSec:   bytesPerSec,
+		closeCh:       closeCh,
+		clock:         systemClock{},
+	}
+	if batching, ok := delegate.(raft.BatchingFSM); ok {
+		return &replayThrottleBatchingFSM{replayThrottleFSM: fsm, batching: batching}
+	}
+	return fsm
+}
+
+func (t *replayThrottleFSM) throttle(logs ...*raft.Log) {
+	if len(logs) == 0 {
+		return
+	}
+	if !t.lagging(logs[len(logs) - 1].Index) {
+		t.active = false
+		return
+	}
+	if !t.active {
+		t.active = true
+		t.entries = newBandwidthLimiterClock(t.entriesPerSec, t.clock)
+		t.bytes = newBandwidthLimiterClock(t.bytesPerSec, t.clock)
+	}
+	size := 0
+	for _, log := range logs {
+		size += len(log.Data) + len(log.Extensions)
+	}
+	if t.entries.Wait(len(logs), t.closeCh) {
+		t.bytes.Wait(size, t.closeCh)
+	}
+}
+
+func (t *replayThrottleFSM) Apply(log *raft.Log) interface{} {
+	t.throttle(log)
+	return t.FSM.Apply(log)
+}
+
+func (t *replayThrottleBatchingFSM) ApplyBatch(logs []*raft.Log) []interface{} {
+	t.throttle(logs...)
+	return t.batching.ApplyBatch(logs)
+}
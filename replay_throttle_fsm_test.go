@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type throttleTestClock struct {
+	now    time.Time
+	slept  []time.Duration
+}
+
+func (t *throttleTestClock) Now() time.Time {
+	return t.now
+}
+
+func (t *throttleTestClock) Sleep(d time.Duration, closeCh <-chan struct{}) bool {
+	select {
+	case <-closeCh:
+		return false
+	default:
+	}
+	t.slept = append(t.slept, d)
+	t.now = t.now.Add(d)
+	return true
+}
+
+type throttleTestFSM struct {
+	raft.MockFSM
+}
+
+func (t *throttleTestFSM) ApplyBatch(logs []*raft.Log) []interface{} {
+	resp := make([]interface{}, len(logs))
+	for i, log := range logs {
+		resp[i] = t.Apply(log)
+	}
+	return resp
+}
+
+func TestReplayThrottle(t *testing.T) {
+
+	lagging := true
+	closeCh := make(chan struct{})
+	delegate := &raft.MockFSM{}
+	fsm := newReplayThrottleFSM(delegate, 20, 0, func(index uint64) bool {
+		return lagging
+	}, closeCh)
+	_, ok := fsm.(raft.BatchingFSM)
+	require.False(t, ok)
+
+	clock := &throttleTestClock{now: time.Now()}
+	fsm.(*replayThrottleFSM).clock = clock
+
+	for i := 1; i <= 4; i++ {
+		fsm.Apply(&raft.Log{Index: uint64(i), Type: raft.LogCommand, Data: []byte{'a'}})
+	}
+	require.Equal(t, []time.Duration{50 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond}, clock.slept)
+
+	// caught up
+	lagging = false
+	clock.slept = nil
+	for i := 5; i <= 100; i++ {
+		fsm.Apply(&raft.Log{Index: uint64(i), Type: raft.LogCommand, Data: []byte{'a'}})
+	}
+	require.Empty(t, clock.slept)
+
+	// the next catch-up starts the rate over instead of using the idle time as the credit
+	lagging = true
+	clock.now = clock.now.Add(time.Hour)
+	fsm.Apply(&raft.Log{Index: 101, Type: raft.LogCommand, Data: []byte{'a'}})
+	require.Equal(t, []time.Duration{50 * time.Millisecond}, clock.slept)
+
+	// shutdown interrupts the wait, the entry is applied
+	close(closeCh)
+	fsm.Apply(&raft.Log{Index: 102, Type: raft.LogCommand, Data: []byte{'a'}})
+	require.Equal(t, []time.Duration{50 * time.Millisecond}, clock.slept)
+	require.Len(t, delegate.Logs(), 102)
+}
+
+func TestReplayThrottleBatch(t *testing.T) {
+
+	delegate := &throttleTestFSM{}
+	fsm := newReplayThrottleFSM(delegate, 0, 1000, func(index uint64) bool {
+		return true
+	}, make(chan struct{}))
+	clock := &throttleTestClock{now: time.Now()}
+	fsm.(*replayThrottleBatchingFSM).clock = clock
+
+	var logs []*raft.Log
+	for i := 1; i <= 4; i++ {
+		logs = append(logs, &raft.Log{Index: uint64(i), Type: raft.LogCommand, Data: bytes.Repeat([]byte{'a'}, 100)})
+	}
+	logs = append(logs, &raft.Log{Index: 5, Type: raft.LogCommand, Data: bytes.Repeat([]byte{'a'}, 50), Extensions: bytes.Repeat([]byte{'e'}, 50)})
+
+	// data and extensions of the batch are accounted in one wait
+	require.Len(t, fsm.(raft.BatchingFSM).ApplyBatch(logs), 5)
+	require.Equal(t, []time.Duration{500 * time.Millisecond}, clock.slept)
+	require.Len(t, delegate.Logs(), 5)
+
+	// leader is never lagging
+	fsm = newReplayThrottleFSM(delegate, 1, 1, func(index uint64) bool {
+		return false
+	}, make(chan struct{}))
+	fsm.(*replayThrottleBatchingFSM).clock = clock
+	clock.slept = nil
+
+	require.Len(t, fsm.(raft.BatchingFSM).ApplyBatch(logs), 5)
+	require.Empty(t, clock.slept)
+	require.Len(t, delegate.Logs(), 10)
+}
@@ -0,0 +1,780 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3MetaObject  = "meta.json"
+	s3StateObject = "state.bin"
+	s3SpillExt    = ".spill"
+
+	// hash of the empty payload
+	s3EmptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// single PUT is limited by 5 GiB, larger states are uploaded in parts
+	s3DefaultPartSize = 64 << 20
+)
+
+/**
+Connection of the S3-compatible object storage, empty endpoint is the AWS endpoint of the region
+ */
+type S3Config struct {
+	Endpoint      string
+	Region        string
+	Bucket        string
+	Prefix        string
+	AccessKey     string
+	SecretKey     string
+	SessionToken  string
+	// path-style addressing of the bucket, required by most non-AWS storages
+	PathStyle     bool
+	Timeout       time.Duration
+	// states above the part size are uploaded by the multipart upload, zero is 64 MiB
+	PartSize      int64
+}
+
+type s3SnapshotMeta struct {
+	raft.SnapshotMeta
+	SHA256  string
+}
+
+/**
+Snapshot store keeping snapshots in the S3-compatible object storage under '<prefix>/<id>/',
+in-progress snapshots are spilled to the local directory and uploaded on Close.
+States above the part size are uploaded part by part while written, only the current part is spilled.
+The meta object is uploaded after the state, so snapshots without the meta are incomplete and ignored.
+ */
+type implS3SnapshotStore struct {
+	client    *s3Client
+	spillDir  string
+	retain    int
+	partSize  int64
+}
+
+func S3SnapshotStore(config S3Config, spillDir string, retain int) (raft.SnapshotStore, error) {
+
+	if retain < 1 {
+		return nil, errors.New("must retain at least one snapshot")
+	}
+	client, err := newS3Client(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(spillDir, 0700); err != nil {
+		return nil, errors.Errorf("create snapshot spill dir '%s', %v", spillDir, err)
+	}
+
+	// spills of the previous run are never uploaded
+	if files, err := filepath.Glob(filepath.Join(spillDir, "*" + s3SpillExt)); err == nil {
+		for _, file := range files {
+			os.Remove(file)
+		}
+	}
+
+	partSize := config.PartSize
+	if partSize <= 0 {
+		partSize = s3DefaultPartSize
+	}
+
+	return &implS3SnapshotStore{client: client, spillDir: spillDir, retain: retain, partSize: partSize}, nil
+}
+
+func (t *implS3SnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration,
+	configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+
+	if version != 1 {
+		return nil, errors.Errorf("unsupported snapshot version %d", version)
+	}
+
+	id := fmt.Sprintf("%d-%d-%d", term, index, time.Now().UnixNano() / int64(time.Millisecond))
+	file, err := os.OpenFile(filepath.Join(t.spillDir, id + s3SpillExt), os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &implS3SnapshotSink{
+		store: t,
+		file:  file,
+		hash:  sha256.New(),
+		part:  sha256.New(),
+		meta: raft.SnapshotMeta{
+			Version:            version,
+			ID:                 id,
+			Index:              index,
+			Term:               term,
+			Configuration:      configuration,
+			ConfigurationIndex: configurationIndex,
+		},
+	}, nil
+}
+
+func (t *implS3SnapshotStore) List() ([]*raft.SnapshotMeta, error) {
+	snapshots, err := t.snapshots()
+	if err != nil {
+		return nil, err
+	}
+	var list []*raft.SnapshotMeta
+	for _, meta := range snapshots {
+		list = append(list, &meta.SnapshotMeta)
+		if len(list) == t.retain {
+			break
+		}
+	}
+	return list, nil
+}
+
+/**
+Returns complete snapshots, the newest first
+ */
+func (t *implS3SnapshotStore) snapshots() ([]*s3SnapshotMeta, error) {
+
+	ids, err := t.client.listDirs(t.client.key(""))
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*s3SnapshotMeta
+	for _, id := range ids {
+		meta, err := t.readMeta(id)
+		if err != nil {
+			if err == errS3NotFound {
+				// upload is in progress or failed
+				continue
+			}
+			return nil, err
+		}
+		list = append(list, meta)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Term != b.Term {
+			return a.Term > b.Term
+		}
+		if a.Index != b.Index {
+			return a.Index > b.Index
+		}
+		return a.ID > b.ID
+	})
+	return list, nil
+}
+
+func (t *implS3SnapshotStore) readMeta(id string) (*s3SnapshotMeta, error) {
+	body, err := t.client.get(t.client.key(id, s3MetaObject))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	meta := new(s3SnapshotMeta)
+	if err := json.NewDecoder(body).Decode(meta); err != nil {
+		return nil, errors.Errorf("invalid meta of snapshot '%s', %v", id, err)
+	}
+	return meta, nil
+}
+
+func (t *implS3SnapshotStore) Open(id string) (*raft.SnapshotMeta, io.ReadCloser, error) {
+
+	meta, err := t.readMeta(id)
+	if err != nil {
+		return nil, nil, errors.Errorf("open snapshot '%s', %v", id, err)
+	}
+
+	body, err := t.client.get(t.client.key(id, s3StateObject))
+	if err != nil {
+		return nil, nil, errors.Errorf("open snapshot '%s', %v", id, err)
+	}
+
+	return &meta.SnapshotMeta, &s3StateReader{
+		body:     body,
+		hash:     sha256.New(),
+		expected: meta.SHA256,
+		size:     meta.Size,
+	}, nil
+}
+
+/**
+Removes snapshots beyond the retain count, the meta goes first, so the snapshot is never seen half-removed
+ */
+func (t *implS3SnapshotStore) reap() error {
+	snapshots, err := t.snapshots()
+	if err != nil {
+		return err
+	}
+	for i := t.retain; i < len(snapshots); i++ {
+		if err := t.removeSnapshot(snapshots[i].ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *implS3SnapshotStore) removeSnapshot(id string) error {
+	if err := t.client.delete(t.client.key(id, s3MetaObject)); err != nil {
+		return err
+	}
+	if err := t.client.delete(t.client.key(id, s3StateObject)); err != nil {
+		return err
+	}
+	for _, name := range snapshotSidecarFiles {
+		if err := t.client.delete(t.client.key(id, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *implS3SnapshotStore) writeSidecar(id, name string, data []byte) error {
+	hash := sha256.Sum256(data)
+	return t.client.put(t.client.key(id, name), bytes.NewReader(data), int64(len(data)), hex.EncodeToString(hash[:]))
+}
+
+func (t *implS3SnapshotStore) readSidecar(id, name string) ([]byte, error) {
+	body, err := t.client.get(t.client.key(id, name))
+	if err != nil {
+		if err == errS3NotFound {
+			return nil, os.ErrNotExist
+		}
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func (t *implS3SnapshotStore) openState(id string) (io.ReadCloser, error) {
+	return t.client.get(t.client.key(id, s3StateObject))
+}
+
+type implS3SnapshotSink struct {
+	store     *implS3SnapshotStore
+	file      *os.File   // spill of the state or of the current part of the multipart upload
+	hash      hash.Hash  // of the whole state
+	part      hash.Hash  // of the spilled bytes
+	spilled   int64
+	uploadID  string
+	parts     []s3CompletedPart
+	meta      raft.SnapshotMeta
+	closed    bool
+}
+
+func (t *implS3SnapshotSink) Write(p []byte) (int, error) {
+	n, err := t.file.Write(p)
+	t.hash.Write(p[:n])
+	t.part.Write(p[:n])
+	t.meta.Size += int64(n)
+	t.spilled += int64(n)
+	if err == nil && t.spilled >= t.store.partSize {
+		err = t.uploadPart()
+	}
+	return n, err
+}
+
+/**
+Uploads the spilled bytes as the next part, the multipart upload starts on the first part
+ */
+func (t *implS3SnapshotSink) uploadPart() error {
+
+	client := t.store.client
+	key := client.key(t.meta.ID, s3StateObject)
+	if t.uploadID == "" {
+		uploadID, err := client.createMultipart(key)
+		if err != nil {
+			return errors.Errorf("start upload of snapshot '%s', %v", t.meta.ID, err)
+		}
+		t.uploadID = uploadID
+	}
+
+	if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	number := len(t.parts) + 1
+	etag, err := client.uploadPart(key, t.uploadID, number, t.file, t.spilled, hex.EncodeToString(t.part.Sum(nil)))
+	if err != nil {
+		return errors.Errorf("upload part %d of snapshot '%s', %v", number, t.meta.ID, err)
+	}
+	t.parts = append(t.parts, s3CompletedPart{PartNumber: number, ETag: etag})
+
+	// the next part reuses the spill file
+	if err := t.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	t.part.Reset()
+	t.spilled = 0
+	return nil
+}
+
+func (t *implS3SnapshotSink) ID() string {
+	return t.meta.ID
+}
+
+func (t *implS3SnapshotSink) Cancel() error {
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	t.file.Close()
+	err := os.Remove(t.file.Name())
+	if t.uploadID != "" {
+		// uploaded parts are billed until the upload is aborted
+		client := t.store.client
+		if abortErr := client.abortMultipart(client.key(t.meta.ID, s3StateObject), t.uploadID); abortErr != nil {
+			return errors.Errorf("abort upload of snapshot '%s', %v", t.meta.ID, abortErr)
+		}
+	}
+	return err
+}
+
+func (t *implS3SnapshotSink) Close() error {
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	defer func() {
+		t.file.Close()
+		os.Remove(t.file.Name())
+	}()
+
+	client := t.store.client
+	key := client.key(t.meta.ID, s3StateObject)
+	stateHash := hex.EncodeToString(t.hash.Sum(nil))
+
+	if t.uploadID == "" {
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := client.put(key, t.file, t.meta.Size, stateHash); err != nil {
+			return errors.Errorf("upload snapshot '%s', %v", t.meta.ID, err)
+		}
+	} else {
+		var err error
+		if t.spilled > 0 {
+			err = t.uploadPart()
+		}
+		if err == nil {
+			err = client.completeMultipart(key, t.uploadID, t.parts)
+		}
+		if err != nil {
+			client.abortMultipart(key, t.uploadID)
+			return errors.Errorf("upload snapshot '%s', %v", t.meta.ID, err)
+		}
+	}
+
+	meta, err := json.Marshal(&s3SnapshotMeta{SnapshotMeta: t.meta, SHA256: stateHash})
+	if err != nil {
+		return err
+	}
+	metaHash := sha256.Sum256(meta)
+	if err := client.put(client.key(t.meta.ID, s3MetaObject), bytes.NewReader(meta), int64(len(meta)), hex.EncodeToString(metaHash[:])); err != nil {
+		return errors.Errorf("upload meta of snapshot '%s', %v", t.meta.ID, err)
+	}
+
+	return t.store.reap()
+}
+
+/**
+Verifies the size and hash of the state when the stream ends
+ */
+type s3StateReader struct {
+	body      io.ReadCloser
+	hash      hash.Hash
+	expected  string
+	size      int64
+	read      int64
+}
+
+func (t *s3StateReader) Read(p []byte) (int, error) {
+	n, err := t.body.Read(p)
+	t.hash.Write(p[:n])
+	t.read += int64(n)
+	if err == io.EOF {
+		if t.read != t.size {
+			return n, errors.Errorf("snapshot state has %d bytes whereas expected %d bytes", t.read, t.size)
+		}
+		if hex.EncodeToString(t.hash.Sum(nil)) != t.expected {
+			return n, errors.New("snapshot state hash mismatch")
+		}
+	}
+	return n, err
+}
+
+func (t *s3StateReader) Close() error {
+	return t.body.Close()
+}
+
+var errS3NotFound = errors.New("object not found")
+
+/**
+Minimal S3 REST client signing requests by AWS Signature Version 4
+ */
+type s3Client struct {
+	config   S3Config
+	base     *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func newS3Client(config S3Config) (*s3Client, error) {
+
+	if config.Bucket == "" {
+		return nil, errors.New("bucket is required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.AccessKey == "" {
+		config.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		config.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		config.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, errors.New("access key and secret key are required")
+	}
+	config.Prefix = strings.Trim(config.Prefix, "/")
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	base, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil {
+		return nil, errors.Errorf("invalid endpoint '%s', %v", endpoint, err)
+	}
+	if config.PathStyle {
+		base.Path += "/" + config.Bucket
+	} else {
+		base.Host = config.Bucket + "." + base.Host
+	}
+
+	// the timeout applies to the response headers, snapshot bodies could take much longer
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = config.Timeout
+
+	return &s3Client{
+		config: config,
+		base:   base,
+		client: &http.Client{Transport: transport},
+		now:    time.Now,
+	}, nil
+}
+
+func (t *s3Client) key(parts ...string) string {
+	key := strings.Join(parts, "/")
+	if t.config.Prefix != "" {
+		key = t.config.Prefix + "/" + key
+	}
+	return key
+}
+
+func (t *s3Client) objectURL(key string, query url.Values) *url.URL {
+	u := *t.base
+	u.Path += "/" + key
+	// the same encoding as the signature
+	u.RawPath = awsURIEncode(u.Path, false)
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+func (t *s3Client) do(method, key string, query url.Values, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+
+	req, err := http.NewRequest(method, t.objectURL(key, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		// the spill file must not be closed by the client
+		req.Body = io.NopCloser(body)
+	}
+	if payloadHash == "" {
+		payloadHash = s3EmptySHA256
+	}
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if t.config.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", t.config.SessionToken)
+	}
+	signS3Request(req, t.config.AccessKey, t.config.SecretKey, t.config.Region, payloadHash, t.now())
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, errors.Errorf("s3 %s '%s', %v", method, key, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, errS3NotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, errors.Errorf("s3 %s '%s' returned status %s, %s", method, key, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+func (t *s3Client) put(key string, body io.Reader, size int64, payloadHash string) error {
+	resp, err := t.do(http.MethodPut, key, nil, body, size, payloadHash)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (t *s3Client) get(key string) (io.ReadCloser, error) {
+	resp, err := t.do(http.MethodGet, key, nil, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (t *s3Client) delete(key string) error {
+	resp, err := t.do(http.MethodDelete, key, nil, nil, 0, "")
+	if err == errS3NotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+type s3InitiateResult struct {
+	UploadID  string  `xml:"UploadId"`
+}
+
+type s3CompletedPart struct {
+	PartNumber  int     `xml:"PartNumber"`
+	ETag        string  `xml:"ETag"`
+}
+
+type s3CompleteUpload struct {
+	XMLName  xml.Name           `xml:"CompleteMultipartUpload"`
+	Parts    []s3CompletedPart  `xml:"Part"`
+}
+
+// complete returns the error in the body of the successful response
+type s3CompleteResult struct {
+	XMLName  xml.Name
+	Code     string  `xml:"Code"`
+	Message  string  `xml:"Message"`
+}
+
+func (t *s3Client) createMultipart(key string) (string, error) {
+	resp, err := t.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, 0, "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result s3InitiateResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", errors.Errorf("s3 create multipart upload '%s', %v", key, err)
+	}
+	if result.UploadID == "" {
+		return "", errors.Errorf("s3 create multipart upload '%s', empty upload id", key)
+	}
+	return result.UploadID, nil
+}
+
+func (t *s3Client) uploadPart(key, uploadID string, number int, body io.Reader, size int64, payloadHash string) (string, error) {
+	query := url.Values{"partNumber": {fmt.Sprint(number)}, "uploadId": {uploadID}}
+	resp, err := t.do(http.MethodPut, key, query, body, size, payloadHash)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		return "", errors.Errorf("s3 upload part %d of '%s', no ETag", number, key)
+	}
+	return etag, nil
+}
+
+func (t *s3Client) completeMultipart(key, uploadID string, parts []s3CompletedPart) error {
+	body, err := xml.Marshal(&s3CompleteUpload{Parts: parts})
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(body)
+	resp, err := t.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, bytes.NewReader(body), int64(len(body)), hex.EncodeToString(hash[:]))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result s3CompleteResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return errors.Errorf("s3 complete multipart upload '%s', %v", key, err)
+	}
+	if result.XMLName.Local == "Error" {
+		return errors.Errorf("s3 complete multipart upload '%s', %s %s", key, result.Code, result.Message)
+	}
+	return nil
+}
+
+func (t *s3Client) abortMultipart(key, uploadID string) error {
+	resp, err := t.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, 0, "")
+	if err == errS3NotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+type s3ListResult struct {
+	IsTruncated            bool    `xml:"IsTruncated"`
+	NextContinuationToken  string  `xml:"NextContinuationToken"`
+	CommonPrefixes         []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+/**
+Returns names of the directories under the prefix by ListObjectsV2
+ */
+func (t *s3Client) listDirs(prefix string) ([]string, error) {
+
+	var dirs []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "delimiter": {"/"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		// list is the request to the bucket itself
+		resp, err := t.do(http.MethodGet, "", query, nil, 0, "")
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Errorf("s3 list '%s', %v", prefix, err)
+		}
+		for _, p := range result.CommonPrefixes {
+			dirs = append(dirs, strings.TrimSuffix(strings.TrimPrefix(p.Prefix, prefix), "/"))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return dirs, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+/**
+Signs the request by AWS Signature Version 4, all headers of the request and the host are signed
+ */
+func signS3Request(req *http.Request, accessKey, secretKey, region, payloadHash string, now time.Time) {
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("x-amz-date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4" + secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=" + accessKey + "/" + scope +
+		", SignedHeaders=" + signedHeaders + ", Signature=" + signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, awsURIEncode(k, true) + "=" + awsURIEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+/**
+Percent-encodes everything except unreserved characters, the slash is kept in paths
+ */
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
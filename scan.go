@@ -6,12 +6,39 @@
 package raftmod
 
 var RaftServices = []interface{}{
+	RaftBadgerStoreHolder(),
+	RaftBoltStoreHolder(),
+	RaftWALStoreHolder(),
 	RaftLogStoreFactory(),
 	RaftStableStoreFactory(),
+	RaftKeyResolver(),
 	RaftSnapshotFactory(),
+	NodeMetadataStore(),
 	SerfConfigFactory(),
 	ServerLookup(),
+	ClusterEventBus(),
 	SerfRPCServer(),
+	DNSSRVDiscovery(),
 	RaftServer(),
 	RaftClientPool(),
+	LeaderExecPublisher(),
+	LeaderWebhookPublisher(),
+	LeaderDNSPublisher(),
+	LeaderEndpointPublisher(),
+	ConsulRegistrar(),
+	SnapshotScheduler(),
+	BadgerValueLogGC(),
+}
+
+/**
+Services of the gossip-only client agent, requires 'raft.role=client'
+ */
+var RaftClientServices = []interface{}{
+	SerfConfigFactory(),
+	ServerLookup(),
+	ServerLookupHandler(),
+	ClusterEventBus(),
+	SerfRPCServer(),
+	DNSSRVDiscovery(),
+	RaftClientPool(),
 }
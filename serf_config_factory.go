@@ -6,16 +6,19 @@
 package raftmod
 
 import (
+	"crypto/tls"
 	"fmt"
 	"github.com/codeallergy/glue"
 	"github.com/hashicorp/serf/serf"
 	"github.com/pkg/errors"
 	"github.com/sprintframework/sprint"
 	"go.uber.org/zap"
+	"net"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strconv"
+	"time"
 )
 
 var SerfConfigClass = reflect.TypeOf((*serf.Config)(nil))
@@ -27,14 +30,42 @@ type implSerfConfigFactory struct {
 
 	Application     sprint.Application  `inject`
 	NodeService     sprint.NodeService  `inject`
+	TlsConfig       *tls.Config         `inject:"optional"`
 
+	/**
+	Gossip bind address, IP or interface name, single one as memberlist binds single address
+	 */
 	SerfAddress  string            `value:"serf.bind-address,default="`
+
+	/**
+	Gossip address reachable by other nodes behind NAT or in overlay networks, IP or interface name,
+	zero port advertises the bind port, the port is adjusted by the node sequence as the bind one
+	 */
+	SerfAdvertiseAddress  string   `value:"serf.advertise-address,default="`
+	SerfAdvertisePort     int      `value:"serf.advertise-port,default=0"`
 	RaftAddress  string            `value:"raft.bind-address,default="`
 	RPCBean      string            `value:"raft.rpc-bean-name,default="`
+	RaftRole     string            `value:"raft.role,default=server"`
+	RaftProtocol int               `value:"raft-server.protocol-version,default=3"`
+	TLSMode      string            `value:"raft.tls-mode,default=auto"`
+	Compression  string            `value:"raft.compression,default=none"`
+	TLSCertFile  string            `value:"raft.tls.cert-file,default="`
+	SnapshotResume bool            `value:"raft.snapshot-resume,default=false"`
+
+	/**
+	Coalescing of member and user events, zero periods disable it, each period needs its quiescent pair
+	 */
+	CoalescePeriod       time.Duration  `value:"serf.coalesce-period,default=0"`
+	QuiescentPeriod      time.Duration  `value:"serf.quiescent-period,default=0"`
+	UserCoalescePeriod   time.Duration  `value:"serf.user-coalesce-period,default=0"`
+	UserQuiescentPeriod  time.Duration  `value:"serf.user-quiescent-period,default=0"`
 
 	DataDir           string       `value:"application.data.dir,default="`
 	DataDirPerm       os.FileMode  `value:"application.perm.data.dir,default=-rwxrwx---"`
 	DataFilePerm      os.FileMode  `value:"application.perm.data.file,default=-rw-rw-r--"`
+	PermMode          string       `value:"application.perm.mode,default=auto"`
+	PermUID           int          `value:"application.perm.uid,default=-1"`
+	PermGID           int          `value:"application.perm.gid,default=-1"`
 
 }
 
@@ -46,24 +77,29 @@ func (t *implSerfConfigFactory) Object() (object interface{}, err error) {
 
 	defer panicToError(&err)
 
+	perm, err := newDataDirPerm(t.DataDirPerm, t.PermMode, t.PermUID, t.PermGID)
+	if err != nil {
+		return nil, err
+	}
+
 	dataDir := t.DataDir
 	if dataDir == "" {
 		dataDir = filepath.Join(t.Application.ApplicationDir(), "db")
 
-		if err := createDirIfNeeded(dataDir, t.DataDirPerm); err != nil {
+		if err := createDirIfNeeded(dataDir, perm); err != nil {
 			return nil, err
 		}
 
 		dataDir = filepath.Join(dataDir, t.NodeService.LocalName())
 	}
 
-	if err := createDirIfNeeded(dataDir, t.DataDirPerm); err != nil {
+	if err := createDirIfNeeded(dataDir, perm); err != nil {
 		return nil, err
 	}
 
 	snapshotFolder := filepath.Join(dataDir, "serf")
 
-	if err := createDirIfNeeded(snapshotFolder, t.DataDirPerm); err != nil {
+	if err := createDirIfNeeded(snapshotFolder, perm); err != nil {
 		return nil, err
 	}
 
@@ -80,30 +116,103 @@ func (t *implSerfConfigFactory) Object() (object interface{}, err error) {
 	conf.Tags["version"] = t.Application.Version()
 	conf.Tags["build"] = t.Application.Build()
 
+	switch t.RaftRole {
+	case RaftRoleServer, RaftRoleClient:
+		conf.Tags[RaftRoleTag] = t.RaftRole
+	default:
+		return nil, errors.Errorf("invalid property 'raft.role' value '%s', expected '%s' or '%s'", t.RaftRole, RaftRoleServer, RaftRoleClient)
+	}
+
 	if t.SerfAddress == "" {
 		return nil, errors.New("required property 'serf.bind-address' is empty")
 	}
 
-	tcpAddr, err := ParseAndAdjustTCPAddr(t.SerfAddress, t.NodeService.NodeSeq())
+	serfAddrs, err := ResolveBindAddresses(t.SerfAddress, t.NodeService.NodeSeq())
 	if err != nil {
 		return nil, errors.Errorf("issue in property 'serf.bind-address', %v", err)
 	}
+	if len(serfAddrs) > 1 {
+		// memberlist binds single address, the rest would be silently ignored
+		return nil, errors.Errorf("property 'serf.bind-address' must have single address instead of '%s'", t.SerfAddress)
+	}
+	tcpAddr := serfAddrs[0]
+
+	if (t.CoalescePeriod > 0) != (t.QuiescentPeriod > 0) {
+		return nil, errors.New("properties 'serf.coalesce-period' and 'serf.quiescent-period' must be both positive or zero")
+	}
+	if (t.UserCoalescePeriod > 0) != (t.UserQuiescentPeriod > 0) {
+		return nil, errors.New("properties 'serf.user-coalesce-period' and 'serf.user-quiescent-period' must be both positive or zero")
+	}
+	conf.CoalescePeriod = t.CoalescePeriod
+	conf.QuiescentPeriod = t.QuiescentPeriod
+	conf.UserCoalescePeriod = t.UserCoalescePeriod
+	conf.UserQuiescentPeriod = t.UserQuiescentPeriod
 
 	memberConfig := conf.MemberlistConfig
 
 	memberConfig.BindAddr = tcpAddr.IP.String()
 	memberConfig.BindPort = tcpAddr.Port
 
-	conf.Tags["port"] = strconv.Itoa(tcpAddr.Port)
-
-	if t.RaftAddress != "" {
-		raftPort, err := getPortNumber(t.RaftAddress)
+	if t.SerfAdvertiseAddress != "" {
+		ip, ok, err := interfaceIP(t.SerfAdvertiseAddress)
 		if err != nil {
-			return nil, errors.Errorf("invalid port in property 'raft.bind-address', %v", err)
+			return nil, errors.Errorf("issue in property 'serf.advertise-address', %v", err)
+		}
+		if !ok {
+			if ip = net.ParseIP(t.SerfAdvertiseAddress); ip == nil {
+				return nil, errors.Errorf("invalid property 'serf.advertise-address' value '%s', expected IP or interface name", t.SerfAdvertiseAddress)
+			}
+		}
+		memberConfig.AdvertiseAddr = ip.String()
+		memberConfig.AdvertisePort = tcpAddr.Port
+	}
+	if t.SerfAdvertisePort < 0 || t.SerfAdvertisePort > 65535 {
+		return nil, errors.Errorf("invalid property 'serf.advertise-port' value %d", t.SerfAdvertisePort)
+	}
+	if t.SerfAdvertisePort > 0 {
+		// memberlist ignores the advertise port without the advertise address
+		if memberConfig.AdvertiseAddr == "" {
+			ip := tcpAddr.IP
+			if ip.IsUnspecified() {
+				if ip, err = PrivateIP(); err != nil {
+					return nil, errors.Errorf("advertise address for property 'serf.advertise-port', %v", err)
+				}
+			}
+			memberConfig.AdvertiseAddr = ip.String()
+		}
+		memberConfig.AdvertisePort = t.SerfAdvertisePort + t.NodeService.NodeSeq()
+	}
+
+	advertisePort := tcpAddr.Port
+	if memberConfig.AdvertisePort > 0 {
+		advertisePort = memberConfig.AdvertisePort
+	}
+	conf.Tags["port"] = strconv.Itoa(advertisePort)
+
+	if t.RaftAddress != "" && t.RaftRole == RaftRoleServer {
+		if path, ok := unixSocketPath(t.RaftAddress); ok {
+			conf.Tags["raft-port"] = "0"
+			conf.Tags[RaftUnixTag] = path
+		} else {
+			raftPort, err := getPortNumber(primaryBindAddress(t.RaftAddress))
+			if err != nil {
+				return nil, errors.Errorf("invalid port in property 'raft.bind-address', %v", err)
+			}
+			conf.Tags["raft-port"] = strconv.Itoa(raftPort)
+		}
+		conf.Tags[RaftVersionTag] = strconv.Itoa(t.RaftProtocol)
+		if (t.TlsConfig != nil || t.TLSCertFile != "") && t.TLSMode != TLSModePlain {
+			conf.Tags[RaftTLSTag] = "true"
+		}
+		if t.Compression != "" && t.Compression != CompressionNone {
+			conf.Tags[RaftCompressTag] = t.Compression
+		}
+		if t.SnapshotResume {
+			conf.Tags[RaftSnapshotResumeTag] = "true"
 		}
-		conf.Tags["raft-port"] = strconv.Itoa(raftPort)
 	}
 
+	// the gRPC server keeps its own port with 'raft.shared-port', clients find the API there
 	if t.RPCBean != "" {
 		propName := fmt.Sprintf("%s.%s", t.RPCBean, "bind-address")
 		value := t.Properties.GetString(propName, "")
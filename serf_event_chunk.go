@@ -0,0 +1,222 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/hashicorp/serf/serf"
+	"github.com/pkg/errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ChunkEventSuffix marks user events carrying the part of the larger payload
+	ChunkEventSuffix = "~chunk"
+
+	// reserved bytes for the serf message encoding of the user event
+	userEventOverhead = 64
+
+	// chunk header: 8 bytes id, 2 bytes sequence number, 2 bytes total number of chunks
+	chunkHeaderSize = 12
+
+	maxChunks = 1<<16 - 1
+
+	// UserEventSizeLimit of serf.DefaultConfig
+	defaultUserEventSizeLimit = 512
+
+	// default of the 'serf.max-chunked-payload' property
+	DefaultMaxChunkedPayload = 1 << 20
+
+	// payloads assembled at the same time, chunks of the other payloads are rejected until they complete or expire
+	maxPendingEvents = 16
+)
+
+/**
+Error returned when the user event does not fit in the serf size limit
+ */
+type EventSizeError struct {
+	Name   string
+	Size   int
+	Limit  int
+}
+
+func (e *EventSizeError) Error() string {
+	return fmt.Sprintf("user event '%s' size %d bytes exceeds limit of %d bytes", e.Name, e.Size, e.Limit)
+}
+
+/**
+Checks that the event name and payload fit in the limit with the encoding overhead
+ */
+func ValidateEventSize(name string, payload []byte, limit int) error {
+	size := len(name) + len(payload) + userEventOverhead
+	if size > limit {
+		return &EventSizeError{Name: name, Size: size, Limit: limit}
+	}
+	return nil
+}
+
+/**
+Splits payload in the chunk events fitting in the limit, every chunk payload has the header with the
+random id of the whole payload, sequence number and total number of chunks.
+ */
+func SplitEvent(name string, payload []byte, limit int) ([][]byte, error) {
+
+	chunkName := name + ChunkEventSuffix
+	capacity := chunkCapacity(name, limit)
+	if capacity <= 0 {
+		return nil, &EventSizeError{Name: chunkName, Size: len(chunkName) + userEventOverhead + chunkHeaderSize, Limit: limit}
+	}
+
+	total := (len(payload) + capacity - 1) / capacity
+	if total == 0 {
+		total = 1
+	}
+	if total > maxChunks {
+		return nil, &EventSizeError{Name: name, Size: len(payload), Limit: capacity * maxChunks}
+	}
+
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, 0, total)
+	for seq := 0; seq < total; seq++ {
+		from := seq * capacity
+		to := from + capacity
+		if to > len(payload) {
+			to = len(payload)
+		}
+		chunk := make([]byte, chunkHeaderSize + to - from)
+		copy(chunk, id[:])
+		binary.BigEndian.PutUint16(chunk[8:], uint16(seq))
+		binary.BigEndian.PutUint16(chunk[10:], uint16(total))
+		copy(chunk[chunkHeaderSize:], payload[from:to])
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+// payload bytes of the single chunk of the event
+func chunkCapacity(name string, limit int) int {
+	return limit - len(name) - len(ChunkEventSuffix) - userEventOverhead - chunkHeaderSize
+}
+
+/**
+Collects chunk events and returns the whole payload when all chunks received.
+Incomplete payloads are dropped after the TTL. Any gossip member can send chunks,
+so the number of chunks is bounded by the max payload and the number of pending payloads and their bytes are capped.
+ */
+type EventAssembler struct {
+	ttl          time.Duration
+	limit        int
+	maxPayload   int
+	maxBuffered  int
+	mutex        sync.Mutex
+	pending      map[string]*pendingEvent
+	buffered     int
+}
+
+type pendingEvent struct {
+	created  time.Time
+	total    int
+	chunks   map[int][]byte
+	size     int
+}
+
+/**
+Limit is the serf user event size limit of the senders, maxPayload is the 'serf.max-chunked-payload' of the senders
+ */
+func NewEventAssembler(ttl time.Duration, limit, maxPayload int) *EventAssembler {
+	return &EventAssembler{
+		ttl:         ttl,
+		limit:       limit,
+		maxPayload:  maxPayload,
+		maxBuffered: maxPendingEvents / 4 * maxPayload,
+		pending:     make(map[string]*pendingEvent),
+	}
+}
+
+/**
+Adds chunk event, returns the original event name and payload when all chunks received
+ */
+func (t *EventAssembler) Add(event serf.UserEvent) (string, []byte, bool, error) {
+
+	if !strings.HasSuffix(event.Name, ChunkEventSuffix) {
+		return event.Name, event.Payload, true, nil
+	}
+	name := event.Name[:len(event.Name) - len(ChunkEventSuffix)]
+
+	if len(event.Payload) < chunkHeaderSize {
+		return name, nil, false, errors.Errorf("chunk of event '%s' is too short", name)
+	}
+	seq := int(binary.BigEndian.Uint16(event.Payload[8:]))
+	total := int(binary.BigEndian.Uint16(event.Payload[10:]))
+	if total == 0 || seq >= total {
+		return name, nil, false, errors.Errorf("chunk of event '%s' has invalid sequence %d/%d", name, seq, total)
+	}
+	data := event.Payload[chunkHeaderSize:]
+	capacity := chunkCapacity(name, t.limit)
+	if capacity <= 0 || len(data) > capacity {
+		return name, nil, false, errors.Errorf("chunk of event '%s' exceeds %d bytes", name, capacity)
+	}
+	// SplitEvent never produces more chunks for the payload within the max size
+	if maxTotal := (t.maxPayload + capacity - 1) / capacity; total > maxTotal && total > 1 {
+		return name, nil, false, errors.Errorf("chunk of event '%s' has total %d above %d for the max payload %d bytes", name, total, maxTotal, t.maxPayload)
+	}
+	key := name + ":" + string(event.Payload[:8])
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	for k, p := range t.pending {
+		if now.Sub(p.created) > t.ttl {
+			t.remove(k, p)
+		}
+	}
+
+	p, ok := t.pending[key]
+	if !ok {
+		if len(t.pending) >= maxPendingEvents {
+			return name, nil, false, errors.Errorf("chunk of event '%s' is rejected, %d payloads are already pending", name, len(t.pending))
+		}
+		p = &pendingEvent{created: now, total: total, chunks: make(map[int][]byte)}
+		t.pending[key] = p
+	}
+	if p.total != total {
+		t.remove(key, p)
+		return name, nil, false, errors.Errorf("chunk of event '%s' has inconsistent total %d", name, total)
+	}
+	if _, ok := p.chunks[seq]; !ok {
+		if t.buffered + len(data) > t.maxBuffered {
+			return name, nil, false, errors.Errorf("chunk of event '%s' is rejected, pending payloads exceed %d bytes", name, t.maxBuffered)
+		}
+		p.chunks[seq] = data
+		p.size += len(data)
+		t.buffered += len(data)
+	}
+	if len(p.chunks) < total {
+		return name, nil, false, nil
+	}
+
+	t.remove(key, p)
+	payload := make([]byte, 0, p.size)
+	for i := 0; i < total; i++ {
+		payload = append(payload, p.chunks[i]...)
+	}
+	return name, payload, true, nil
+}
+
+func (t *EventAssembler) remove(key string, p *pendingEvent) {
+	delete(t.pending, key)
+	t.buffered -= p.size
+}
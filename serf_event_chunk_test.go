@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/hashicorp/serf/serf"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestEventChunks(t *testing.T) {
+
+	payload := bytes.Repeat([]byte("0123456789"), 200)
+
+	err := ValidateEventSize("app:test", payload, 512)
+	require.Error(t, err)
+	_, ok := err.(*EventSizeError)
+	require.True(t, ok)
+
+	chunks, err := SplitEvent("app:test", payload, 512)
+	require.NoError(t, err)
+	require.True(t, len(chunks) > 1)
+
+	assembler := NewEventAssembler(time.Minute, 512, DefaultMaxChunkedPayload)
+
+	// deliver in reverse order
+	for i := len(chunks) - 1; i >= 0; i-- {
+		require.NoError(t, ValidateEventSize("app:test" + ChunkEventSuffix, chunks[i], 512))
+		name, result, complete, err := assembler.Add(serf.UserEvent{Name: "app:test" + ChunkEventSuffix, Payload: chunks[i]})
+		require.NoError(t, err)
+		require.Equal(t, "app:test", name)
+		require.Equal(t, i == 0, complete)
+		if complete {
+			require.True(t, bytes.Equal(payload, result))
+		}
+	}
+
+}
+
+func spoofedChunk(id byte, seq, total int, size int) serf.UserEvent {
+	payload := make([]byte, chunkHeaderSize + size)
+	payload[0] = id
+	binary.BigEndian.PutUint16(payload[8:], uint16(seq))
+	binary.BigEndian.PutUint16(payload[10:], uint16(total))
+	return serf.UserEvent{Name: "app:test" + ChunkEventSuffix, Payload: payload}
+}
+
+func TestEventChunksLimits(t *testing.T) {
+
+	// 422 bytes per chunk at the limit 512, so the payload of 4096 bytes is at most 10 chunks
+	assembler := NewEventAssembler(time.Minute, 512, 4096)
+
+	_, _, _, err := assembler.Add(spoofedChunk(1, 0, 65535, 1))
+	require.Error(t, err)
+	_, _, _, err = assembler.Add(spoofedChunk(1, 0, 11, 1))
+	require.Error(t, err)
+	_, _, _, err = assembler.Add(spoofedChunk(1, 0, 10, 423))
+	require.Error(t, err)
+	require.Equal(t, 0, len(assembler.pending))
+
+	for i := 0; i < maxPendingEvents; i++ {
+		_, _, complete, err := assembler.Add(spoofedChunk(byte(i), 0, 10, 1))
+		require.NoError(t, err)
+		require.False(t, complete)
+	}
+	_, _, _, err = assembler.Add(spoofedChunk(maxPendingEvents, 0, 10, 1))
+	require.Error(t, err)
+
+	// buffered bytes are capped below the pending payloads times max payload
+	assembler = NewEventAssembler(time.Minute, 512, 4096)
+	var n int
+	for id := 0; err == nil; id++ {
+		for seq := 0; seq < 9 && err == nil; seq++ {
+			_, _, _, err = assembler.Add(spoofedChunk(byte(id), seq, 10, 422))
+			if err == nil {
+				n += 422
+			}
+		}
+	}
+	require.True(t, n <= assembler.maxBuffered)
+	require.Equal(t, n, assembler.buffered)
+
+	// completed payload releases its bytes
+	assembler = NewEventAssembler(time.Minute, 512, 4096)
+	_, _, _, err = assembler.Add(spoofedChunk(1, 1, 2, 10))
+	require.NoError(t, err)
+	require.Equal(t, 10, assembler.buffered)
+	_, payload, complete, err := assembler.Add(spoofedChunk(1, 0, 2, 422))
+	require.NoError(t, err)
+	require.True(t, complete)
+	require.Equal(t, 432, len(payload))
+	require.Equal(t, 0, assembler.buffered)
+}
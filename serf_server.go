@@ -7,7 +7,6 @@ package raftmod
 
 import (
 	"crypto/tls"
-	"fmt"
 	"github.com/codeallergy/glue"
 	"github.com/go-errors/errors"
 	"github.com/hashicorp/go-hclog"
@@ -18,7 +17,10 @@ import (
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type implSerfServer struct {
@@ -44,6 +46,17 @@ type implSerfServer struct {
 
 	RPCAddress     string     `value:"serf.rpc-address,default=:8700"`
 
+	/**
+	Comma separated user event names emitted by the server that must never be coalesced
+	 */
+	NoCoalesceEvents  string  `value:"serf.user-coalesce-exclude,default="`
+	noCoalesce        map[string]bool
+
+	/**
+	Maximum payload of the chunked user event, receivers reject chunks of larger payloads
+	 */
+	MaxChunkedPayload  int    `value:"serf.max-chunked-payload,default=1048576"`
+
 	/**
 	RPCAuthKey is a key that can be set to optionally require that
 	RPC's provide an authentication key.
@@ -65,6 +78,11 @@ type implSerfServer struct {
 	 */
 	Interface string          `value:"serf.iface,default="`
 
+	/**
+	Budget of the leave propagation on shutdown
+	 */
+	LeaveTimeout  time.Duration  `value:"serf.shutdown-leave-timeout,default=5s"`
+
 	alive        atomic.Bool
 	shutdownOnce sync.Once
 	shutdownCh   chan struct{}
@@ -78,8 +96,15 @@ func SerfRPCServer() raftapi.SerfServer {
 }
 
 func (t *implSerfServer) PostConstruct() (err error) {
+	t.noCoalesce = make(map[string]bool)
+	for _, name := range strings.Split(t.NoCoalesceEvents, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			t.noCoalesce[name] = true
+		}
+	}
+
 	t.agentConfig = agent.DefaultConfig()
-	t.agentConfig.BindAddr = fmt.Sprintf("%s:%d", t.SerfConfig.MemberlistConfig.BindAddr, t.SerfConfig.MemberlistConfig.BindPort)
+	t.agentConfig.BindAddr = net.JoinHostPort(t.SerfConfig.MemberlistConfig.BindAddr, strconv.Itoa(t.SerfConfig.MemberlistConfig.BindPort))
 	t.agentConfig.RPCAddr = t.RPCAddress
 	t.agentConfig.RPCAuthKey = t.RPCAuthKey
 	t.agentConfig.EnableCompression = t.SerfConfig.MemberlistConfig.EnableCompression
@@ -112,7 +137,7 @@ func (t *implSerfServer) Bind() error {
 	if err != nil {
 		return err
 	}
-	t.RPCAddress = fmt.Sprintf("%s:%d", tcpAddr.IP.String(), tcpAddr.Port)
+	t.RPCAddress = tcpAddr.String()
 	t.agentConfig.RPCAddr = t.RPCAddress
 
 	// Setup the RPC listener
@@ -167,9 +192,7 @@ func (t *implSerfServer) Shutdown() (err error) {
 		}
 		if t.serfAgent != nil {
 
-			if err := t.serfAgent.Serf().Leave(); err != nil {
-				t.Log.Error("SerfLeave", zap.Error(err))
-			}
+			waitPhase(t.Log, "serf-leave", t.LeaveTimeout, t.serfAgent.Serf().Leave)
 
 			err = t.serfAgent.Shutdown()
 		}
@@ -203,3 +226,42 @@ func (t *implSerfServer) Destroy() error {
 	return nil
 }
 
+
+/**
+Emits user event after validation of the size limit, returns *EventSizeError if the event is too large
+ */
+func (t *implSerfServer) EmitEvent(name string, payload []byte, coalesce bool) error {
+	if !t.alive.Load() {
+		return errors.New("serf server is not running")
+	}
+	if err := ValidateEventSize(name, payload, t.SerfConfig.UserEventSizeLimit); err != nil {
+		return err
+	}
+	if coalesce && t.noCoalesce[name] {
+		coalesce = false
+	}
+	return t.serfAgent.UserEvent(name, payload, coalesce)
+}
+
+/**
+Emits payload larger than the user event size limit as the sequence of chunk events without coalescing,
+receivers use EventAssembler to restore the payload
+ */
+func (t *implSerfServer) EmitChunkedEvent(name string, payload []byte) error {
+	if ValidateEventSize(name, payload, t.SerfConfig.UserEventSizeLimit) == nil {
+		return t.EmitEvent(name, payload, false)
+	}
+	if len(payload) > t.MaxChunkedPayload {
+		return &EventSizeError{Name: name, Size: len(payload), Limit: t.MaxChunkedPayload}
+	}
+	chunks, err := SplitEvent(name, payload, t.SerfConfig.UserEventSizeLimit)
+	if err != nil {
+		return err
+	}
+	for i, chunk := range chunks {
+		if err := t.EmitEvent(name + ChunkEventSuffix, chunk, false); err != nil {
+			return errors.Errorf("emit chunk %d of %d for event '%s', %v", i+1, len(chunks), name, err)
+		}
+	}
+	return nil
+}
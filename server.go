@@ -7,6 +7,7 @@ package raftmod
 
 import (
 	"github.com/go-errors/errors"
+	"github.com/hashicorp/raft"
 	"github.com/hashicorp/serf/serf"
 	"github.com/sprintframework/raftapi"
 	"net"
@@ -14,11 +15,70 @@ import (
 )
 
 
+const (
+	// RaftRoleTag distinguishes raft servers from gossip-only client members
+	RaftRoleTag = "raft-role"
+
+	RaftRoleServer = "server"
+	RaftRoleClient = "client"
+)
+
+var ErrClientMember = errors.New("gossip-only client member")
+
+const (
+	// RaftTLSTag advertises that the raft transport of the server accepts TLS
+	RaftTLSTag = "raft-tls"
+
+	TLSModeAuto  = "auto"
+	TLSModeMixed = "mixed"
+	TLSModePlain = "plain"
+)
+
+// RaftVersionTag advertises raft protocol version of the server
+const RaftVersionTag = "raft-vsn"
+
+// RaftUnixTag advertises Unix domain socket path of the raft transport instead of 'raft-port'
+const RaftUnixTag = "raft-unix"
+
+// RaftCompressTag advertises compression codec accepted by the raft transport of the server
+const RaftCompressTag = "raft-compress"
+
+// ZoneTag groups members by the failure domain, for example availability zone or rack
+const ZoneTag = "zone"
+
+/**
+Checks that the member raft protocol version is compatible with the local one,
+raft servers are able to talk with the adjacent protocol versions only.
+Members without the tag are not validated.
+ */
+func CheckRaftProtocol(m serf.Member, local int) error {
+	vsnStr, ok := m.Tags[RaftVersionTag]
+	if !ok {
+		return nil
+	}
+	vsn, err := strconv.Atoi(vsnStr)
+	if err != nil {
+		return errors.Errorf("parsing '%s' tag '%s', %v", RaftVersionTag, vsnStr, err)
+	}
+	if vsn < int(raft.ProtocolVersionMin) || vsn > int(raft.ProtocolVersionMax) {
+		return errors.Errorf("member '%s' raft protocol version %d is not supported, supported range [%d, %d]", m.Name, vsn, raft.ProtocolVersionMin, raft.ProtocolVersionMax)
+	}
+	if vsn < local - 1 || vsn > local + 1 {
+		return errors.Errorf("member '%s' raft protocol version %d is incompatible with local version %d", m.Name, vsn, local)
+	}
+	return nil
+}
+
 func ParseServerTags(m serf.Member, role string) (*raftapi.Server, error) {
 	if m.Tags["role"] != role {
 		return nil, errors.Errorf("joining role '%s' whereas expected role '%s'", m.Tags["role"], role)
 	}
 
+	// members without the tag are raft servers of the previous versions
+	if m.Tags[RaftRoleTag] == RaftRoleClient {
+		return nil, ErrClientMember
+	}
+
 	portStr := m.Tags["port"]
 	port, err := strconv.Atoi(portStr)
 	if err != nil {
@@ -37,7 +97,11 @@ func ParseServerTags(m serf.Member, role string) (*raftapi.Server, error) {
 		return nil, errors.Errorf("parsing 'grpc-port' tag '%s', %v", grpcStr, err)
 	}
 
-	addr := &net.TCPAddr{IP: m.Addr, Port: port}
+	var addr net.Addr = &net.TCPAddr{IP: m.Addr, Port: port}
+	if path, ok := m.Tags[RaftUnixTag]; ok {
+		// co-located servers reach each other by the socket path
+		addr = &net.UnixAddr{Name: path, Net: "unix"}
+	}
 
 	server := &raftapi.Server{
 		Name:                m.Name,
@@ -53,3 +117,14 @@ func ParseServerTags(m serf.Member, role string) (*raftapi.Server, error) {
 	}
 	return server, nil
 }
+
+/**
+Raft transport address of the server built from the member IP and 'raft-port' tag
+ */
+func RaftServerAddress(server *raftapi.Server) raft.ServerAddress {
+	if tcpAddr, ok := server.Addr.(*net.TCPAddr); ok {
+		addr := &net.TCPAddr{IP: tcpAddr.IP, Port: server.RaftPort}
+		return raft.ServerAddress(addr.String())
+	}
+	return raft.ServerAddress(server.Addr.String())
+}
@@ -8,7 +8,11 @@ package raftmod
 import (
 	"fmt"
 	"github.com/hashicorp/raft"
+	"github.com/hashicorp/serf/cmd/serf/command/agent"
+	"github.com/hashicorp/serf/serf"
 	"github.com/sprintframework/raftapi"
+	"github.com/sprintframework/sprint"
+	"go.uber.org/zap"
 	"sync"
 )
 
@@ -65,4 +69,48 @@ func (t *implServerLookup) Servers() []*raftapi.Server {
 	return servers
 }
 
+/**
+Serf event handler keeping ServerLookup up to date on the gossip-only client agents,
+raft servers update the lookup in the raft server event handler
+ */
+type implServerLookupHandler struct {
+	Log             *zap.Logger            `inject`
+	Application     sprint.Application     `inject`
+	ServerLookup    raftapi.ServerLookup   `inject`
+	EventBus        ClusterEventPublisher  `inject:"optional"`
+}
+
+func ServerLookupHandler() agent.EventHandler {
+	return &implServerLookupHandler{}
+}
 
+func (t *implServerLookupHandler) HandleEvent(e serf.Event) {
+	me, ok := e.(serf.MemberEvent)
+	if !ok {
+		return
+	}
+	for _, m := range me.Members {
+		server, err := ParseServerTags(m, t.Application.Name())
+		if err != nil {
+			t.Log.Debug("ServerLookupHandler", zap.String("event", me.EventType().String()), zap.Error(err))
+			continue
+		}
+		var eventType ClusterEventType
+		switch me.EventType() {
+		case serf.EventMemberJoin:
+			t.ServerLookup.AddServer(server)
+			eventType = EventMemberJoined
+		case serf.EventMemberUpdate:
+			t.ServerLookup.AddServer(server)
+			eventType = EventMemberUpdated
+		case serf.EventMemberLeave, serf.EventMemberFailed, serf.EventMemberReap:
+			t.ServerLookup.RemoveServer(server)
+			eventType = EventMemberFailed
+		default:
+			continue
+		}
+		if t.EventBus != nil {
+			t.EventBus.Publish(&ClusterEvent{Type: eventType, ID: server.ID, Name: server.Name, Address: string(RaftServerAddress(server)), Status: server.Status})
+		}
+	}
+}
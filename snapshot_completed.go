@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"go.uber.org/zap"
+	"sync"
+)
+
+// completed snapshots waiting for the handlers, the next ones are dropped while the queue is full
+const snapshotNotifyQueue = 16
+
+/**
+Snapshot store invoking SnapshotCompletedHandler beans after the successful Close of each sink,
+every handler reads its own stream opened from the store
+ */
+type notifySnapshotStore struct {
+	raft.SnapshotStore
+
+	handlers    []SnapshotCompletedHandler
+	log         *zap.Logger
+	shutdownCh  <-chan struct{}
+
+	// handlers see one snapshot at a time in the order of completion
+	queue       chan string
+	once        sync.Once
+}
+
+func newNotifySnapshotStore(delegate raft.SnapshotStore, handlers []SnapshotCompletedHandler, log *zap.Logger, shutdownCh <-chan struct{}) *notifySnapshotStore {
+	return &notifySnapshotStore{
+		SnapshotStore: delegate,
+		handlers:      handlers,
+		log:           log,
+		shutdownCh:    shutdownCh,
+		queue:         make(chan string, snapshotNotifyQueue),
+	}
+}
+
+func (t *notifySnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration,
+	configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+
+	sink, err := t.SnapshotStore.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil {
+		return nil, err
+	}
+	return &notifySnapshotSink{SnapshotSink: sink, store: t}, nil
+}
+
+type notifySnapshotSink struct {
+	raft.SnapshotSink
+	store  *notifySnapshotStore
+}
+
+func (t *notifySnapshotSink) Close() error {
+	if err := t.SnapshotSink.Close(); err != nil {
+		return err
+	}
+	t.store.enqueue(t.ID())
+	return nil
+}
+
+func (t *notifySnapshotStore) enqueue(id string) {
+	t.once.Do(func() {
+		go t.run()
+	})
+	select {
+	case t.queue <- id:
+	default:
+		t.log.Warn("SnapshotCompletedDropped", zap.String("id", id), zap.Int("queue", snapshotNotifyQueue))
+	}
+}
+
+func (t *notifySnapshotStore) run() {
+	for {
+		select {
+		case id := <-t.queue:
+			for i, handler := range t.handlers {
+				t.invoke(i, id, handler)
+			}
+		case <-t.shutdownCh:
+			return
+		}
+	}
+}
+
+func (t *notifySnapshotStore) invoke(i int, id string, handler SnapshotCompletedHandler) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.log.Error("SnapshotCompletedHandler", zap.Int("handler", i), zap.String("id", id), zap.Any("recover", r))
+		}
+	}()
+
+	meta, reader, err := t.SnapshotStore.Open(id)
+	if err != nil {
+		// reaped or quarantined meanwhile
+		t.log.Warn("SnapshotCompletedOpen", zap.String("id", id), zap.Error(err))
+		return
+	}
+	defer reader.Close()
+
+	if err := handler.SnapshotCompleted(meta, reader); err != nil {
+		t.log.Error("SnapshotCompletedHandler", zap.Int("handler", i), zap.String("id", id), zap.Error(err))
+	}
+}
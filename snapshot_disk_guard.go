@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"go.uber.org/atomic"
+	"strconv"
+)
+
+// ErrSnapshotDiskSpace is returned when the data partition has no room for the next snapshot
+var ErrSnapshotDiskSpace = errors.New("not enough disk space for snapshot")
+
+/**
+Snapshot store refusing to create the sink when the free space of the snapshot directory is below
+the size of the last snapshot multiplied by the factor, the first snapshot is never refused
+ */
+type diskGuardSnapshotStore struct {
+	raft.SnapshotStore
+
+	dir        string
+	percent    int
+	freeSpace  func(dir string) (uint64, bool)
+
+	low       atomic.Bool
+	required  atomic.Uint64
+	free      atomic.Uint64
+}
+
+func newDiskGuardSnapshotStore(delegate raft.SnapshotStore, dir string, percent int) *diskGuardSnapshotStore {
+	return &diskGuardSnapshotStore{
+		SnapshotStore: delegate,
+		dir:           dir,
+		percent:       percent,
+		freeSpace:     diskFreeSpace,
+	}
+}
+
+func (t *diskGuardSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration,
+	configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	return t.SnapshotStore.Create(version, index, term, configuration, configurationIndex, trans)
+}
+
+func (t *diskGuardSnapshotStore) check() error {
+
+	list, err := t.SnapshotStore.List()
+	if err != nil || len(list) == 0 || list[0].Size <= 0 {
+		// nothing to estimate from, the store reports its own errors on Create
+		return nil
+	}
+	free, ok := t.freeSpace(t.dir)
+	if !ok {
+		return nil
+	}
+
+	required := uint64(list[0].Size) * uint64(t.percent) / 100
+	t.required.Store(required)
+	t.free.Store(free)
+	if free < required {
+		t.low.Store(true)
+		return errors.Wrapf(ErrSnapshotDiskSpace, "'%s' has %d bytes free whereas %d bytes are required by the last snapshot '%s' of %d bytes",
+			t.dir, free, required, list[0].ID, list[0].Size)
+	}
+	t.low.Store(false)
+	return nil
+}
+
+/**
+Reports whether the last snapshot was refused and the free and required bytes of that check
+ */
+func (t *diskGuardSnapshotStore) GetStats(cb func(name, value string) bool) {
+	cb("snapshot_disk_low", strconv.FormatBool(t.low.Load()))
+	if required := t.required.Load(); required > 0 {
+		cb("snapshot_disk_required", strconv.FormatUint(required, 10))
+		cb("snapshot_disk_free", strconv.FormatUint(t.free.Load(), 10))
+	}
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestDiskGuardSnapshotStore(t *testing.T) {
+
+	dir, err := os.MkdirTemp(os.TempDir(), "raftmodtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	snapshots, err := raft.NewFileSnapshotStore(dir, 5, os.Stderr)
+	require.NoError(t, err)
+
+	store := newDiskGuardSnapshotStore(snapshots, dir, 150)
+	free := uint64(0)
+	store.freeSpace = func(string) (uint64, bool) {
+		return free, true
+	}
+
+	// the first snapshot has nothing to estimate from
+	sink, err := store.Create(raft.SnapshotVersionMax, 100, 1, raft.Configuration{}, 0, nil)
+	require.NoError(t, err)
+	_, err = sink.Write(bytes.Repeat([]byte("x"), 1000))
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+
+	free = 1499
+	_, err = store.Create(raft.SnapshotVersionMax, 200, 1, raft.Configuration{}, 0, nil)
+	require.True(t, errors.Is(err, ErrSnapshotDiskSpace), err)
+
+	stats := make(map[string]string)
+	store.GetStats(func(name, value string) bool {
+		stats[name] = value
+		return true
+	})
+	require.Equal(t, "true", stats["snapshot_disk_low"])
+	require.Equal(t, "1500", stats["snapshot_disk_required"])
+
+	free = 1500
+	sink, err = store.Create(raft.SnapshotVersionMax, 200, 1, raft.Configuration{}, 0, nil)
+	require.NoError(t, err)
+	require.NoError(t, sink.Cancel())
+	require.False(t, store.low.Load())
+}
@@ -0,0 +1,351 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// names of the key providers in 'raft.snapshot-key-provider'
+const (
+	TokenKeyProviderName    = "token"
+	VaultKeyProviderName    = "vault"
+	GCPKMSKeyProviderName   = "gcp-kms"
+)
+
+// GCE metadata server issuing access tokens of the instance service account
+var gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+const (
+	// iterations of PBKDF2-HMAC-SHA256 recommended by OWASP
+	DefaultTokenKDFIterations = 600000
+	// bounds the work of the tampered header
+	maxTokenKDFIterations     = 10000000
+
+	tokenKDFPBKDF2SHA256 = byte(1)
+	// kdf id, iterations and salt precede the sealed data key
+	tokenKDFHeaderSize   = 1 + 4 + gcmSaltSize
+)
+
+/**
+Master key derived from the token of the property or prompt by PBKDF2-HMAC-SHA256 with the random salt,
+the salt and iterations are stored in the wrapped key of the snapshot header.
+The key is derived once per salt, new snapshots of the provider share the salt.
+ */
+type tokenKeyProvider struct {
+	token       string
+	iterations  int
+
+	mutex    sync.Mutex
+	salt     []byte
+	derived  map[string][]byte  // key - iterations and salt
+}
+
+func TokenKeyProvider(token string) KeyProvider {
+	return TokenKeyProviderKDF(token, DefaultTokenKDFIterations)
+}
+
+/**
+Token provider with the iterations of the key derivation for new snapshots, snapshots of any iterations are readable
+ */
+func TokenKeyProviderKDF(token string, iterations int) KeyProvider {
+	if iterations < 1 || iterations > maxTokenKDFIterations {
+		iterations = DefaultTokenKDFIterations
+	}
+	return &tokenKeyProvider{token: token, iterations: iterations, derived: make(map[string][]byte)}
+}
+
+func (t *tokenKeyProvider) KeyProviderName() string {
+	return TokenKeyProviderName
+}
+
+// legacy snapshots are encrypted by the single SHA-256 of the token
+func (t *tokenKeyProvider) masterKey() []byte {
+	h := sha256.New()
+	h.Write([]byte(t.token))
+	return h.Sum(nil)
+}
+
+func (t *tokenKeyProvider) derivedKey(header []byte) []byte {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	key, ok := t.derived[string(header)]
+	if !ok {
+		iterations := int(binary.BigEndian.Uint32(header[1:5]))
+		key = pbkdf2SHA256([]byte(t.token), header[5:], iterations, gcmKeySize)
+		t.derived[string(header)] = key
+	}
+	return key
+}
+
+func (t *tokenKeyProvider) WrapKey(dataKey, aad []byte) ([]byte, error) {
+	t.mutex.Lock()
+	if t.salt == nil {
+		salt := make([]byte, gcmSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			t.mutex.Unlock()
+			return nil, err
+		}
+		t.salt = salt
+	}
+	header := make([]byte, tokenKDFHeaderSize)
+	header[0] = tokenKDFPBKDF2SHA256
+	binary.BigEndian.PutUint32(header[1:5], uint32(t.iterations))
+	copy(header[5:], t.salt)
+	t.mutex.Unlock()
+
+	sealed, err := wrapDataKey(t.derivedKey(header), dataKey, aad)
+	if err != nil {
+		return nil, err
+	}
+	return append(header, sealed...), nil
+}
+
+func (t *tokenKeyProvider) UnwrapKey(wrapped, aad []byte) ([]byte, error) {
+	if len(wrapped) < tokenKDFHeaderSize {
+		return nil, errors.Wrap(ErrSnapshotIntegrity, "truncated wrapped key")
+	}
+	if wrapped[0] != tokenKDFPBKDF2SHA256 {
+		return nil, errors.Errorf("unknown key derivation function %d", wrapped[0])
+	}
+	if n := binary.BigEndian.Uint32(wrapped[1:5]); n == 0 || n > maxTokenKDFIterations {
+		return nil, errors.Wrapf(ErrSnapshotIntegrity, "invalid iterations %d of the key derivation", n)
+	}
+	// the header is authenticated by the derived key, tampered parameters fail to unwrap
+	return unwrapDataKey(t.derivedKey(wrapped[:tokenKDFHeaderSize]), wrapped[tokenKDFHeaderSize:], aad)
+}
+
+/**
+PBKDF2 of RFC 8018 with HMAC-SHA256
+ */
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	var counter [4]byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], block)
+		prf.Write(counter[:])
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+/**
+HashiCorp Vault transit secrets engine, the master key never leaves Vault.
+Data key is bound to the snapshot by the authenticated stream, transit keys do not need the derivation context.
+ */
+type vaultKeyProvider struct {
+	address  string
+	token    string
+	mount    string
+	key      string
+	client   *http.Client
+}
+
+func VaultKeyProvider(address, token, mount, key string, timeout time.Duration) (KeyProvider, error) {
+	if address == "" || token == "" || key == "" {
+		return nil, errors.New("vault address, token and transit key are required")
+	}
+	if !strings.Contains(address, "://") {
+		address = "https://" + address
+	}
+	if mount == "" {
+		mount = "transit"
+	}
+	return &vaultKeyProvider{
+		address: strings.TrimRight(address, "/"),
+		token:   token,
+		mount:   strings.Trim(mount, "/"),
+		key:     key,
+		client:  &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (t *vaultKeyProvider) KeyProviderName() string {
+	return VaultKeyProviderName
+}
+
+func (t *vaultKeyProvider) WrapKey(dataKey, aad []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	req := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dataKey)}
+	if err := t.call("encrypt", req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data.Ciphertext == "" {
+		return nil, errors.New("vault returned empty ciphertext")
+	}
+	return []byte(resp.Data.Ciphertext), nil
+}
+
+func (t *vaultKeyProvider) UnwrapKey(wrapped, aad []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := t.call("decrypt", map[string]string{"ciphertext": string(wrapped)}, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+func (t *vaultKeyProvider) call(op string, body interface{}, result interface{}) error {
+	path := "/v1/" + t.mount + "/" + op + "/" + t.key
+	return postJSON(t.client, t.address + path, "vault '" + path + "'", func(req *http.Request) error {
+		req.Header.Set("X-Vault-Token", t.token)
+		return nil
+	}, body, result)
+}
+
+/**
+Google Cloud KMS symmetric key, the access token is taken from the property or the GCE metadata server
+ */
+type gcpKMSKeyProvider struct {
+	key     string
+	token   string
+	client  *http.Client
+}
+
+func GCPKMSKeyProvider(key, token string, timeout time.Duration) (KeyProvider, error) {
+	if !strings.HasPrefix(key, "projects/") || !strings.Contains(key, "/cryptoKeys/") {
+		return nil, errors.Errorf("invalid cloud kms key '%s', expected 'projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>'", key)
+	}
+	return &gcpKMSKeyProvider{
+		key:    key,
+		token:  token,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (t *gcpKMSKeyProvider) KeyProviderName() string {
+	return GCPKMSKeyProviderName
+}
+
+func (t *gcpKMSKeyProvider) WrapKey(dataKey, aad []byte) ([]byte, error) {
+	var resp struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	req := map[string]string{
+		"plaintext":                   base64.StdEncoding.EncodeToString(dataKey),
+		"additionalAuthenticatedData": base64.StdEncoding.EncodeToString(aad),
+	}
+	if err := t.call("encrypt", req, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Ciphertext)
+}
+
+func (t *gcpKMSKeyProvider) UnwrapKey(wrapped, aad []byte) ([]byte, error) {
+	var resp struct {
+		Plaintext string `json:"plaintext"`
+	}
+	req := map[string]string{
+		"ciphertext":                  base64.StdEncoding.EncodeToString(wrapped),
+		"additionalAuthenticatedData": base64.StdEncoding.EncodeToString(aad),
+	}
+	if err := t.call("decrypt", req, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Plaintext)
+}
+
+func (t *gcpKMSKeyProvider) call(op string, body interface{}, result interface{}) error {
+	url := "https://cloudkms.googleapis.com/v1/" + t.key + ":" + op
+	return postJSON(t.client, url, "cloud kms '" + op + "'", func(req *http.Request) error {
+		token, err := t.accessToken()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer " + token)
+		return nil
+	}, body, result)
+}
+
+func (t *gcpKMSKeyProvider) accessToken() (string, error) {
+	if t.token != "" {
+		return t.token, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, gcpMetadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", errors.Errorf("gcp metadata token, %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("gcp metadata token returned status %s", resp.Status)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", errors.Errorf("gcp metadata token, %v", err)
+	}
+	return token.AccessToken, nil
+}
+
+func postJSON(client *http.Client, url, name string, auth func(req *http.Request) error, body interface{}, result interface{}) error {
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := auth(req); err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Errorf("%s, %v", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.Errorf("%s returned status %s, %s", name, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return errors.Errorf("%s, %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"go.uber.org/atomic"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/**
+Snapshot store tracking bytes written to in-flight sinks and limiting their write rate,
+both persisted snapshots of the FSM and snapshots installed from the leader are throttled
+ */
+type progressSnapshotStore struct {
+	raft.SnapshotStore
+
+	bytesPerSec  float64
+	closeCh      <-chan struct{}
+
+	mutex     sync.Mutex
+	inFlight  map[*progressSnapshotSink]bool
+}
+
+func newProgressSnapshotStore(delegate raft.SnapshotStore, bytesPerSec float64, closeCh <-chan struct{}) *progressSnapshotStore {
+	return &progressSnapshotStore{
+		SnapshotStore: delegate,
+		bytesPerSec:   bytesPerSec,
+		closeCh:       closeCh,
+		inFlight:      make(map[*progressSnapshotSink]bool),
+	}
+}
+
+func (t *progressSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration,
+	configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+
+	sink, err := t.SnapshotStore.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil {
+		return nil, err
+	}
+	s := &progressSnapshotSink{
+		SnapshotSink: sink,
+		store:        t,
+		limiter:      newBandwidthLimiter(t.bytesPerSec),
+		started:      time.Now(),
+	}
+	t.mutex.Lock()
+	t.inFlight[s] = true
+	t.mutex.Unlock()
+	return s, nil
+}
+
+func (t *progressSnapshotStore) done(s *progressSnapshotSink) {
+	t.mutex.Lock()
+	delete(t.inFlight, s)
+	t.mutex.Unlock()
+}
+
+/**
+Reports in-flight snapshots, the bytes written to them and the time of the oldest one
+ */
+func (t *progressSnapshotStore) GetStats(cb func(name, value string) bool) {
+	t.mutex.Lock()
+	var written int64
+	var started time.Time
+	for s := range t.inFlight {
+		written += s.written.Load()
+		if started.IsZero() || s.started.Before(started) {
+			started = s.started
+		}
+	}
+	count := len(t.inFlight)
+	t.mutex.Unlock()
+
+	cb("snapshot_in_flight", strconv.Itoa(count))
+	if count > 0 {
+		cb("snapshot_bytes_written", strconv.FormatInt(written, 10))
+		cb("snapshot_elapsed", time.Since(started).Truncate(time.Millisecond).String())
+	}
+}
+
+type progressSnapshotSink struct {
+	raft.SnapshotSink
+	store    *progressSnapshotStore
+	limiter  *bandwidthLimiter
+	started  time.Time
+	written  atomic.Int64
+}
+
+func (t *progressSnapshotSink) Write(p []byte) (int, error) {
+	// shutdown stops throttling, so the sink is closed without delay
+	t.limiter.Wait(len(p), t.store.closeCh)
+	n, err := t.SnapshotSink.Write(p)
+	t.written.Add(int64(n))
+	return n, err
+}
+
+func (t *progressSnapshotSink) Close() error {
+	defer t.store.done(t)
+	return t.SnapshotSink.Close()
+}
+
+func (t *progressSnapshotSink) Cancel() error {
+	defer t.store.done(t)
+	return t.SnapshotSink.Cancel()
+}
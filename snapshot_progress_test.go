@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestProgressSnapshotStore(t *testing.T) {
+
+	closeCh := make(chan struct{})
+	store := newProgressSnapshotStore(raft.NewInmemSnapshotStore(), 200 * 1024, closeCh)
+
+	stats := func() map[string]string {
+		m := make(map[string]string)
+		store.GetStats(func(name, value string) bool {
+			m[name] = value
+			return true
+		})
+		return m
+	}
+
+	sink, err := store.Create(raft.SnapshotVersionMax, 100, 1, raft.Configuration{}, 0, nil)
+	require.NoError(t, err)
+
+	start := time.Now()
+	chunk := make([]byte, 10 * 1024)
+	for i := 0; i < 10; i++ {
+		_, err = sink.Write(chunk)
+		require.NoError(t, err)
+	}
+	require.True(t, time.Since(start) >= 400 * time.Millisecond)
+
+	m := stats()
+	require.Equal(t, "1", m["snapshot_in_flight"])
+	require.Equal(t, "102400", m["snapshot_bytes_written"])
+
+	require.NoError(t, sink.Close())
+	m = stats()
+	require.Equal(t, "0", m["snapshot_in_flight"])
+	_, ok := m["snapshot_bytes_written"]
+	require.False(t, ok)
+
+	// shutdown stops throttling
+	sink, err = store.Create(raft.SnapshotVersionMax, 101, 1, raft.Configuration{}, 0, nil)
+	require.NoError(t, err)
+	close(closeCh)
+	start = time.Now()
+	_, err = sink.Write(make([]byte, 1024 * 1024))
+	require.NoError(t, err)
+	require.True(t, time.Since(start) < time.Second)
+	require.NoError(t, sink.Cancel())
+	require.Equal(t, "0", stats()["snapshot_in_flight"])
+}
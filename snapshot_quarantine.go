@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/raft"
+	"go.uber.org/zap"
+	"io"
+	"sync"
+)
+
+// metadata namespace of the snapshots failed to restore
+const snapshotQuarantineNamespace = "snapshot-quarantine"
+
+/**
+Snapshot store hiding snapshots which FSM failed to restore, so raft falls back to the previous
+retained snapshot with log replay instead of crash-looping on the same corrupt snapshot.
+Quarantined IDs are persisted in the metadata store if available.
+ */
+type quarantineSnapshotStore struct {
+	raft.SnapshotStore
+
+	log       *zap.Logger
+	logStore  raft.LogStore
+	meta      MetadataStore  // can be nil
+
+	mutex       sync.Mutex
+	quarantined map[string]bool
+}
+
+/**
+Reader of the opened snapshot carrying its ID to the FSM restore
+ */
+type quarantineReader struct {
+	io.ReadCloser
+	id  string
+}
+
+func newQuarantineSnapshotStore(delegate raft.SnapshotStore, logStore raft.LogStore, meta MetadataStore, log *zap.Logger) *quarantineSnapshotStore {
+	t := &quarantineSnapshotStore{
+		SnapshotStore: delegate,
+		log:           log,
+		logStore:      logStore,
+		meta:          meta,
+		quarantined:   make(map[string]bool),
+	}
+	if meta != nil {
+		ids, err := meta.List(snapshotQuarantineNamespace)
+		if err != nil {
+			log.Error("SnapshotQuarantineLoad", zap.Error(err))
+		}
+		for _, id := range ids {
+			t.quarantined[id] = true
+		}
+	}
+	return t
+}
+
+func (t *quarantineSnapshotStore) List() ([]*raft.SnapshotMeta, error) {
+	list, err := t.SnapshotStore.List()
+	if err != nil {
+		return nil, err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var result []*raft.SnapshotMeta
+	var skipped *raft.SnapshotMeta
+	for _, meta := range list {
+		if t.quarantined[meta.ID] {
+			if skipped == nil {
+				skipped = meta
+			}
+			continue
+		}
+		result = append(result, meta)
+	}
+
+	// list is sorted from the newest, fall back is possible only if logs after the previous snapshot are retained
+	if skipped != nil && len(result) > 0 && result[0].Index < skipped.Index {
+		first, err := t.logStore.FirstIndex()
+		if err == nil && first > result[0].Index + 1 {
+			t.log.Error("SnapshotFallbackImpossible", zap.String("quarantined", skipped.ID), zap.String("fallback", result[0].ID),
+				zap.Uint64("fallbackIndex", result[0].Index), zap.Uint64("firstLogIndex", first),
+				zap.String("action", "logs after the fallback snapshot are compacted, restore the node from the healthy peer"))
+		}
+	}
+
+	return result, nil
+}
+
+func (t *quarantineSnapshotStore) Open(id string) (*raft.SnapshotMeta, io.ReadCloser, error) {
+	meta, reader, err := t.SnapshotStore.Open(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return meta, &quarantineReader{ReadCloser: reader, id: id}, nil
+}
+
+/**
+Finds the ID of the snapshot opened by this store under the wrappers of raft
+ */
+func quarantineSnapshotID(reader io.ReadCloser) (string, bool) {
+	for reader != nil {
+		if r, ok := reader.(*quarantineReader); ok {
+			return r.id, true
+		}
+		wrapper, ok := reader.(raft.ReadCloserWrapper)
+		if !ok {
+			return "", false
+		}
+		reader = wrapper.WrappedReadCloser()
+	}
+	return "", false
+}
+
+func (t *quarantineSnapshotStore) quarantine(id string, restoreErr error) bool {
+	t.mutex.Lock()
+	if t.quarantined[id] {
+		t.mutex.Unlock()
+		return false
+	}
+	t.quarantined[id] = true
+	t.mutex.Unlock()
+
+	metrics.IncrCounter([]string{"raft", "snapshot", "quarantined"}, 1)
+	t.log.Named("audit").Error("SnapshotQuarantined", zap.String("id", id), zap.Error(restoreErr),
+		zap.String("action", "snapshot is skipped, falling back to the previous snapshot and log replay"))
+
+	if t.meta != nil {
+		if err := t.meta.Set(snapshotQuarantineNamespace, id, []byte(restoreErr.Error())); err != nil {
+			t.log.Error("SnapshotQuarantineStore", zap.String("id", id), zap.Error(err))
+		}
+	}
+	return true
+}
+
+/**
+FSM decorator reporting restore failures to the quarantine snapshot store
+ */
+type restoreGuardFSM struct {
+	raft.FSM
+	store    *quarantineSnapshotStore
+	onError  func(id string, err error)
+}
+
+type restoreGuardBatchingFSM struct {
+	*restoreGuardFSM
+	batching raft.BatchingFSM
+}
+
+func newRestoreGuardFSM(delegate raft.FSM, store *quarantineSnapshotStore, onError func(id string, err error)) raft.FSM {
+	fsm := &restoreGuardFSM{FSM: delegate, store: store, onError: onError}
+	if batching, ok := delegate.(raft.BatchingFSM); ok {
+		return &restoreGuardBatchingFSM{restoreGuardFSM: fsm, batching: batching}
+	}
+	return fsm
+}
+
+// raft opens the snapshot from the store for every restore, readers of other sources are not quarantined
+func (t *restoreGuardFSM) Restore(reader io.ReadCloser) error {
+	id, ok := quarantineSnapshotID(reader)
+	err := t.FSM.Restore(reader)
+	if err != nil && ok && t.store.quarantine(id, err) && t.onError != nil {
+		t.onError(id, err)
+	}
+	return err
+}
+
+func (t *restoreGuardBatchingFSM) ApplyBatch(logs []*raft.Log) []interface{} {
+	return t.batching.ApplyBatch(logs)
+}
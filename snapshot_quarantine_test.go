@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"testing"
+)
+
+type failingRestoreFSM struct {
+	recoverTestFSM
+	restored []string
+}
+
+func (t *failingRestoreFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	if string(data) == "corrupt" {
+		return errors.New("corrupt snapshot")
+	}
+	t.restored = append(t.restored, string(data))
+	return nil
+}
+
+// wrapper of raft passing the reader of the store to the FSM
+type wrappedTestReader struct {
+	io.ReadCloser
+}
+
+func (t wrappedTestReader) WrappedReadCloser() io.ReadCloser {
+	return t.ReadCloser
+}
+
+func TestQuarantineSnapshotStore(t *testing.T) {
+
+	dir, err := os.MkdirTemp(os.TempDir(), "raftmodtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	snapshots, err := raft.NewFileSnapshotStore(dir, 5, os.Stderr)
+	require.NoError(t, err)
+
+	create := func(index uint64, content string) string {
+		sink, err := snapshots.Create(raft.SnapshotVersionMax, index, 1, raft.Configuration{}, 0, nil)
+		require.NoError(t, err)
+		_, err = sink.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, sink.Close())
+		return sink.ID()
+	}
+	healthy := create(100, "healthy")
+	corrupt := create(200, "corrupt")
+
+	logs := raft.NewInmemStore()
+	meta := NewMetadataStore(raft.NewInmemStore())
+	store := newQuarantineSnapshotStore(snapshots, logs, meta, zap.NewNop())
+
+	var events []string
+	delegate := &failingRestoreFSM{}
+	fsm := newRestoreGuardFSM(delegate, store, func(id string, err error) {
+		events = append(events, id)
+	})
+
+	// the leader sends the healthy snapshot meanwhile
+	_, sending, err := store.Open(healthy)
+	require.NoError(t, err)
+	defer sending.Close()
+
+	_, reader, err := store.Open(corrupt)
+	require.NoError(t, err)
+	require.Error(t, fsm.Restore(wrappedTestReader{reader}))
+	require.Equal(t, []string{corrupt}, events)
+
+	list, err := store.List()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(list))
+	require.Equal(t, healthy, list[0].ID)
+
+	_, reader, err = store.Open(healthy)
+	require.NoError(t, err)
+	require.NoError(t, fsm.Restore(wrappedTestReader{reader}))
+	require.Equal(t, []string{"healthy"}, delegate.restored)
+
+	// readers of other sources are not quarantined
+	_, reader, err = snapshots.Open(healthy)
+	require.NoError(t, err)
+	delegate.restored = nil
+	require.NoError(t, fsm.Restore(reader))
+	require.Equal(t, []string{"healthy"}, delegate.restored)
+
+	// quarantine survives restart
+	store = newQuarantineSnapshotStore(snapshots, logs, meta, zap.NewNop())
+	list, err = store.List()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(list))
+	require.Equal(t, healthy, list[0].ID)
+}
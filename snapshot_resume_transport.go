@@ -0,0 +1,412 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// RaftSnapshotResumeTag advertises the resumable snapshot installation by the raft transport of the server
+const RaftSnapshotResumeTag = "raft-snap-resume"
+
+// prefix of the resumable snapshot stream, followed by the session, offset and total size,
+// the stream ends with SHA-256 of the whole snapshot
+var snapshotResumeMagic = []byte("RAFTRSM1")
+
+const (
+	snapshotStagingDir = "snapshot-resume"
+	snapshotResumeExt  = ".part"
+)
+
+/**
+Transport staging InstallSnapshot streams of the leaders advertising the extension on disk,
+interrupted transfer continues from the staged offset on the next attempt of the leader
+ */
+type resumableTransport struct {
+	*raft.NetworkTransport
+
+	dir         string
+	log         *zap.Logger
+	peerResume  func(address raft.ServerAddress) bool
+	peerOffset  func(id raft.ServerID, session string) (int64, error)
+	snapshotID  func(args *raft.InstallSnapshotRequest) (string, bool)
+	consumeCh   chan raft.RPC
+	shutdownCh  <-chan struct{}
+}
+
+func newResumableTransport(trans *raft.NetworkTransport, dir string, log *zap.Logger,
+	peerResume func(address raft.ServerAddress) bool,
+	peerOffset func(id raft.ServerID, session string) (int64, error),
+	snapshotID func(args *raft.InstallSnapshotRequest) (string, bool),
+	shutdownCh <-chan struct{}) (*resumableTransport, error) {
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Errorf("create snapshot staging dir '%s', %v", dir, err)
+	}
+
+	t := &resumableTransport{
+		NetworkTransport: trans,
+		dir:              dir,
+		log:              log,
+		peerResume:       peerResume,
+		peerOffset:       peerOffset,
+		snapshotID:       snapshotID,
+		consumeCh:        make(chan raft.RPC),
+		shutdownCh:       shutdownCh,
+	}
+	go t.consume()
+	return t, nil
+}
+
+/**
+Session of the snapshot transfer is the same for all attempts of the leader to install the snapshot,
+different snapshots at the same index have different IDs
+ */
+func snapshotSession(id string, args *raft.InstallSnapshotRequest) string {
+	sum := sha256.Sum256([]byte(id))
+	return fmt.Sprintf("%d-%d-%d-%s", args.LastLogTerm, args.LastLogIndex, args.Size, hex.EncodeToString(sum[:8]))
+}
+
+/**
+ID of the snapshot sent by raft, it is the latest one of the store with the index, term and size of the request
+ */
+func snapshotIDOf(store raft.SnapshotStore, args *raft.InstallSnapshotRequest) (string, bool) {
+	list, err := store.List()
+	if err != nil {
+		return "", false
+	}
+	for _, meta := range list {
+		if meta.Index == args.LastLogIndex && meta.Term == args.LastLogTerm && meta.Size == args.Size {
+			return meta.ID, true
+		}
+	}
+	return "", false
+}
+
+func validSession(session string) bool {
+	if session == "" || len(session) > 64 {
+		return false
+	}
+	for _, c := range session {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func encodeResumeHeader(session string, offset, total int64) []byte {
+	var buf bytes.Buffer
+	buf.Write(snapshotResumeMagic)
+	binary.Write(&buf, binary.BigEndian, uint16(len(session)))
+	buf.WriteString(session)
+	binary.Write(&buf, binary.BigEndian, uint64(offset))
+	binary.Write(&buf, binary.BigEndian, uint64(total))
+	return buf.Bytes()
+}
+
+func decodeResumeHeader(r io.Reader) (session string, offset, total int64, err error) {
+	var n uint16
+	if err = binary.Read(r, binary.BigEndian, &n); err != nil {
+		return
+	}
+	name := make([]byte, n)
+	if _, err = io.ReadFull(r, name); err != nil {
+		return
+	}
+	var off, size uint64
+	if err = binary.Read(r, binary.BigEndian, &off); err != nil {
+		return
+	}
+	if err = binary.Read(r, binary.BigEndian, &size); err != nil {
+		return
+	}
+	session, offset, total = string(name), int64(off), int64(size)
+	if !validSession(session) || offset < 0 || total < 0 || offset > total {
+		err = errors.Errorf("invalid resumable snapshot header, session '%s', offset %d, total %d", session, offset, total)
+	}
+	return
+}
+
+// InstallSnapshot implements the Transport interface.
+func (t *resumableTransport) InstallSnapshot(id raft.ServerID, target raft.ServerAddress, args *raft.InstallSnapshotRequest, resp *raft.InstallSnapshotResponse, data io.Reader) error {
+
+	if !t.peerResume(target) {
+		return t.NetworkTransport.InstallSnapshot(id, target, args, resp, data)
+	}
+
+	snapshotID, ok := t.snapshotID(args)
+	if !ok {
+		t.log.Debug("SnapshotResumeUnknown", zap.String("id", string(id)), zap.Uint64("index", args.LastLogIndex), zap.Uint64("term", args.LastLogTerm))
+		return t.NetworkTransport.InstallSnapshot(id, target, args, resp, data)
+	}
+
+	session := snapshotSession(snapshotID, args)
+	offset, err := t.peerOffset(id, session)
+	if err != nil || offset < 0 || offset > args.Size {
+		t.log.Debug("SnapshotResumeOffset", zap.String("id", string(id)), zap.String("session", session), zap.Int64("offset", offset), zap.Error(err))
+		offset = 0
+	}
+
+	// the digest covers the skipped bytes as well, the peer verifies the whole staged snapshot
+	digest := sha256.New()
+	data = io.TeeReader(data, digest)
+
+	if offset > 0 {
+		if _, err := io.CopyN(io.Discard, data, offset); err != nil {
+			return errors.Errorf("skip %d bytes of the snapshot, %v", offset, err)
+		}
+		t.log.Info("SnapshotResume", zap.String("id", string(id)), zap.String("session", session), zap.Int64("offset", offset), zap.Int64("size", args.Size))
+	}
+
+	header := encodeResumeHeader(session, offset, args.Size)
+	req := *args
+	req.Size = int64(len(header)) + args.Size - offset + sha256.Size
+	return t.NetworkTransport.InstallSnapshot(id, target, &req, resp, io.MultiReader(bytes.NewReader(header),
+		io.LimitReader(data, args.Size-offset), &digestReader{hash: digest}))
+}
+
+/**
+Reads the sum of the hash after the preceding readers of the stream are consumed
+ */
+type digestReader struct {
+	hash  hash.Hash
+	sum   []byte
+}
+
+func (t *digestReader) Read(p []byte) (int, error) {
+	if t.sum == nil {
+		t.sum = t.hash.Sum(nil)
+	}
+	if len(t.sum) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, t.sum)
+	t.sum = t.sum[n:]
+	return n, nil
+}
+
+// Consumer implements the Transport interface.
+func (t *resumableTransport) Consumer() <-chan raft.RPC {
+	return t.consumeCh
+}
+
+func (t *resumableTransport) consume() {
+	in := t.NetworkTransport.Consumer()
+	for {
+		select {
+		case rpc := <-in:
+			if _, ok := rpc.Command.(*raft.InstallSnapshotRequest); ok {
+				// staging of the large stream must not block other RPCs
+				go t.receiveSnapshot(rpc)
+				continue
+			}
+			t.forward(rpc)
+		case <-t.shutdownCh:
+			return
+		}
+	}
+}
+
+func (t *resumableTransport) forward(rpc raft.RPC) bool {
+	select {
+	case t.consumeCh <- rpc:
+		return true
+	case <-t.shutdownCh:
+		rpc.Respond(nil, raft.ErrTransportShutdown)
+		return false
+	}
+}
+
+func (t *resumableTransport) receiveSnapshot(rpc raft.RPC) {
+
+	req := rpc.Command.(*raft.InstallSnapshotRequest)
+	reader := bufio.NewReader(rpc.Reader)
+
+	magic, err := reader.Peek(len(snapshotResumeMagic))
+	if err != nil || !bytes.Equal(magic, snapshotResumeMagic) {
+		rpc.Reader = reader
+		t.forward(rpc)
+		return
+	}
+	reader.Discard(len(snapshotResumeMagic))
+
+	session, offset, total, err := decodeResumeHeader(reader)
+	if err != nil {
+		rpc.Respond(nil, err)
+		return
+	}
+
+	path := filepath.Join(t.dir, session + snapshotResumeExt)
+	file, err := t.openStaging(path, offset)
+	if err != nil {
+		t.log.Error("SnapshotResumeStaging", zap.String("session", session), zap.Error(err))
+		rpc.Respond(nil, err)
+		return
+	}
+
+	received, err := io.Copy(file, io.LimitReader(reader, total - offset))
+	if err == nil {
+		err = file.Sync()
+	} else {
+		file.Sync()
+	}
+	file.Close()
+
+	if err == nil && offset + received != total {
+		err = errors.Errorf("snapshot stream ended at %d of %d bytes", offset + received, total)
+	}
+	if err != nil {
+		// staged bytes are kept for the next attempt of the leader
+		t.log.Warn("SnapshotResumeInterrupted", zap.String("session", session), zap.Int64("staged", offset + received), zap.Int64("size", total), zap.Error(err))
+		rpc.Respond(nil, err)
+		return
+	}
+
+	if err := verifyStaging(path, reader); err != nil {
+		// the next attempt of the leader starts from the beginning
+		os.Remove(path)
+		t.log.Error("SnapshotResumeMismatch", zap.String("session", session), zap.Error(err))
+		rpc.Respond(nil, err)
+		return
+	}
+
+	staged, err := os.Open(path)
+	if err != nil {
+		rpc.Respond(nil, err)
+		return
+	}
+	defer func() {
+		staged.Close()
+		os.Remove(path)
+	}()
+
+	install := *req
+	install.Size = total
+	respCh := make(chan raft.RPCResponse, 1)
+	if !t.forward(raft.RPC{Command: &install, Reader: staged, RespChan: respCh}) {
+		rpc.Respond(nil, raft.ErrTransportShutdown)
+		return
+	}
+
+	select {
+	case resp := <-respCh:
+		rpc.Respond(resp.Response, resp.Error)
+	case <-t.shutdownCh:
+		rpc.Respond(nil, raft.ErrTransportShutdown)
+	}
+}
+
+/**
+Compares SHA-256 of the staged snapshot with the digest at the end of the stream
+ */
+func verifyStaging(path string, stream io.Reader) error {
+	expected := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(stream, expected); err != nil {
+		return errors.Errorf("read snapshot digest, %v", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return err
+	}
+	if !bytes.Equal(digest.Sum(nil), expected) {
+		return errors.New("staged snapshot does not match the digest of the leader")
+	}
+	return nil
+}
+
+/**
+Opens staging file positioned at the offset, the new session removes staging files of the previous ones
+ */
+func (t *resumableTransport) openStaging(path string, offset int64) (*os.File, error) {
+
+	if offset == 0 {
+		t.removeStaging(path)
+		return os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err == nil && fi.Size() < offset {
+		err = errors.Errorf("staged %d bytes are behind offset %d", fi.Size(), offset)
+	}
+	if err == nil {
+		// bytes beyond the offset are the same snapshot bytes written again
+		err = file.Truncate(offset)
+	}
+	if err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func (t *resumableTransport) removeStaging(except string) {
+	files, err := filepath.Glob(filepath.Join(t.dir, "*" + snapshotResumeExt))
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if file != except {
+			os.Remove(file)
+		}
+	}
+}
+
+/**
+Size of the staged snapshot of the session, zero if not staged
+ */
+func (t *resumableTransport) stagedOffset(session string) (int64, error) {
+	if !validSession(session) {
+		return 0, errors.Errorf("invalid snapshot session '%s'", session)
+	}
+	fi, err := os.Stat(filepath.Join(t.dir, session + snapshotResumeExt))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+/**
+Staged offset of the snapshot session on the peer, queried before each attempt to install the snapshot
+ */
+func (t *implRaftServer) stagedPeerOffset(id raft.ServerID, session string) (int64, error) {
+	member, ok := t.findMember(string(id))
+	if !ok {
+		return 0, errors.Errorf("server '%s' is not a serf member", id)
+	}
+	var offset int64
+	if err := t.queryNode(member.Name, "snapshot-offset", []byte(session), 0, &offset); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
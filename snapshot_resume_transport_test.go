@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResumeHeader(t *testing.T) {
+
+	header := encodeResumeHeader("7-1024-4096", 100, 4096)
+	require.True(t, bytes.HasPrefix(header, snapshotResumeMagic))
+
+	session, offset, total, err := decodeResumeHeader(bytes.NewReader(header[len(snapshotResumeMagic):]))
+	require.NoError(t, err)
+	require.Equal(t, "7-1024-4096", session)
+	require.Equal(t, int64(100), offset)
+	require.Equal(t, int64(4096), total)
+
+	_, _, _, err = decodeResumeHeader(bytes.NewReader(encodeResumeHeader("../x", 0, 1)[len(snapshotResumeMagic):]))
+	require.Error(t, err)
+
+	_, _, _, err = decodeResumeHeader(bytes.NewReader(encodeResumeHeader("1-2-3", 5, 3)[len(snapshotResumeMagic):]))
+	require.Error(t, err)
+}
+
+func TestResumeSession(t *testing.T) {
+
+	args := &raft.InstallSnapshotRequest{LastLogTerm: 7, LastLogIndex: 1024, Size: 4096}
+
+	first := snapshotSession("7-1024-1700000000000", args)
+	second := snapshotSession("7-1024-1700000000001", args)
+	require.True(t, validSession(first))
+	require.True(t, validSession(second))
+	require.NotEqual(t, first, second)
+	require.Equal(t, first, snapshotSession("7-1024-1700000000000", args))
+}
+
+func TestResumeDigest(t *testing.T) {
+
+	trans := &resumableTransport{
+		dir:        t.TempDir(),
+		log:        zap.NewNop(),
+		consumeCh:  make(chan raft.RPC, 1),
+		shutdownCh: make(chan struct{}),
+	}
+
+	session := "2-10-6-0123456789abcdef"
+	path := filepath.Join(trans.dir, session + snapshotResumeExt)
+
+	receive := func(offset int64, data string, snapshot string) error {
+		sum := sha256.Sum256([]byte(snapshot))
+		stream := append(encodeResumeHeader(session, offset, int64(len(snapshot))), data...)
+		stream = append(stream, sum[:]...)
+		respCh := make(chan raft.RPCResponse, 1)
+		trans.receiveSnapshot(raft.RPC{Command: &raft.InstallSnapshotRequest{}, Reader: bytes.NewReader(stream), RespChan: respCh})
+		return (<-respCh).Error
+	}
+
+	// staged bytes of another snapshot with the same index
+	require.NoError(t, os.WriteFile(path, []byte("abX"), 0600))
+	require.Error(t, receive(3, "def", "abcdef"))
+	_, err := os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+
+	require.NoError(t, os.WriteFile(path, []byte("abc"), 0600))
+	go func() {
+		rpc := <-trans.consumeCh
+		content, err := io.ReadAll(rpc.Reader)
+		if err == nil && string(content) != "abcdef" {
+			err = io.ErrUnexpectedEOF
+		}
+		rpc.Respond(&raft.InstallSnapshotResponse{Success: true}, err)
+	}()
+	require.NoError(t, receive(3, "def", "abcdef"))
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestResumeStaging(t *testing.T) {
+
+	trans := &resumableTransport{dir: t.TempDir()}
+
+	stale := filepath.Join(trans.dir, "1-1-1" + snapshotResumeExt)
+	require.NoError(t, os.WriteFile(stale, []byte("x"), 0600))
+
+	path := filepath.Join(trans.dir, "2-10-6" + snapshotResumeExt)
+	file, err := trans.openStaging(path, 0)
+	require.NoError(t, err)
+	_, err = file.Write([]byte("abcd"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	_, err = os.Stat(stale)
+	require.True(t, os.IsNotExist(err))
+
+	offset, err := trans.stagedOffset("2-10-6")
+	require.NoError(t, err)
+	require.Equal(t, int64(4), offset)
+
+	_, err = trans.openStaging(path, 5)
+	require.Error(t, err)
+
+	file, err = trans.openStaging(path, 3)
+	require.NoError(t, err)
+	_, err = file.Write([]byte("def"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	file, err = os.Open(path)
+	require.NoError(t, err)
+	content, err := io.ReadAll(file)
+	file.Close()
+	require.NoError(t, err)
+	require.Equal(t, "abcdef", string(content))
+
+	_, err = trans.stagedOffset("../etc")
+	require.Error(t, err)
+}
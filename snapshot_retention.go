@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+Snapshot store removing snapshots older than the retain age and beyond the retain total size
+after each new snapshot, the newest snapshot is always kept.
+The count limit stays with the backend, so it has to be large enough for the age policy.
+ */
+type retentionSnapshotStore struct {
+	raft.SnapshotStore
+
+	remove     func(id string) error
+	maxAge     time.Duration
+	maxSize    int64
+	now        func() time.Time
+
+	mutex      sync.Mutex
+}
+
+func newRetentionSnapshotStore(delegate raft.SnapshotStore, remove func(id string) error, maxAge time.Duration, maxSize int64) *retentionSnapshotStore {
+	return &retentionSnapshotStore{
+		SnapshotStore: delegate,
+		remove:        remove,
+		maxAge:        maxAge,
+		maxSize:       maxSize,
+		now:           time.Now,
+	}
+}
+
+/**
+Removes the snapshot directory of raft.FileSnapshotStore created in the folder
+ */
+func fileSnapshotRemover(folder string) func(id string) error {
+	return func(id string) error {
+		if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+			return errors.Errorf("invalid snapshot id '%s'", id)
+		}
+		return os.RemoveAll(filepath.Join(folder, "snapshots", id))
+	}
+}
+
+/**
+Creation time of the snapshot from the ID 'term-index-msec' used by file and s3 backends
+ */
+func snapshotCreated(id string) (time.Time, bool) {
+	i := strings.LastIndexByte(id, '-')
+	if i < 0 {
+		return time.Time{}, false
+	}
+	msec, err := strconv.ParseInt(id[i+1:], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, msec * int64(time.Millisecond)), true
+}
+
+func (t *retentionSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration,
+	configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+
+	sink, err := t.SnapshotStore.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil {
+		return nil, err
+	}
+	return &retentionSnapshotSink{SnapshotSink: sink, store: t}, nil
+}
+
+type retentionSnapshotSink struct {
+	raft.SnapshotSink
+	store  *retentionSnapshotStore
+}
+
+func (t *retentionSnapshotSink) Close() error {
+	if err := t.SnapshotSink.Close(); err != nil {
+		return err
+	}
+	return t.store.enforce()
+}
+
+/**
+Applies the policies to the snapshots listed by the backend, the newest first
+ */
+func (t *retentionSnapshotStore) enforce() error {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	list, err := t.SnapshotStore.List()
+	if err != nil {
+		return err
+	}
+
+	now := t.now()
+	var total int64
+	overSize := false
+	for i, meta := range list {
+		if i > 0 {
+			// older snapshots than the first one beyond the size are beyond it too
+			overSize = overSize || (t.maxSize > 0 && total + meta.Size > t.maxSize)
+			expired := overSize
+			if t.maxAge > 0 {
+				if created, ok := snapshotCreated(meta.ID); ok && now.Sub(created) > t.maxAge {
+					expired = true
+				}
+			}
+			if expired {
+				if err := t.remove(meta.ID); err != nil {
+					return errors.Errorf("remove snapshot '%s', %v", meta.ID, err)
+				}
+				continue
+			}
+		}
+		total += meta.Size
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRetention(t *testing.T) {
+
+	dir, err := os.MkdirTemp(os.TempDir(), "raftmodtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	snapshots, err := raft.NewFileSnapshotStore(dir, 10, os.Stderr)
+	require.NoError(t, err)
+
+	store := newRetentionSnapshotStore(snapshots, fileSnapshotRemover(dir), 0, 2500)
+
+	create := func(index uint64) string {
+		sink, err := store.Create(raft.SnapshotVersionMax, index, 1, raft.Configuration{}, 0, nil)
+		require.NoError(t, err)
+		_, err = sink.Write(bytes.Repeat([]byte{1}, 1000))
+		require.NoError(t, err)
+		require.NoError(t, sink.Close())
+		// unique millisecond in the snapshot id
+		time.Sleep(2 * time.Millisecond)
+		return sink.ID()
+	}
+
+	// total size keeps two snapshots
+	for i := uint64(1); i <= 4; i++ {
+		create(i)
+	}
+	list, err := snapshots.List()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(list))
+	require.Equal(t, uint64(4), list[0].Index)
+	require.Equal(t, uint64(3), list[1].Index)
+
+	// age keeps only the newest one
+	store.maxSize = 0
+	store.maxAge = time.Hour
+	store.now = func() time.Time {
+		return time.Now().Add(2 * time.Hour)
+	}
+	id := create(5)
+	list, err = snapshots.List()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(list))
+	require.Equal(t, id, list[0].ID)
+
+	require.Error(t, fileSnapshotRemover(dir)("../x"))
+}
@@ -0,0 +1,269 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+Triggers raft snapshots on the schedule independent of 'raft.snapshot-threshold', for example to align them with backup windows.
+The schedule is the interval like '6h' or '@every 6h', the macro '@hourly', '@daily', '@weekly', '@monthly'
+or the cron expression 'minute hour day-of-month month day-of-week' in the local time, for example '30 2 * * *'.
+Empty schedule disables the bean.
+ */
+type implSnapshotScheduler struct {
+
+	Log          *zap.Logger      `inject`
+	Snapshotter  RaftSnapshotter  `inject:"optional"`
+
+	Schedule     string  `value:"raft-snapshot.schedule,default="`
+
+	next         func(time.Time) time.Time
+	nextAt       atomic.Time
+	closeCh      chan struct{}
+}
+
+func SnapshotScheduler() ScheduledSnapshotter {
+	return &implSnapshotScheduler{}
+}
+
+func (t *implSnapshotScheduler) NextSnapshot() (time.Time, bool) {
+	at := t.nextAt.Load()
+	return at, !at.IsZero()
+}
+
+func (t *implSnapshotScheduler) PostConstruct() error {
+
+	if t.Schedule == "" {
+		return nil
+	}
+	if t.Snapshotter == nil {
+		return errors.New("property 'raft-snapshot.schedule' requires the raft server")
+	}
+
+	next, err := parseSchedule(t.Schedule)
+	if err != nil {
+		return errors.Errorf("issue in property 'raft-snapshot.schedule', %v", err)
+	}
+	t.next = next
+	t.closeCh = make(chan struct{})
+
+	go t.run()
+	return nil
+}
+
+func (t *implSnapshotScheduler) Destroy() error {
+	if t.closeCh != nil {
+		close(t.closeCh)
+	}
+	return nil
+}
+
+func (t *implSnapshotScheduler) run() {
+
+	for {
+		now := time.Now()
+		at := t.next(now)
+		t.nextAt.Store(at)
+		t.Log.Debug("SnapshotScheduled", zap.Time("at", at))
+
+		timer := time.NewTimer(at.Sub(now))
+		select {
+		case <-timer.C:
+		case <-t.closeCh:
+			timer.Stop()
+			return
+		}
+
+		meta, err := t.Snapshotter.Snapshot()
+		switch {
+		case err == nil:
+			t.Log.Info("SnapshotScheduledTaken", zap.String("id", meta.ID), zap.Uint64("index", meta.Index))
+		// the error of the snapshotter has the raft error in the message
+		case strings.Contains(err.Error(), raft.ErrNothingNewToSnapshot.Error()):
+			t.Log.Debug("SnapshotScheduledSkipped", zap.Error(err))
+		default:
+			t.Log.Error("SnapshotScheduled", zap.Error(err))
+		}
+	}
+}
+
+/**
+Returns the function of the next run time after the given time
+ */
+func parseSchedule(schedule string) (func(time.Time) time.Time, error) {
+
+	schedule = strings.TrimSpace(schedule)
+
+	every := strings.TrimSpace(strings.TrimPrefix(schedule, "@every"))
+	if d, err := time.ParseDuration(every); err == nil {
+		if d < time.Second {
+			return nil, errors.Errorf("interval %v is less than a second", d)
+		}
+		return func(now time.Time) time.Time {
+			return now.Add(d)
+		}, nil
+	}
+
+	switch schedule {
+	case "@hourly":
+		schedule = "0 * * * *"
+	case "@daily", "@midnight":
+		schedule = "0 0 * * *"
+	case "@weekly":
+		schedule = "0 0 * * 0"
+	case "@monthly":
+		schedule = "0 0 1 * *"
+	}
+
+	fields := strings.Fields(schedule)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("invalid schedule '%s', expected interval or cron expression of 5 fields", schedule)
+	}
+
+	c := new(cronSchedule)
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, errors.Errorf("minute, %v", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, errors.Errorf("hour, %v", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, errors.Errorf("day of month, %v", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, errors.Errorf("month, %v", err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, errors.Errorf("day of week, %v", err)
+	}
+	// sunday is 0 or 7
+	if c.dow & (1 << 7) != 0 {
+		c.dow |= 1
+	}
+	c.anyDom, c.anyDow = fields[2] == "*", fields[4] == "*"
+	if _, ok := c.find(time.Now()); !ok {
+		return nil, errors.Errorf("schedule '%s' never runs", schedule)
+	}
+	return c.next, nil
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow  uint64
+	anyDom, anyDow                 bool
+}
+
+/**
+Parses '*', 'n', 'a-b', lists of them and steps like '0-59/15' or '5/10' to the bit set of values
+ */
+func parseCronField(field string, min, max int) (uint64, error) {
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, errors.Errorf("invalid step in '%s'", part)
+			}
+			step, part = n, part[:i]
+		}
+
+		lo, hi := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			i := strings.IndexByte(part, '-')
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(part[:i])
+			hi, err2 = strconv.Atoi(part[i+1:])
+			if err1 != nil || err2 != nil {
+				return 0, errors.Errorf("invalid range '%s'", part)
+			}
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, errors.Errorf("invalid value '%s'", part)
+			}
+			lo, hi = n, n
+			if step > 1 {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, errors.Errorf("'%s' is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronSchedule) matchDay(t time.Time) bool {
+	dom := c.dom & (1 << uint(t.Day())) != 0
+	dow := c.dow & (1 << uint(t.Weekday())) != 0
+	switch {
+	case c.anyDom && c.anyDow:
+		return true
+	case c.anyDom:
+		return dow
+	case c.anyDow:
+		return dom
+	}
+	// both restricted, either one matches as in cron
+	return dom || dow
+}
+
+func (c *cronSchedule) next(now time.Time) time.Time {
+	if t, ok := c.find(now); ok {
+		return t
+	}
+	return now.AddDate(100, 0, 0)
+}
+
+/**
+Returns the first matching minute after the time, skips mismatched months, days and hours at once,
+false if there is no such minute in five years
+ */
+func (c *cronSchedule) find(now time.Time) (time.Time, bool) {
+
+	loc := now.Location()
+	t := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute() + 1, 0, 0, loc)
+	// every day of every month is seen within five years, for example February 29
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month & (1 << uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month() + 1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day() + 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour & (1 << uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour() + 1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute & (1 << uint(t.Minute())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute() + 1, 0, 0, loc)
+			continue
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
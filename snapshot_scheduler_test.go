@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSnapshotSchedule(t *testing.T) {
+
+	// friday
+	now := time.Date(2023, 3, 10, 14, 20, 30, 0, time.UTC)
+
+	cases := []struct {
+		schedule  string
+		expected  time.Time
+	}{
+		{"6h", now.Add(6 * time.Hour)},
+		{"@every 90m", now.Add(90 * time.Minute)},
+		{"@hourly", time.Date(2023, 3, 10, 15, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2023, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2023, 3, 11, 2, 30, 0, 0, time.UTC)},
+		{"0-59/15 * * * *", time.Date(2023, 3, 10, 14, 30, 0, 0, time.UTC)},
+		{"0 3 * * 0", time.Date(2023, 3, 12, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * 7", time.Date(2023, 3, 12, 3, 0, 0, 0, time.UTC)},
+		{"0 1 1 * *", time.Date(2023, 4, 1, 1, 0, 0, 0, time.UTC)},
+		// day of month or day of week
+		{"0 1 15 * 1", time.Date(2023, 3, 13, 1, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		next, err := parseSchedule(c.schedule)
+		require.NoError(t, err, c.schedule)
+		require.Equal(t, c.expected, next(now), c.schedule)
+	}
+
+	for _, schedule := range []string{"", "100ms", "* * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "0 0 31 2 *", "@yearly"} {
+		_, err := parseSchedule(schedule)
+		require.Error(t, err, schedule)
+	}
+}
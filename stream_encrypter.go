@@ -17,15 +17,32 @@ import (
 /**
 STREAM ENCRYPTER
 
-Warning: fast but modifies stream data
+Encrypts into the internal buffer, the data of the caller stays untouched
 */
 
+// largest internal buffer of the encrypter, larger writes are encrypted by parts
+const streamEncrypterBufferSize = 64 * 1024
+
 type implStreamEncrypter struct {
-	sink   raft.SnapshotSink
-	stream cipher.Stream
+	sink    raft.SnapshotSink
+	stream  cipher.Stream
+	inPlace bool
+	buf     []byte
 }
 
 func StreamEncrypter(sessionKey []byte, sink raft.SnapshotSink) (raft.SnapshotSink, error) {
+	return newStreamEncrypter(sessionKey, sink, false)
+}
+
+/**
+Zero-copy encrypter, warning: fast but modifies stream data,
+the caller must not reuse the buffer after Write
+ */
+func InPlaceStreamEncrypter(sessionKey []byte, sink raft.SnapshotSink) (raft.SnapshotSink, error) {
+	return newStreamEncrypter(sessionKey, sink, true)
+}
+
+func newStreamEncrypter(sessionKey []byte, sink raft.SnapshotSink, inPlace bool) (raft.SnapshotSink, error) {
 	block, err := aes.NewCipher(sessionKey)
 	if err != nil {
 		return nil, err
@@ -50,15 +67,42 @@ func StreamEncrypter(sessionKey []byte, sink raft.SnapshotSink) (raft.SnapshotSi
 	return &implStreamEncrypter{
 		sink: sink,
 		stream: stream,
+		inPlace: inPlace,
 	}, nil
 }
 
 func (t *implStreamEncrypter) Write(p []byte) (int, error) {
-	t.stream.XORKeyStream(p, p)
-	return t.sink.Write(p)
+	if t.inPlace {
+		t.stream.XORKeyStream(p, p)
+		return t.sink.Write(p)
+	}
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > streamEncrypterBufferSize {
+			n = streamEncrypterBufferSize
+		}
+		if cap(t.buf) < n {
+			t.buf = make([]byte, n)
+		}
+		buf := t.buf[:n]
+		t.stream.XORKeyStream(buf, p[:n])
+		m, err := t.sink.Write(buf)
+		written += m
+		if err != nil {
+			return written, err
+		}
+		if m != n {
+			// key stream is already advanced, the rest of the snapshot can not be encrypted
+			return written, errors.Errorf("i/o write error, written %d bytes whereas expected %d bytes", m, n)
+		}
+		p = p[n:]
+	}
+	return written, nil
 }
 
 func (t *implStreamEncrypter) Close() error {
+	clean(t.buf)
 	return t.sink.Close()
 }
 
@@ -67,13 +111,14 @@ func (t *implStreamEncrypter) ID() string {
 }
 
 func (t *implStreamEncrypter) Cancel() error {
+	clean(t.buf)
 	return t.sink.Cancel()
 }
 
 /**
 STREAM DECRYPTER
 
-Warning: fast but modifies stream data
+Decrypts in place the buffer of the caller filled by Read
  */
 
 type implStreamDecrypter struct {
@@ -105,6 +150,42 @@ func StreamDecrypter(sessionKey []byte, source io.ReadCloser) (io.ReadCloser, er
 	}, nil
 }
 
+/**
+Encrypts the stream by AES-CTR with the random data key wrapped by the key provider,
+the header is the magic, name of the key provider and the wrapped key followed by IV.
+The stream is not authenticated, use AuthStreamEncrypter unless readers require the CTR mode.
+ */
+func KeyedStreamEncrypter(keys KeyProvider, aad []byte, sink raft.SnapshotSink) (raft.SnapshotSink, error) {
+	dataKey, header, err := newDataKeyHeader(ctrStreamMagic, keys, aad)
+	if err != nil {
+		return nil, err
+	}
+	defer clean(dataKey)
+	if err := writeFull(sink, header); err != nil {
+		return nil, err
+	}
+	return StreamEncrypter(dataKey, sink)
+}
+
+/**
+Decrypts the stream of KeyedStreamEncrypter with the header magic already consumed
+ */
+func KeyedStreamDecrypter(keys KeyProvider, aad []byte, source io.ReadCloser) (io.ReadCloser, error) {
+	wrapped, err := readWrappedKey(keys, source)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := keys.UnwrapKey(wrapped, aad)
+	if err != nil {
+		if errors.Is(err, ErrSnapshotIntegrity) {
+			return nil, err
+		}
+		return nil, errors.Errorf("unwrap data key by '%s', %v", keys.KeyProviderName(), err)
+	}
+	defer clean(dataKey)
+	return StreamDecrypter(dataKey, source)
+}
+
 func (t *implStreamDecrypter) Read(p []byte) (int, error) {
 	n, err := t.source.Read(p)
 	if n > 0 {
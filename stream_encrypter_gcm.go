@@ -0,0 +1,353 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"io"
+)
+
+/**
+AUTHENTICATED STREAM ENCRYPTER
+
+Header is magic, name of the key provider, random data key of the snapshot wrapped by the key provider
+and chunk size, followed by AES-GCM sealed chunks prefixed by the length with the final flag in the high bit.
+The nonce is the chunk counter with the final flag, so reordered, truncated or extended streams fail to open.
+
+The magic is 'RAFT', the cipher and the format version. Key derivation parameters of the token provider
+are in its wrapped key. Snapshots of the legacy CTR mode without the header start with IV.
+*/
+
+// magic prefix of all headers, unknown formats with it are rejected rather than decrypted as legacy
+var streamMagicPrefix = []byte("RAFT")
+
+var (
+	// AES-CTR stream with the data key wrapped by the key provider
+	ctrStreamMagic   = []byte("RAFTCTR1")
+	gcmStreamMagic   = []byte("RAFTGCM3")
+)
+
+const (
+	gcmSaltSize   = 16
+	gcmKeySize    = 32
+	gcmChunkSize  = 64 * 1024
+	gcmFinalFlag  = uint32(1) << 31
+)
+
+// ErrSnapshotIntegrity is returned when the authenticated snapshot was tampered or truncated
+var ErrSnapshotIntegrity = errors.New("snapshot integrity check failed")
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+/**
+Seals the data key by the master key, aad binds the wrapped key to the snapshot
+ */
+func wrapDataKey(masterKey, dataKey, aad []byte) ([]byte, error) {
+	aead, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, aad), nil
+}
+
+func unwrapDataKey(masterKey, wrapped, aad []byte) ([]byte, error) {
+	aead, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.Wrap(ErrSnapshotIntegrity, "truncated wrapped key")
+	}
+	dataKey, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], aad)
+	if err != nil {
+		return nil, errors.Wrapf(ErrSnapshotIntegrity, "unwrap data key, %v", err)
+	}
+	return dataKey, nil
+}
+
+func gcmNonce(aead cipher.AEAD, counter uint64, final bool) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce, counter)
+	if final {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+type implAuthStreamEncrypter struct {
+	sink     raft.SnapshotSink
+	aead     cipher.AEAD
+	aad      []byte
+	buf      []byte
+	counter  uint64
+	closed   bool
+}
+
+/**
+Generates the random data key and returns it with the header of the magic, name of the key provider
+and the data key wrapped by it
+ */
+func newDataKeyHeader(magic []byte, keys KeyProvider, aad []byte) (dataKey, header []byte, err error) {
+	dataKey = make([]byte, gcmKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := keys.WrapKey(dataKey, aad)
+	if err != nil {
+		clean(dataKey)
+		return nil, nil, errors.Errorf("wrap data key by '%s', %v", keys.KeyProviderName(), err)
+	}
+	name := keys.KeyProviderName()
+	if len(name) > 255 || len(wrapped) > 65535 {
+		clean(dataKey)
+		return nil, nil, errors.Errorf("key provider '%s' returned wrapped key of %d bytes", name, len(wrapped))
+	}
+	header = make([]byte, 0, len(magic) + 1 + len(name) + 2 + len(wrapped) + 4)
+	header = append(header, magic...)
+	header = append(header, byte(len(name)))
+	header = append(header, name...)
+	var size [2]byte
+	binary.BigEndian.PutUint16(size[:], uint16(len(wrapped)))
+	header = append(header, size[:]...)
+	header = append(header, wrapped...)
+	return dataKey, header, nil
+}
+
+/**
+Reads the name of the key provider and the wrapped data key after the magic
+ */
+func readWrappedKey(keys KeyProvider, source io.Reader) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(source, size[:1]); err != nil {
+		return nil, errors.Wrap(ErrSnapshotIntegrity, "truncated header")
+	}
+	name := make([]byte, size[0])
+	if _, err := io.ReadFull(source, name); err != nil {
+		return nil, errors.Wrap(ErrSnapshotIntegrity, "truncated header")
+	}
+	if string(name) != keys.KeyProviderName() {
+		return nil, errors.Errorf("data key is wrapped by key provider '%s' whereas configured '%s'", name, keys.KeyProviderName())
+	}
+	if _, err := io.ReadFull(source, size[:]); err != nil {
+		return nil, errors.Wrap(ErrSnapshotIntegrity, "truncated header")
+	}
+	wrapped := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(source, wrapped); err != nil {
+		return nil, errors.Wrap(ErrSnapshotIntegrity, "truncated header")
+	}
+	return wrapped, nil
+}
+
+/**
+Encrypts and authenticates the snapshot stream by the random data key wrapped by the key provider,
+aad binds the stream to the snapshot, for example index and term
+ */
+func AuthStreamEncrypter(keys KeyProvider, aad []byte, sink raft.SnapshotSink) (raft.SnapshotSink, error) {
+	dataKey, header, err := newDataKeyHeader(gcmStreamMagic, keys, aad)
+	if err != nil {
+		return nil, err
+	}
+	defer clean(dataKey)
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], gcmChunkSize)
+	header = append(header, size[:]...)
+	if err := writeFull(sink, header); err != nil {
+		return nil, err
+	}
+	return &implAuthStreamEncrypter{
+		sink: sink,
+		aead: aead,
+		aad:  aad,
+		buf:  make([]byte, 0, gcmChunkSize),
+	}, nil
+}
+
+func writeFull(w io.Writer, p []byte) error {
+	n, err := w.Write(p)
+	if err == nil && n != len(p) {
+		err = errors.Errorf("i/o write error, written %d bytes whereas expected %d bytes", n, len(p))
+	}
+	return err
+}
+
+func (t *implAuthStreamEncrypter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// the full chunk is sealed only when more data follows, the last one is sealed as final on Close
+		if len(t.buf) == gcmChunkSize {
+			if err := t.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(t.buf[len(t.buf):gcmChunkSize], p)
+		t.buf = t.buf[:len(t.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (t *implAuthStreamEncrypter) seal(final bool) error {
+	sealed := t.aead.Seal(nil, gcmNonce(t.aead, t.counter, final), t.buf, t.aad)
+	t.counter++
+	clean(t.buf)
+	t.buf = t.buf[:0]
+
+	length := uint32(len(sealed))
+	if final {
+		length |= gcmFinalFlag
+	}
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], length)
+	if err := writeFull(t.sink, prefix[:]); err != nil {
+		return err
+	}
+	return writeFull(t.sink, sealed)
+}
+
+func (t *implAuthStreamEncrypter) Close() error {
+	if !t.closed {
+		t.closed = true
+		if err := t.seal(true); err != nil {
+			t.sink.Cancel()
+			return err
+		}
+	}
+	return t.sink.Close()
+}
+
+func (t *implAuthStreamEncrypter) ID() string {
+	return t.sink.ID()
+}
+
+func (t *implAuthStreamEncrypter) Cancel() error {
+	t.closed = true
+	clean(t.buf)
+	return t.sink.Cancel()
+}
+
+type implAuthStreamDecrypter struct {
+	source   io.ReadCloser
+	aead     cipher.AEAD
+	aad      []byte
+	chunk    []byte
+	pos      int
+	counter  uint64
+	final    bool
+	maxSize  int
+}
+
+/**
+Decrypts the stream of AuthStreamEncrypter with the header magic already consumed,
+the first chunk is opened immediately, so tampered header or data fail here rather than in Read
+ */
+func AuthStreamDecrypter(keys KeyProvider, aad []byte, source io.ReadCloser) (io.ReadCloser, error) {
+	wrapped, err := readWrappedKey(keys, source)
+	if err != nil {
+		return nil, err
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(source, size[:]); err != nil {
+		return nil, errors.Wrap(ErrSnapshotIntegrity, "truncated header")
+	}
+	dataKey, err := keys.UnwrapKey(wrapped, aad)
+	if err != nil {
+		if errors.Is(err, ErrSnapshotIntegrity) {
+			return nil, err
+		}
+		return nil, errors.Errorf("unwrap data key by '%s', %v", keys.KeyProviderName(), err)
+	}
+	defer clean(dataKey)
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return newAuthStreamDecrypter(aead, aad, binary.BigEndian.Uint32(size[:]), source)
+}
+
+func newAuthStreamDecrypter(aead cipher.AEAD, aad []byte, chunkSize uint32, source io.ReadCloser) (io.ReadCloser, error) {
+	if chunkSize == 0 || chunkSize > 16 * 1024 * 1024 {
+		return nil, errors.Wrapf(ErrSnapshotIntegrity, "invalid chunk size %d", chunkSize)
+	}
+	t := &implAuthStreamDecrypter{
+		source:  source,
+		aead:    aead,
+		aad:     aad,
+		maxSize: int(chunkSize) + aead.Overhead(),
+	}
+	if err := t.open(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *implAuthStreamDecrypter) open() error {
+	var prefix [4]byte
+	if _, err := io.ReadFull(t.source, prefix[:]); err != nil {
+		return errors.Wrapf(ErrSnapshotIntegrity, "truncated at chunk %d", t.counter)
+	}
+	length := binary.BigEndian.Uint32(prefix[:])
+	final := length & gcmFinalFlag != 0
+	size := int(length &^ gcmFinalFlag)
+	if size < t.aead.Overhead() || size > t.maxSize {
+		return errors.Wrapf(ErrSnapshotIntegrity, "invalid length %d of chunk %d", size, t.counter)
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(t.source, sealed); err != nil {
+		return errors.Wrapf(ErrSnapshotIntegrity, "truncated at chunk %d", t.counter)
+	}
+	chunk, err := t.aead.Open(sealed[:0], gcmNonce(t.aead, t.counter, final), sealed, t.aad)
+	if err != nil {
+		return errors.Wrapf(ErrSnapshotIntegrity, "chunk %d, %v", t.counter, err)
+	}
+	t.counter++
+	t.chunk, t.pos, t.final = chunk, 0, final
+	if final {
+		var extra [1]byte
+		if n, _ := t.source.Read(extra[:]); n > 0 {
+			return errors.Wrap(ErrSnapshotIntegrity, "data after the final chunk")
+		}
+	}
+	return nil
+}
+
+func (t *implAuthStreamDecrypter) Read(p []byte) (int, error) {
+	for t.pos == len(t.chunk) {
+		if t.final {
+			return 0, io.EOF
+		}
+		if err := t.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, t.chunk[t.pos:])
+	t.pos += n
+	return n, nil
+}
+
+func (t *implAuthStreamDecrypter) Close() error {
+	clean(t.chunk)
+	return t.source.Close()
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bufio"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	CompressionNone   = "none"
+	CompressionSnappy = "snappy"
+
+	// first byte of the compression negotiation, never used as raft rpc type
+	compressPreamble = 0xC5
+
+	compressCodeNone   = 0
+	compressCodeSnappy = 1
+)
+
+func compressionCode(name string) (byte, error) {
+	switch name {
+	case "", CompressionNone:
+		return compressCodeNone, nil
+	case CompressionSnappy:
+		return compressCodeSnappy, nil
+	}
+	return 0, errors.Errorf("unsupported compression '%s'", name)
+}
+
+type compressedConn struct {
+	net.Conn
+	reader  io.Reader
+	writer  io.Writer
+}
+
+func (c *compressedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (c *compressedConn) Write(p []byte) (int, error) {
+	return c.writer.Write(p)
+}
+
+func wrapCompression(conn net.Conn, reader io.Reader, code byte) net.Conn {
+	switch code {
+	case compressCodeSnappy:
+		// unbuffered writer, raft transport flushes its own buffer
+		return &compressedConn{Conn: conn, reader: snappy.NewReader(reader), writer: snappy.NewWriter(conn)}
+	}
+	if reader != conn {
+		return &peekedConn{Conn: conn, reader: reader.(*bufio.Reader)}
+	}
+	return conn
+}
+
+/**
+Client side of the negotiation: sends preamble with the requested codec and waits for the accepted one
+ */
+func negotiateCompression(conn net.Conn, code byte, timeout time.Duration) (net.Conn, error) {
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+	if _, err := conn.Write([]byte{compressPreamble, code}); err != nil {
+		return nil, err
+	}
+	var ack [1]byte
+	if _, err := io.ReadFull(conn, ack[:]); err != nil {
+		return nil, errors.Errorf("compression negotiation, %v", err)
+	}
+	return wrapCompression(conn, conn, ack[0]), nil
+}
+
+/**
+Inbound connection answering the compression negotiation on the first read or write,
+connections without preamble stay uncompressed
+ */
+type compressAcceptConn struct {
+	net.Conn
+	supported  byte
+	once       sync.Once
+	conn       net.Conn
+	err        error
+}
+
+func (c *compressAcceptConn) detect() {
+	reader := bufio.NewReader(c.Conn)
+	b, err := reader.Peek(1)
+	if err != nil {
+		c.err = err
+		return
+	}
+	if b[0] != compressPreamble {
+		c.conn = &peekedConn{Conn: c.Conn, reader: reader}
+		return
+	}
+	var hdr [2]byte
+	if _, err := io.ReadFull(reader, hdr[:]); err != nil {
+		c.err = err
+		return
+	}
+	accepted := byte(compressCodeNone)
+	if hdr[1] == c.supported {
+		accepted = c.supported
+	}
+	if _, err := c.Conn.Write([]byte{accepted}); err != nil {
+		c.err = err
+		return
+	}
+	c.conn = wrapCompression(c.Conn, reader, accepted)
+}
+
+func (c *compressAcceptConn) Read(p []byte) (int, error) {
+	c.once.Do(c.detect)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.conn.Read(p)
+}
+
+func (c *compressAcceptConn) Write(p []byte) (int, error) {
+	c.once.Do(c.detect)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.conn.Write(p)
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// echoes one message of the size through the accepted connection
+func compressEchoServer(t *testing.T, supported byte, size int) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				conn := &compressAcceptConn{Conn: c, supported: supported}
+				buf := make([]byte, size)
+				if _, err := io.ReadFull(conn, buf); err != nil {
+					return
+				}
+				conn.Write(buf)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+
+	payload := bytes.Repeat([]byte("raft append entries "), 4096)
+
+	echo := func(address string, dial func(conn net.Conn) net.Conn) {
+		c, err := net.Dial("tcp", address)
+		require.NoError(t, err)
+		defer c.Close()
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		conn := dial(c)
+		_, err = conn.Write(payload)
+		require.NoError(t, err)
+		actual := make([]byte, len(payload))
+		_, err = io.ReadFull(conn, actual)
+		require.NoError(t, err)
+		require.True(t, bytes.Equal(payload, actual))
+	}
+
+	snappyServer := compressEchoServer(t, compressCodeSnappy, len(payload))
+
+	// both sides support snappy
+	echo(snappyServer, func(c net.Conn) net.Conn {
+		conn, err := negotiateCompression(c, compressCodeSnappy, time.Second)
+		require.NoError(t, err)
+		_, ok := conn.(*compressedConn)
+		require.True(t, ok)
+		return conn
+	})
+
+	// peer of the previous version sends no preamble
+	echo(snappyServer, func(c net.Conn) net.Conn {
+		return c
+	})
+
+	// server without compression accepts none
+	plainServer := compressEchoServer(t, compressCodeNone, len(payload))
+	echo(plainServer, func(c net.Conn) net.Conn {
+		conn, err := negotiateCompression(c, compressCodeSnappy, time.Second)
+		require.NoError(t, err)
+		_, ok := conn.(*compressedConn)
+		require.False(t, ok)
+		return conn
+	})
+
+	_, err := compressionCode("zstd")
+	require.Error(t, err)
+}
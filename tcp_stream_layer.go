@@ -6,36 +6,123 @@
 package raftmod
 
 import (
+	"bufio"
 	"crypto/rand"
 	"crypto/tls"
 	"errors"
 	"github.com/hashicorp/raft"
 	"net"
+	"sync"
+	"syscall"
 	"time"
 )
 
 var (
 	errNotAdvertisable = errors.New("local bind address is not advertisable")
 	errNotTCP          = errors.New("local address is not a TCP address")
+	errNotUnix         = errors.New("local address is not a Unix socket address")
 )
 
+// first byte of the TLS handshake record
+const tlsHandshakeRecord = 0x16
+
+type tcpStreamOptions struct {
+	tlsConfig  *tls.Config // can be nil, accept side
+	dialConfig *tls.Config // can be nil, dial side, by default skips server verification
+
+	// accept both TLS and plaintext, dial TLS only to peers advertising TLS capability
+	mixedTLS   bool
+	peerTLS    func(address raft.ServerAddress) bool
+
+	// compression codec, dial compresses only to peers advertising support
+	compression   byte
+	peerCompress  func(address raft.ServerAddress) bool
+
+	// inbound connection limits, can be nil
+	limiter       *connLimiter
+
+	// socket options of both sides, zero keepalive keeps the Go default, negative disables it
+	keepAlive      time.Duration
+	userTimeout    time.Duration
+	connectTimeout time.Duration
+
+	// socket tuning of both sides, zero buffer sizes and negative linger keep the OS defaults
+	noDelay        bool
+	readBuffer     int
+	writeBuffer    int
+	linger         time.Duration
+
+	// PROXY protocol mode of inbound connections: none, optional or required
+	proxyProtocol  string
+	proxyTrusted   []*net.IPNet
+	proxyTimeout   time.Duration
+
+	// retries of the refused dials with exponential backoff within the dial timeout, zero disables them
+	dialRetries    int
+	dialBackoff    time.Duration
+
+	// timeout of the slow peer replacing the transport timeout, can be nil
+	peerTimeout    func(address raft.ServerAddress) time.Duration
+	timeout        time.Duration
+}
+
 // TCPStreamLayer implements StreamLayer interface for plain TCP.
 type TCPStreamLayer struct {
 	advertise     net.Addr
 	listener      net.Listener
 	tlsConfigOpt  *tls.Config // can be nil
+	dialConfig    *tls.Config
+	mixedTLS      bool
+	peerTLS       func(address raft.ServerAddress) bool
+	compression   byte
+	peerCompress  func(address raft.ServerAddress) bool
+	limiter       *connLimiter
+	keepAlive     time.Duration
+	userTimeout   time.Duration
+	connectTimeout time.Duration
+	noDelay        bool
+	readBuffer     int
+	writeBuffer    int
+	linger         time.Duration
+	proxyProtocol  string
+	proxyTrusted   []*net.IPNet
+	proxyTimeout   time.Duration
+	dialRetries    int
+	dialBackoff    time.Duration
+	peerTimeout    func(address raft.ServerAddress) time.Duration
+	timeout        time.Duration
 }
 
 func newTCPTransport(listener net.Listener,
 	advertise net.Addr,
-	tlsConfigOpt *tls.Config, // can be nil
+	options tcpStreamOptions,
 	transportCreator func(stream raft.StreamLayer) *raft.NetworkTransport) (*raft.NetworkTransport, error) {
 
 	// Create stream
 	stream := &TCPStreamLayer{
 		advertise:    advertise,
 		listener:     listener,
-		tlsConfigOpt: tlsConfigOpt,
+		tlsConfigOpt: options.tlsConfig,
+		dialConfig:   options.dialConfig,
+		mixedTLS:     options.mixedTLS && options.tlsConfig != nil,
+		peerTLS:      options.peerTLS,
+		compression:  options.compression,
+		peerCompress: options.peerCompress,
+		limiter:      options.limiter,
+		keepAlive:    options.keepAlive,
+		userTimeout:  options.userTimeout,
+		connectTimeout: options.connectTimeout,
+		noDelay:        options.noDelay,
+		readBuffer:     options.readBuffer,
+		writeBuffer:    options.writeBuffer,
+		linger:         options.linger,
+		proxyProtocol:  options.proxyProtocol,
+		proxyTrusted:   options.proxyTrusted,
+		proxyTimeout:   options.proxyTimeout,
+		dialRetries:    options.dialRetries,
+		dialBackoff:    options.dialBackoff,
+		peerTimeout:    options.peerTimeout,
+		timeout:        options.timeout,
 	}
 
 	// Verify that we have a usable advertise address
@@ -54,27 +141,218 @@ func newTCPTransport(listener net.Listener,
 
 // Dial implements the StreamLayer interface.
 func (t *TCPStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	var peerTimeout time.Duration
+	if t.peerTimeout != nil {
+		if peerTimeout = t.peerTimeout(address); peerTimeout > 0 {
+			timeout = peerTimeout
+		}
+	}
+	conn, err := t.dialRetry(address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if t.compression != compressCodeNone && t.peerCompress != nil && t.peerCompress(address) {
+		compressed, err := negotiateCompression(conn, t.compression, timeout)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = compressed
+	}
+	return newPeerTimeoutConn(conn, peerTimeout, t.timeout), nil
+}
+
+/**
+Retries dials refused by the restarting peer, backoff doubles on each attempt and never exceeds the remaining timeout
+ */
+func (t *TCPStreamLayer) dialRetry(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	deadline := time.Now().Add(timeout)
+	backoff := t.dialBackoff
+	conn, err := t.dial(address, timeout)
+	for attempt := 0; err != nil && attempt < t.dialRetries && errors.Is(err, syscall.ECONNREFUSED); attempt++ {
+		if timeout > 0 && time.Until(deadline) <= backoff {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if timeout > 0 {
+			conn, err = t.dial(address, time.Until(deadline))
+		} else {
+			conn, err = t.dial(address, 0)
+		}
+	}
+	return conn, err
+}
+
+func (t *TCPStreamLayer) dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+
+	useTLS := t.tlsConfigOpt != nil
+	if t.mixedTLS {
+		useTLS = t.peerTLS != nil && t.peerTLS(address)
+	}
 
-	if t.tlsConfigOpt != nil {
+	d := t.dialer(timeout)
+	conn, err := d.Dial("tcp", string(address))
+	if err != nil {
+		return nil, err
+	}
+	if err := t.tuneSocket(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
 
-		tlsConf := &tls.Config{
-			Rand:                        rand.Reader,
-			Certificates:                t.tlsConfigOpt.Certificates,
-			ClientCAs:                   t.tlsConfigOpt.ClientCAs,
-			InsecureSkipVerify:          true,
+	if useTLS {
+
+		var tlsConf *tls.Config
+		if t.dialConfig != nil {
+			tlsConf = t.dialConfig.Clone()
+			if !tlsConf.InsecureSkipVerify && tlsConf.ServerName == "" {
+				if host, _, err := net.SplitHostPort(string(address)); err == nil {
+					tlsConf.ServerName = host
+				}
+			}
+		} else {
+			tlsConf = &tls.Config{
+				Rand:                        rand.Reader,
+				Certificates:                t.tlsConfigOpt.Certificates,
+				ClientCAs:                   t.tlsConfigOpt.ClientCAs,
+				InsecureSkipVerify:          true,
+			}
 		}
 
-		d := net.Dialer{Timeout: timeout}
-		return tls.DialWithDialer(&d, "tcp", string(address), tlsConf)
+		tlsConn := tls.Client(conn, tlsConf)
+		if d.Timeout > 0 {
+			tlsConn.SetDeadline(time.Now().Add(d.Timeout))
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn.SetDeadline(time.Time{})
+		return tlsConn, nil
 	} else {
-		return net.DialTimeout("tcp", string(address), timeout)
+		return conn, nil
 	}
 
 }
 
 // Accept implements the net.Listener interface.
 func (t *TCPStreamLayer) Accept() (c net.Conn, err error) {
-	return t.listener.Accept()
+	c, err = t.accept()
+	if err != nil || t.compression == compressCodeNone {
+		return
+	}
+	return &compressAcceptConn{Conn: c, supported: t.compression}, nil
+}
+
+func (t *TCPStreamLayer) accept() (c net.Conn, err error) {
+	c, err = t.acceptLimited()
+	if err != nil || t.tlsConfigOpt == nil {
+		return
+	}
+	if t.mixedTLS {
+		return &mixedConn{Conn: c, tlsConfig: t.tlsConfigOpt}, nil
+	}
+	return tls.Server(c, t.tlsConfigOpt), nil
+}
+
+func (t *TCPStreamLayer) dialer(timeout time.Duration) *net.Dialer {
+	if t.connectTimeout > 0 && (timeout <= 0 || t.connectTimeout < timeout) {
+		timeout = t.connectTimeout
+	}
+	d := &net.Dialer{Timeout: timeout, KeepAlive: t.keepAlive}
+	if t.userTimeout > 0 {
+		d.Control = func(network, address string, c syscall.RawConn) error {
+			return setTCPUserTimeout(c, t.userTimeout)
+		}
+	}
+	return d
+}
+
+// applies keepalive and user timeout to the accepted connection
+func (t *TCPStreamLayer) setSocketOptions(c net.Conn) error {
+	if peeked, ok := c.(*peekedConn); ok {
+		// sniffed by the shared port listener
+		c = peeked.Conn
+	}
+	tcpConn, ok := c.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if err := t.tuneSocket(tcpConn); err != nil {
+		return err
+	}
+	if t.keepAlive > 0 {
+		if err := tcpConn.SetKeepAlive(true); err != nil {
+			return err
+		}
+		if err := tcpConn.SetKeepAlivePeriod(t.keepAlive); err != nil {
+			return err
+		}
+	} else if t.keepAlive < 0 {
+		if err := tcpConn.SetKeepAlive(false); err != nil {
+			return err
+		}
+	}
+	if t.userTimeout > 0 {
+		raw, err := tcpConn.SyscallConn()
+		if err != nil {
+			return err
+		}
+		return setTCPUserTimeout(raw, t.userTimeout)
+	}
+	return nil
+}
+
+// applies no delay, buffer sizes and linger to the connection
+func (t *TCPStreamLayer) tuneSocket(c net.Conn) error {
+	tcpConn, ok := c.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if err := tcpConn.SetNoDelay(t.noDelay); err != nil {
+		return err
+	}
+	if t.readBuffer > 0 {
+		if err := tcpConn.SetReadBuffer(t.readBuffer); err != nil {
+			return err
+		}
+	}
+	if t.writeBuffer > 0 {
+		if err := tcpConn.SetWriteBuffer(t.writeBuffer); err != nil {
+			return err
+		}
+	}
+	if t.linger >= 0 {
+		return tcpConn.SetLinger(int(t.linger / time.Second))
+	}
+	return nil
+}
+
+// rejected connections are closed before the TLS handshake without returning error to the transport
+func (t *TCPStreamLayer) acceptLimited() (net.Conn, error) {
+	for {
+		c, err := t.listener.Accept()
+		if err != nil {
+			return c, err
+		}
+		if err := t.setSocketOptions(c); err != nil {
+			c.Close()
+			continue
+		}
+		if !proxyAllowed(t.proxyProtocol, t.proxyTrusted, c.RemoteAddr()) {
+			c.Close()
+			continue
+		}
+		// limits apply to the balancer address, the header is read on the first use of the connection
+		if t.limiter == nil {
+			return newProxyConn(c, t.proxyProtocol, t.proxyTrusted, t.proxyTimeout), nil
+		}
+		if limited, ok := t.limiter.admit(c); ok {
+			return newProxyConn(limited, t.proxyProtocol, t.proxyTrusted, t.proxyTimeout), nil
+		}
+		c.Close()
+	}
 }
 
 // Close implements the net.Listener interface.
@@ -91,3 +369,53 @@ func (t *TCPStreamLayer) Addr() net.Addr {
 	return t.listener.Addr()
 }
 
+/**
+Inbound connection detecting TLS handshake on the first read or write
+ */
+type mixedConn struct {
+	net.Conn
+	tlsConfig  *tls.Config
+	once       sync.Once
+	conn       net.Conn
+	err        error
+}
+
+func (c *mixedConn) detect() {
+	reader := bufio.NewReader(c.Conn)
+	peeked := &peekedConn{Conn: c.Conn, reader: reader}
+	b, err := reader.Peek(1)
+	if err != nil {
+		c.err = err
+		return
+	}
+	if b[0] == tlsHandshakeRecord {
+		c.conn = tls.Server(peeked, c.tlsConfig)
+	} else {
+		c.conn = peeked
+	}
+}
+
+func (c *mixedConn) Read(p []byte) (int, error) {
+	c.once.Do(c.detect)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.conn.Read(p)
+}
+
+func (c *mixedConn) Write(p []byte) (int, error) {
+	c.once.Do(c.detect)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.conn.Write(p)
+}
+
+type peekedConn struct {
+	net.Conn
+	reader  *bufio.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
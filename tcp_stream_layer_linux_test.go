@@ -0,0 +1,62 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSocketOptions(t *testing.T) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	c, err := listener.Accept()
+	require.NoError(t, err)
+	defer c.Close()
+
+	layer := &TCPStreamLayer{
+		noDelay:     true,
+		keepAlive:   30 * time.Second,
+		userTimeout: 5 * time.Second,
+		linger:      2 * time.Second,
+	}
+	require.NoError(t, layer.setSocketOptions(c))
+
+	raw, err := c.(*net.TCPConn).SyscallConn()
+	require.NoError(t, err)
+
+	var linger *unix.Linger
+	var noDelay, keepAlive, userTimeout int
+	require.NoError(t, raw.Control(func(fd uintptr) {
+		linger, err = unix.GetsockoptLinger(int(fd), unix.SOL_SOCKET, unix.SO_LINGER)
+		require.NoError(t, err)
+		noDelay, err = unix.GetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_NODELAY)
+		require.NoError(t, err)
+		keepAlive, err = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_KEEPALIVE)
+		require.NoError(t, err)
+		userTimeout, err = unix.GetsockoptInt(int(fd), unix.IPPROTO_TCP, tcpUserTimeout)
+		require.NoError(t, err)
+	}))
+
+	require.Equal(t, int32(1), linger.Onoff)
+	require.Equal(t, int32(2), linger.Linger)
+	require.Equal(t, 1, noDelay)
+	require.Equal(t, 1, keepAlive)
+	require.Equal(t, 5000, userTimeout)
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"go.uber.org/atomic"
+	"net"
+	"sync"
+	"time"
+)
+
+// idle per-IP buckets are dropped after this period
+const connBucketIdle = 10 * time.Minute
+
+/**
+Limits of the inbound raft transport connections, zero values mean unlimited
+ */
+type connLimiter struct {
+	maxConns   int64
+	ratePerIP  float64
+	burstPerIP float64
+
+	active     atomic.Int64
+	rejected   atomic.Uint64
+
+	mutex      sync.Mutex
+	buckets    map[string]*connBucket
+	lastSweep  time.Time
+}
+
+type connBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newConnLimiter(maxConns int, ratePerIP float64, burstPerIP int) *connLimiter {
+	if maxConns <= 0 && ratePerIP <= 0 {
+		return nil
+	}
+	if burstPerIP < 1 {
+		burstPerIP = 1
+	}
+	return &connLimiter{
+		maxConns:   int64(maxConns),
+		ratePerIP:  ratePerIP,
+		burstPerIP: float64(burstPerIP),
+		buckets:    make(map[string]*connBucket),
+		lastSweep:  time.Now(),
+	}
+}
+
+/**
+Returns the tracked connection or false if the connection must be rejected
+ */
+func (t *connLimiter) admit(c net.Conn) (net.Conn, bool) {
+
+	if t.ratePerIP > 0 && !t.allowIP(remoteIP(c)) {
+		t.rejected.Inc()
+		return nil, false
+	}
+
+	if t.maxConns > 0 {
+		if t.active.Inc() > t.maxConns {
+			t.active.Dec()
+			t.rejected.Inc()
+			return nil, false
+		}
+		return &limitedConn{Conn: c, limiter: t}, true
+	}
+
+	return c, true
+}
+
+func (t *connLimiter) allowIP(ip string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(t.lastSweep) > connBucketIdle {
+		for k, b := range t.buckets {
+			if now.Sub(b.updated) > connBucketIdle {
+				delete(t.buckets, k)
+			}
+		}
+		t.lastSweep = now
+	}
+
+	b, ok := t.buckets[ip]
+	if !ok {
+		b = &connBucket{tokens: t.burstPerIP, updated: now}
+		t.buckets[ip] = b
+	} else {
+		b.tokens += now.Sub(b.updated).Seconds() * t.ratePerIP
+		if b.tokens > t.burstPerIP {
+			b.tokens = t.burstPerIP
+		}
+		b.updated = now
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (t *connLimiter) Active() int64 {
+	return t.active.Load()
+}
+
+func (t *connLimiter) Rejected() uint64 {
+	return t.rejected.Load()
+}
+
+func remoteIP(c net.Conn) string {
+	if addr, ok := c.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return c.RemoteAddr().String()
+}
+
+type limitedConn struct {
+	net.Conn
+	limiter   *connLimiter
+	closeOnce sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.limiter.active.Dec()
+	})
+	return c.Conn.Close()
+}
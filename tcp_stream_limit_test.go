@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+type limitTestConn struct {
+	net.Conn
+	remote  net.Addr
+}
+
+func (c *limitTestConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *limitTestConn) Close() error {
+	return nil
+}
+
+func limitTestPeer(ip string) net.Conn {
+	return &limitTestConn{remote: &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000}}
+}
+
+func TestConnLimiterMaxConns(t *testing.T) {
+
+	require.Nil(t, newConnLimiter(0, 0, 0))
+
+	limiter := newConnLimiter(2, 0, 0)
+	first, ok := limiter.admit(limitTestPeer("10.0.0.1"))
+	require.True(t, ok)
+	second, ok := limiter.admit(limitTestPeer("10.0.0.2"))
+	require.True(t, ok)
+	_, ok = limiter.admit(limitTestPeer("10.0.0.3"))
+	require.False(t, ok)
+	require.Equal(t, int64(2), limiter.Active())
+	require.Equal(t, uint64(1), limiter.Rejected())
+
+	// the double close releases the slot once
+	require.NoError(t, first.Close())
+	require.NoError(t, first.Close())
+	require.Equal(t, int64(1), limiter.Active())
+
+	_, ok = limiter.admit(limitTestPeer("10.0.0.3"))
+	require.True(t, ok)
+	_, ok = limiter.admit(limitTestPeer("10.0.0.4"))
+	require.False(t, ok)
+	require.NoError(t, second.Close())
+	require.Equal(t, int64(1), limiter.Active())
+}
+
+func TestConnLimiterRatePerIP(t *testing.T) {
+
+	limiter := newConnLimiter(0, 10, 2)
+
+	for i := 0; i < 2; i++ {
+		_, ok := limiter.admit(limitTestPeer("10.0.0.1"))
+		require.True(t, ok)
+	}
+	_, ok := limiter.admit(limitTestPeer("10.0.0.1"))
+	require.False(t, ok)
+
+	// buckets are per IP
+	_, ok = limiter.admit(limitTestPeer("10.0.0.2"))
+	require.True(t, ok)
+
+	// refilled by the rate
+	require.Eventually(t, func() bool {
+		_, ok := limiter.admit(limitTestPeer("10.0.0.1"))
+		return ok
+	}, time.Second, 20 * time.Millisecond)
+
+	// idle buckets are swept
+	limiter.mutex.Lock()
+	limiter.lastSweep = time.Now().Add(-2 * connBucketIdle)
+	limiter.buckets["10.0.0.2"].updated = time.Now().Add(-2 * connBucketIdle)
+	limiter.mutex.Unlock()
+	_, ok = limiter.admit(limitTestPeer("10.0.0.3"))
+	require.True(t, ok)
+	require.NotContains(t, limiter.buckets, "10.0.0.2")
+	require.Contains(t, limiter.buckets, "10.0.0.1")
+}
@@ -0,0 +1,239 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+// HTTP/2 client connection preface sent first by plaintext gRPC clients
+var http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+
+// TLS extension carrying application protocols, gRPC clients offer 'h2'
+const tlsExtensionALPN = 16
+
+/**
+Splits connections of the single listener to the raft transport and the gRPC API:
+plaintext gRPC is detected by the HTTP/2 preface, TLS gRPC by the 'h2' protocol in the ClientHello,
+everything else goes to the raft transport
+ */
+type muxListener struct {
+	root          net.Listener
+	sniffTimeout  time.Duration
+	// connections not accepted in time are closed instead of parking the dispatch goroutine
+	acceptTimeout time.Duration
+	raft          *muxChild
+	api           *muxChild
+	closeOnce     sync.Once
+	closeCh       chan struct{}
+}
+
+type muxChild struct {
+	mux      *muxListener
+	connCh   chan net.Conn
+	// closing the raft child closes the shared port, closing the api child only stops its accepts
+	owner    bool
+	once     sync.Once
+	closeCh  chan struct{}
+}
+
+func newMuxListener(root net.Listener, sniffTimeout, acceptTimeout time.Duration) *muxListener {
+	t := &muxListener{
+		root:          root,
+		sniffTimeout:  sniffTimeout,
+		acceptTimeout: acceptTimeout,
+		closeCh:      make(chan struct{}),
+	}
+	t.raft = &muxChild{mux: t, connCh: make(chan net.Conn), owner: true, closeCh: make(chan struct{})}
+	t.api = &muxChild{mux: t, connCh: make(chan net.Conn), closeCh: make(chan struct{})}
+	go t.serve()
+	return t
+}
+
+func (t *muxListener) serve() {
+	for {
+		conn, err := t.root.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			t.close()
+			return
+		}
+		go t.dispatch(conn)
+	}
+}
+
+func (t *muxListener) dispatch(conn net.Conn) {
+
+	// fits the largest TLS record with ClientHello
+	reader := bufio.NewReaderSize(conn, 5 + 16*1024)
+	if t.sniffTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(t.sniffTimeout))
+	}
+	isAPI := sniffAPI(reader)
+	if t.sniffTimeout > 0 {
+		conn.SetReadDeadline(time.Time{})
+	}
+
+	child := t.raft
+	if isAPI {
+		child = t.api
+	}
+
+	var timeoutCh <-chan time.Time
+	if t.acceptTimeout > 0 {
+		timer := time.NewTimer(t.acceptTimeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case child.connCh <- &peekedConn{Conn: conn, reader: reader}:
+	case <-child.closeCh:
+		conn.Close()
+	case <-t.closeCh:
+		conn.Close()
+	case <-timeoutCh:
+		conn.Close()
+	}
+}
+
+/**
+Returns true for the gRPC connection, sniffed bytes stay in the reader
+ */
+func sniffAPI(reader *bufio.Reader) bool {
+
+	first, err := reader.Peek(1)
+	if err != nil {
+		return false
+	}
+
+	if first[0] != tlsHandshakeRecord {
+		// peer waiting for the reply after a short preamble must not block the sniffing
+		for n := 1; n <= len(http2Preface); n++ {
+			prefix, err := reader.Peek(n)
+			if err != nil || !bytes.Equal(prefix, http2Preface[:n]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	header, err := reader.Peek(5)
+	if err != nil {
+		return false
+	}
+	size := 5 + int(binary.BigEndian.Uint16(header[3:5]))
+	if size > reader.Size() {
+		size = reader.Size()
+	}
+	record, _ := reader.Peek(size)
+	for _, proto := range clientHelloALPN(record[5:]) {
+		if proto == "h2" {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+Parses application protocols of the ClientHello handshake message, nil if absent or truncated
+ */
+func clientHelloALPN(msg []byte) []string {
+
+	// handshake type, length, client version and random
+	if len(msg) < 38 || msg[0] != 1 {
+		return nil
+	}
+	p := msg[38:]
+
+	skip := func(lenSize int) bool {
+		if len(p) < lenSize {
+			return false
+		}
+		n := 0
+		for _, b := range p[:lenSize] {
+			n = n<<8 | int(b)
+		}
+		if len(p) < lenSize+n {
+			return false
+		}
+		p = p[lenSize+n:]
+		return true
+	}
+
+	// session id, cipher suites, compression methods
+	if !skip(1) || !skip(2) || !skip(1) || len(p) < 2 {
+		return nil
+	}
+	p = p[2:]
+
+	for len(p) >= 4 {
+		extType := binary.BigEndian.Uint16(p[0:2])
+		extLen := int(binary.BigEndian.Uint16(p[2:4]))
+		if len(p) < 4+extLen {
+			return nil
+		}
+		data := p[4 : 4+extLen]
+		p = p[4+extLen:]
+		if extType != tlsExtensionALPN || len(data) < 2 {
+			continue
+		}
+		var protos []string
+		for list := data[2:]; len(list) > 0; {
+			n := int(list[0])
+			if len(list) < 1+n {
+				break
+			}
+			protos = append(protos, string(list[1:1+n]))
+			list = list[1+n:]
+		}
+		return protos
+	}
+	return nil
+}
+
+func (t *muxListener) close() {
+	t.closeOnce.Do(func() {
+		close(t.closeCh)
+		t.root.Close()
+	})
+}
+
+// Accept implements the net.Listener interface.
+func (c *muxChild) Accept() (net.Conn, error) {
+	select {
+	case conn := <-c.connCh:
+		return conn, nil
+	case <-c.closeCh:
+		return nil, net.ErrClosed
+	case <-c.mux.closeCh:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements the net.Listener interface.
+func (c *muxChild) Close() error {
+	c.once.Do(func() {
+		close(c.closeCh)
+		if c.owner {
+			c.mux.close()
+		}
+	})
+	return nil
+}
+
+// Addr implements the net.Listener interface.
+func (c *muxChild) Addr() net.Addr {
+	return c.mux.root.Addr()
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func clientHello(t *testing.T, protos []string) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		conn := tls.Client(client, &tls.Config{InsecureSkipVerify: true, NextProtos: protos})
+		conn.Handshake()
+		client.Close()
+	}()
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	var hello bytes.Buffer
+	buf := make([]byte, 4096)
+	for {
+		n, err := server.Read(buf)
+		hello.Write(buf[:n])
+		if err != nil {
+			break
+		}
+		if b := hello.Bytes(); len(b) >= 5 && len(b) >= 5+int(binary.BigEndian.Uint16(b[3:5])) {
+			break
+		}
+	}
+	require.True(t, hello.Len() > 5)
+	return hello.Bytes()
+}
+
+func TestSniffAPI(t *testing.T) {
+
+	sniff := func(data []byte) bool {
+		return sniffAPI(bufio.NewReader(bytes.NewReader(data)))
+	}
+
+	require.True(t, sniff(append(append([]byte(nil), http2Preface...), 0, 0, 0)))
+	require.False(t, sniff([]byte("PROXY TCP4 ")))
+	require.False(t, sniff([]byte{0, 1, 2}))
+	require.False(t, sniff([]byte{compressPreamble}))
+
+	require.True(t, sniff(clientHello(t, []string{"h2"})))
+	require.False(t, sniff(clientHello(t, nil)))
+	require.False(t, sniff(clientHello(t, []string{"http/1.1"})))
+}
+
+func TestMuxListenerAcceptTimeout(t *testing.T) {
+
+	root, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	mux := newMuxListener(root, time.Second, 100*time.Millisecond)
+	defer mux.raft.Close()
+
+	// nobody accepts the API connection
+	conn, err := net.Dial("tcp", root.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write(http2Preface)
+	require.NoError(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err)
+	ne, ok := err.(net.Error)
+	require.False(t, ok && ne.Timeout(), err)
+
+	// raft connection is accepted
+	go func() {
+		conn, err := net.Dial("tcp", root.Addr().String())
+		if err == nil {
+			conn.Write([]byte{1})
+		}
+	}()
+	accepted, err := mux.raft.Accept()
+	require.NoError(t, err)
+	accepted.Close()
+}
@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ProxyProtocolNone     = "none"
+	ProxyProtocolOptional = "optional"
+	ProxyProtocolRequired = "required"
+)
+
+var (
+	proxyV1Prefix = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// maximum length of the v1 header including CRLF
+const proxyV1MaxLength = 107
+
+/**
+Inbound connection reading the PROXY protocol header on the first use, RemoteAddr returns the original peer
+ */
+type proxyConn struct {
+	net.Conn
+	required  bool
+	timeout   time.Duration
+
+	once      sync.Once
+	reader    *bufio.Reader
+	remote    net.Addr
+	err       error
+}
+
+func newProxyConn(c net.Conn, mode string, trusted []*net.IPNet, timeout time.Duration) net.Conn {
+	if mode == "" || mode == ProxyProtocolNone || !proxyTrusted(trusted, c.RemoteAddr()) {
+		return c
+	}
+	return &proxyConn{Conn: c, required: mode == ProxyProtocolRequired, timeout: timeout}
+}
+
+/**
+Parses comma separated CIDRs or IP addresses of the load balancers allowed to send the PROXY header
+ */
+func parseProxyTrusted(value string) ([]*net.IPNet, error) {
+	var list []*net.IPNet
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, errors.Errorf("invalid address '%s'", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8 * net.IPv4len
+			}
+			list = append(list, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ipNet)
+	}
+	return list, nil
+}
+
+/**
+Empty list trusts every source
+ */
+func proxyTrusted(trusted []*net.IPNet, addr net.Addr) bool {
+	if len(trusted) == 0 {
+		return true
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range trusted {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+Connections bypassing the trusted balancers are refused in the 'required' mode
+ */
+func proxyAllowed(mode string, trusted []*net.IPNet, addr net.Addr) bool {
+	return mode != ProxyProtocolRequired || proxyTrusted(trusted, addr)
+}
+
+func (c *proxyConn) init() {
+	if c.timeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+	}
+	c.reader = bufio.NewReader(c.Conn)
+	c.remote, c.err = readProxyHeader(c.reader, c.required)
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	c.once.Do(c.init)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+func (c *proxyConn) Write(p []byte) (int, error) {
+	c.once.Do(c.init)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.Conn.Write(p)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.once.Do(c.init)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+/**
+Reads v1 or v2 header, returns nil address for LOCAL and UNKNOWN connections or missing optional header
+ */
+func readProxyHeader(r *bufio.Reader, required bool) (net.Addr, error) {
+
+	if b, err := r.Peek(len(proxyV2Signature)); err == nil && bytes.Equal(b, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+	if b, err := r.Peek(len(proxyV1Prefix)); err == nil && bytes.Equal(b, proxyV1Prefix) {
+		return readProxyV1(r)
+	} else if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if required {
+		return nil, errors.New("PROXY protocol header is required")
+	}
+	return nil, nil
+}
+
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, errors.Errorf("PROXY v1 header, %v", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("PROXY v1 header is too long or not terminated by CRLF")
+	}
+
+	fields := strings.Fields(string(line[:len(line) - 2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.Errorf("invalid PROXY v1 header '%s'", strings.TrimSpace(string(line)))
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, errors.Errorf("invalid source in PROXY v1 header '%s'", strings.TrimSpace(string(line)))
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, errors.Errorf("PROXY v2 header, %v", err)
+	}
+	if hdr[12] >> 4 != 2 {
+		return nil, errors.Errorf("unsupported PROXY protocol version %d", hdr[12] >> 4)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errors.Errorf("PROXY v2 addresses, %v", err)
+	}
+
+	// LOCAL command is used by health checks of the balancer itself
+	if hdr[12] & 0x0F == 0 {
+		return nil, nil
+	}
+
+	switch hdr[13] {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, errors.New("short PROXY v2 IPv4 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, errors.New("short PROXY v2 IPv6 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:]))}, nil
+	}
+	return nil, nil
+}
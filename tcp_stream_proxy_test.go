@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestProxyProtocol(t *testing.T) {
+
+	r := bufio.NewReader(strings.NewReader("PROXY TCP4 10.0.0.5 10.0.0.1 51000 8300\r\npayload"))
+	addr, err := readProxyHeader(r, true)
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.5:51000", addr.String())
+	rest, _ := io.ReadAll(r)
+	require.Equal(t, "payload", string(rest))
+
+	var v2 bytes.Buffer
+	v2.Write(proxyV2Signature)
+	v2.Write([]byte{0x21, 0x21})
+	binary.Write(&v2, binary.BigEndian, uint16(36))
+	v2.Write(net.ParseIP("fd00::5").To16())
+	v2.Write(net.ParseIP("fd00::1").To16())
+	binary.Write(&v2, binary.BigEndian, uint16(51000))
+	binary.Write(&v2, binary.BigEndian, uint16(8300))
+	v2.WriteString("payload")
+
+	r = bufio.NewReader(&v2)
+	addr, err = readProxyHeader(r, true)
+	require.NoError(t, err)
+	require.Equal(t, "[fd00::5]:51000", addr.String())
+	rest, _ = io.ReadAll(r)
+	require.Equal(t, "payload", string(rest))
+
+	// raft rpc without header
+	_, err = readProxyHeader(bufio.NewReader(bytes.NewReader([]byte{0, 1, 2})), true)
+	require.Error(t, err)
+	addr, err = readProxyHeader(bufio.NewReader(bytes.NewReader([]byte{0, 1, 2})), false)
+	require.NoError(t, err)
+	require.Nil(t, addr)
+}
+
+type proxyTestConn struct {
+	net.Conn
+	remote  net.Addr
+}
+
+func (c proxyTestConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func TestProxyProtocolTrusted(t *testing.T) {
+
+	trusted, err := parseProxyTrusted("10.0.0.0/24, fd00::1")
+	require.NoError(t, err)
+	require.Len(t, trusted, 2)
+
+	_, err = parseProxyTrusted("10.0.0.0/33")
+	require.Error(t, err)
+	_, err = parseProxyTrusted("balancer")
+	require.Error(t, err)
+
+	balancer := proxyTestConn{remote: &net.TCPAddr{IP: net.ParseIP("10.0.0.7"), Port: 40000}}
+	balancer6 := proxyTestConn{remote: &net.TCPAddr{IP: net.ParseIP("fd00::1"), Port: 40000}}
+	client := proxyTestConn{remote: &net.TCPAddr{IP: net.ParseIP("10.0.1.7"), Port: 40000}}
+
+	_, ok := newProxyConn(balancer, ProxyProtocolOptional, trusted, 0).(*proxyConn)
+	require.True(t, ok)
+	_, ok = newProxyConn(balancer6, ProxyProtocolOptional, trusted, 0).(*proxyConn)
+	require.True(t, ok)
+
+	// header of the untrusted source is never parsed
+	require.Equal(t, client, newProxyConn(client, ProxyProtocolOptional, trusted, 0))
+
+	require.True(t, proxyAllowed(ProxyProtocolOptional, trusted, client.RemoteAddr()))
+	require.False(t, proxyAllowed(ProxyProtocolRequired, trusted, client.RemoteAddr()))
+	require.True(t, proxyAllowed(ProxyProtocolRequired, trusted, balancer.RemoteAddr()))
+	require.True(t, proxyAllowed(ProxyProtocolRequired, nil, client.RemoteAddr()))
+}
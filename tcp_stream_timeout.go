@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"net"
+	"strings"
+	"time"
+)
+
+/**
+Parses 'address=timeout' or 'id=timeout' comma separated pairs
+ */
+func parsePeerTimeouts(value string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.LastIndexByte(pair, '=')
+		if i <= 0 {
+			return nil, errors.Errorf("expected 'peer=timeout' in '%s'", pair)
+		}
+		timeout, err := time.ParseDuration(pair[i+1:])
+		if err != nil {
+			return nil, errors.Errorf("invalid timeout in '%s', %v", pair, err)
+		}
+		if timeout <= 0 {
+			return nil, errors.Errorf("timeout must be positive in '%s'", pair)
+		}
+		timeouts[pair[:i]] = timeout
+	}
+	return timeouts, nil
+}
+
+/**
+Outbound connection stretching deadlines set by the transport with its timeout to the peer timeout,
+snapshot deadlines scaled by 'raft.timeout-scale' keep their proportion
+ */
+type peerTimeoutConn struct {
+	net.Conn
+	scale  float64
+}
+
+func newPeerTimeoutConn(conn net.Conn, peerTimeout, timeout time.Duration) net.Conn {
+	if peerTimeout <= 0 || timeout <= 0 || peerTimeout == timeout {
+		return conn
+	}
+	return &peerTimeoutConn{Conn: conn, scale: float64(peerTimeout) / float64(timeout)}
+}
+
+func (c *peerTimeoutConn) scaled(deadline time.Time) time.Time {
+	if deadline.IsZero() {
+		return deadline
+	}
+	now := time.Now()
+	return now.Add(time.Duration(float64(deadline.Sub(now)) * c.scale))
+}
+
+func (c *peerTimeoutConn) SetDeadline(t time.Time) error {
+	return c.Conn.SetDeadline(c.scaled(t))
+}
+
+func (c *peerTimeoutConn) SetReadDeadline(t time.Time) error {
+	return c.Conn.SetReadDeadline(c.scaled(t))
+}
+
+func (c *peerTimeoutConn) SetWriteDeadline(t time.Time) error {
+	return c.Conn.SetWriteDeadline(c.scaled(t))
+}
+
+/**
+Timeout of the peer configured by 'raft.peer-timeouts' for its address or server id, zero if not configured
+ */
+func (t *implRaftServer) peerTimeout(address raft.ServerAddress) time.Duration {
+	if timeout, ok := t.peerTimeouts[string(address)]; ok {
+		return timeout
+	}
+	for _, server := range t.ServerLookup.Servers() {
+		if RaftServerAddress(server) == address {
+			return t.peerTimeouts[server.ID]
+		}
+	}
+	return 0
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+const (
+	TLSClientAuthNone    = "none"
+	TLSClientAuthRequire = "require"
+)
+
+/**
+Verification settings of the raft transport TLS
+ */
+type transportTLSOptions struct {
+	verify      bool
+	caFile      string
+	serverName  string
+	sanPattern  string
+	clientAuth  string
+	clientAllow string
+
+	// 'raft.tls-mode=mixed' accepts plaintext connections bypassing the client certificate checks
+	mixed       bool
+
+	// rotated certificate, replaces static certificates of the base config
+	reloader    *certReloader
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no certificates found in '%s'", caFile)
+	}
+	return pool, nil
+}
+
+/**
+Builds dial and accept TLS configs of the raft transport from the base config.
+Without verification the dial side keeps the legacy behavior and skips server certificate checks.
+ */
+func buildTransportTLS(base *tls.Config, opts transportTLSOptions) (dial *tls.Config, accept *tls.Config, err error) {
+
+	pool := base.RootCAs
+	clientPool := base.ClientCAs
+	if opts.caFile != "" {
+		if pool, err = loadCertPool(opts.caFile); err != nil {
+			return nil, nil, errors.Errorf("load 'raft.tls.ca-file', %v", err)
+		}
+		clientPool = pool
+	}
+
+	dial = &tls.Config{
+		Rand:               rand.Reader,
+		Certificates:       base.Certificates,
+		InsecureSkipVerify: true,
+	}
+
+	if opts.reloader != nil {
+		base = base.Clone()
+		base.Certificates = nil
+		base.GetCertificate = opts.reloader.GetCertificate
+		dial.Certificates = nil
+		dial.GetClientCertificate = opts.reloader.GetClientCertificate
+	} else if base.GetCertificate != nil && len(base.Certificates) == 0 {
+		// certificate callback of the injected config serves both sides
+		getCertificate := base.GetCertificate
+		dial.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return getCertificate(&tls.ClientHelloInfo{})
+		}
+	}
+
+	if opts.verify {
+		dial.RootCAs = pool
+		dial.ServerName = opts.serverName
+		dial.InsecureSkipVerify = false
+		if opts.sanPattern != "" {
+			if _, err := path.Match(opts.sanPattern, ""); err != nil {
+				return nil, nil, errors.Errorf("invalid 'raft.tls.san-pattern' '%s', %v", opts.sanPattern, err)
+			}
+			// chain is verified manually, host name is checked by the pattern
+			dial.InsecureSkipVerify = true
+			dial.VerifyPeerCertificate = verifyBySANPattern(pool, opts.sanPattern)
+		}
+	}
+
+	if opts.mixed && (opts.clientAuth == TLSClientAuthRequire || opts.clientAllow != "") {
+		return nil, nil, errors.New("properties 'raft.tls.client-auth=require' and 'raft.tls.client-allow' can not be enforced on plaintext connections of 'raft.tls-mode=mixed'")
+	}
+
+	accept = base
+	switch opts.clientAuth {
+	case "", TLSClientAuthNone:
+	case TLSClientAuthRequire:
+		if clientPool == nil {
+			return nil, nil, errors.New("property 'raft.tls.client-auth=require' needs 'raft.tls.ca-file' or ClientCAs in TLS config")
+		}
+		accept = base.Clone()
+		accept.ClientAuth = tls.RequireAndVerifyClientCert
+		accept.ClientCAs = clientPool
+	default:
+		return nil, nil, errors.Errorf("invalid property 'raft.tls.client-auth' value '%s'", opts.clientAuth)
+	}
+
+	if opts.clientAllow != "" {
+		if accept.ClientAuth != tls.RequireAndVerifyClientCert {
+			return nil, nil, errors.New("property 'raft.tls.client-allow' needs 'raft.tls.client-auth=require'")
+		}
+		patterns, err := parseAllowList(opts.clientAllow)
+		if err != nil {
+			return nil, nil, errors.Errorf("issue in property 'raft.tls.client-allow', %v", err)
+		}
+		accept.VerifyPeerCertificate = verifyByAllowList(patterns)
+	}
+
+	return dial, accept, nil
+}
+
+func verifyBySANPattern(pool *x509.CertPool, pattern string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no server certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		if _, err := certs[0].Verify(x509.VerifyOptions{Roots: pool, Intermediates: intermediates}); err != nil {
+			return err
+		}
+		names := append([]string(nil), certs[0].DNSNames...)
+		for _, ip := range certs[0].IPAddresses {
+			names = append(names, ip.String())
+		}
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return nil
+			}
+		}
+		return errors.Errorf("server certificate SANs %v do not match pattern '%s'", names, pattern)
+	}
+}
+
+func parseAllowList(list string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Errorf("invalid pattern '%s', %v", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("empty allow-list")
+	}
+	return patterns, nil
+}
+
+/**
+Names of the certificate matched by the allow-list: CN, DNS, IP and URI SANs, URI SANs carry SPIFFE ids
+ */
+func certificateNames(cert *x509.Certificate) []string {
+	var names []string
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
+
+/**
+Accepts client certificates verified by the CA having any name matching any pattern,
+'spiffe://cluster.local/raft/*' limits peers to the trust domain path
+ */
+func verifyByAllowList(patterns []string) func([][]byte, [][]*x509.Certificate) error {
+	return func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+			return errors.New("no verified client certificate")
+		}
+		names := certificateNames(verifiedChains[0][0])
+		for _, pattern := range patterns {
+			for _, name := range names {
+				if ok, _ := path.Match(pattern, name); ok {
+					return nil
+				}
+			}
+		}
+		return errors.Errorf("client certificate names %v are not in the allow-list", names)
+	}
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClientAllowList(t *testing.T) {
+
+	patterns, err := parseAllowList(" spiffe://cluster.local/raft/*, node-?.raft.internal ,")
+	require.NoError(t, err)
+	require.Equal(t, []string{"spiffe://cluster.local/raft/*", "node-?.raft.internal"}, patterns)
+
+	_, err = parseAllowList(" , ")
+	require.Error(t, err)
+
+	_, err = parseAllowList("[")
+	require.Error(t, err)
+
+	verify := verifyByAllowList(patterns)
+
+	spiffe, err := url.Parse("spiffe://cluster.local/raft/node-1")
+	require.NoError(t, err)
+
+	chain := func(cert *x509.Certificate) [][]*x509.Certificate {
+		return [][]*x509.Certificate{{cert}}
+	}
+
+	require.NoError(t, verify(nil, chain(&x509.Certificate{URIs: []*url.URL{spiffe}})))
+	require.NoError(t, verify(nil, chain(&x509.Certificate{Subject: pkix.Name{CommonName: "node-2.raft.internal"}})))
+	require.NoError(t, verify(nil, chain(&x509.Certificate{DNSNames: []string{"other", "node-3.raft.internal"}})))
+
+	other, err := url.Parse("spiffe://other.domain/raft/node-1")
+	require.NoError(t, err)
+	require.Error(t, verify(nil, chain(&x509.Certificate{URIs: []*url.URL{other}})))
+	require.Error(t, verify(nil, chain(&x509.Certificate{Subject: pkix.Name{CommonName: "node-10.raft.internal"}})))
+	require.Error(t, verify(nil, nil))
+}
+
+// returns the CA file and the certificate signed by the CA for the names
+func testCertificate(t *testing.T, names ...string) (string, tls.Certificate) {
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "raft-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: names[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			leaf.IPAddresses = append(leaf.IPAddresses, ip)
+		} else {
+			leaf.DNSNames = append(leaf.DNSNames, name)
+		}
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leaf, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600))
+	return caFile, tls.Certificate{Certificate: [][]byte{leafDER}, PrivateKey: key}
+}
+
+func tlsHandshake(t *testing.T, dial, accept *tls.Config) error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	accepted := make(chan error, 1)
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			accepted <- err
+			return
+		}
+		defer c.Close()
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		server := tls.Server(c, accept)
+		if err = server.Handshake(); err == nil {
+			// client certificate is verified by the server after the client completes TLS 1.3 handshake
+			_, err = server.Write([]byte{1})
+		}
+		accepted <- err
+	}()
+	c, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	client := tls.Client(c, dial)
+	err = client.Handshake()
+	if err == nil {
+		_, err = client.Read(make([]byte, 1))
+	}
+	if acceptErr := <-accepted; err == nil {
+		err = acceptErr
+	}
+	return err
+}
+
+func TestTransportTLSVerify(t *testing.T) {
+
+	caFile, cert := testCertificate(t, "node-1.raft.internal", "10.0.0.1")
+	base := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	// legacy dial side skips the verification
+	dial, accept, err := buildTransportTLS(base, transportTLSOptions{})
+	require.NoError(t, err)
+	require.True(t, dial.InsecureSkipVerify)
+	require.NoError(t, tlsHandshake(t, dial, accept))
+
+	dial, accept, err = buildTransportTLS(base, transportTLSOptions{verify: true, caFile: caFile, serverName: "node-1.raft.internal"})
+	require.NoError(t, err)
+	require.False(t, dial.InsecureSkipVerify)
+	require.NoError(t, tlsHandshake(t, dial, accept))
+
+	dial, accept, err = buildTransportTLS(base, transportTLSOptions{verify: true, caFile: caFile, serverName: "node-2.raft.internal"})
+	require.NoError(t, err)
+	require.Error(t, tlsHandshake(t, dial, accept))
+
+	// server of the other CA
+	otherCA, _ := testCertificate(t, "node-1.raft.internal")
+	dial, accept, err = buildTransportTLS(base, transportTLSOptions{verify: true, caFile: otherCA, serverName: "node-1.raft.internal"})
+	require.NoError(t, err)
+	require.Error(t, tlsHandshake(t, dial, accept))
+
+	// SAN pattern replaces the server name check, IP SANs are matched too
+	for _, pattern := range []string{"node-*.raft.internal", "10.0.0.*"} {
+		dial, accept, err = buildTransportTLS(base, transportTLSOptions{verify: true, caFile: caFile, sanPattern: pattern})
+		require.NoError(t, err)
+		require.NoError(t, tlsHandshake(t, dial, accept), pattern)
+	}
+	dial, accept, err = buildTransportTLS(base, transportTLSOptions{verify: true, caFile: caFile, sanPattern: "db-*.raft.internal"})
+	require.NoError(t, err)
+	require.Error(t, tlsHandshake(t, dial, accept))
+
+	dial, accept, err = buildTransportTLS(base, transportTLSOptions{verify: true, caFile: otherCA, sanPattern: "node-*.raft.internal"})
+	require.NoError(t, err)
+	require.Error(t, tlsHandshake(t, dial, accept))
+
+	_, _, err = buildTransportTLS(base, transportTLSOptions{verify: true, caFile: caFile, sanPattern: "["})
+	require.Error(t, err)
+}
+
+func TestTransportTLSClientAuth(t *testing.T) {
+
+	caFile, cert := testCertificate(t, "node-1.raft.internal")
+	base := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	dial, accept, err := buildTransportTLS(base, transportTLSOptions{caFile: caFile, clientAuth: TLSClientAuthRequire, clientAllow: "node-*.raft.internal"})
+	require.NoError(t, err)
+	require.Equal(t, tls.RequireAndVerifyClientCert, accept.ClientAuth)
+	require.NoError(t, tlsHandshake(t, dial, accept))
+
+	_, accept, err = buildTransportTLS(base, transportTLSOptions{caFile: caFile, clientAuth: TLSClientAuthRequire, clientAllow: "db-*.raft.internal"})
+	require.NoError(t, err)
+	require.Error(t, tlsHandshake(t, dial, accept))
+
+	// client without the certificate
+	_, accept, err = buildTransportTLS(base, transportTLSOptions{caFile: caFile, clientAuth: TLSClientAuthRequire})
+	require.NoError(t, err)
+	require.Error(t, tlsHandshake(t, &tls.Config{InsecureSkipVerify: true}, accept))
+
+	_, _, err = buildTransportTLS(base, transportTLSOptions{clientAuth: TLSClientAuthRequire})
+	require.Error(t, err)
+	_, _, err = buildTransportTLS(base, transportTLSOptions{clientAuth: "optional"})
+	require.Error(t, err)
+	_, _, err = buildTransportTLS(base, transportTLSOptions{clientAllow: "node-*"})
+	require.Error(t, err)
+
+	// plaintext connections of the mixed mode bypass the client checks
+	_, _, err = buildTransportTLS(base, transportTLSOptions{caFile: caFile, clientAuth: TLSClientAuthRequire, mixed: true})
+	require.Error(t, err)
+	_, _, err = buildTransportTLS(base, transportTLSOptions{caFile: caFile, clientAuth: TLSClientAuthRequire, clientAllow: "node-*", mixed: true})
+	require.Error(t, err)
+	_, _, err = buildTransportTLS(base, transportTLSOptions{caFile: caFile, mixed: true})
+	require.NoError(t, err)
+}
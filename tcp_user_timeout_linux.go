@@ -0,0 +1,30 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"syscall"
+	"time"
+)
+
+// TCP_USER_TIMEOUT, not defined by syscall on every linux architecture
+const tcpUserTimeout = 0x12
+
+const tcpUserTimeoutSupported = true
+
+func setTCPUserTimeout(conn syscall.RawConn, timeout time.Duration) error {
+	var sockErr error
+	err := conn.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpUserTimeout, int(timeout / time.Millisecond))
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
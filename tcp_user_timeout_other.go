@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"syscall"
+	"time"
+)
+
+const tcpUserTimeoutSupported = false
+
+func setTCPUserTimeout(syscall.RawConn, time.Duration) error {
+	return nil
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+)
+
+/**
+Certificate of the raft transport reloaded from files when they change, used for short-lived certificates
+ */
+type certReloader struct {
+	certFile  string
+	keyFile   string
+
+	mutex     sync.RWMutex
+	cert      *tls.Certificate
+	modTime   time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("properties 'raft.tls.cert-file' and 'raft.tls.key-file' must be both defined")
+	}
+	t := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := t.reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *certReloader) lastModified() (time.Time, error) {
+	var last time.Time
+	for _, file := range []string{t.certFile, t.keyFile} {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return last, err
+		}
+		if fi.ModTime().After(last) {
+			last = fi.ModTime()
+		}
+	}
+	return last, nil
+}
+
+/**
+Loads the key pair if files were modified since the last load, returns true if certificate changed
+ */
+func (t *certReloader) reload() (bool, error) {
+
+	modTime, err := t.lastModified()
+	if err != nil {
+		return false, err
+	}
+
+	t.mutex.RLock()
+	unchanged := t.cert != nil && modTime.Equal(t.modTime)
+	t.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(t.certFile, t.keyFile)
+	if err != nil {
+		return false, errors.Errorf("load key pair '%s' and '%s', %v", t.certFile, t.keyFile, err)
+	}
+	if cert.Leaf == nil && len(cert.Certificate) > 0 {
+		cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+
+	t.mutex.Lock()
+	t.cert = &cert
+	t.modTime = modTime
+	t.mutex.Unlock()
+	return true, nil
+}
+
+func (t *certReloader) certificate() *tls.Certificate {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.cert
+}
+
+func (t *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return t.certificate(), nil
+}
+
+func (t *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return t.certificate(), nil
+}
+
+func (t *certReloader) NotAfter() time.Time {
+	if cert := t.certificate(); cert != nil && cert.Leaf != nil {
+		return cert.Leaf.NotAfter
+	}
+	return time.Time{}
+}
+
+func (t *certReloader) watch(interval time.Duration, log *zap.Logger, shutdownCh <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			changed, err := t.reload()
+			if err != nil {
+				// keep serving the previous certificate while the files are being rotated
+				log.Error("TLSCertReload", zap.String("cert", t.certFile), zap.Error(err))
+			} else if changed {
+				log.Info("TLSCertReloaded", zap.String("cert", t.certFile), zap.Time("notAfter", t.NotAfter()))
+			}
+		case <-shutdownCh:
+			return
+		}
+	}
+}
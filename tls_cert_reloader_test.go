@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeKeyPair(t *testing.T, cert tls.Certificate, certFile, keyFile string, modTime time.Time) {
+	der, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+func TestCertReloader(t *testing.T) {
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	caFile, first := testCertificate(t, "node-1.raft.internal")
+	modTime := time.Now().Add(-time.Minute)
+	writeKeyPair(t, first, certFile, keyFile, modTime)
+
+	_, err := newCertReloader(certFile, "")
+	require.Error(t, err)
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	require.Equal(t, first.Certificate[0], reloader.certificate().Certificate[0])
+	require.False(t, reloader.NotAfter().IsZero())
+
+	changed, err := reloader.reload()
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	// rotated certificate is served by the next handshakes
+	_, second := testCertificate(t, "node-1.raft.internal")
+	writeKeyPair(t, second, certFile, keyFile, modTime.Add(time.Second))
+	changed, err = reloader.reload()
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	served, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, second.Certificate[0], served.Certificate[0])
+	served, err = reloader.GetClientCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, second.Certificate[0], served.Certificate[0])
+
+	// the previous certificate is kept while the files are being rotated
+	require.NoError(t, os.WriteFile(keyFile, []byte("partial"), 0600))
+	require.NoError(t, os.Chtimes(keyFile, modTime.Add(2 * time.Second), modTime.Add(2 * time.Second)))
+	_, err = reloader.reload()
+	require.Error(t, err)
+	require.Equal(t, second.Certificate[0], reloader.certificate().Certificate[0])
+
+	// the certificate of the other CA is not trusted by the dial side of the first one
+	dial, accept, err := buildTransportTLS(&tls.Config{}, transportTLSOptions{verify: true, caFile: caFile, serverName: "node-1.raft.internal", reloader: reloader})
+	require.NoError(t, err)
+	require.Nil(t, accept.Certificates)
+	require.Error(t, tlsHandshake(t, dial, accept))
+
+	writeKeyPair(t, first, certFile, keyFile, modTime.Add(3 * time.Second))
+	changed, err = reloader.reload()
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.NoError(t, tlsHandshake(t, dial, accept))
+}
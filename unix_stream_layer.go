@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2023 Zander Schwid & Co. LLC.
+ * SPDX-License-Identifier: BUSL-1.1
+ */
+
+package raftmod
+
+import (
+	"github.com/hashicorp/raft"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// unixAddressPrefix selects Unix domain socket stream layer in 'raft.bind-address'
+const unixAddressPrefix = "unix://"
+
+/**
+Returns socket path if the address has 'unix://' scheme
+ */
+func unixSocketPath(address string) (string, bool) {
+	if strings.HasPrefix(address, unixAddressPrefix) {
+		return strings.TrimPrefix(address, unixAddressPrefix), true
+	}
+	return "", false
+}
+
+// UnixStreamLayer implements StreamLayer interface for Unix domain sockets of co-located processes.
+type UnixStreamLayer struct {
+	listener  net.Listener
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	// socket file left by the previous process blocks the bind
+	if fi, err := os.Stat(path); err == nil && fi.Mode() & os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+func newUnixTransport(listener net.Listener,
+	transportCreator func(stream raft.StreamLayer) *raft.NetworkTransport) (*raft.NetworkTransport, error) {
+
+	if _, ok := listener.Addr().(*net.UnixAddr); !ok {
+		return nil, errNotUnix
+	}
+
+	stream := &UnixStreamLayer{
+		listener: listener,
+	}
+
+	return transportCreator(stream), nil
+}
+
+// Dial implements the StreamLayer interface.
+func (t *UnixStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	path, ok := unixSocketPath(string(address))
+	if !ok {
+		path = string(address)
+	}
+	return net.DialTimeout("unix", path, timeout)
+}
+
+// Accept implements the net.Listener interface.
+func (t *UnixStreamLayer) Accept() (net.Conn, error) {
+	return t.listener.Accept()
+}
+
+// Close implements the net.Listener interface.
+func (t *UnixStreamLayer) Close() error {
+	return t.listener.Close()
+}
+
+// Addr implements the net.Listener interface.
+func (t *UnixStreamLayer) Addr() net.Addr {
+	return t.listener.Addr()
+}
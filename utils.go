@@ -6,12 +6,12 @@
 package raftmod
 
 import (
-	"fmt"
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
 	"net"
-	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func panicToError(err *error) {
@@ -51,19 +51,6 @@ func getHostAndPortNumber(address string) (string, int, error) {
 	return host, portNum, err
 }
 
-func createDirIfNeeded(dir string, perm os.FileMode) error {
-	if _, err := os.Stat(dir); err != nil {
-		if err = os.Mkdir(dir, perm); err != nil {
-			return errors.Errorf("unable to create dir '%s' with permissions %x, %v", dir, perm ,err)
-		}
-		if err = os.Chmod(dir, perm); err != nil {
-			return errors.Errorf("unable to chmod dir '%s' with permissions %x, %v", dir, perm ,err)
-		}
-	}
-	return nil
-}
-
-
 // PrivateIP get the host machine private IP address
 func PrivateIP() (net.IP, error) {
 	ifaces, err := net.Interfaces()
@@ -106,24 +93,28 @@ func GetIP(addr net.Addr) []byte {
 }
 
 func addLocalIP(addr string) string {
-	parts := strings.Split(addr, ":")
-	if parts[0] == "" {
+	host, port, err := net.SplitHostPort(addr)
+	if err == nil && host == "" {
 		ipAddr, err := PrivateIP()
 		if err == nil {
-			parts[0] = ipAddr.String()
-			return strings.Join(parts, ":")
+			return net.JoinHostPort(ipAddr.String(), port)
 		}
 	}
 	return addr
 }
 
+/**
+Replaces empty, unspecified or loopback host of the address to the private IP, IPv6 literals are in brackets
+ */
 func ReplaceToPrivateIP(addr string) string {
-	parts := strings.Split(addr, ":")
-	if parts[0] == "" || parts[0] == "0.0.0.0" || parts[0] == "127.0.0.1" {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "127.0.0.1" || host == "::" || host == "::1" {
 		ipAddr, err := PrivateIP()
 		if err == nil {
-			parts[0] = ipAddr.String()
-			return strings.Join(parts, ":")
+			return net.JoinHostPort(ipAddr.String(), port)
 		}
 	}
 	return addr
@@ -140,7 +131,7 @@ func ParseAndAdjustTCPAddr(address string, seq int) (*net.TCPAddr, error) {
 		host = "0.0.0.0"
 	}
 
-	addr := fmt.Sprintf("%s:%s", host, port)
+	addr := net.JoinHostPort(host, port)
 
 	// Resolve the address
 	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
@@ -152,4 +143,131 @@ func ParseAndAdjustTCPAddr(address string, seq int) (*net.TCPAddr, error) {
 
 	return tcpAddr, nil
 
-}
\ No newline at end of file
+}
+
+/**
+Simple bandwidth limiter, zero or negative rate means unlimited
+ */
+type bandwidthLimiter struct {
+	bytesPerSec float64
+	started     time.Time
+	bytes       float64
+	clock       limiterClock
+}
+
+/**
+Time source of the bandwidth limiter, tests replace it to account the waits without sleeping
+ */
+type limiterClock interface {
+
+	Now() time.Time
+
+	/**
+	Sleeps for the duration, returns false if closeCh was closed while sleeping
+	 */
+	Sleep(d time.Duration, closeCh <-chan struct{}) bool
+
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(d time.Duration, closeCh <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-closeCh:
+		return false
+	}
+}
+
+func newBandwidthLimiter(bytesPerSec float64) *bandwidthLimiter {
+	return newBandwidthLimiterClock(bytesPerSec, systemClock{})
+}
+
+func newBandwidthLimiterClock(bytesPerSec float64, clock limiterClock) *bandwidthLimiter {
+	return &bandwidthLimiter{
+		bytesPerSec: bytesPerSec,
+		started:     clock.Now(),
+		clock:       clock,
+	}
+}
+
+/**
+Accounts n bytes and sleeps if the rate exceeded, returns false if closeCh was closed while waiting
+ */
+func (t *bandwidthLimiter) Wait(n int, closeCh <-chan struct{}) bool {
+	if t.bytesPerSec <= 0 {
+		select {
+		case <-closeCh:
+			return false
+		default:
+			return true
+		}
+	}
+	t.bytes += float64(n)
+	expected := time.Duration(t.bytes / t.bytesPerSec * float64(time.Second))
+	delay := expected - t.clock.Now().Sub(t.started)
+	if delay <= 0 {
+		return true
+	}
+	return t.clock.Sleep(delay, closeCh)
+}
+
+/**
+Runs shutdown phase in the background and waits for it no longer than the budget, zero budget means no waiting
+ */
+func waitPhase(log *zap.Logger, phase string, budget time.Duration, fn func() error) {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	if budget <= 0 {
+		return
+	}
+	timer := time.NewTimer(budget)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			log.Error("ShutdownPhase", zap.String("phase", phase), zap.Error(err))
+		}
+	case <-timer.C:
+		log.Warn("ShutdownPhaseTimeout", zap.String("phase", phase), zap.Duration("budget", budget))
+	}
+}
+
+/**
+Parses the size with the optional binary unit suffix, for example '512MB', '10GB' or '4096', empty string is zero
+ */
+func ParseByteSize(size string) (int64, error) {
+
+	s := strings.ToUpper(strings.TrimSpace(size))
+	if s == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		value  int64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+	} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, multiplier = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.value
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1) / multiplier {
+		return 0, errors.Errorf("invalid size '%s'", size)
+	}
+	return n * multiplier, nil
+}
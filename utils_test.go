@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"github.com/sprintframework/raftmod"
 	"github.com/stretchr/testify/require"
+	"net"
 	"testing"
 )
 
@@ -21,3 +22,57 @@ func TestLocalIP(t *testing.T) {
 
 
 }
+
+func TestIPv6Address(t *testing.T) {
+
+	addr, err := raftmod.ParseAndAdjustTCPAddr("[::1]:7000", 2)
+	require.NoError(t, err)
+	require.Equal(t, "[::1]:7002", addr.String())
+
+	addr, err = raftmod.ParseAndAdjustTCPAddr(":7000", 0)
+	require.NoError(t, err)
+	require.Equal(t, 7000, addr.Port)
+
+	require.Equal(t, "[fd00::5]:7000", raftmod.ReplaceToPrivateIP("[fd00::5]:7000"))
+	require.Equal(t, "unix:///tmp/raft.sock", raftmod.ReplaceToPrivateIP("unix:///tmp/raft.sock"))
+}
+
+func TestBindAddresses(t *testing.T) {
+
+	addrs, err := raftmod.ResolveBindAddresses("127.0.0.1:7000, [::1]:7100", 1)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(addrs))
+	require.Equal(t, "127.0.0.1:7001", addrs[0].String())
+	require.Equal(t, "[::1]:7101", addrs[1].String())
+
+	_, err = raftmod.ResolveBindAddresses(" , ", 0)
+	require.Error(t, err)
+
+	if _, err := net.InterfaceByName("lo"); err == nil {
+		addrs, err = raftmod.ResolveBindAddresses("lo:7000", 0)
+		require.NoError(t, err)
+		require.Equal(t, "127.0.0.1:7000", addrs[0].String())
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+
+	for size, expected := range map[string]int64{
+		"":      0,
+		"4096":  4096,
+		"512B":  512,
+		"64kb":  64 << 10,
+		"512MB": 512 << 20,
+		"10 GB": 10 << 30,
+		"2TB":   2 << 40,
+	} {
+		actual, err := raftmod.ParseByteSize(size)
+		require.NoError(t, err, size)
+		require.Equal(t, expected, actual, size)
+	}
+
+	for _, size := range []string{"GB", "-1MB", "1.5GB", "10PB"} {
+		_, err := raftmod.ParseByteSize(size)
+		require.Error(t, err, size)
+	}
+}